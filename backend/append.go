@@ -0,0 +1,168 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+)
+
+var (
+	// Each segment appended with AppendToRow is stored as a Row of its
+	// own, tagged with SegmentOfPrefix + the id:... tag of the Row it
+	// extends and SegmentPrefix + when it was appended
+	SegmentOfPrefix = "segmentof:"
+	SegmentPrefix   = "segment:"
+
+	ErrMultipleRows = errors.New("backend: More than one Row matches")
+	ErrNoRowID      = errors.New("backend: Row has no id:... tag")
+)
+
+// AppendToRow appends data to the one Row tagged with all of randtags
+// by encrypting and saving data as a new segment, rather than
+// re-encrypting and re-saving the whole Row.  Use ReadAppendedRow to
+// get the Row's full data, segments and all.
+//
+// Segments are ordered by when they were appended.  Deleting the Row
+// does not delete its segments.
+func AppendToRow(bk Backend, randtags cryptag.RandomTags, data []byte) error {
+	pairs, err := bk.AllTagPairs(nil)
+	if err != nil {
+		return err
+	}
+
+	rows, err := listRows(bk, randtags)
+	if err != nil {
+		return err
+	}
+
+	id, err := rowID(rows, pairs)
+	if err != nil {
+		return err
+	}
+
+	segment, err := types.NewRowSimple(data, []string{
+		SegmentOfPrefix + id,
+		SegmentPrefix + cryptag.NowStr(),
+	})
+	if err != nil {
+		return err
+	}
+	segment.SkipAllTag = true
+
+	if _, err = PopulateRowBeforeSave(bk, segment, pairs); err != nil {
+		return err
+	}
+
+	return bk.SaveRow(segment)
+}
+
+// ReadAppendedRow fetches and decrypts the one Row tagged with all of
+// randtags, then appends the data of each segment appended to it with
+// AppendToRow, in order.
+func ReadAppendedRow(bk Backend, randtags cryptag.RandomTags) (*types.Row, error) {
+	pairs, err := bk.AllTagPairs(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := rowsFromRandomTags(bk, randtags)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := rowID(rows, pairs)
+	if err != nil {
+		return nil, err
+	}
+	row := rows[0]
+
+	if err = row.Populate(bk.RowKey(), pairs); err != nil {
+		return nil, err
+	}
+
+	segOf := normalizeTags([]string{SegmentOfPrefix + id})[0]
+
+	var segOfRand string
+	for _, pair := range pairs {
+		if pair.Plain() == segOf {
+			segOfRand = pair.Random
+			break
+		}
+	}
+	if segOfRand == "" {
+		// Nothing appended
+		return row, nil
+	}
+
+	segments, err := rowsFromRandomTags(bk, []string{segOfRand})
+	if err != nil && err != types.ErrRowsNotFound {
+		return nil, err
+	}
+
+	if err = segments.Populate(bk.RowKey(), pairs); err != nil {
+		return nil, err
+	}
+
+	sort.Sort(bySegment(segments))
+
+	for _, seg := range segments {
+		row.AppendDecrypted(seg.Decrypted())
+	}
+
+	return row, nil
+}
+
+// rowID returns the ID (the part of its id:... plaintag after "id:")
+// of the one Row in rows
+func rowID(rows types.Rows, pairs types.TagPairs) (string, error) {
+	if len(rows) == 0 {
+		return "", types.ErrRowsNotFound
+	}
+	if len(rows) > 1 {
+		return "", ErrMultipleRows
+	}
+
+	// Random tags without a TagPair (e.g., decoys; see PadTagsTo)
+	// can't be the id tag, so they're skipped
+	for _, pair := range pairs {
+		if !rows[0].HasRandomTag(pair.Random) {
+			continue
+		}
+		if strings.HasPrefix(pair.Plain(), "id:") {
+			return strings.TrimPrefix(pair.Plain(), "id:"), nil
+		}
+	}
+
+	return "", ErrNoRowID
+}
+
+// segmentTag returns the SegmentPrefix plaintag of seg
+func segmentTag(seg *types.Row) string {
+	for _, plain := range seg.PlainTags() {
+		if strings.HasPrefix(plain, SegmentPrefix) {
+			return plain
+		}
+	}
+	return ""
+}
+
+type bySegment types.Rows
+
+func (rows bySegment) Len() int      { return len(rows) }
+func (rows bySegment) Swap(i, j int) { rows[i], rows[j] = rows[j], rows[i] }
+
+// Less orders segments by when they were appended, then (for those
+// saved together by SaveRowFromReader) by their sequence numbers
+func (rows bySegment) Less(i, j int) bool {
+	ti, tj := segmentTag(rows[i]), segmentTag(rows[j])
+	if ti != tj {
+		return ti < tj
+	}
+	return string(rows[i].Summary()) < string(rows[j].Summary())
+}
@@ -0,0 +1,65 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"testing"
+
+	"github.com/cryptag/cryptag/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppendToRow(t *testing.T) {
+	bk := newMemBackend(t)
+
+	mustCreateRow(t, bk, "line 1\n", "log")
+	mustCreateRow(t, bk, "unrelated", "other")
+
+	pairs, _ := bk.AllTagPairs(nil)
+	matches, err := pairs.WithAllPlainTags([]string{"log"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	randtags := matches.AllRandom()
+
+	// Nothing appended yet
+	row, err := ReadAppendedRow(bk, randtags)
+	if err != nil {
+		t.Fatalf("Error from ReadAppendedRow: %v", err)
+	}
+	assert.Equal(t, "line 1\n", string(row.Decrypted()))
+
+	for _, line := range []string{"line 2\n", "line 3\n", "line 4\n"} {
+		if err = AppendToRow(bk, randtags, []byte(line)); err != nil {
+			t.Fatalf("Error from AppendToRow: %v", err)
+		}
+	}
+
+	row, err = ReadAppendedRow(bk, randtags)
+	if err != nil {
+		t.Fatalf("Error from ReadAppendedRow: %v", err)
+	}
+	assert.Equal(t, "line 1\nline 2\nline 3\nline 4\n", string(row.Decrypted()))
+	assert.True(t, row.HasPlainTag("log"))
+
+	// Only the segments were written, not the whole Row again
+	assert.Equal(t, []string{"line 1\n"}, rowData(t, bk, "log"))
+}
+
+func TestAppendToRowErrors(t *testing.T) {
+	bk := newMemBackend(t)
+
+	mustCreateRow(t, bk, "a", "dup")
+	mustCreateRow(t, bk, "b", "dup")
+
+	pairs, _ := bk.AllTagPairs(nil)
+	matches, _ := pairs.WithAllPlainTags([]string{"dup"})
+
+	err := AppendToRow(bk, matches.AllRandom(), []byte("c"))
+	assert.Equal(t, ErrMultipleRows, err)
+
+	matches, _ = pairs.WithAllPlainTags([]string{"all"})
+	_, err = ReadAppendedRow(bk, append(matches.AllRandom(), "nosuchtag"))
+	assert.Equal(t, types.ErrRowsNotFound, err)
+}
@@ -0,0 +1,101 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+)
+
+var (
+	ErrAppendOnly = errors.New("backend: append-only; existing data can't be changed")
+)
+
+// AppendOnlyBackend wraps a Backend so that data can be added to it
+// but never changed or removed, e.g. for auditing: SaveRow only saves
+// Rows whose random tags no existing Row has, SaveTagPair only saves
+// TagPairs whose random tag is new, and DeleteRows always fails, each
+// returning ErrAppendOnly otherwise.  Every other method is passed
+// straight through to the wrapped Backend.  UpdateRow still works,
+// since it saves each new version as a new Row.
+//
+// Only writes made through the AppendOnlyBackend are checked.
+type AppendOnlyBackend struct {
+	Backend
+
+	mu sync.Mutex // Makes checking for existing data and saving atomic
+}
+
+// AppendOnly returns an append-only view of bk.
+func AppendOnly(bk Backend) *AppendOnlyBackend {
+	return &AppendOnlyBackend{Backend: bk}
+}
+
+func (ao *AppendOnlyBackend) SaveTagPair(pair *types.TagPair) error {
+	ao.mu.Lock()
+	defer ao.mu.Unlock()
+
+	taken, err := randomTagTaken(ao.Backend, pair.Random)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrAppendOnly
+	}
+	return ao.Backend.SaveTagPair(pair)
+}
+
+func (ao *AppendOnlyBackend) SaveRow(row *types.Row) error {
+	ao.mu.Lock()
+	defer ao.mu.Unlock()
+
+	exists, err := rowExists(ao.Backend, row.RandomTags)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrAppendOnly
+	}
+	return ao.Backend.SaveRow(row)
+}
+
+func (ao *AppendOnlyBackend) DeleteRows(randtags cryptag.RandomTags) error {
+	return ErrAppendOnly
+}
+
+func (ao *AppendOnlyBackend) Flush() error {
+	return Flush(ao.Backend)
+}
+
+func (ao *AppendOnlyBackend) Warm(queries []cryptag.RandomTags) error {
+	return Warm(ao.Backend, queries)
+}
+
+// rowExists reports whether bk has a Row tagged with exactly randtags
+func rowExists(bk Backend, randtags []string) (bool, error) {
+	if len(randtags) == 0 {
+		return false, nil
+	}
+
+	rows, err := listRows(bk, randtags)
+	if err == types.ErrRowsNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	want := strings.Join(canonicalRandomTags(append([]string{}, randtags...)), "-")
+	for _, row := range rows {
+		got := strings.Join(canonicalRandomTags(append([]string{}, row.RandomTags...)), "-")
+		if got == want {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,45 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"testing"
+
+	"github.com/cryptag/cryptag/rowutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppendOnly(t *testing.T) {
+	bk := newMemBackend(t)
+	ao := AppendOnly(bk)
+
+	// New Rows and tags save
+	row := mustCreateRow(t, ao, "first", "log")
+	mustCreateRow(t, ao, "second", "log")
+	assert.Equal(t, []string{"first", "second"}, rowData(t, ao, "log"))
+
+	// Re-saving an existing Row, or one with the same tags, doesn't
+	assert.Equal(t, ErrAppendOnly, ao.SaveRow(row))
+
+	pairs, err := ao.AllTagPairs(nil)
+	if err != nil {
+		t.Fatalf("Error from AllTagPairs: %v", err)
+	}
+	assert.Equal(t, ErrAppendOnly, ao.SaveTagPair(pairs[0]))
+
+	// Nor can anything be deleted
+	assert.Equal(t, ErrAppendOnly, ao.DeleteRows(row.RandomTags))
+	assert.Equal(t, ErrAppendOnly, DeleteRows(ao, nil, []string{"log"}))
+
+	// Nothing changed underneath
+	assert.Equal(t, []string{"first", "second"}, rowData(t, bk, "log"))
+	assert.Equal(t, 2, len(bk.rows))
+
+	// New versions are new Rows, leaving the old ones in place
+	_, err = UpdateRow(ao, nil, rowutil.TagWithPrefix(row, "id:"), []byte("third"))
+	if err != nil {
+		t.Fatalf("Error from UpdateRow: %v", err)
+	}
+	assert.Equal(t, []string{"first", "second", "third"}, rowData(t, bk, "log"))
+}
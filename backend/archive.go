@@ -0,0 +1,584 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+	"github.com/elimisteve/fun"
+)
+
+var (
+	ErrArchiveClosed = errors.New("backend: Archive is closed")
+)
+
+// Archive is a Backend whose entire state -- every Row and TagPair --
+// is stored in one encrypted file (conf.DataPath), making it easy to
+// back up or move around, like a password vault.  The file is loaded
+// into memory by NewArchive, then rewritten (atomically; see flush)
+// after every change and by Close.  Archives opened with
+// NewBufferedArchive are instead only rewritten by Flush and Close.
+//
+// The file's contents are encrypted with the Archive's key, even
+// though the Rows and TagPairs within are already encrypted, so that
+// not even the number of Rows or which random tags they have is
+// revealed.
+type Archive struct {
+	name     string
+	dataPath string // The archive file
+	new      bool
+	buffered bool // Only write to disk on Flush and Close
+	key      *[32]byte
+	tagKey   *[32]byte // Encrypts TagPairs if set; see TagKey
+
+	mu     sync.Mutex
+	pairs  map[string]*types.TagPair // Random tag -> TagPair
+	rows   map[string]*types.Row     // Random tags joined by "-" -> Row
+	dirty  bool                      // Changed since last flush
+	closed bool
+}
+
+// archiveContents is what gets encrypted and stored in an Archive's
+// file
+type archiveContents struct {
+	TagPairs []*types.TagPair `json:"tag_pairs"`
+	Rows     []*types.Row     `json:"rows"`
+}
+
+// archiveFile is the outer, on-disk format of an Archive's file
+type archiveFile struct {
+	Data  []byte    `json:"data"`
+	Nonce *[24]byte `json:"nonce"`
+}
+
+// NewArchive opens the Archive whose file is at conf.DataPath,
+// creating an empty one if the file doesn't exist yet.
+func NewArchive(conf *Config) (*Archive, error) {
+	buffered := false
+	return newArchive(conf, buffered)
+}
+
+// NewBufferedArchive is like NewArchive, but the Archive returned
+// only writes changes to disk when Flush or Close is called, which is
+// much faster when saving many Rows at once.  Changes not yet flushed
+// are lost if the process exits.
+func NewBufferedArchive(conf *Config) (*Archive, error) {
+	buffered := true
+	return newArchive(conf, buffered)
+}
+
+func newArchive(conf *Config, buffered bool) (*Archive, error) {
+	if err := conf.Canonicalize(); err != nil {
+		return nil, err
+	}
+
+	ar := &Archive{
+		name:     conf.Name,
+		dataPath: conf.DataPath,
+		new:      conf.New,
+		buffered: buffered,
+		key:      conf.Key,
+		tagKey:   conf.TagKey,
+		pairs:    map[string]*types.TagPair{},
+		rows:     map[string]*types.Row{},
+	}
+	if err := ar.load(); err != nil {
+		return nil, err
+	}
+
+	// Save config to disk
+	if conf.New {
+		if err := saveConfig(conf); err != nil {
+			return nil, err
+		}
+	}
+
+	return ar, nil
+}
+
+// load reads and decrypts ar's file, if it exists
+func (ar *Archive) load() error {
+	b, err := ioutil.ReadFile(ar.dataPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var file archiveFile
+	if err = json.Unmarshal(b, &file); err != nil {
+		return fmt.Errorf("Error parsing archive `%s`: %v", ar.dataPath, err)
+	}
+
+	dec, err := cryptag.Decrypt(file.Data, file.Nonce, ar.key)
+	if err != nil {
+		return fmt.Errorf("Error decrypting archive `%s`: %v", ar.dataPath, err)
+	}
+
+	var contents archiveContents
+	if err = json.Unmarshal(dec, &contents); err != nil {
+		return fmt.Errorf("Error parsing decrypted archive `%s`: %v",
+			ar.dataPath, err)
+	}
+
+	for _, pair := range contents.TagPairs {
+		ar.pairs[pair.Random] = pair
+	}
+	for _, row := range contents.Rows {
+		ar.rows[strings.Join(row.RandomTags, "-")] = row
+	}
+
+	return nil
+}
+
+// flush encrypts and writes ar's contents to ar's file, atomically
+// (see writeFileAtomic).  ar.mu must be held.
+func (ar *Archive) flush() error {
+	var contents archiveContents
+	for _, rand := range sortedKeysPairs(ar.pairs) {
+		contents.TagPairs = append(contents.TagPairs, ar.pairs[rand])
+	}
+	for _, key := range sortedKeysRows(ar.rows) {
+		contents.Rows = append(contents.Rows, ar.rows[key])
+	}
+
+	b, err := json.Marshal(contents)
+	if err != nil {
+		return err
+	}
+
+	nonce, err := cryptag.RandomNonce()
+	if err != nil {
+		return err
+	}
+	enc, err := cryptag.Encrypt(b, nonce, ar.key)
+	if err != nil {
+		return err
+	}
+
+	b, err = json.Marshal(archiveFile{Data: enc, Nonce: nonce})
+	if err != nil {
+		return err
+	}
+
+	if err = writeFileAtomic(ar.dataPath, b); err != nil {
+		return err
+	}
+
+	ar.dirty = false
+	return nil
+}
+
+// changed flushes ar to disk, unless ar is buffered, in which case
+// it's flushed later by Flush or Close.  ar.mu must be held.
+func (ar *Archive) changed() error {
+	if ar.buffered {
+		ar.dirty = true
+		return nil
+	}
+	return ar.flush()
+}
+
+// Flush writes any changes not yet written to disk (see
+// NewBufferedArchive).  Implements Flusher.
+func (ar *Archive) Flush() error {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+
+	if ar.closed {
+		return ErrArchiveClosed
+	}
+	if !ar.dirty {
+		return nil
+	}
+
+	return ar.flush()
+}
+
+// Close flushes ar to disk one last time; ar can't be used after.
+func (ar *Archive) Close() error {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+
+	if ar.closed {
+		return ErrArchiveClosed
+	}
+
+	if err := ar.flush(); err != nil {
+		return err
+	}
+
+	ar.closed = true
+	ar.pairs = nil
+	ar.rows = nil
+
+	return nil
+}
+
+func (ar *Archive) Name() string {
+	return ar.name
+}
+
+func (ar *Archive) ToConfig() (*Config, error) {
+	config := Config{
+		Name:     ar.name,
+		Type:     TypeArchive,
+		New:      ar.new,
+		Key:      ar.key,
+		TagKey:   ar.tagKey,
+		Local:    true,
+		DataPath: ar.dataPath,
+	}
+
+	return &config, nil
+}
+
+func (ar *Archive) Key() *[32]byte {
+	return ar.key
+}
+
+// TagKey returns the key that ar's TagPairs are encrypted with, which
+// is ar.Key() unless a separate tag key has been set.
+func (ar *Archive) TagKey() *[32]byte {
+	if ar.tagKey != nil {
+		return ar.tagKey
+	}
+	return ar.key
+}
+
+// RowKey returns the key that ar's Rows are encrypted with.
+func (ar *Archive) RowKey() *[32]byte {
+	return ar.key
+}
+
+// SetTagKey sets the key that ar's TagPairs are encrypted with.
+// Implements TagKeySetter.
+func (ar *Archive) SetTagKey(key *[32]byte) {
+	ar.tagKey = key
+}
+
+func (ar *Archive) AllTagPairs(oldPairs types.TagPairs) (_ types.TagPairs, err error) {
+	defer annotateErr(&err, ar, "AllTagPairs")
+
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+
+	if ar.closed {
+		return nil, ErrArchiveClosed
+	}
+
+	var pairs types.TagPairs
+	ierr := &InvalidTagPairsError{Invalid: map[string]error{}}
+
+	for _, rand := range sortedKeysPairs(ar.pairs) {
+		pair, err := ar.decryptedPair(ar.pairs[rand])
+		if err != nil {
+			ierr.Invalid[rand] = err
+			continue
+		}
+		pairs = append(pairs, pair)
+	}
+
+	return validTagPairs(pairs, ierr)
+}
+
+func (ar *Archive) TagPairsFromRandomTags(randtags cryptag.RandomTags) (_ types.TagPairs, err error) {
+	defer annotateErr(&err, ar, "TagPairsFromRandomTags")
+
+	if len(randtags) == 0 {
+		return nil, fmt.Errorf("Can't get 0 tags")
+	}
+
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+
+	if ar.closed {
+		return nil, ErrArchiveClosed
+	}
+
+	var found types.TagPairs
+	for _, rand := range randtags {
+		stored, ok := ar.pairs[rand]
+		if !ok {
+			continue
+		}
+		found = append(found, &types.TagPair{
+			PlainEncrypted: stored.PlainEncrypted,
+			Random:         stored.Random,
+			Nonce:          stored.Nonce,
+		})
+	}
+
+	pairs, err := verifyTagPairs(ar.TagKey(), found)
+	if err != nil {
+		return pairs, err
+	}
+
+	if len(pairs) == 0 {
+		return nil, types.ErrTagPairNotFound
+	}
+
+	return pairs, nil
+}
+
+// decryptedPair returns a decrypted copy of stored
+func (ar *Archive) decryptedPair(stored *types.TagPair) (*types.TagPair, error) {
+	pair := &types.TagPair{
+		PlainEncrypted: stored.PlainEncrypted,
+		Random:         stored.Random,
+		Nonce:          stored.Nonce,
+	}
+	if err := pair.Decrypt(ar.TagKey()); err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+func (ar *Archive) SaveTagPair(pair *types.TagPair) (err error) {
+	defer annotateErr(&err, ar, "SaveTagPair")
+
+	if len(pair.PlainEncrypted) == 0 || len(pair.Random) == 0 || pair.Nonce == nil || *pair.Nonce == [24]byte{} {
+		return errors.New("Invalid tag pair; requires plain_encrypted, random, and nonce fields")
+	}
+
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+
+	if ar.closed {
+		return ErrArchiveClosed
+	}
+
+	ar.pairs[pair.Random] = &types.TagPair{
+		PlainEncrypted: pair.PlainEncrypted,
+		Random:         pair.Random,
+		Nonce:          pair.Nonce,
+	}
+
+	return ar.changed()
+}
+
+// DeleteTagPair deletes the TagPair whose random tag is random.
+// Implements TagPairDeleter.
+func (ar *Archive) DeleteTagPair(random string) error {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+
+	if ar.closed {
+		return ErrArchiveClosed
+	}
+
+	if _, ok := ar.pairs[random]; !ok {
+		return types.ErrTagPairNotFound
+	}
+	delete(ar.pairs, random)
+
+	return ar.changed()
+}
+
+func (ar *Archive) ListRows(randtags cryptag.RandomTags) (_ types.Rows, err error) {
+	defer annotateErr(&err, ar, "ListRows")
+
+	includeData, includeSummary := false, false
+	return ar.rowsFromRandomTags(randtags, includeData, includeSummary, 0, 0)
+}
+
+// ListRowsLimit is like ListRows, but only returns one page of Rows.
+// Implements Limiter.
+func (ar *Archive) ListRowsLimit(randtags cryptag.RandomTags, offset, limit int) (types.Rows, error) {
+	includeData, includeSummary := false, false
+	return ar.rowsFromRandomTags(randtags, includeData, includeSummary,
+		offset, limit)
+}
+
+// ListRowSummaries is like ListRows, but includes each Row's
+// encrypted summary.  Implements SummaryLister.
+func (ar *Archive) ListRowSummaries(randtags cryptag.RandomTags) (types.Rows, error) {
+	includeData, includeSummary := false, true
+	return ar.rowsFromRandomTags(randtags, includeData, includeSummary, 0, 0)
+}
+
+func (ar *Archive) RowsFromRandomTags(randtags cryptag.RandomTags) (_ types.Rows, err error) {
+	defer annotateErr(&err, ar, "RowsFromRandomTags")
+
+	includeData, includeSummary := true, true
+	return ar.rowsFromRandomTags(randtags, includeData, includeSummary, 0, 0)
+}
+
+// RowsFromRandomTagsLimit is like RowsFromRandomTags, but only
+// returns one page of Rows.  Implements Limiter.
+func (ar *Archive) RowsFromRandomTagsLimit(randtags cryptag.RandomTags, offset, limit int) (types.Rows, error) {
+	includeData, includeSummary := true, true
+	return ar.rowsFromRandomTags(randtags, includeData, includeSummary,
+		offset, limit)
+}
+
+// rowsFromRandomTags skips the first offset Rows tagged with all of
+// randtags, then returns at most limit of them (all of them if limit
+// is 0)
+func (ar *Archive) rowsFromRandomTags(randtags cryptag.RandomTags, includeData, includeSummary bool, offset, limit int) (types.Rows, error) {
+	if len(randtags) == 0 {
+		return nil, errors.New("Must query by 1 or more tags")
+	}
+
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+
+	if ar.closed {
+		return nil, ErrArchiveClosed
+	}
+
+	var rows types.Rows
+	matched := 0
+
+	for _, key := range sortedKeysRows(ar.rows) {
+		stored := ar.rows[key]
+		if !fun.SliceContainsAll(stored.RandomTags, randtags) {
+			continue
+		}
+
+		include, done := inPage(matched, offset, limit)
+		matched++
+		if !include {
+			continue
+		}
+
+		// Return copies so callers can't modify what's stored
+		row := &types.Row{RandomTags: append([]string{}, stored.RandomTags...)}
+		if includeData {
+			row.Encrypted = stored.Encrypted
+			row.Nonce = stored.Nonce
+		}
+		if includeSummary {
+			row.EncryptedSummary = stored.EncryptedSummary
+			row.SummaryNonce = stored.SummaryNonce
+		}
+		rows = append(rows, row)
+
+		if done {
+			break
+		}
+	}
+
+	if len(rows) == 0 {
+		return nil, types.ErrRowsNotFound
+	}
+
+	return rows, nil
+}
+
+func (ar *Archive) SaveRow(row *types.Row) (err error) {
+	defer annotateErr(&err, ar, "SaveRow")
+
+	if len(row.Encrypted) == 0 || len(row.RandomTags) == 0 || row.Nonce == nil || *row.Nonce == [24]byte{} {
+		return errors.New("Invalid row; requires Encrypted, RandomTags, Nonce fields")
+	}
+
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+
+	if ar.closed {
+		return ErrArchiveClosed
+	}
+
+	ar.rows[strings.Join(row.RandomTags, "-")] = &types.Row{
+		Encrypted:        row.Encrypted,
+		RandomTags:       append([]string{}, row.RandomTags...),
+		Nonce:            row.Nonce,
+		EncryptedSummary: row.EncryptedSummary,
+		SummaryNonce:     row.SummaryNonce,
+	}
+
+	return ar.changed()
+}
+
+func (ar *Archive) DeleteRows(randtags cryptag.RandomTags) (err error) {
+	defer annotateErr(&err, ar, "DeleteRows")
+
+	if len(randtags) == 0 {
+		return fmt.Errorf("Must query by 1 or more tags")
+	}
+
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+
+	if ar.closed {
+		return ErrArchiveClosed
+	}
+
+	deleted := 0
+	for key, row := range ar.rows {
+		if fun.SliceContainsAll(row.RandomTags, randtags) {
+			delete(ar.rows, key)
+			deleted++
+		}
+	}
+
+	if deleted == 0 {
+		return types.ErrRowsNotFound
+	}
+
+	return ar.changed()
+}
+
+//
+// Helpers
+//
+
+// writeFileAtomic writes b to a temporary file then renames it to
+// filename, so that filename is never left half-written
+func writeFileAtomic(filename string, b []byte) error {
+	dir := filepath.Dir(filename)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("Error making dir `%s`: %v", dir, err)
+	}
+
+	tmp, err := ioutil.TempFile(dir, filepath.Base(filename)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // Fails harmlessly once renamed
+
+	if _, err = tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("Error writing `%s`: %v", filename, err)
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("Error writing `%s`: %v", filename, err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("Error writing `%s`: %v", filename, err)
+	}
+
+	return os.Rename(tmp.Name(), filename)
+}
+
+func sortedKeysPairs(m map[string]*types.TagPair) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedKeysRows(m map[string]*types.Row) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
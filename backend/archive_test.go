@@ -0,0 +1,156 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArchiveReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cryptag-archive-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := &Config{
+		Name:     "vault",
+		Type:     TypeArchive,
+		DataPath: path.Join(dir, "vault.archive"),
+	}
+
+	ar, err := NewArchive(conf)
+	if err != nil {
+		t.Fatalf("Error from NewArchive: %v", err)
+	}
+
+	mustCreateRow(t, ar, "keep me", "keep")
+	mustCreateRow(t, ar, "delete me", "delete")
+
+	if err = DeleteRows(ar, nil, cryptag.PlainTags{"delete"}); err != nil {
+		t.Fatalf("Error from DeleteRows: %v", err)
+	}
+
+	if err = ar.Close(); err != nil {
+		t.Fatalf("Error from Close: %v", err)
+	}
+	_, err = ar.AllTagPairs(nil)
+	assert.True(t, errors.Is(err, ErrArchiveClosed))
+
+	// Everything's in the one file; no temp files left behind
+	files, _ := filepath.Glob(path.Join(dir, "*"))
+	assert.Equal(t, []string{conf.DataPath}, files)
+
+	// Reopen
+	ar, err = NewArchive(conf)
+	if err != nil {
+		t.Fatalf("Error reopening archive: %v", err)
+	}
+	defer ar.Close()
+
+	assert.Equal(t, []string{"keep me"}, rowData(t, ar, "keep"))
+
+	_, err = RowsFromPlainTags(ar, nil, cryptag.PlainTags{"delete"})
+	assert.Equal(t, types.ErrRowsNotFound, err)
+
+	// Modify after reopening
+	mustCreateRow(t, ar, "added later", "keep")
+	assert.Equal(t, 2, len(rowData(t, ar, "keep")))
+}
+
+func TestBufferedArchiveFlush(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cryptag-archive-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := &Config{
+		Name:     "vault",
+		Type:     TypeArchive,
+		DataPath: path.Join(dir, "vault.archive"),
+	}
+
+	ar, err := NewBufferedArchive(conf)
+	if err != nil {
+		t.Fatalf("Error from NewBufferedArchive: %v", err)
+	}
+
+	// Flushes propagate through wrappers
+	bk := WithTimeout(ar, 5*time.Second)
+
+	mustCreateRow(t, bk, "first", "note")
+
+	// Nothing written yet
+	_, err = os.Stat(conf.DataPath)
+	assert.True(t, os.IsNotExist(err))
+
+	if err = Flush(bk); err != nil {
+		t.Fatalf("Error from Flush: %v", err)
+	}
+
+	reopened := func() *Archive {
+		r, err := NewArchive(conf)
+		if err != nil {
+			t.Fatalf("Error reopening archive: %v", err)
+		}
+		return r
+	}
+
+	assert.Equal(t, []string{"first"}, rowData(t, reopened(), "note"))
+
+	mustCreateRow(t, bk, "second", "note")
+	assert.Equal(t, []string{"first"}, rowData(t, reopened(), "note"))
+
+	// Close implies Flush
+	if err = ar.Close(); err != nil {
+		t.Fatalf("Error from Close: %v", err)
+	}
+	assert.Equal(t, 2, len(rowData(t, reopened(), "note")))
+
+	// Flushing a Backend that doesn't buffer writes does nothing
+	assert.Nil(t, Flush(newMemBackend(t)))
+}
+
+func TestArchiveWrongKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cryptag-archive-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := &Config{
+		Name:     "vault",
+		Type:     TypeArchive,
+		DataPath: path.Join(dir, "vault.archive"),
+	}
+
+	ar, err := NewArchive(conf)
+	if err != nil {
+		t.Fatalf("Error from NewArchive: %v", err)
+	}
+	mustCreateRow(t, ar, "secret", "secret")
+	pairs, _ := ar.AllTagPairs(nil)
+	ar.Close()
+
+	// Not even random tags are visible without the key
+	b, _ := ioutil.ReadFile(conf.DataPath)
+	for _, pair := range pairs {
+		assert.NotContains(t, string(b), pair.Random)
+	}
+
+	conf.Key, _ = cryptag.RandomKey()
+	_, err = NewArchive(conf)
+	assert.NotNil(t, err, "Opened archive with the wrong key")
+}
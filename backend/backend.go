@@ -4,20 +4,79 @@
 package backend
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"sort"
 
 	"github.com/cryptag/cryptag"
 	"github.com/cryptag/cryptag/types"
 	"github.com/elimisteve/fun"
+	"golang.org/x/net/context"
 )
 
 var (
 	RANDOM_TAG_ALPHABET = "abcdefghijklmnopqrstuvwxyz0123456789"
 	RANDOM_TAG_LENGTH   = 9
 
+	// TagRandReader is where NewTagPair gets each random tag and the
+	// nonce it encrypts the plaintag with, and where decoy tags (see
+	// PadTagsTo) come from: crypto/rand by default.  Tests may replace
+	// it with a seeded source to make TagPairs reproducible; keys and
+	// Row nonces always come from crypto/rand.
+	TagRandReader io.Reader = rand.Reader
+
+	// DeterministicTagEncryption makes NewTagPair encrypt plaintags
+	// with NewTagPairDeterministic.  Off by default; see
+	// NewTagPairDeterministic's privacy note before turning it on.
+	DeterministicTagEncryption = false
+
+	// DeterministicRandomTags makes NewTagPairDeterministic derive
+	// each random tag from its plaintag and key (see
+	// DeterministicRandomTag) rather than generate it randomly, so
+	// that lost TagPairs can be rebuilt with RebuildTagIndex.  Off by
+	// default; whoever stores the TagPairs learns nothing more from it
+	// than from DeterministicTagEncryption.
+	DeterministicRandomTags = false
+
+	// AllTag is the plaintag that every Row is tagged with (by
+	// types.NewRow, and by PopulateRowBeforeSave if AddAllTag is
+	// set), so that every Row can be found by querying for it; see
+	// ListAllRows.  Rows with SkipAllTag set are the exception;
+	// PopulateRowBeforeSave strips AllTag from them.
+	AllTag = "all"
+
+	// AddAllTag makes PopulateRowBeforeSave tag every Row with AllTag,
+	// even Rows not created with types.NewRow.
+	AddAllTag = false
+
+	// CreateTagsConcurrency is the most TagPairs CreateTagsFromPlain
+	// creates at once; 0 means no limit.
+	CreateTagsConcurrency = 0
+
+	// PadTagsTo, if greater than 1, makes PopulateRowBeforeSave pad
+	// each Row's random tags with decoys to the next multiple of
+	// PadTagsTo, so that a Backend can't tell Rows apart by how many
+	// tags they have.  Each decoy gets a TagPair, for a random
+	// plaintag starting with types.DecoyTagPrefix, so that a Backend
+	// can't tell decoys from real tags either; populating a Row
+	// leaves their plaintags out.
+	PadTagsTo = 0
+
+	// TagCollisionRetries is how many more times CreateTag generates
+	// a new random tag when the one it generated is already taken
+	// before giving up with ErrTagCollisionRetriesExhausted.
+	TagCollisionRetries = 3
+
 	ErrBackendExists = errors.New("Backend already exists")
+	ErrEmptyPlainTag = errors.New("Plaintag cannot be empty")
+
+	ErrTagCollisionRetriesExhausted = errors.New("backend: Every random tag generated was already taken")
 )
 
 // Backend is an interface that represents a type of storage location
@@ -26,6 +85,11 @@ type Backend interface {
 	Name() string
 	Key() *[32]byte
 
+	// TagKey encrypts TagPairs and RowKey encrypts Rows; both are
+	// Key() unless the Backend has been given separate keys.
+	TagKey() *[32]byte
+	RowKey() *[32]byte
+
 	AllTagPairs(oldPairs types.TagPairs) (types.TagPairs, error)
 	TagPairsFromRandomTags(randtags cryptag.RandomTags) (types.TagPairs, error)
 	SaveTagPair(pair *types.TagPair) error
@@ -41,84 +105,336 @@ type Backend interface {
 // CreateTagsFromPlain concurrently creates new TagPairs for each
 // plaintag that doesn't already have a corresponding PlainTag in
 // pairs.  (Be sure that pairs contains the latest TagPairs contained
-// in backend.)
+// in backend.)  Creation is best-effort: plaintags whose TagPair can't
+// be created are logged and left out of newPairs, and err is nil.
 func CreateTagsFromPlain(bk Backend, plaintags []string, pairs types.TagPairs) (newPairs types.TagPairs, err error) {
-	// Find out which members of plaintags don't have an existing,
-	// corresponding TagPair
+	failFast := false
+	return createTagsFromPlain(context.Background(), bk, plaintags, pairs,
+		failFast)
+}
+
+// CreateTagsFromPlainFailFast is like CreateTagsFromPlain, except it
+// gives up as soon as one TagPair can't be created (or ctx is
+// cancelled), returning that error along with the TagPairs created so
+// far.  TagPairs not yet being created by then never are, though ones
+// already being created (see CreateTagsConcurrency) may still be
+// saved.
+func CreateTagsFromPlainFailFast(ctx context.Context, bk Backend, plaintags []string, pairs types.TagPairs) (newPairs types.TagPairs, err error) {
+	failFast := true
+	return createTagsFromPlain(ctx, bk, plaintags, pairs, failFast)
+}
+
+type createdTag struct {
+	i    int // Index in the list of TagPairs to create
+	pair *types.TagPair
+	err  error
+}
 
-	existingPlain := pairs.AllPlain()
+func createTagsFromPlain(ctx context.Context, bk Backend, plaintags []string, pairs types.TagPairs, failFast bool) (newPairs types.TagPairs, err error) {
+	// Find out which members of plaintags don't have an existing,
+	// corresponding TagPair.  Build a set once rather than scanning
+	// pairs for every plaintag, since pairs can be huge.  Normalize
+	// first (as CreateTag would) so that, e.g., "Foo" and "foo" don't
+	// each get a TagPair.
 
-	// Concurrent Tag creation ftw
-	var chs []chan *types.TagPair
+	plaintags = normalizeTags(plaintags)
 
-	// TODO: Put the following in a `CreateTags` function
+	existingPlain := make(map[string]bool, len(pairs))
+	for _, pair := range pairs {
+		existingPlain[pair.Plain()] = true
+	}
 
+	var toCreate []string
 	for _, plain := range plaintags {
-		if !fun.SliceContains(existingPlain, plain) {
-			// Preserve tag ordering despite concurrent creation
-			ch := make(chan *types.TagPair)
-			chs = append(chs, ch)
+		if !existingPlain[plain] {
+			// Don't create 2 TagPairs for 1 plaintag listed twice
+			existingPlain[plain] = true
+			toCreate = append(toCreate, plain)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Concurrent Tag creation ftw.  Buffered so that goroutines never
+	// block, even once we've stopped listening.
+	results := make(chan createdTag, len(toCreate))
+
+	concurrency := CreateTagsConcurrency
+	if concurrency <= 0 {
+		concurrency = len(toCreate)
+	}
+	sem := make(chan struct{}, concurrency)
+
+	go func() {
+		for i, plain := range toCreate {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			// A failure may have cancelled ctx before freeing up sem
+			if ctx.Err() != nil {
+				return
+			}
+
+			go func(i int, plain string) {
+				defer func() { <-sem }()
 
-			go func(plain string, ch chan *types.TagPair) {
 				pair, err := CreateTag(bk, plain)
 				if err != nil {
-					log.Printf("Error calling CreateTag(%q): %v\n", plain, err)
-					ch <- nil
+					results <- createdTag{i: i,
+						err: fmt.Errorf("Error creating tag `%s`: %v", plain, err)}
+					if failFast {
+						// Before freeing up sem, so no more get created
+						cancel()
+					}
 					return
 				}
 				if types.Debug {
 					log.Printf("Created TagPair{plain: %q, Random: %q}\n",
 						pair.Plain(), pair.Random)
 				}
-				ch <- pair
-				return
-			}(plain, ch)
+				results <- createdTag{i: i, pair: pair}
+			}(i, plain)
+		}
+	}()
+
+	// Preserve tag ordering despite concurrent creation
+	created := make([]*types.TagPair, len(toCreate))
+
+	for n := 0; n < len(toCreate); n++ {
+		var res createdTag
+		select {
+		case res = <-results:
+		case <-ctx.Done():
+			return drainCreated(results, created, ctx.Err())
 		}
+
+		if res.err != nil {
+			if failFast {
+				return collectCreated(created), res.err
+			}
+			log.Println(res.err)
+			continue
+		}
+		created[res.i] = res.pair
 	}
 
-	// Append successfully-created *TagPair values to `chs`
-	//
-	// TODO: Consider timing out in case CreateTag() never returns
-	for i := 0; i < len(chs); i++ {
-		if p := <-chs[i]; p != nil {
-			newPairs = append(newPairs, p)
+	return collectCreated(created), nil
+}
+
+// drainCreated collects the results already sent once ctx has been
+// cancelled, returning the failure that cancelled it, if any (which is
+// sent before cancelling), else ctxErr
+func drainCreated(results chan createdTag, created []*types.TagPair, ctxErr error) (types.TagPairs, error) {
+	for {
+		select {
+		case res := <-results:
+			if res.err != nil {
+				return collectCreated(created), res.err
+			}
+			created[res.i] = res.pair
+		default:
+			return collectCreated(created), ctxErr
 		}
 	}
+}
 
-	return newPairs, nil
+// collectCreated returns the non-nil members of created, in order
+func collectCreated(created []*types.TagPair) types.TagPairs {
+	var pairs types.TagPairs
+	for _, pair := range created {
+		if pair != nil {
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs
 }
 
 // NewTagPair creates a (cryptographically secure pseudorandom)
 // RandomTag that corresponds to the given PlainTag, generates a new
 // nonce, encrypts the PlainTag, then creates and returns the newly
-// allocated TagPair.
+// allocated TagPair.  Returns ErrEmptyPlainTag if plaintag is empty.
 func NewTagPair(key *[32]byte, plaintag string) (*types.TagPair, error) {
-	rand := fun.RandomString(RANDOM_TAG_ALPHABET, RANDOM_TAG_LENGTH)
+	if plaintag == "" {
+		return nil, ErrEmptyPlainTag
+	}
+
+	if DeterministicTagEncryption {
+		return NewTagPairDeterministic(key, plaintag)
+	}
 
-	nonce, err := cryptag.RandomNonce()
+	random, err := randomTag()
 	if err != nil {
 		return nil, err
 	}
 
-	plainEnc, err := cryptag.Encrypt([]byte(plaintag), nonce, key)
+	var nonce [24]byte
+	if _, err = io.ReadFull(TagRandReader, nonce[:]); err != nil {
+		return nil, err
+	}
+
+	plainEnc, err := cryptag.Encrypt([]byte(plaintag), &nonce, key)
 	if err != nil {
 		return nil, err
 	}
 
-	pair := types.NewTagPair(plainEnc, rand, nonce, plaintag)
+	pair := types.NewTagPair(plainEnc, random, &nonce, plaintag)
 
 	return pair, nil
 }
 
-// CreateTag uses NewTagPair to create a new TagPair, then saves said
-// TagPair in backend.
-func CreateTag(bk Backend, plaintag string) (*types.TagPair, error) {
-	pair, err := NewTagPair(bk.Key(), plaintag)
+// randomTag returns a new random tag of RANDOM_TAG_LENGTH characters
+// from RANDOM_TAG_ALPHABET, read from TagRandReader
+func randomTag() (string, error) {
+	return randomTagFrom(TagRandReader)
+}
+
+// randomTagFrom is like randomTag, but reads from r
+func randomTagFrom(r io.Reader) (string, error) {
+	alphabet := RANDOM_TAG_ALPHABET
+	if len(alphabet) == 0 || len(alphabet) > 256 {
+		return "", fmt.Errorf("Invalid random tag alphabet of length %d",
+			len(alphabet))
+	}
+
+	// Reject bytes past the last multiple of len(alphabet) so that
+	// every character is equally likely
+	max := 256 - 256%len(alphabet)
+
+	tag := make([]byte, 0, RANDOM_TAG_LENGTH)
+	buf := make([]byte, RANDOM_TAG_LENGTH)
+
+	for len(tag) < RANDOM_TAG_LENGTH {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return "", fmt.Errorf("Error generating random tag: %v", err)
+		}
+		for _, b := range buf {
+			if int(b) >= max {
+				continue
+			}
+			tag = append(tag, alphabet[int(b)%len(alphabet)])
+			if len(tag) == RANDOM_TAG_LENGTH {
+				break
+			}
+		}
+	}
+
+	return string(tag), nil
+}
+
+// NewTagPairDeterministic is like NewTagPair, except the PlainTag is
+// encrypted deterministically (see cryptag.EncryptDeterministic): the
+// same plaintag and key always yield the same PlainEncrypted, so a
+// Backend can find the TagPair for a plaintag by comparing
+// ciphertexts, without ever learning the plaintag.  The RandomTag is
+// still random.  Row data is never encrypted this way.
+//
+// PRIVACY NOTE: whoever stores these TagPairs can tell when two of
+// them are for the same plaintag (and, e.g., count duplicates), and
+// can recognize a TagPair for a plaintag it has seen encrypted under
+// this key before.
+//
+// If DeterministicRandomTags is set, the RandomTag is derived from the
+// plaintag and key, too.
+func NewTagPairDeterministic(key *[32]byte, plaintag string) (*types.TagPair, error) {
+	if plaintag == "" {
+		return nil, ErrEmptyPlainTag
+	}
+
+	var random string
+	var err error
+	if DeterministicRandomTags {
+		random, err = DeterministicRandomTag(key, plaintag)
+	} else {
+		random, err = randomTag()
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	err = bk.SaveTagPair(pair)
+	plainEnc, nonce, err := cryptag.EncryptDeterministic([]byte(plaintag), key)
+	if err != nil {
+		return nil, err
+	}
+
+	pair := types.NewTagPair(plainEnc, random, nonce, plaintag)
+
+	return pair, nil
+}
+
+// DeterministicRandomTag derives a random tag, of the same form as
+// those generated by NewTagPair, from plaintag and key using
+// HMAC-SHA512, so the same plaintag and key always yield the same
+// random tag.
+func DeterministicRandomTag(key *[32]byte, plaintag string) (string, error) {
+	if key == nil {
+		return "", cryptag.ErrNilKey
+	}
+	return randomTagFrom(&hmacStream{key: key, msg: []byte(plaintag)})
+}
+
+// hmacStream is an endless stream of HMAC-SHA512(key, msg, counter)
+// blocks
+type hmacStream struct {
+	key     *[32]byte
+	msg     []byte
+	counter uint64
+	buf     []byte
+}
+
+func (hs *hmacStream) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(hs.buf) == 0 {
+			mac := hmac.New(sha512.New, hs.key[:])
+			mac.Write([]byte("cryptag deterministic random tag\x00"))
+			mac.Write(hs.msg)
+			binary.Write(mac, binary.BigEndian, hs.counter)
+			hs.counter++
+			hs.buf = mac.Sum(nil)
+		}
+		m := copy(p[n:], hs.buf)
+		hs.buf = hs.buf[m:]
+		n += m
+	}
+	return n, nil
+}
+
+// CreateTag uses NewTagPair to create a new TagPair for plaintag
+// (normalized with NormalizeTag), then saves said TagPair in backend.
+// If bk already has a TagPair with the new random tag, a new one is
+// generated, up to TagCollisionRetries times.
+func CreateTag(bk Backend, plaintag string) (*types.TagPair, error) {
+	plaintag = normalizeTags([]string{plaintag})[0]
+
+	var pair *types.TagPair
+	for attempt := 0; ; attempt++ {
+		if attempt > TagCollisionRetries {
+			return nil, ErrTagCollisionRetriesExhausted
+		}
+
+		var err error
+		pair, err = NewTagPair(bk.TagKey(), plaintag)
+		if err != nil {
+			return nil, err
+		}
+
+		taken, err := randomTagTaken(bk, pair.Random)
+		if err != nil {
+			return nil, fmt.Errorf("Error checking for random tag `%s` in"+
+				" backend %v: %v", pair.Random, bk.Name(), err)
+		}
+		if !taken {
+			break
+		}
+		if types.Debug {
+			log.Printf("CreateTag: random tag `%s` already taken\n", pair.Random)
+		}
+	}
+
+	err := bk.SaveTagPair(pair)
 	if err != nil {
 		return nil, fmt.Errorf("Error saving tag pair to backend %v: %v",
 			bk.Name(), err)
@@ -127,47 +443,285 @@ func CreateTag(bk Backend, plaintag string) (*types.TagPair, error) {
 	return pair, nil
 }
 
-// PopulateRowBeforeSave creates a new TagPair for each plaintag
-// unique to row, sets row.RandomTags, and sets row.Encrypted.  row is
-// now ready to be saved to a Backend.
+// randomTagTaken reports whether bk has a TagPair with random tag
+// randtag, including one that can't be decrypted
+func randomTagTaken(bk Backend, randtag string) (bool, error) {
+	pairs, err := bk.TagPairsFromRandomTags([]string{randtag})
+	var ierr *InvalidTagPairsError
+	if errors.As(err, &ierr) {
+		return len(pairs) > 0 || ierr.Invalid[randtag] != nil, nil
+	}
+	if err == types.ErrTagPairNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return len(pairs) > 0, nil
+}
+
+// PopulateResult describes what PopulateRowBeforeSaveResult did to
+// prepare a Row for saving.
+type PopulateResult struct {
+	// NewPairs are the TagPairs created (and saved to the Backend),
+	// including those of any decoys (see PadTagsTo)
+	NewPairs types.TagPairs
+
+	// RandomTags are the random tags the Row's plaintags resolved to,
+	// sorted and deduplicated; also set as row.RandomTags (along with
+	// any decoys; see PadTagsTo)
+	RandomTags []string
+
+	// ReusedPlainTags are the Row's plaintags that already had a
+	// TagPair
+	ReusedPlainTags []string
+
+	// CreatedPlainTags are the Row's plaintags that a new TagPair was
+	// created for
+	CreatedPlainTags []string
+}
+
+// PopulateRowBeforeSave adds any plaintags from TagEnrichers to row,
+// normalizes and validates row's plaintags (see NormalizeTag and
+// ValidateTags), creates a new TagPair for each plaintag unique to
+// row, sets row.RandomTags (sorted and deduplicated, so that Rows
+// with the same tags have identical RandomTags no matter the order
+// their plaintags were listed in), and sets row.Encrypted (and
+// row.EncryptedSummary, if row has a summary) using a fresh nonce,
+// stored in row.Nonce; any nonce the caller set is ignored, so that
+// one can never be reused by mistake.  row is now ready to be saved
+// to a Backend.
 func PopulateRowBeforeSave(bk Backend, row *types.Row, pairs types.TagPairs) (newPairs types.TagPairs, err error) {
+	res, err := PopulateRowBeforeSaveResult(bk, row, pairs)
+	if res == nil {
+		return nil, err
+	}
+	return res.NewPairs, err
+}
+
+// PopulateRowBeforeSaveResult is like PopulateRowBeforeSave, but
+// also reports which random tags row's plaintags resolved to and
+// which plaintags were reused versus newly created (e.g., so a UI can
+// say "created 2 new tags, reused 3").
+func PopulateRowBeforeSaveResult(bk Backend, row *types.Row, pairs types.TagPairs) (*PopulateResult, error) {
+	strict := false
+	return populateRow(bk, row, pairs, strict)
+}
+
+// PopulateRowsBeforeSave is like calling PopulateRowBeforeSave on
+// each of rows, except that each new plaintag shared by several rows
+// gets just one TagPair, created once, rather than one per row
+// racing to create it.  Returns every TagPair created.
+func PopulateRowsBeforeSave(bk Backend, rows types.Rows, pairs types.TagPairs) (newPairs types.TagPairs, err error) {
+	var union []string
+	for _, row := range rows {
+		plaintags, err := rowPlainTags(row)
+		if err != nil {
+			return nil, err
+		}
+		row.ReplacePlainTags(plaintags)
+		union = append(union, plaintags...)
+	}
+
+	// Duplicates in union are only created once
+	newPairs, err = CreateTagsFromPlain(bk, union, pairs)
+	if err != nil {
+		return newPairs, fmt.Errorf("Error from CreateNewTagsFromPlain: %v", err)
+	}
+
+	allPairs := make(types.TagPairs, 0, len(pairs)+len(newPairs))
+	allPairs = append(append(allPairs, pairs...), newPairs...)
+
+	strict := false
+	for _, row := range rows {
+		_, err = populateRowTags(bk, row, row.PlainTags(), allPairs, strict)
+		if err != nil {
+			return newPairs, err
+		}
+	}
+
+	return newPairs, nil
+}
+
+func populateRow(bk Backend, row *types.Row, pairs types.TagPairs, strict bool) (*PopulateResult, error) {
 	// For each element of row.plainTags that doesn't match an
 	// existing tag, call CreateTag().  Encrypt row.decrypted and
 	// store it in row.Encrypted.  POST to server.
 
-	// TODO: Call this in parallel with encryption below
-	newPairs, err = CreateTagsFromPlain(bk, row.PlainTags(), pairs)
+	plaintags, err := rowPlainTags(row)
 	if err != nil {
-		return newPairs, fmt.Errorf("Error from CreateNewTagsFromPlain: %v", err)
+		return &PopulateResult{}, err
 	}
+	row.ReplacePlainTags(plaintags)
 
-	allTagPairs := append(pairs, newPairs...)
+	return populateRowTags(bk, row, plaintags, pairs, strict)
+}
 
-	var randtags []string
+// rowPlainTags returns the plaintags row will be saved with: its own,
+// plus any from TagEnrichers, normalized and validated, with AllTag
+// added or removed as need be
+func rowPlainTags(row *types.Row) ([]string, error) {
+	plaintags := enrichTags(row.Decrypted(), row.PlainTags())
+	plaintags = normalizeTags(plaintags)
+	if AllTag != "" {
+		all := normalizeTags([]string{AllTag})[0]
+		if row.SkipAllTag {
+			plaintags = withoutTag(plaintags, all)
+		} else if AddAllTag && !fun.SliceContains(plaintags, all) {
+			plaintags = append(plaintags, all)
+		}
+	}
 
-	// Set row.RandomTags
+	return ValidateTags(plaintags)
+}
 
-	for _, plain := range row.PlainTags() {
-		for i, pair := range allTagPairs {
-			if plain == pair.Plain() {
-				randtags = append(randtags, pair.Random)
-				break
+// populateRowTags does the rest of populateRow's work once row's final
+// plaintags are known
+func populateRowTags(bk Backend, row *types.Row, plaintags []string, pairs types.TagPairs, strict bool) (*PopulateResult, error) {
+	res := &PopulateResult{}
+
+	if strict {
+		// Otherwise every tag would look unknown
+		if pairs == nil {
+			var err error
+			pairs, err = partialTagPairs(bk.AllTagPairs(nil))
+			if err != nil {
+				return res, err
 			}
-			if i == len(allTagPairs)-1 {
-				return newPairs, fmt.Errorf(
+		}
+		if unknown := unknownTags(plaintags, pairs); len(unknown) > 0 {
+			return res, &UnknownTagsError{PlainTags: unknown}
+		}
+	}
+
+	// TODO: Call this in parallel with encryption below
+	newPairs, err := CreateTagsFromPlain(bk, plaintags, pairs)
+	res.NewPairs = newPairs
+	if err != nil {
+		return res, fmt.Errorf("Error from CreateNewTagsFromPlain: %v", err)
+	}
+
+	// plaintag -> random tag, preferring existing TagPairs
+	existing := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		if _, ok := existing[pair.Plain()]; !ok {
+			existing[pair.Plain()] = pair.Random
+		}
+	}
+	created := make(map[string]string, len(newPairs))
+	for _, pair := range newPairs {
+		created[pair.Plain()] = pair.Random
+	}
+
+	// Set row.RandomTags
+
+	seen := map[string]bool{}
+
+	for _, plain := range plaintags {
+		rand, reused := existing[plain]
+		if !reused {
+			var ok bool
+			if rand, ok = created[plain]; !ok {
+				return res, fmt.Errorf(
 					"No corresponding TagPair found for plain tag `%s`", plain)
 			}
 		}
+		res.RandomTags = append(res.RandomTags, rand)
+
+		if seen[plain] {
+			continue
+		}
+		seen[plain] = true
+
+		if reused {
+			res.ReusedPlainTags = append(res.ReusedPlainTags, plain)
+		} else {
+			res.CreatedPlainTags = append(res.CreatedPlainTags, plain)
+		}
+	}
+	res.RandomTags = canonicalRandomTags(res.RandomTags)
+	row.RandomTags = res.RandomTags
+
+	if PadTagsTo > 1 {
+		decoys, err := decoyTags(bk, len(res.RandomTags))
+		if err != nil {
+			return res, err
+		}
+		res.NewPairs = append(res.NewPairs, decoys...)
+		padded := append(append([]string{}, res.RandomTags...), decoys.AllRandom()...)
+		row.RandomTags = canonicalRandomTags(padded)
 	}
-	row.RandomTags = randtags
 
-	// Set row.Encrypted
+	// Set row.Encrypted, always with a fresh nonce
 
-	encData, err := cryptag.Encrypt(row.Decrypted(), row.Nonce, bk.Key())
+	plain, err := row.Plaintext()
 	if err != nil {
-		return newPairs, fmt.Errorf("Error encrypting data: %v", err)
+		return res, err
 	}
-	row.Encrypted = encData
 
-	return newPairs, nil
+	if err = row.EncryptPlaintext(plain, bk.RowKey()); err != nil {
+		return res, fmt.Errorf("Error encrypting data: %v", err)
+	}
+
+	// Set row.EncryptedSummary, with its own nonce
+
+	if summary := row.Summary(); len(summary) > 0 {
+		nonce, err := cryptag.RandomNonce()
+		if err != nil {
+			return res, err
+		}
+		encSummary, err := cryptag.Encrypt(summary, nonce, bk.RowKey())
+		if err != nil {
+			return res, fmt.Errorf("Error encrypting summary: %v", err)
+		}
+		row.EncryptedSummary = encSummary
+		row.SummaryNonce = nonce
+	}
+
+	return res, nil
+}
+
+// rebindRow sets row.RandomTags to randtags, re-encrypting row's data
+// (with a fresh nonce), since it's bound to row's random tags (see
+// types.Row.Plaintext)
+func rebindRow(bk Backend, row *types.Row, randtags []string) error {
+	if err := row.Decrypt(bk.RowKey()); err != nil {
+		return err
+	}
+	row.RandomTags = randtags
+
+	plain, err := row.Plaintext()
+	if err != nil {
+		return err
+	}
+
+	if err = row.EncryptPlaintext(plain, bk.RowKey()); err != nil {
+		return fmt.Errorf("Error encrypting data: %v", err)
+	}
+
+	return nil
+}
+
+// canonicalRandomTags sorts randtags in place and removes duplicates
+func canonicalRandomTags(randtags []string) []string {
+	sort.Strings(randtags)
+
+	uniq := randtags[:0]
+	for i, rand := range randtags {
+		if i == 0 || rand != randtags[i-1] {
+			uniq = append(uniq, rand)
+		}
+	}
+	return uniq
+}
+
+// withoutTag returns plaintags minus every occurrence of plain
+func withoutTag(plaintags []string, plain string) []string {
+	kept := make([]string, 0, len(plaintags))
+	for _, tag := range plaintags {
+		if tag != plain {
+			kept = append(kept, tag)
+		}
+	}
+	return kept
 }
@@ -0,0 +1,49 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cryptag/cryptag/types"
+)
+
+// BackendError is returned by FileSystem, Archive, WebserverBackend,
+// and DropboxRemote when one of their Backend methods fails, saying
+// which Backend and which method ("SaveRow", etc), so that failures
+// can be told apart when several Backends are in use.  Wrappers pass
+// it through as is, so it names the Backend that actually failed; use
+// errors.As to get at it through any further wrapping, and errors.Is
+// or errors.As to inspect Err.
+//
+// types.ErrRowsNotFound and types.ErrTagPairNotFound are returned as
+// is, since they report a result rather than a failure.
+type BackendError struct {
+	Backend string // Name of the Backend
+	Op      string // Name of the method that failed
+	Err     error
+}
+
+func (e *BackendError) Error() string {
+	return fmt.Sprintf("Error from %s on backend %s: %v", e.Op, e.Backend, e.Err)
+}
+
+func (e *BackendError) Unwrap() error {
+	return e.Err
+}
+
+// annotateErr sets *err to a *BackendError saying that bk's op method
+// returned it, unless it's nil, a not-found error, or already a
+// *BackendError.  Meant to be deferred.
+func annotateErr(err *error, bk Backend, op string) {
+	if *err == nil || *err == types.ErrRowsNotFound || *err == types.ErrTagPairNotFound {
+		return
+	}
+	var berr *BackendError
+	if errors.As(*err, &berr) {
+		return
+	}
+	*err = &BackendError{Backend: bk.Name(), Op: op, Err: *err}
+}
@@ -0,0 +1,60 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackendError(t *testing.T) {
+	fs, cleanup := newTestFileSystem(t)
+	defer cleanup()
+
+	mustCreateRow(t, fs, "saved", "tag")
+
+	// Make saving Rows fail
+	if err := os.RemoveAll(fs.rowsPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(fs.rowsPath, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Through a wrapper, the error still names the FileSystem
+	_, err := CreateRow(WithTimeout(fs, 5*time.Second), nil, []byte("lost"), []string{"tag"})
+
+	var berr *BackendError
+	if !errors.As(err, &berr) {
+		t.Fatalf("Expected *BackendError, got %v", err)
+	}
+	assert.Equal(t, fs.Name(), berr.Backend)
+	assert.Equal(t, "SaveRow", berr.Op)
+	assert.NotNil(t, errors.Unwrap(err))
+
+	// Not found isn't a failure
+	_, err = fs.RowsFromRandomTags([]string{"nonexistent"})
+	assert.Equal(t, types.ErrRowsNotFound, err)
+
+	// Decryption errors can still be told apart
+	key, err := cryptag.RandomKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs.SetTagKey(key)
+
+	_, err = fs.AllTagPairs(nil)
+	if !errors.As(err, &berr) {
+		t.Fatalf("Expected *BackendError, got %v", err)
+	}
+	assert.Equal(t, "AllTagPairs", berr.Op)
+	assert.True(t, types.IsWrongKey(err))
+}
@@ -0,0 +1,568 @@
+// Steve Phillips / elimisteve
+// 2017.04.03
+
+package backend
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	mathrand "math/rand"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// memBackend is the in-memory Backend most tests use
+type memBackend = MemoryBackend
+
+func newMemBackend(t testing.TB) *memBackend {
+	mb, err := NewMemoryBackend("", nil)
+	if err != nil {
+		t.Fatalf("Error from NewMemoryBackend: %v", err)
+	}
+	return mb
+}
+
+// plaintagsN returns n distinct plaintags of the form prefix0, prefix1, ...
+func plaintagsN(prefix string, n int) []string {
+	tags := make([]string, n)
+	for i := range tags {
+		tags[i] = fmt.Sprintf("%s%d", prefix, i)
+	}
+	return tags
+}
+
+// newPairsN creates TagPairs for n distinct plaintags without saving
+// them anywhere
+func newPairsN(tb testing.TB, key *[32]byte, prefix string, n int) types.TagPairs {
+	pairs := make(types.TagPairs, 0, n)
+	for _, plain := range plaintagsN(prefix, n) {
+		pair, err := NewTagPair(key, plain)
+		if err != nil {
+			tb.Fatalf("Error from NewTagPair: %v", err)
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs
+}
+
+func TestCreateTagsFromPlainLarge(t *testing.T) {
+	bk := newMemBackend(t)
+
+	existing := newPairsN(t, bk.Key(), "existing", 20000)
+
+	// Interleave existing and new tags; list one new tag twice
+	plaintags := []string{
+		"new0", "existing5", "new1", "existing19999", "new2", "new0",
+		"new3",
+	}
+
+	newPairs, err := CreateTagsFromPlain(bk, plaintags, existing)
+	if err != nil {
+		t.Fatalf("Error from CreateTagsFromPlain: %v", err)
+	}
+
+	assert.Equal(t, []string{"new0", "new1", "new2", "new3"},
+		newPairs.AllPlain())
+
+	saved, err := bk.AllTagPairs(nil)
+	if err != nil {
+		t.Fatalf("Error from AllTagPairs: %v", err)
+	}
+	assert.Equal(t, 4, len(saved))
+}
+
+func BenchmarkCreateTagsFromPlainExisting(b *testing.B) {
+	bk := newMemBackend(b)
+
+	// Worst case for the old O(n*m) check: every plaintag already
+	// exists, so nothing new is created and only the lookup is timed
+	pairs := newPairsN(b, bk.Key(), "tag", 20000)
+	plaintags := plaintagsN("tag", 20000)[19900:]
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := CreateTagsFromPlain(bk, plaintags, pairs); err != nil {
+			b.Fatalf("Error from CreateTagsFromPlain: %v", err)
+		}
+	}
+}
+
+func TestNewTagPairDeterministic(t *testing.T) {
+	bk := newMemBackend(t)
+
+	p1, err := NewTagPairDeterministic(bk.Key(), "project:cryptag")
+	if err != nil {
+		t.Fatalf("Error from NewTagPairDeterministic: %v", err)
+	}
+	p2, _ := NewTagPairDeterministic(bk.Key(), "project:cryptag")
+	p3, _ := NewTagPairDeterministic(bk.Key(), "project:other")
+
+	assert.Equal(t, p1.PlainEncrypted, p2.PlainEncrypted)
+	assert.NotEqual(t, p1.PlainEncrypted, p3.PlainEncrypted)
+
+	// Random tags remain random
+	assert.NotEqual(t, p1.Random, p2.Random)
+
+	// Off by default
+	r1, _ := NewTagPair(bk.Key(), "project:cryptag")
+	r2, _ := NewTagPair(bk.Key(), "project:cryptag")
+	assert.NotEqual(t, r1.PlainEncrypted, r2.PlainEncrypted)
+
+	DeterministicTagEncryption = true
+	defer func() { DeterministicTagEncryption = false }()
+
+	d1, _ := NewTagPair(bk.Key(), "project:cryptag")
+	assert.Equal(t, p1.PlainEncrypted, d1.PlainEncrypted)
+
+	// Decrypts like any other TagPair
+	saved := &types.TagPair{PlainEncrypted: d1.PlainEncrypted, Nonce: d1.Nonce}
+	if err = saved.Decrypt(bk.Key()); err != nil {
+		t.Fatalf("Error decrypting: %v", err)
+	}
+	assert.Equal(t, "project:cryptag", saved.Plain())
+}
+
+func TestPopulateRowBeforeSaveResult(t *testing.T) {
+	bk := newMemBackend(t)
+
+	var pairs types.TagPairs
+	for _, plain := range []string{"reused1", "reused2", "reused3"} {
+		pair, err := CreateTag(bk, plain)
+		if err != nil {
+			t.Fatalf("Error from CreateTag: %v", err)
+		}
+		pairs = append(pairs, pair)
+	}
+
+	row, err := types.NewRowSimple([]byte("data"),
+		[]string{"reused1", "new1", "reused2", "new2", "reused3", "new1"})
+	if err != nil {
+		t.Fatalf("Error from NewRowSimple: %v", err)
+	}
+
+	res, err := PopulateRowBeforeSaveResult(bk, row, pairs)
+	if err != nil {
+		t.Fatalf("Error from PopulateRowBeforeSaveResult: %v", err)
+	}
+
+	assert.Equal(t, []string{"reused1", "reused2", "reused3"}, res.ReusedPlainTags)
+	assert.Equal(t, []string{"new1", "new2"}, res.CreatedPlainTags)
+
+	assert.Equal(t, 2, len(res.NewPairs))
+	assert.Equal(t, "new1", res.NewPairs[0].Plain())
+	assert.Equal(t, "new2", res.NewPairs[1].Plain())
+
+	assert.Equal(t, row.RandomTags, res.RandomTags)
+
+	// Sorted and deduplicated
+	want := []string{pairs[0].Random, res.NewPairs[0].Random,
+		pairs[1].Random, res.NewPairs[1].Random, pairs[2].Random}
+	sort.Strings(want)
+	assert.Equal(t, want, res.RandomTags)
+
+	assert.NotEmpty(t, row.Encrypted)
+}
+
+func TestAddAllTag(t *testing.T) {
+	AddAllTag = true
+	defer func() { AddAllTag = false }()
+
+	bk := newMemBackend(t)
+
+	// NewRowSimple doesn't add "all", NewRow does; either way, each
+	// Row should end up with exactly one "all" tag
+	var pairs types.TagPairs
+	for _, data := range []string{"simple1", "simple2"} {
+		row, err := types.NewRowSimple([]byte(data), []string{"simple"})
+		if err != nil {
+			t.Fatalf("Error from NewRowSimple: %v", err)
+		}
+		res, err := PopulateRowBeforeSaveResult(bk, row, pairs)
+		if err != nil {
+			t.Fatalf("Error from PopulateRowBeforeSaveResult: %v", err)
+		}
+		pairs = append(pairs, res.NewPairs...)
+
+		assert.Equal(t, []string{"simple", AllTag}, row.PlainTags())
+		if err = bk.SaveRow(row); err != nil {
+			t.Fatalf("Error from SaveRow: %v", err)
+		}
+	}
+
+	row := mustCreateRow(t, bk, "full", "simple")
+	assert.Equal(t, 4, len(row.RandomTags), "Expected id, simple, created, all")
+
+	rows, err := ListAllRows(bk, nil)
+	if err != nil {
+		t.Fatalf("Error from ListAllRows: %v", err)
+	}
+	assert.Equal(t, 3, len(rows))
+
+	assert.Equal(t, []string{"full", "simple1", "simple2"}, rowData(t, bk, AllTag))
+}
+
+func TestSkipAllTag(t *testing.T) {
+	bk := newMemBackend(t)
+
+	mustCreateRow(t, bk, "public", "note")
+
+	private, err := CreatePrivateRow(bk, nil, []byte("private"), []string{"note", "secret"})
+	if err != nil {
+		t.Fatalf("Error from CreatePrivateRow: %v", err)
+	}
+	assert.False(t, private.HasPlainTag(AllTag))
+
+	assert.Equal(t, []string{"public"}, rowData(t, bk, AllTag))
+	assert.Equal(t, []string{"private"}, rowData(t, bk, "secret"))
+	assert.Equal(t, []string{"private", "public"}, rowData(t, bk, "note"))
+
+	rows, err := ListAllRows(bk, nil)
+	if err != nil {
+		t.Fatalf("Error from ListAllRows: %v", err)
+	}
+	assert.Equal(t, 1, len(rows))
+
+	// SkipAllTag wins over AddAllTag
+	AddAllTag = true
+	defer func() { AddAllTag = false }()
+
+	row, _ := types.NewRowSimple([]byte("also private"), []string{"secret"})
+	row.SkipAllTag = true
+	if _, err = PopulateRowBeforeSave(bk, row, nil); err != nil {
+		t.Fatalf("Error from PopulateRowBeforeSave: %v", err)
+	}
+	assert.Equal(t, []string{"secret"}, row.PlainTags())
+}
+
+func TestCanonicalRandomTags(t *testing.T) {
+	bk := newMemBackend(t)
+	pairs := createTags(t, bk, "c", "a", "b")
+
+	row1, _ := types.NewRowSimple([]byte("same"), []string{"a", "b", "c"})
+	row2, _ := types.NewRowSimple([]byte("same"), []string{"c", "a", "b", "a"})
+
+	for _, row := range []*types.Row{row1, row2} {
+		if _, err := PopulateRowBeforeSave(bk, row, pairs); err != nil {
+			t.Fatalf("Error from PopulateRowBeforeSave: %v", err)
+		}
+	}
+
+	assert.Equal(t, row1.RandomTags, row2.RandomTags)
+	assert.Equal(t, 3, len(row2.RandomTags))
+	assert.True(t, sort.StringsAreSorted(row1.RandomTags))
+}
+
+func TestPopulateRowFreshNonce(t *testing.T) {
+	bk := newMemBackend(t)
+
+	// Caller sets the same (zero) nonce on both Rows
+	var nonce [24]byte
+	var rows []*types.Row
+	for i := 0; i < 2; i++ {
+		row, _ := types.NewRowSimple([]byte("same"), []string{"nonce"})
+		row.Nonce = &nonce
+		if _, err := PopulateRowBeforeSave(bk, row, nil); err != nil {
+			t.Fatalf("Error from PopulateRowBeforeSave: %v", err)
+		}
+		rows = append(rows, row)
+	}
+
+	assert.NotEqual(t, nonce, *rows[0].Nonce)
+	assert.NotEqual(t, *rows[0].Nonce, *rows[1].Nonce)
+	assert.NotEqual(t, rows[0].Encrypted, rows[1].Encrypted)
+
+	// The nonce read back after populating decrypts the Row
+	saved := &types.Row{Encrypted: rows[1].Encrypted, RandomTags: rows[1].RandomTags,
+		Nonce: rows[1].Nonce}
+	if err := saved.Decrypt(bk.RowKey()); err != nil {
+		t.Fatalf("Error decrypting Row: %v", err)
+	}
+	assert.Equal(t, "same", string(saved.Decrypted()))
+}
+
+// substitutingBackend is a malicious memBackend that answers every
+// query with the whole stored record of row, tags and all
+type substitutingBackend struct {
+	*memBackend
+	row *types.Row
+}
+
+func (sb *substitutingBackend) RowsFromRandomTags(randtags cryptag.RandomTags) (types.Rows, error) {
+	row := *sb.row
+	return types.Rows{&row}, nil
+}
+
+func (sb *substitutingBackend) ListRows(randtags cryptag.RandomTags) (types.Rows, error) {
+	return sb.RowsFromRandomTags(randtags)
+}
+
+func TestRowSubstitutionDetected(t *testing.T) {
+	bk := newMemBackend(t)
+	mustCreateRow(t, bk, "row A", "a")
+	mustCreateRow(t, bk, "row B", "b")
+
+	// A malicious Backend answers a query on B's tags with A's record
+	sb := &substitutingBackend{memBackend: bk, row: bk.rows[0]}
+
+	rows, err := RowsFromPlainTags(sb, nil, []string{"b"})
+	rerr, ok := err.(*types.RowsError)
+	if !ok {
+		t.Fatalf("Expected *types.RowsError, got %v", err)
+	}
+	assert.Equal(t, types.ErrTagsMismatch, rerr.Errs[0])
+	assert.Empty(t, rows)
+
+	rows, err = ListRowsFromPlainTags(sb, nil, []string{"b"})
+	assert.IsType(t, &types.RowsError{}, err)
+	assert.Empty(t, rows)
+
+	pairs, err := bk.AllTagPairs(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches, err := pairs.WithAllPlainTags([]string{"b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = GetRawRow(sb, matches.AllRandom())
+	assert.Equal(t, types.ErrRowsNotFound, err)
+
+	// The honest Backend still returns B
+	assert.Equal(t, []string{"row B"}, rowData(t, bk, "b"))
+}
+
+// secondFails is a memBackend whose second SaveTagPair call fails
+type secondFails struct {
+	*memBackend
+	calls int32
+}
+
+func (sf *secondFails) SaveTagPair(pair *types.TagPair) error {
+	if atomic.AddInt32(&sf.calls, 1) == 2 {
+		return errors.New("second save fails")
+	}
+	return sf.memBackend.SaveTagPair(pair)
+}
+
+func TestCreateTagsFromPlainFailFast(t *testing.T) {
+	CreateTagsConcurrency = 1
+	defer func() { CreateTagsConcurrency = 0 }()
+
+	plaintags := plaintagsN("tag", 10)
+
+	// Best-effort: every tag but the failed one is created
+	bk := &secondFails{memBackend: newMemBackend(t)}
+
+	newPairs, err := CreateTagsFromPlain(bk, plaintags, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 9, len(newPairs))
+	assert.Equal(t, int32(10), atomic.LoadInt32(&bk.calls))
+
+	// Fail fast: stops at the failed tag
+	bk = &secondFails{memBackend: newMemBackend(t)}
+
+	newPairs, err = CreateTagsFromPlainFailFast(context.Background(), bk,
+		plaintags, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, len(newPairs))
+	assert.Equal(t, "tag0", newPairs[0].Plain())
+
+	// Give any stragglers a chance to (wrongly) run
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&bk.calls))
+}
+
+func TestEmptyRow(t *testing.T) {
+	fs, cleanup := newTestFileSystem(t)
+	defer cleanup()
+
+	for _, bk := range []Backend{newMemBackend(t), fs} {
+		for i, body := range [][]byte{nil, {}} {
+			marker := fmt.Sprintf("marker%d", i)
+
+			row, err := CreateRow(bk, nil, body, []string{marker})
+			if err != nil {
+				t.Fatalf("Error creating empty row on %s: %v", bk.Name(), err)
+			}
+			assert.NotNil(t, row.Decrypted())
+			assert.NotEqual(t, 0, len(row.Encrypted))
+
+			rows, err := RowsFromPlainTags(bk, nil, cryptag.PlainTags{marker})
+			if err != nil {
+				t.Fatalf("Error fetching empty row from %s: %v", bk.Name(), err)
+			}
+			assert.Equal(t, 1, len(rows))
+			assert.Equal(t, []byte{}, rows[0].Decrypted())
+			assert.True(t, rows[0].HasPlainTag(marker))
+		}
+
+		// Listed but not fetched, so no data
+		rows, err := ListRowsFromPlainTags(bk, nil, cryptag.PlainTags{"marker0"})
+		if err != nil {
+			t.Fatalf("Error listing empty row from %s: %v", bk.Name(), err)
+		}
+		assert.Nil(t, rows[0].Decrypted())
+	}
+}
+
+func TestNewTagPairSeeded(t *testing.T) {
+	origReader := TagRandReader
+	defer func() { TagRandReader = origReader }()
+
+	key := &[32]byte{1, 2, 3}
+
+	seeded := func(seed int64) *types.TagPair {
+		TagRandReader = mathrand.New(mathrand.NewSource(seed))
+		pair, err := NewTagPair(key, "project:cryptag")
+		if err != nil {
+			t.Fatalf("Error from NewTagPair: %v", err)
+		}
+		return pair
+	}
+
+	p1 := seeded(42)
+	p2 := seeded(42)
+	p3 := seeded(43)
+
+	assert.Equal(t, "l6tg72l1h", p1.Random)
+	assert.Equal(t, p1.Random, p2.Random)
+	assert.Equal(t, *p1.Nonce, *p2.Nonce)
+	assert.Equal(t, p1.PlainEncrypted, p2.PlainEncrypted)
+
+	assert.NotEqual(t, p1.Random, p3.Random)
+	assert.NotEqual(t, *p1.Nonce, *p3.Nonce)
+
+	// Random tags only use RANDOM_TAG_ALPHABET
+	assert.Equal(t, RANDOM_TAG_LENGTH, len(p3.Random))
+	assert.Equal(t, "", strings.Trim(p3.Random, RANDOM_TAG_ALPHABET))
+
+	// Keys stay random
+	TagRandReader = constReader(7)
+	k1, _ := cryptag.RandomKey()
+	k2, _ := cryptag.RandomKey()
+	assert.NotEqual(t, *k1, *k2)
+}
+
+// constReader is a stubbed RNG that always yields the same byte, so
+// every random tag it generates collides with the first
+type constReader byte
+
+func (cr constReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(cr)
+	}
+	return len(p), nil
+}
+
+func TestCreateTagCollisionRetries(t *testing.T) {
+	origReader := TagRandReader
+	defer func() { TagRandReader = origReader }()
+
+	bk := &countingBackend{memBackend: newMemBackend(t)}
+
+	TagRandReader = constReader(7)
+	first, err := CreateTag(bk, "first")
+	if err != nil {
+		t.Fatalf("Error from CreateTag: %v", err)
+	}
+
+	bk.reset()
+	_, err = CreateTag(bk, "second")
+	assert.Equal(t, ErrTagCollisionRetriesExhausted, err)
+	calls, _ := bk.counts()
+	assert.Equal(t, TagCollisionRetries+1, calls)
+	assert.Len(t, bk.pairs, 1)
+
+	// Colliding twice, then getting fresh randomness, succeeds
+	TagRandReader = io.MultiReader(
+		bytes.NewReader(bytes.Repeat([]byte{7}, 2*RANDOM_TAG_LENGTH+24)),
+		origReader)
+	_, err = CreateTag(bk, "first-again")
+	assert.Nil(t, err)
+
+	second, err := CreateTag(bk, "second")
+	if err != nil {
+		t.Fatalf("Error from CreateTag: %v", err)
+	}
+	assert.NotEqual(t, first.Random, second.Random)
+}
+
+func TestPopulateRowsBeforeSave(t *testing.T) {
+	bk := newMemBackend(t)
+	pairs := createTags(t, bk, "existing")
+
+	var rows types.Rows
+	for i := 0; i < 5; i++ {
+		row, _ := types.NewRow([]byte(fmt.Sprintf("row %d", i)),
+			[]string{"shared", "existing", fmt.Sprintf("own%d", i)})
+		rows = append(rows, row)
+	}
+
+	newPairs, err := PopulateRowsBeforeSave(bk, rows, pairs)
+	if err != nil {
+		t.Fatalf("Error from PopulateRowsBeforeSave: %v", err)
+	}
+
+	allPairs, _ := bk.AllTagPairs(nil)
+	count := func(plain string) int {
+		n := 0
+		for _, pair := range allPairs {
+			if pair.Plain() == plain {
+				n++
+			}
+		}
+		return n
+	}
+
+	// Shared new tags created once, existing ones reused
+	assert.Equal(t, 1, count("shared"))
+	assert.Equal(t, 1, count(AllTag))
+	assert.Equal(t, 1, count("existing"))
+	assert.Equal(t, 1, count("own3"))
+	assert.Equal(t, len(allPairs)-1, len(newPairs))
+
+	shared, _ := allPairs.WithAllPlainTags([]string{"shared"})
+	for _, row := range rows {
+		assert.True(t, row.HasRandomTag(shared[0].Random))
+		assert.NotEqual(t, 0, len(row.Encrypted))
+		if err = bk.SaveRow(row); err != nil {
+			t.Fatalf("Error saving row: %v", err)
+		}
+	}
+
+	assert.Equal(t, 5, len(rowData(t, bk, "shared", "existing")))
+	assert.Equal(t, []string{"row 2"}, rowData(t, bk, "own2"))
+}
+
+func TestRowsFromPlainTagsPartial(t *testing.T) {
+	bk := newMemBackend(t)
+
+	mustCreateRow(t, bk, "good one", "mixed")
+	mustCreateRow(t, bk, "bad one", "mixed")
+	mustCreateRow(t, bk, "good two", "mixed")
+
+	bk.rows[1].Encrypted[0] ^= 0xff
+
+	rows, err := RowsFromPlainTags(bk, nil, cryptag.PlainTags{"mixed"})
+	if _, ok := err.(*types.RowsError); !ok {
+		t.Fatalf("Expected *types.RowsError, got %v", err)
+	}
+
+	var data []string
+	for _, row := range rows {
+		data = append(data, string(row.Decrypted()))
+	}
+	sort.Strings(data)
+	assert.Equal(t, []string{"good one", "good two"}, data)
+}
@@ -0,0 +1,63 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/cryptag/cryptag"
+)
+
+var (
+	// ClockSkewWarning is how far off a server's clock can be from
+	// the local clock before SyncClock logs a warning.
+	ClockSkewWarning = 1 * time.Minute
+
+	ErrClockSkewUnsupported = errors.New("backend: Backend can't report clock skew")
+	ErrNoServerTime         = errors.New("backend: Server didn't report its time")
+)
+
+// ClockSkewer is implemented by (remote) Backends that can tell how far
+// the server's clock is from the local clock.
+type ClockSkewer interface {
+	// ClockSkew returns the server's clock minus the local clock
+	ClockSkew() (time.Duration, error)
+}
+
+// ClockSkew returns how far ahead of the local clock bk's server's
+// clock is (negative if it's behind), or ErrClockSkewUnsupported if
+// bk doesn't implement ClockSkewer (e.g., because it's local).
+func ClockSkew(bk Backend) (time.Duration, error) {
+	skewer, ok := bk.(ClockSkewer)
+	if !ok {
+		return 0, ErrClockSkewUnsupported
+	}
+	return skewer.ClockSkew()
+}
+
+// SyncClock sets cryptag.ClockOffset to bk's clock skew so that
+// cryptag.Now -- and therefore the created:... tags of new Rows --
+// agree with bk's server, logging a warning if the skew exceeds
+// ClockSkewWarning.  Returns the skew.
+//
+// The offset is process-wide, so when using several Backends, the
+// last one synced wins; sync only the one whose clock timestamps
+// should agree with (e.g., the primary of a ReplicaBackend).
+func SyncClock(bk Backend) (time.Duration, error) {
+	skew, err := ClockSkew(bk)
+	if err != nil {
+		return 0, err
+	}
+
+	if skew > ClockSkewWarning || -skew > ClockSkewWarning {
+		log.Printf("WARNING: Clock of backend %s is off from ours by %v\n",
+			bk.Name(), skew)
+	}
+
+	cryptag.SetClockOffset(skew)
+
+	return skew, nil
+}
@@ -0,0 +1,73 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cryptag/cryptag"
+	"github.com/stretchr/testify/assert"
+)
+
+// skewedServer returns a server whose clock is skew ahead of ours
+func skewedServer(skew time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Date", time.Now().Add(skew).UTC().Format(http.TimeFormat))
+		w.Write([]byte("[]"))
+	}))
+}
+
+func TestClockSkew(t *testing.T) {
+	for _, skew := range []time.Duration{time.Hour, -90 * time.Second, 0} {
+		srv := skewedServer(skew)
+
+		ws, err := NewWebserverBackend(nil, "skewed", srv.URL, "token")
+		if err != nil {
+			t.Fatalf("Error from NewWebserverBackend: %v", err)
+		}
+
+		got, err := ClockSkew(ws)
+		srv.Close()
+		if err != nil {
+			t.Fatalf("Error from ClockSkew: %v", err)
+		}
+
+		diff := got - skew
+		assert.True(t, -2*time.Second < diff && diff < 2*time.Second,
+			"Reported skew %v, expected about %v", got, skew)
+	}
+}
+
+func TestClockSkewUnsupported(t *testing.T) {
+	_, err := ClockSkew(newMemBackend(t))
+	assert.Equal(t, ErrClockSkewUnsupported, err)
+}
+
+func TestSyncClock(t *testing.T) {
+	srv := skewedServer(-time.Hour)
+	defer srv.Close()
+
+	defer cryptag.SetClockOffset(0)
+
+	ws, _ := NewWebserverBackend(nil, "skewed", srv.URL, "token")
+
+	// Recorded from an ordinary request
+	if _, err := ws.AllTagPairs(nil); err != nil {
+		t.Fatalf("Error from AllTagPairs: %v", err)
+	}
+
+	skew, err := SyncClock(ws)
+	if err != nil {
+		t.Fatalf("Error from SyncClock: %v", err)
+	}
+	assert.Equal(t, skew, cryptag.ClockOffset())
+
+	// Local clock now agrees with the server's
+	diff := cryptag.Now().Sub(time.Now().Add(-time.Hour))
+	assert.True(t, -2*time.Second < diff && diff < 2*time.Second,
+		"cryptag.Now() off from server's clock by %v", diff)
+}
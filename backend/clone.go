@@ -0,0 +1,73 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/cryptag/cryptag/types"
+	"github.com/elimisteve/fun"
+)
+
+// CloneRow saves a copy of src (which must already be populated; see
+// types.Row.Populate) as a new Row with its own id:... and
+// created:... tags and nonce, tagged with src's other plaintags plus
+// addTags minus removeTags.  src's summary and references (see
+// types.Row.SetReferences), if any, are copied too.
+// src itself is left untouched.  Useful for template Rows.
+func CloneRow(bk Backend, src *types.Row, addTags, removeTags []string) (*types.Row, error) {
+	if len(src.PlainTags()) == 0 {
+		return nil, errors.New("Row to clone must be populated first")
+	}
+
+	remove := normalizeTags(removeTags)
+	all := normalizeTag(AllTag)
+
+	var plaintags []string
+	for _, plain := range src.PlainTags() {
+		if strings.HasPrefix(plain, "id:") || strings.HasPrefix(plain, "created:") ||
+			plain == all || fun.SliceContains(remove, plain) {
+			continue
+		}
+		plaintags = append(plaintags, plain)
+	}
+	for _, plain := range normalizeTags(addTags) {
+		if !fun.SliceContains(remove, plain) && !fun.SliceContains(plaintags, plain) {
+			plaintags = append(plaintags, plain)
+		}
+	}
+
+	data := append([]byte{}, src.Decrypted()...)
+
+	clone, err := types.NewRow(data, plaintags)
+	if err != nil {
+		return nil, err
+	}
+
+	// Clones of Rows kept out of ListAllRows stay out of it
+	clone.SkipAllTag = all != "" && !src.HasPlainTag(all)
+
+	if summary := src.Summary(); len(summary) > 0 {
+		clone.SetSummary(append([]byte{}, summary...))
+	}
+	if refs := src.References(); len(refs) > 0 {
+		clone.SetReferences(append([]string{}, refs...))
+	}
+
+	pairs, err := bk.AllTagPairs(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = PopulateRowBeforeSave(bk, clone, pairs); err != nil {
+		return nil, err
+	}
+
+	if err = bk.SaveRow(clone); err != nil {
+		return nil, err
+	}
+
+	return clone, nil
+}
@@ -0,0 +1,112 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// userTags returns row's plaintags other than id:..., created:..., and
+// AllTag, sorted
+func userTags(plaintags []string) []string {
+	var tags []string
+	for _, plain := range plaintags {
+		if strings.HasPrefix(plain, "id:") || strings.HasPrefix(plain, "created:") ||
+			plain == AllTag {
+			continue
+		}
+		tags = append(tags, plain)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+func TestCloneRow(t *testing.T) {
+	bk := newMemBackend(t)
+
+	mustCreateRow(t, bk, "- [ ] Pack\n- [ ] Go", "template", "type:checklist")
+
+	rows, err := RowsFromPlainTags(bk, nil, cryptag.PlainTags{"template"})
+	if err != nil {
+		t.Fatalf("Error from RowsFromPlainTags: %v", err)
+	}
+	src := rows[0]
+	srcTags := append([]string{}, src.PlainTags()...)
+
+	clone, err := CloneRow(bk, src, []string{"trip:paris"}, []string{"template"})
+	if err != nil {
+		t.Fatalf("Error from CloneRow: %v", err)
+	}
+
+	// Original untouched
+	assert.Equal(t, srcTags, src.PlainTags())
+	assert.Equal(t, []string{"- [ ] Pack\n- [ ] Go"}, rowData(t, bk, "template"))
+
+	// Clone saved with its own identity
+	assert.Equal(t, []string{"- [ ] Pack\n- [ ] Go"}, rowData(t, bk, "trip:paris"))
+	assert.Equal(t, []string{"trip:paris", "type:checklist"},
+		userTags(clone.PlainTags()))
+	assert.NotEqual(t, src.Nonce, clone.Nonce)
+	assert.NotEqual(t, idTag(src.PlainTags()), idTag(clone.PlainTags()))
+	assert.True(t, clone.HasPlainTag(AllTag))
+
+	// Both exist
+	assert.Equal(t, 2, len(rowData(t, bk, "type:checklist")))
+}
+
+func idTag(plaintags []string) string {
+	for _, plain := range plaintags {
+		if strings.HasPrefix(plain, "id:") {
+			return plain
+		}
+	}
+	return ""
+}
+
+func TestCloneRowReferencesNormalized(t *testing.T) {
+	NormalizeTag = LowerTrimTag
+	defer func() { NormalizeTag = IdentityTag }()
+
+	origAll := AllTag
+	AllTag = "All"
+	defer func() { AllTag = origAll }()
+
+	bk := newMemBackend(t)
+	project := mustCreateRow(t, bk, "Launch the website", "type:project")
+	projectRef, err := RowRef(bk, project)
+	if err != nil {
+		t.Fatalf("Error from RowRef: %v", err)
+	}
+
+	src, _ := types.NewRow([]byte("Buy a domain"), []string{"template"})
+	src.SetReferences([]string{projectRef})
+	if _, err = PopulateRowBeforeSave(bk, src, nil); err != nil {
+		t.Fatalf("Error from PopulateRowBeforeSave: %v", err)
+	}
+	if err = bk.SaveRow(src); err != nil {
+		t.Fatalf("Error from SaveRow: %v", err)
+	}
+
+	clone, err := CloneRow(bk, src, []string{"copy"}, nil)
+	if err != nil {
+		t.Fatalf("Error from CloneRow: %v", err)
+	}
+	assert.Equal(t, []string{projectRef}, clone.References())
+
+	// src has the normalized AllTag, so the clone gets it too, once
+	assert.False(t, clone.SkipAllTag)
+	alls := 0
+	for _, plain := range clone.PlainTags() {
+		if plain == "all" {
+			alls++
+		}
+	}
+	assert.Equal(t, 1, alls)
+}
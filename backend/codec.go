@@ -0,0 +1,81 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Codec serializes the Rows, TagPairs, etc that a Backend persists.
+// Marshal and Unmarshal are called with pointers to []string values
+// and to structs whose fields are []byte, *[24]byte, string, and
+// []string values and whose names are given by their `json` struct
+// tags, so a Codec needn't support anything more.
+type Codec interface {
+	// Name is what Config.Custom["Codec"] is set to in order to
+	// select this Codec; see RegisterCodec
+	Name() string
+
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec is the default Codec, and the one used by Backends whose
+// Config doesn't name another.
+type JSONCodec struct{}
+
+func (JSONCodec) Name() string {
+	return "json"
+}
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// DefaultCodec is used by Backends whose Config doesn't name a Codec.
+var DefaultCodec Codec = JSONCodec{}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{
+		JSONCodec{}.Name(): JSONCodec{},
+	}
+)
+
+// RegisterCodec makes c selectable by setting Config.Custom["Codec"]
+// to c.Name(), replacing any Codec already registered by that name.
+func RegisterCodec(c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+
+	codecs[c.Name()] = c
+}
+
+// CodecByName returns the registered Codec named name.
+func CodecByName(name string) (Codec, error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	c, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown codec `%s`; see RegisterCodec", name)
+	}
+	return c, nil
+}
+
+// Codec returns the Codec named by conf.Custom["Codec"], or
+// DefaultCodec if it's unset.
+func (conf *Config) Codec() (Codec, error) {
+	name, _ := conf.Custom["Codec"].(string)
+	if name == "" {
+		return DefaultCodec, nil
+	}
+	return CodecByName(name)
+}
@@ -0,0 +1,310 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// msgpackCodec is a minimal MessagePack Codec supporting just what
+// Codec requires: structs (encoded as maps keyed by their `json`
+// field names), []byte and [N]byte (bin), strings (str), slices
+// (array), and nil pointers (nil)
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string {
+	return "msgpack"
+}
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := msgpackEncode(&buf, reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	r := bytes.NewReader(data)
+	if err := msgpackDecode(r, reflect.ValueOf(v)); err != nil {
+		return err
+	}
+	if r.Len() != 0 {
+		return fmt.Errorf("msgpack: %d trailing bytes", r.Len())
+	}
+	return nil
+}
+
+func msgpackField(f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if name == "" {
+		name = f.Name
+	}
+	return name
+}
+
+func msgpackHeader(buf *bytes.Buffer, fix, base byte, fixMax, n int) {
+	if n <= fixMax {
+		buf.WriteByte(fix | byte(n))
+		return
+	}
+	buf.WriteByte(base)
+	binary.Write(buf, binary.BigEndian, uint32(n))
+}
+
+func msgpackEncode(buf *bytes.Buffer, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			buf.WriteByte(0xc0)
+			return nil
+		}
+		return msgpackEncode(buf, v.Elem())
+	case reflect.Struct:
+		msgpackHeader(buf, 0x80, 0xdf, 15, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			msgpackEncode(buf, reflect.ValueOf(msgpackField(v.Type().Field(i))))
+			if err := msgpackEncode(buf, v.Field(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.String:
+		msgpackHeader(buf, 0xa0, 0xdb, 31, v.Len())
+		buf.WriteString(v.String())
+		return nil
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			if v.Kind() == reflect.Slice && v.IsNil() {
+				buf.WriteByte(0xc0)
+				return nil
+			}
+			buf.WriteByte(0xc6)
+			binary.Write(buf, binary.BigEndian, uint32(v.Len()))
+			for i := 0; i < v.Len(); i++ {
+				buf.WriteByte(byte(v.Index(i).Uint()))
+			}
+			return nil
+		}
+		msgpackHeader(buf, 0x90, 0xdd, 15, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if err := msgpackEncode(buf, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("msgpack: can't encode %v", v.Type())
+}
+
+// msgpackLength reads the length of the str, bin, map, or array whose
+// first byte is b
+func msgpackLength(r *bytes.Reader, b, fix, fixMask, base byte) (int, error) {
+	if fixMask != 0 && b&^fixMask == fix {
+		return int(b & fixMask), nil
+	}
+	if b != base {
+		return 0, fmt.Errorf("msgpack: unexpected type byte 0x%x", b)
+	}
+	var n uint32
+	err := binary.Read(r, binary.BigEndian, &n)
+	return int(n), err
+}
+
+func msgpackDecode(r *bytes.Reader, v reflect.Value) error {
+	if v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Ptr {
+		// Decoding into a pointer field
+		b, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b == 0xc0 {
+			v.Elem().Set(reflect.Zero(v.Elem().Type()))
+			return nil
+		}
+		r.UnreadByte()
+		if v.Elem().IsNil() {
+			v.Elem().Set(reflect.New(v.Elem().Type().Elem()))
+		}
+		return msgpackDecode(r, v.Elem())
+	}
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("msgpack: can't decode into non-pointer %v", v.Type())
+	}
+	v = v.Elem()
+
+	b, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		n, err := msgpackLength(r, b, 0x80, 0x0f, 0xdf)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			var name string
+			if err = msgpackDecode(r, reflect.ValueOf(&name)); err != nil {
+				return err
+			}
+			found := false
+			for j := 0; j < v.NumField(); j++ {
+				if msgpackField(v.Type().Field(j)) == name {
+					found = true
+					err = msgpackDecode(r, v.Field(j).Addr())
+					break
+				}
+			}
+			if err != nil {
+				return err
+			}
+			if !found {
+				return fmt.Errorf("msgpack: unknown field `%s`", name)
+			}
+		}
+		return nil
+	case reflect.String:
+		n, err := msgpackLength(r, b, 0xa0, 0x1f, 0xdb)
+		if err != nil {
+			return err
+		}
+		s := make([]byte, n)
+		if _, err = io.ReadFull(r, s); err != nil {
+			return err
+		}
+		v.SetString(string(s))
+		return nil
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			if b == 0xc0 {
+				v.Set(reflect.Zero(v.Type()))
+				return nil
+			}
+			n, err := msgpackLength(r, b, 0, 0, 0xc6)
+			if err != nil {
+				return err
+			}
+			data := make([]byte, n)
+			if _, err = io.ReadFull(r, data); err != nil {
+				return err
+			}
+			if v.Kind() == reflect.Slice {
+				v.SetBytes(data)
+				return nil
+			}
+			if n != v.Len() {
+				return fmt.Errorf("msgpack: can't decode %d bytes into %v", n, v.Type())
+			}
+			reflect.Copy(v, reflect.ValueOf(data))
+			return nil
+		}
+		n, err := msgpackLength(r, b, 0x90, 0x0f, 0xdd)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.MakeSlice(v.Type(), n, n))
+		for i := 0; i < n; i++ {
+			if err = msgpackDecode(r, v.Index(i).Addr()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("msgpack: can't decode into %v", v.Type())
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	RegisterCodec(msgpackCodec{})
+
+	for _, codec := range []Codec{DefaultCodec, msgpackCodec{}} {
+		fs, cleanup := newTestFileSystem(t)
+		defer cleanup()
+		fs.codec = codec
+		fs.hashFilenames = true
+
+		mustCreateSummaryRow(t, fs, "sum", "first", "tag:a", "tag:b")
+		mustCreateRow(t, fs, "second", "tag:a")
+
+		tagFile, err := ioutil.ReadFile(path.Join(fs.tagsPath, pairsRandom(t, fs, "tag:a")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if codec == DefaultCodec {
+			assert.Equal(t, byte('{'), tagFile[0])
+		} else {
+			assert.Equal(t, byte(0x82), tagFile[0], "Tag file should be a 2-entry msgpack map")
+		}
+
+		// Reopen from the saved Config, which must name the Codec
+		conf, err := fs.ToConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := conf.Codec()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, codec.Name(), got.Name())
+
+		reopened, err := NewFileSystem(conf)
+		if err != nil {
+			t.Fatalf("Error from NewFileSystem: %v", err)
+		}
+
+		assert.Equal(t, []string{"first", "second"}, rowData(t, reopened, "tag:a"))
+		assert.Equal(t, []string{"first"}, rowData(t, reopened, "tag:b"))
+
+		rows, err := reopened.ListRowSummaries([]string{pairsRandom(t, reopened, "tag:b")})
+		if err != nil {
+			t.Fatalf("Error from ListRowSummaries: %v", err)
+		}
+		if err = rows[0].DecryptSummary(reopened.RowKey()); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "sum", string(rows[0].Summary()))
+
+		report, err := FsckFilesystem(reopened)
+		if err != nil {
+			t.Fatalf("Error from FsckFilesystem: %v", err)
+		}
+		assert.Equal(t, 2, report.Rows)
+		assert.Empty(t, report.Orphaned)
+	}
+}
+
+func TestCodecMismatch(t *testing.T) {
+	fs, cleanup := newTestFileSystem(t)
+	defer cleanup()
+	fs.codec = msgpackCodec{}
+
+	mustCreateRow(t, fs, "data", "tag:a")
+
+	// Files written by one Codec can't be read by another
+	fs.codec = DefaultCodec
+	_, err := fs.AllTagPairs(nil)
+	assert.NotNil(t, err)
+}
+
+func TestConfigCodec(t *testing.T) {
+	conf := &Config{}
+	codec, err := conf.Codec()
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultCodec, codec)
+
+	conf.Custom = map[string]interface{}{"Codec": "no-such-codec"}
+	_, err = conf.Codec()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,55 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/cryptag/cryptag/types"
+)
+
+var ErrConflict = errors.New("backend: Row was modified since it was read")
+
+// conditionalSaveMu keeps SaveRowIfUnchanged calls in this process
+// from interleaving their checks and saves
+var conditionalSaveMu sync.Mutex
+
+// RowChecksum returns the checksum of row's encrypted data, as stored
+// in a Backend, for passing to SaveRowIfUnchanged.  Every save of a
+// Row encrypts it with a new nonce, so the checksum changes with every
+// save, even of the same data.
+func RowChecksum(row *types.Row) string {
+	return checksum(row.Encrypted, row.Nonce)
+}
+
+// SaveRowIfUnchanged saves row, which must be ready to save (see
+// PopulateRowBeforeSave), only if the Row stored in bk with the same
+// random tags still has the checksum expectedChecksum (see
+// RowChecksum), e.g. the one it had when it was read for editing.
+// An empty expectedChecksum means no such Row may exist yet.  Returns
+// ErrConflict, without saving, if the stored Row has changed.
+//
+// Saves made through SaveRowIfUnchanged in this process can't
+// interleave, but bk has no way to check and save in one step, so a
+// write by another client in between can still be overwritten.
+func SaveRowIfUnchanged(bk Backend, row *types.Row, expectedChecksum string) error {
+	conditionalSaveMu.Lock()
+	defer conditionalSaveMu.Unlock()
+
+	actual := ""
+	stored, err := rowByKey(bk, rowKey(row))
+	if err != nil && err != types.ErrRowsNotFound {
+		return err
+	}
+	if err == nil {
+		actual = RowChecksum(stored)
+	}
+
+	if actual != expectedChecksum {
+		return ErrConflict
+	}
+
+	return bk.SaveRow(row)
+}
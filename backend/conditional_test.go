@@ -0,0 +1,75 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"testing"
+
+	"github.com/cryptag/cryptag/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// editedRow returns a Row with row's tags and data as its data, ready
+// to save
+func editedRow(t *testing.T, bk Backend, row *types.Row, data string) *types.Row {
+	edited, err := types.NewRowSimple([]byte(data), row.PlainTags())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pairs, err := bk.AllTagPairs(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = PopulateRowBeforeSave(bk, edited, pairs); err != nil {
+		t.Fatalf("Error from PopulateRowBeforeSave: %v", err)
+	}
+	assert.Equal(t, row.RandomTags, edited.RandomTags)
+	return edited
+}
+
+func TestSaveRowIfUnchanged(t *testing.T) {
+	fs, cleanup := newTestFileSystem(t)
+	defer cleanup()
+
+	row := mustCreateRow(t, fs, "v1", "type:note")
+	sum := RowChecksum(row)
+
+	// Two clients read the same version and edit it
+	mine := editedRow(t, fs, row, "mine")
+	theirs := editedRow(t, fs, row, "theirs")
+
+	// They save first
+	if err := SaveRowIfUnchanged(fs, theirs, sum); err != nil {
+		t.Fatalf("Error from SaveRowIfUnchanged: %v", err)
+	}
+
+	// So my save, based on the version before theirs, fails
+	assert.Equal(t, ErrConflict, SaveRowIfUnchanged(fs, mine, sum))
+	assert.Equal(t, []string{"theirs"}, rowData(t, fs, "type:note"))
+
+	// Until I start from their version
+	assert.Nil(t, SaveRowIfUnchanged(fs, mine, RowChecksum(theirs)))
+	assert.Equal(t, []string{"mine"}, rowData(t, fs, "type:note"))
+}
+
+func TestSaveRowIfUnchangedNew(t *testing.T) {
+	fs, cleanup := newTestFileSystem(t)
+	defer cleanup()
+
+	row := mustCreateRow(t, fs, "v1", "type:note")
+
+	// "" means the Row mustn't exist yet
+	edited := editedRow(t, fs, row, "v2")
+	assert.Equal(t, ErrConflict, SaveRowIfUnchanged(fs, edited, ""))
+
+	created, err := types.NewRowSimple([]byte("new"), []string{"type:other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = PopulateRowBeforeSave(fs, created, nil); err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, SaveRowIfUnchanged(fs, created, ""))
+	assert.Equal(t, []string{"new"}, rowData(t, fs, "type:other"))
+}
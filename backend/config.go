@@ -34,10 +34,13 @@ type Config struct {
 	Type     string // Should be one of: backend.Type*
 	New      bool   `json:"-"`
 	Key      *[32]byte
+	TagKey   *[32]byte `json:",omitempty"` // Encrypts TagPairs, if set; see TagKeySetter
 	Local    bool
 	DataPath string // Used by backend.FileSystem, other local backends
 
 	Custom map[string]interface{} `json:",omitempty"` // Used by Dropbox, Webserver, other backends
+
+	HTTP *HTTPConfig `json:",omitempty"` // Used by Dropbox, Webserver, other HTTP-based backends
 }
 
 // Save persists this config to disk.  Returns error if a Config
@@ -143,6 +146,11 @@ func (conf *Config) Canonicalize() error {
 		// Save data to ~/.cryptag/backends/${conf.Name}/{rows,tags}
 		conf.DataPath = path.Join(cryptag.LocalDataPath, "backends", conf.Name)
 	}
+	if conf.GetType() == TypeArchive && conf.DataPath == "" {
+		// Save data to ~/.cryptag/backends/${conf.Name}.archive
+		conf.DataPath = path.Join(cryptag.LocalDataPath, "backends",
+			conf.Name+".archive")
+	}
 	conf.DataPath = strings.TrimRight(conf.DataPath, "/\\")
 
 	return nil
@@ -185,7 +193,7 @@ func (conf *Config) GetPath() string {
 	switch typ {
 	case TypeDropboxRemote:
 		return fmt.Sprintf("%s", conf.Custom["BasePath"])
-	case TypeFileSystem:
+	case TypeFileSystem, TypeArchive:
 		return conf.DataPath
 	case TypeWebserver:
 		return fmt.Sprintf("%s", conf.Custom["BaseURL"])
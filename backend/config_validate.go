@@ -0,0 +1,167 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/elimisteve/fun"
+)
+
+// ConfigError lists every problem ValidateConfig found with a Config.
+type ConfigError struct {
+	Name     string
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("Backend config `%s` is invalid: %s", e.Name,
+		strings.Join(e.Problems, "; "))
+}
+
+// ValidateConfig checks that cfg is well-formed -- a non-zero key, a
+// known type, a well-formed URL, credentials, and so on -- without
+// creating the Backend or touching the disk or network, so that a
+// misconfiguration is reported clearly rather than as a cryptic error
+// partway through some later call.  Returns a *ConfigError listing
+// every problem found, or nil.
+//
+// Only syntax is checked, so that, e.g., a FileSystem Backend in a
+// read-only directory can still be loaded and read from; call
+// CheckConfigWritable before writing.  Unlike Canonicalize,
+// ValidateConfig doesn't fill anything in, so it's meant for existing
+// Configs (LoadBackend calls it), not ones about to be created.
+func ValidateConfig(cfg *Config) error {
+	cerr := &ConfigError{Name: cfg.Name}
+	problem := func(format string, args ...interface{}) {
+		cerr.Problems = append(cerr.Problems, fmt.Sprintf(format, args...))
+	}
+
+	if cfg.Name == "" {
+		problem("Name can't be empty")
+	} else if fun.ContainsAnyStrings(cfg.Name, " ", "\t", "\r", "\n") {
+		problem("Name `%s` can't contain whitespace", cfg.Name)
+	}
+
+	if cfg.Key == nil || *cfg.Key == [32]byte{} {
+		problem("Key must be set to a non-zero 32-byte key")
+	}
+	if cfg.TagKey != nil && *cfg.TagKey == [32]byte{} {
+		problem("TagKey, if set, must be non-zero")
+	}
+
+	typ := cfg.GetType()
+	if typ == "" {
+		problem("Type is missing and can't be inferred")
+	} else if _, err := GetMaker(typ); err != nil {
+		problem("Type `%s` isn't a known Backend type", typ)
+	}
+
+	switch typ {
+	case TypeWebserver:
+		baseURL, _ := cfg.Custom["BaseURL"].(string)
+		if err := checkURL(baseURL); err != nil {
+			problem("Custom.BaseURL: %v", err)
+		}
+
+	case TypeSandstorm:
+		webkey, _ := cfg.Custom["WebKey"].(string)
+		info := strings.SplitN(webkey, "#", 2)
+		if len(info) < 2 || info[1] == "" {
+			problem("Custom.WebKey must be of the form https://...#token")
+		} else if err := checkURL(info[0]); err != nil {
+			problem("Custom.WebKey: %v", err)
+		}
+
+	case TypeDropboxRemote:
+		for _, field := range []string{"AppKey", "AppSecret", "AccessToken", "BasePath"} {
+			if s, _ := cfg.Custom[field].(string); s == "" {
+				problem("Custom.%s can't be empty", field)
+			}
+		}
+	}
+
+	if len(cerr.Problems) > 0 {
+		return cerr
+	}
+	return nil
+}
+
+// CheckConfigWritable checks that the Backend cfg describes can be
+// saved to, which for local Backends means that the directory its data
+// is in (or will be created in) is writable.  Call it before writing
+// to a Backend, e.g. before importing into it; remote Backends aren't
+// checked, so nil is returned for them.  Returns a *ConfigError, or
+// nil.
+func CheckConfigWritable(cfg *Config) error {
+	var dir string
+	switch cfg.GetType() {
+	case TypeFileSystem:
+		dir = cfg.DataPath
+	case TypeArchive:
+		if cfg.DataPath != "" {
+			dir = filepath.Dir(cfg.DataPath)
+		}
+	}
+	if dir == "" {
+		return nil
+	}
+
+	if err := checkWritableDir(dir); err != nil {
+		return &ConfigError{Name: cfg.Name,
+			Problems: []string{fmt.Sprintf("DataPath: %v", err)}}
+	}
+	return nil
+}
+
+// checkURL returns an error unless rawurl is an absolute http(s) URL
+func checkURL(rawurl string) error {
+	if rawurl == "" {
+		return fmt.Errorf("URL can't be empty")
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("`%s` isn't an http or https URL", rawurl)
+	}
+	return nil
+}
+
+// checkWritableDir returns an error unless dir, or (if dir doesn't
+// exist yet) the nearest of its parents that does, is a directory
+// that files can be created in
+func checkWritableDir(dir string) error {
+	for {
+		info, err := os.Stat(dir)
+		if os.IsNotExist(err) {
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				return err
+			}
+			dir = parent
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("`%s` isn't a directory", dir)
+		}
+		break
+	}
+
+	f, err := ioutil.TempFile(dir, ".cryptag-write-test-")
+	if err != nil {
+		return fmt.Errorf("`%s` isn't writable: %v", dir, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
@@ -0,0 +1,145 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/cryptag/cryptag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cryptag-test-")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	notDir := path.Join(dir, "file")
+	if err = ioutil.WriteFile(notDir, nil, 0600); err != nil {
+		t.Fatalf("Error creating file: %v", err)
+	}
+
+	key, _ := cryptag.RandomKey()
+	var zeroKey [32]byte
+
+	// Valid
+	for _, cfg := range []*Config{
+		{Name: "fs", Type: TypeFileSystem, Key: key,
+			DataPath: path.Join(dir, "not", "created", "yet")},
+		{Name: "ar", Type: TypeArchive, Key: key,
+			DataPath: path.Join(dir, "x.archive")},
+		{Name: "web", Type: TypeWebserver, Key: key, Custom: map[string]interface{}{
+			"AuthToken": "token", "BaseURL": "https://example.com/cryptag"}},
+		{Name: "sand", Type: TypeSandstorm, Key: key, Custom: map[string]interface{}{
+			"WebKey": "https://api-abc.example.com#token"}},
+
+		// Writability isn't checked; see CheckConfigWritable
+		{Name: "fsfile", Type: TypeFileSystem, Key: key,
+			DataPath: path.Join(notDir, "data")},
+
+		// Nor is an AuthToken required
+		{Name: "webnotoken", Type: TypeWebserver, Key: key, Custom: map[string]interface{}{
+			"BaseURL": "https://example.com/cryptag"}},
+	} {
+		assert.Nil(t, ValidateConfig(cfg), cfg.Name)
+	}
+
+	tests := []struct {
+		cfg      *Config
+		problems int
+	}{
+		{&Config{Name: "", Type: TypeFileSystem, Key: key}, 1},
+		{&Config{Name: "has space", Type: TypeFileSystem, Key: key}, 1},
+		{&Config{Name: "nokey", Type: TypeFileSystem}, 1},
+		{&Config{Name: "zerokey", Type: TypeFileSystem, Key: &zeroKey}, 1},
+		{&Config{Name: "zerotagkey", Type: TypeFileSystem, Key: key, TagKey: &zeroKey}, 1},
+		{&Config{Name: "notype", Key: key}, 1},
+		{&Config{Name: "badtype", Type: "floppy", Key: key}, 1},
+		{&Config{Name: "webempty", Type: TypeWebserver, Key: key}, 1},
+		{&Config{Name: "webscheme", Type: TypeWebserver, Key: key,
+			Custom: map[string]interface{}{"AuthToken": "t", "BaseURL": "ftp://example.com"}}, 1},
+		{&Config{Name: "webnohost", Type: TypeWebserver, Key: key,
+			Custom: map[string]interface{}{"AuthToken": "t", "BaseURL": "example.com/path"}}, 1},
+		{&Config{Name: "sandnotoken", Type: TypeSandstorm, Key: key,
+			Custom: map[string]interface{}{"WebKey": "https://api.example.com"}}, 1},
+		{&Config{Name: "dropbox", Type: TypeDropboxRemote, Key: key,
+			Custom: map[string]interface{}{"AppKey": "k", "BasePath": "/cryptag"}}, 2},
+
+		// Every problem is reported at once
+		{&Config{Name: "all wrong", Type: TypeWebserver, Key: &zeroKey,
+			Custom: map[string]interface{}{"BaseURL": "::"}}, 3},
+	}
+
+	for _, tt := range tests {
+		err := ValidateConfig(tt.cfg)
+		cerr, ok := err.(*ConfigError)
+		if !ok {
+			t.Errorf("%s: expected *ConfigError, got %v", tt.cfg.Name, err)
+			continue
+		}
+		assert.Equal(t, tt.problems, len(cerr.Problems),
+			"%s: %q", tt.cfg.Name, cerr.Problems)
+	}
+}
+
+func TestCheckConfigWritable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cryptag-test-")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	notDir := path.Join(dir, "file")
+	if err = ioutil.WriteFile(notDir, nil, 0600); err != nil {
+		t.Fatalf("Error creating file: %v", err)
+	}
+
+	key, _ := cryptag.RandomKey()
+
+	for _, cfg := range []*Config{
+		{Name: "fs", Type: TypeFileSystem, Key: key,
+			DataPath: path.Join(dir, "not", "created", "yet")},
+		{Name: "ar", Type: TypeArchive, Key: key,
+			DataPath: path.Join(dir, "x.archive")},
+		{Name: "web", Type: TypeWebserver, Key: key, Custom: map[string]interface{}{
+			"BaseURL": "https://example.com/cryptag"}},
+	} {
+		assert.Nil(t, CheckConfigWritable(cfg), cfg.Name)
+	}
+
+	for _, cfg := range []*Config{
+		{Name: "fsfile", Type: TypeFileSystem, Key: key,
+			DataPath: path.Join(notDir, "data")},
+		{Name: "arfile", Type: TypeArchive, Key: key,
+			DataPath: path.Join(notDir, "x.archive")},
+	} {
+		_, ok := CheckConfigWritable(cfg).(*ConfigError)
+		assert.True(t, ok, cfg.Name)
+	}
+}
+
+func TestLoadBackendWebserverNoAuthToken(t *testing.T) {
+	backendPath, err := ioutil.TempDir("", "cryptag-test-")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(backendPath)
+
+	key, _ := cryptag.RandomKey()
+
+	web := &Config{Name: "web", Type: TypeWebserver, Key: key,
+		Custom: map[string]interface{}{"AuthToken": "",
+			"BaseURL": "https://example.com/cryptag"}}
+	if err = web.Save(backendPath); err != nil {
+		t.Fatalf("Error saving config: %v", err)
+	}
+
+	_, err = LoadBackend(backendPath, "web")
+	assert.Nil(t, err)
+}
@@ -0,0 +1,68 @@
+// Steve Phillips / elimisteve
+// 2017.04.12
+
+package backend
+
+import (
+	"time"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/rowutil"
+	"github.com/cryptag/cryptag/types"
+)
+
+// DateField is the prefix of the plaintag holding the timestamp (in
+// cryptag.TimeStr format) that ListRowsByDateRange filters by.
+type DateField string
+
+const (
+	// DateCreated is when a Row was created.  Updating a Row (see
+	// UpdateRow) creates a new version with its own "created:..."
+	// tag, so for versioned Rows this is also when it was last
+	// modified.
+	DateCreated DateField = "created:"
+
+	// DateModified is when a Row was last touched (see TouchRow).
+	DateModified DateField = "modified:"
+)
+
+// ListRowsByDateRange lists the Rows tagged with all of randtags whose
+// field timestamp is at or after from and before to.  Timestamps are
+// encrypted plaintags, so the filtering happens client-side, after
+// decryption.  Rows lacking a (valid) field timestamp are skipped.
+func ListRowsByDateRange(bk Backend, randtags cryptag.RandomTags, from, to time.Time, field DateField) (types.Rows, error) {
+	rows, err := listRows(bk, randtags)
+	if err != nil {
+		return nil, err
+	}
+
+	pairs, err := bk.AllTagPairs(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = rows.Populate(bk.RowKey(), pairs); err != nil {
+		return nil, err
+	}
+
+	var inRange types.Rows
+	for _, row := range rows {
+		ts := rowutil.TagWithPrefixStripped(row, string(field))
+		if ts == "" {
+			continue
+		}
+		t, err := cryptag.ParseTimeStr(ts)
+		if err != nil {
+			continue
+		}
+		if !t.Before(from) && t.Before(to) {
+			inRange = append(inRange, row)
+		}
+	}
+
+	if len(inRange) == 0 {
+		return nil, types.ErrRowsNotFound
+	}
+
+	return inRange, nil
+}
@@ -0,0 +1,81 @@
+// Steve Phillips / elimisteve
+// 2017.04.12
+
+package backend
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/rowutil"
+	"github.com/cryptag/cryptag/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListRowsByDateRange(t *testing.T) {
+	bk := newMemBackend(t)
+
+	monday := time.Date(2017, 4, 10, 0, 0, 0, 0, time.UTC)
+	today := time.Date(2017, 4, 12, 0, 0, 0, 0, time.UTC)
+
+	created := map[string]time.Time{
+		"sunday":       monday.Add(-24 * time.Hour),
+		"just before":  monday.Add(-time.Nanosecond),
+		"monday":       monday,
+		"tuesday":      monday.Add(24 * time.Hour),
+		"just in time": today.Add(-time.Nanosecond),
+		"today":        today,
+	}
+
+	var pairs types.TagPairs
+	for data, ts := range created {
+		row, err := types.NewRowSimple([]byte(data),
+			[]string{"log", "created:" + cryptag.TimeStr(ts)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := PopulateRowBeforeSaveResult(bk, row, pairs)
+		if err != nil {
+			t.Fatalf("Error from PopulateRowBeforeSaveResult: %v", err)
+		}
+		pairs = append(pairs, res.NewPairs...)
+		if err = bk.SaveRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Not timestamped
+	row, _ := types.NewRowSimple([]byte("undated"), []string{"log"})
+	if _, err := PopulateRowBeforeSave(bk, row, pairs); err != nil {
+		t.Fatal(err)
+	}
+	bk.SaveRow(row)
+
+	pairs, _ = bk.AllTagPairs(nil)
+	logTag, _ := pairs.WithAllPlainTags([]string{"log"})
+
+	rows, err := ListRowsByDateRange(bk, logTag.AllRandom(), monday, today,
+		DateCreated)
+	if err != nil {
+		t.Fatalf("Error from ListRowsByDateRange: %v", err)
+	}
+
+	// From is inclusive, to is exclusive
+	var got []string
+	for _, row := range rows {
+		got = append(got, rowutil.TagWithPrefixStripped(row, "created:"))
+	}
+	sort.Strings(got)
+
+	assert.Equal(t, []string{
+		cryptag.TimeStr(created["monday"]),
+		cryptag.TimeStr(created["tuesday"]),
+		cryptag.TimeStr(created["just in time"]),
+	}, got)
+
+	_, err = ListRowsByDateRange(bk, logTag.AllRandom(), today.Add(time.Hour),
+		today.Add(2*time.Hour), DateCreated)
+	assert.Equal(t, types.ErrRowsNotFound, err)
+}
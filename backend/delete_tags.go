@@ -0,0 +1,70 @@
+// Steve Phillips / elimisteve
+// 2017.04.16
+
+package backend
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cryptag/cryptag/types"
+)
+
+// TagPairsDeleter is implemented by Backends that can delete many
+// TagPairs more efficiently than one at a time.  Implementations
+// should return a *DeleteTagPairsError if only some deletions fail.
+type TagPairsDeleter interface {
+	DeleteTagPairs(pairs types.TagPairs) error
+}
+
+// DeleteTagPairsError reports which TagPairs DeleteTagPairs failed to
+// delete.
+type DeleteTagPairsError struct {
+	// Failed maps the random tag of each TagPair that wasn't deleted
+	// to why
+	Failed map[string]error
+}
+
+func (e *DeleteTagPairsError) Error() string {
+	var failed []string
+	for random, err := range e.Failed {
+		failed = append(failed, fmt.Sprintf("%s (%v)", random, err))
+	}
+	sort.Strings(failed)
+	return fmt.Sprintf("Error deleting %d TagPair(s): %s", len(failed),
+		strings.Join(failed, ", "))
+}
+
+// DeleteTagPairs deletes every TagPair in pairs from bk, all at once
+// if bk implements TagPairsDeleter, otherwise one at a time with
+// TagPairDeleter (returning ErrCannotDeleteTagPairs if bk implements
+// neither).  When deleting one at a time, a failure doesn't stop the
+// remaining TagPairs from being deleted; every failure is reported in
+// the returned *DeleteTagPairsError.
+func DeleteTagPairs(bk Backend, pairs types.TagPairs) error {
+	if len(pairs) == 0 {
+		return nil
+	}
+
+	if batcher, ok := bk.(TagPairsDeleter); ok {
+		return batcher.DeleteTagPairs(pairs)
+	}
+
+	deleter, ok := bk.(TagPairDeleter)
+	if !ok {
+		return ErrCannotDeleteTagPairs
+	}
+
+	failed := map[string]error{}
+	for _, pair := range pairs {
+		if err := deleter.DeleteTagPair(pair.Random); err != nil {
+			failed[pair.Random] = err
+		}
+	}
+
+	if len(failed) > 0 {
+		return &DeleteTagPairsError{Failed: failed}
+	}
+	return nil
+}
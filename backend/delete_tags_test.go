@@ -0,0 +1,93 @@
+// Steve Phillips / elimisteve
+// 2017.04.16
+
+package backend
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cryptag/cryptag/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubbornBackend refuses to delete one TagPair
+type stubbornBackend struct {
+	*memBackend
+	keep string
+}
+
+var errStubborn = errors.New("won't delete")
+
+func (sb *stubbornBackend) DeleteTagPair(random string) error {
+	if random == sb.keep {
+		return errStubborn
+	}
+	return sb.memBackend.DeleteTagPair(random)
+}
+
+// batchBackend deletes TagPairs in batches
+type batchBackend struct {
+	*memBackend
+	batches int
+}
+
+func (bb *batchBackend) DeleteTagPairs(pairs types.TagPairs) error {
+	bb.batches++
+	for _, pair := range pairs {
+		if err := bb.memBackend.DeleteTagPair(pair.Random); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func createTags(t testing.TB, bk Backend, plaintags ...string) types.TagPairs {
+	var pairs types.TagPairs
+	for _, plain := range plaintags {
+		pair, err := CreateTag(bk, plain)
+		if err != nil {
+			t.Fatalf("Error from CreateTag: %v", err)
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs
+}
+
+func TestDeleteTagPairsOneFailure(t *testing.T) {
+	mem := newMemBackend(t)
+	pairs := createTags(t, mem, plaintagsN("stale", 5)...)
+	createTags(t, mem, "fresh")
+
+	bk := &stubbornBackend{memBackend: mem, keep: pairs[2].Random}
+
+	err := DeleteTagPairs(bk, pairs)
+	delErr, ok := err.(*DeleteTagPairsError)
+	if !ok {
+		t.Fatalf("Expected *DeleteTagPairsError, got %v", err)
+	}
+	assert.Equal(t, map[string]error{pairs[2].Random: errStubborn}, delErr.Failed)
+
+	left, _ := mem.AllTagPairs(nil)
+	assert.Equal(t, 2, len(left))
+	assert.Equal(t, []string{"stale2", "fresh"}, left.AllPlain())
+}
+
+func TestDeleteTagPairsBatch(t *testing.T) {
+	bk := &batchBackend{memBackend: newMemBackend(t)}
+	pairs := createTags(t, bk, plaintagsN("stale", 5)...)
+
+	if err := DeleteTagPairs(bk, pairs); err != nil {
+		t.Fatalf("Error from DeleteTagPairs: %v", err)
+	}
+	assert.Equal(t, 1, bk.batches)
+
+	left, _ := bk.AllTagPairs(nil)
+	assert.Equal(t, 0, len(left))
+}
+
+func TestDeleteTagPairsUnsupported(t *testing.T) {
+	bk := ReadOnly(newMemBackend(t))
+	pairs := newPairsN(t, bk.Key(), "x", 1)
+	assert.Equal(t, ErrCannotDeleteTagPairs, DeleteTagPairs(bk, pairs))
+}
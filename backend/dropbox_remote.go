@@ -40,9 +40,11 @@ type DropboxRemote struct {
 	tagCursor  string // Used to fetch latest tags only
 
 	// Used for encryption/decryption
-	key *[32]byte
+	key    *[32]byte
+	tagKey *[32]byte // Encrypts TagPairs if set; see TagKey
 
 	dboxConf DropboxConfig
+	httpConf *HTTPConfig
 }
 
 // SetTagCursor sets the cursor for the remote tags directory
@@ -118,7 +120,16 @@ func DropboxRemoteFromConfig(conf *Config) (*DropboxRemote, error) {
 		return nil, err
 	}
 
-	return NewDropboxRemote((*conf.Key)[:], conf.Name, dboxConf)
+	db, err := NewDropboxRemote((*conf.Key)[:], conf.Name, dboxConf)
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetHTTPClient(HTTPClient(conf.HTTP))
+	db.httpConf = conf.HTTP
+	db.SetTagKey(conf.TagKey)
+
+	return db, nil
 }
 
 // NewDropboxRemote creates a new DropboxRemote using the given
@@ -218,9 +229,11 @@ func (db *DropboxRemote) ToConfig() (*Config, error) {
 
 	config := Config{
 		Key:    db.key,
+		TagKey: db.tagKey,
 		Name:   name,
 		Type:   TypeDropboxRemote,
 		Custom: DropboxConfigToMap(db.dboxConf),
+		HTTP:   db.httpConf,
 	}
 	return &config, nil
 }
@@ -229,22 +242,44 @@ func (db *DropboxRemote) Key() *[32]byte {
 	return db.key
 }
 
-func (db *DropboxRemote) AllTagPairs(oldPairs types.TagPairs) (types.TagPairs, error) {
+// TagKey returns the key that db's TagPairs are encrypted with, which
+// is db.Key() unless a separate tag key has been set.
+func (db *DropboxRemote) TagKey() *[32]byte {
+	if db.tagKey != nil {
+		return db.tagKey
+	}
+	return db.key
+}
+
+// RowKey returns the key that db's Rows are encrypted with.
+func (db *DropboxRemote) RowKey() *[32]byte {
+	return db.key
+}
+
+// SetTagKey sets the key that db's TagPairs are encrypted with.
+// Implements TagKeySetter.
+func (db *DropboxRemote) SetTagKey(key *[32]byte) {
+	db.tagKey = key
+}
+
+func (db *DropboxRemote) AllTagPairs(oldPairs types.TagPairs) (_ types.TagPairs, err error) {
+	defer annotateErr(&err, db, "AllTagPairs")
+
 	start := time.Now()
 
+	// Valid TagPairs are returned along with an *InvalidTagPairsError
 	pairs, err := getAllTagsFromDbox(db)
-	if err != nil {
-		return nil, err
-	}
 	if types.Debug {
 		log.Printf("getAllTagsFromDbox took %v, returning %d TagPairs\n",
 			time.Since(start), len(pairs))
 	}
 
-	return pairs, nil
+	return pairs, err
 }
 
-func (db *DropboxRemote) SaveRow(row *types.Row) error {
+func (db *DropboxRemote) SaveRow(row *types.Row) (err error) {
+	defer annotateErr(&err, db, "SaveRow")
+
 	if len(row.Encrypted) == 0 || len(row.RandomTags) == 0 || row.Nonce == nil || *row.Nonce == [24]byte{} {
 		if types.Debug {
 			log.Printf("Error saving row `%#v`\n", row)
@@ -276,7 +311,9 @@ func (db *DropboxRemote) SaveRow(row *types.Row) error {
 	return nil
 }
 
-func (db *DropboxRemote) SaveTagPair(pair *types.TagPair) error {
+func (db *DropboxRemote) SaveTagPair(pair *types.TagPair) (err error) {
+	defer annotateErr(&err, db, "SaveTagPair")
+
 	pairB, err := json.Marshal(pair)
 	if err != nil {
 		return err
@@ -301,24 +338,32 @@ func (db *DropboxRemote) SaveTagPair(pair *types.TagPair) error {
 	return nil
 }
 
-func (db *DropboxRemote) TagPairsFromRandomTags(randtags cryptag.RandomTags) (types.TagPairs, error) {
+func (db *DropboxRemote) TagPairsFromRandomTags(randtags cryptag.RandomTags) (_ types.TagPairs, err error) {
+	defer annotateErr(&err, db, "TagPairsFromRandomTags")
+
 	if len(randtags) == 0 {
 		return nil, fmt.Errorf("Can't get 0 tags")
 	}
 	return getTagsFromDbox(db, randtags)
 }
 
-func (db *DropboxRemote) ListRows(randtags cryptag.RandomTags) (types.Rows, error) {
+func (db *DropboxRemote) ListRows(randtags cryptag.RandomTags) (_ types.Rows, err error) {
+	defer annotateErr(&err, db, "ListRows")
+
 	includeFileBody := false
 	return fetchRows(db, randtags, includeFileBody)
 }
 
-func (db *DropboxRemote) RowsFromRandomTags(randtags cryptag.RandomTags) (types.Rows, error) {
+func (db *DropboxRemote) RowsFromRandomTags(randtags cryptag.RandomTags) (_ types.Rows, err error) {
+	defer annotateErr(&err, db, "RowsFromRandomTags")
+
 	includeFileBody := true
 	return fetchRows(db, randtags, includeFileBody)
 }
 
-func (db *DropboxRemote) DeleteRows(randTags cryptag.RandomTags) error {
+func (db *DropboxRemote) DeleteRows(randTags cryptag.RandomTags) (err error) {
+	defer annotateErr(&err, db, "DeleteRows")
+
 	return errors.New("DropboxRemote.DeleteRows NOT IMPLEMENTED")
 }
 
@@ -375,39 +420,46 @@ func getAllTagsFromDbox(db *DropboxRemote) (types.TagPairs, error) {
 }
 
 // getTagsFromDbox fetches the encrypted tag pairs at db.tagsURL,
-// decrypts them, and unmarshals them into a TagPairs value
+// decrypts them, and unmarshals them into a TagPairs value.  TagPairs
+// that don't decrypt to a valid plaintag (see verifyTagPair) are
+// reported as by validTagPairs; ones that can't be downloaded are
+// logged and skipped.
 func getTagsFromDbox(db *DropboxRemote, randtags cryptag.RandomTags) (types.TagPairs, error) {
-	tags := make(chan *types.TagPair)
+	type fetched struct {
+		pair *types.TagPair
+		err  error
+	}
+	results := make(chan fetched)
 
 	// Download tags in randtags
 	for _, tag := range randtags {
 		go func(tag string) {
 			pair, err := getTagFromDbox(db, tag)
-			if err != nil {
-				log.Printf("Error from getTagFromDbox: %v\n", err)
-				tags <- nil
-				return
-			}
-			tags <- pair
+			results <- fetched{pair, err}
 		}(tag)
 	}
 
 	var pairs types.TagPairs
+	ierr := &InvalidTagPairsError{Invalid: map[string]error{}}
 
 	for i := 0; i < len(randtags); i++ {
-		if t := <-tags; t != nil {
-			// log.Printf("Tag #%d: %#v\n", i, t)
-			pairs = append(pairs, t)
+		res := <-results
+		if res.err != nil {
+			log.Printf("Error from getTagFromDbox: %v\n", res.err)
+			continue
 		}
+		if err := verifyTagPair(db.TagKey(), res.pair); err != nil {
+			ierr.Invalid[res.pair.Random] = err
+			continue
+		}
+		pairs = append(pairs, res.pair)
 	}
 
-	if len(pairs) == 0 {
-		log.Printf("getTagsFromDbox returning no pairs!\n")
-	}
-
-	return pairs, nil
+	return validTagPairs(pairs, ierr)
 }
 
+// getTagFromDbox downloads the (still encrypted) TagPair whose random
+// tag is tag
 func getTagFromDbox(db *DropboxRemote, tag string) (*types.TagPair, error) {
 	b, err := download(db, db.tagsURL+"/"+tag)
 	if err != nil {
@@ -419,11 +471,6 @@ func getTagFromDbox(db *DropboxRemote, tag string) (*types.TagPair, error) {
 		return nil, fmt.Errorf("Error from newTagPair: %v\n", err)
 	}
 
-	// Decrypt, thereby setting pair.plain
-	if err = pair.Decrypt(db.Key()); err != nil {
-		return nil, fmt.Errorf("Error from Decrypt: %v\n", err)
-	}
-
 	return pair, nil
 }
 
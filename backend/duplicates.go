@@ -0,0 +1,95 @@
+// Steve Phillips / elimisteve
+// 2017.04.06
+
+package backend
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/cryptag/cryptag/types"
+)
+
+// FindDuplicateTags returns every plaintag in bk that more than one
+// TagPair (each with a different random tag) corresponds to, which
+// can happen when two clients create the same tag concurrently.
+//
+// Each group of duplicates is sorted by random tag, and its first
+// TagPair is considered canonical by ConsolidateDuplicateTags.
+func FindDuplicateTags(bk Backend) (map[string]types.TagPairs, error) {
+	pairs, err := bk.AllTagPairs(nil)
+	if err != nil {
+		return nil, err
+	}
+	return duplicateTags(pairs), nil
+}
+
+func duplicateTags(pairs types.TagPairs) map[string]types.TagPairs {
+	byPlain := map[string]types.TagPairs{}
+	for _, pair := range pairs {
+		byPlain[pair.Plain()] = append(byPlain[pair.Plain()], pair)
+	}
+
+	dups := map[string]types.TagPairs{}
+	for plain, group := range byPlain {
+		if len(group) < 2 {
+			continue
+		}
+		sort.Sort(byRandom(group))
+		dups[plain] = group
+	}
+	return dups
+}
+
+// ConsolidateDuplicateTags re-tags every Row tagged with a duplicate
+// TagPair (see FindDuplicateTags) so that it is tagged with the
+// canonical TagPair instead.  If bk implements TagPairDeleter, the
+// duplicate TagPairs are then deleted.  Returns the number of Rows
+// re-tagged.
+func ConsolidateDuplicateTags(bk Backend) (retagged int, err error) {
+	dups, err := FindDuplicateTags(bk)
+	if err != nil {
+		return 0, err
+	}
+
+	deleter, canDelete := bk.(TagPairDeleter)
+
+	for plain, group := range dups {
+		canonical := group[0].Random
+
+		for _, dup := range group[1:] {
+			rows, err := rowsFromRandomTags(bk, []string{dup.Random})
+			if err != nil && err != types.ErrRowsNotFound {
+				return retagged, err
+			}
+
+			for _, row := range rows {
+				if err = retagRow(bk, row, dup.Random, canonical); err != nil {
+					return retagged, fmt.Errorf("Error re-tagging row with"+
+						" duplicate tag `%s`: %v", plain, err)
+				}
+				retagged++
+			}
+
+			if canDelete {
+				if err = deleter.DeleteTagPair(dup.Random); err != nil {
+					return retagged, err
+				}
+			}
+		}
+
+		if types.Debug {
+			log.Printf("ConsolidateDuplicateTags: `%s` now only has random"+
+				" tag `%s`\n", plain, canonical)
+		}
+	}
+
+	return retagged, nil
+}
+
+type byRandom types.TagPairs
+
+func (pairs byRandom) Len() int           { return len(pairs) }
+func (pairs byRandom) Swap(i, j int)      { pairs[i], pairs[j] = pairs[j], pairs[i] }
+func (pairs byRandom) Less(i, j int) bool { return pairs[i].Random < pairs[j].Random }
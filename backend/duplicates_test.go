@@ -0,0 +1,68 @@
+// Steve Phillips / elimisteve
+// 2017.04.06
+
+package backend
+
+import (
+	"testing"
+
+	"github.com/cryptag/cryptag/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindAndConsolidateDuplicateTags(t *testing.T) {
+	bk := newMemBackend(t)
+
+	// CreateTag doesn't check for existing TagPairs, so this is how
+	// duplicates get made
+	var dupPairs types.TagPairs
+	for i := 0; i < 3; i++ {
+		pair, err := CreateTag(bk, "dup")
+		if err != nil {
+			t.Fatalf("Error from CreateTag: %v", err)
+		}
+		dupPairs = append(dupPairs, pair)
+	}
+
+	// CreateRow tags every Row with "all"; create it just once
+	all, err := CreateTag(bk, "all")
+	if err != nil {
+		t.Fatalf("Error from CreateTag: %v", err)
+	}
+
+	// Tag one Row with each duplicate
+	for i, pair := range dupPairs {
+		_, err := CreateRow(bk, types.TagPairs{pair, all}, []byte{byte('a' + i)},
+			[]string{"dup"})
+		if err != nil {
+			t.Fatalf("Error from CreateRow: %v", err)
+		}
+	}
+
+	dups, err := FindDuplicateTags(bk)
+	if err != nil {
+		t.Fatalf("Error from FindDuplicateTags: %v", err)
+	}
+
+	assert.Equal(t, 1, len(dups))
+	assert.Equal(t, 3, len(dups["dup"]))
+	assert.True(t, dups["dup"][0].Random < dups["dup"][1].Random)
+
+	canonical := dups["dup"][0].Random
+
+	retagged, err := ConsolidateDuplicateTags(bk)
+	if err != nil {
+		t.Fatalf("Error from ConsolidateDuplicateTags: %v", err)
+	}
+	assert.Equal(t, 2, retagged)
+
+	dups, _ = FindDuplicateTags(bk)
+	assert.Equal(t, 0, len(dups))
+
+	rows, err := bk.ListRows([]string{canonical})
+	if err != nil {
+		t.Fatalf("Error from ListRows: %v", err)
+	}
+	assert.Equal(t, 3, len(rows))
+	assert.Equal(t, []string{"a", "b", "c"}, rowData(t, bk, "dup"))
+}
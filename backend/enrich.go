@@ -0,0 +1,38 @@
+// Steve Phillips / elimisteve
+// 2017.04.11
+
+package backend
+
+import "github.com/elimisteve/fun"
+
+// TagEnricher derives additional plaintags from a Row's decrypted data
+// and existing plaintags (e.g., "has:email" for a Row containing an
+// email address).  It returns only the plaintags to add.
+type TagEnricher func(data []byte, plaintags []string) []string
+
+// TagEnrichers are called, in order, by PopulateRowBeforeSave before
+// it resolves a Row's plaintags, and the plaintags they return are
+// added to the Row.  Each TagEnricher sees the plaintags added by
+// those before it.  Empty (off) by default.
+var TagEnrichers []TagEnricher
+
+// enrichTags returns plaintags plus any new plaintags from
+// TagEnrichers.  plaintags itself is not modified.
+func enrichTags(data []byte, plaintags []string) []string {
+	if len(TagEnrichers) == 0 {
+		return plaintags
+	}
+
+	enriched := make([]string, len(plaintags))
+	copy(enriched, plaintags)
+
+	for _, enrich := range TagEnrichers {
+		for _, plain := range enrich(data, enriched) {
+			if !fun.SliceContains(enriched, plain) {
+				enriched = append(enriched, plain)
+			}
+		}
+	}
+
+	return enriched
+}
@@ -0,0 +1,66 @@
+// Steve Phillips / elimisteve
+// 2017.04.11
+
+package backend
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+
+	"github.com/elimisteve/fun"
+	"github.com/stretchr/testify/assert"
+)
+
+var emailRegex = regexp.MustCompile(`[^@\s]+@[^@\s]+\.[a-z]+`)
+
+func hasEmail(data []byte, plaintags []string) []string {
+	if emailRegex.Match(data) {
+		return []string{"has:email"}
+	}
+	return nil
+}
+
+func TestTagEnrichers(t *testing.T) {
+	TagEnrichers = []TagEnricher{
+		hasEmail,
+		// Composes with the enricher above
+		func(data []byte, plaintags []string) []string {
+			if fun.SliceContains(plaintags, "has:email") &&
+				bytes.Contains(data, []byte("@example.com")) {
+				return []string{"has:example-email", "has:email"}
+			}
+			return nil
+		},
+	}
+	defer func() { TagEnrichers = nil }()
+
+	bk := newMemBackend(t)
+
+	row := mustCreateRow(t, bk, "write to me@example.com", "contact")
+	mustCreateRow(t, bk, "write to you@elsewhere.org", "contact")
+	mustCreateRow(t, bk, "no address here", "contact")
+
+	// "has:email" added once, despite being returned twice
+	var n int
+	for _, plain := range row.PlainTags() {
+		if plain == "has:email" {
+			n++
+		}
+	}
+	assert.Equal(t, 1, n)
+
+	assert.Equal(t, []string{"write to me@example.com", "write to you@elsewhere.org"},
+		rowData(t, bk, "has:email"))
+	assert.Equal(t, []string{"write to me@example.com"},
+		rowData(t, bk, "has:example-email"))
+	assert.Equal(t, 3, len(rowData(t, bk, "contact")))
+}
+
+func TestTagEnrichersOffByDefault(t *testing.T) {
+	bk := newMemBackend(t)
+	mustCreateRow(t, bk, "me@example.com", "contact")
+
+	_, err := RowsFromPlainTags(bk, nil, []string{"has:email"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,81 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"strings"
+
+	"github.com/cryptag/cryptag/types"
+)
+
+// ListRowsExactTags is like ListRowsFromPlainTags, except it returns
+// only the Rows tagged with plaintags and nothing else, rather than
+// every Row tagged with at least plaintags.  Decoy tags (see
+// PadTagsTo), system tags (see IsSystemTag), AllTag, and tags
+// generated for each Row (see StrictAutoTagPrefixes, AppendToRow, and
+// ImportDir) are ignored, on the Rows and in plaintags alike.
+func ListRowsExactTags(bk Backend, plaintags []string) (types.Rows, error) {
+	pairs, err := partialTagPairs(bk.AllTagPairs(nil))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := ListRowsFromPlainTags(bk, pairs, plaintags)
+	if err != nil {
+		return nil, err
+	}
+
+	want := exactTagSet(normalizeTags(plaintags))
+
+	var exact types.Rows
+	for _, row := range rows {
+		have := exactTagSet(row.PlainTags())
+		if len(have) != len(want) {
+			continue
+		}
+		match := true
+		for plain := range have {
+			if !want[plain] {
+				match = false
+				break
+			}
+		}
+		if match {
+			exact = append(exact, row)
+		}
+	}
+
+	if len(exact) == 0 {
+		return nil, types.ErrRowsNotFound
+	}
+
+	return exact, nil
+}
+
+// exactTagSet returns the set of plaintags that ListRowsExactTags
+// compares
+func exactTagSet(plaintags []string) map[string]bool {
+	set := make(map[string]bool, len(plaintags))
+	for _, plain := range plaintags {
+		if IsSystemTag(plain) || isAutoTag(plain) || isGeneratedTag(plain) {
+			continue
+		}
+		set[plain] = true
+	}
+	return set
+}
+
+// isGeneratedTag reports whether plain is AllTag or one of the tags
+// AppendToRow or ImportDir add to the Rows they save
+func isGeneratedTag(plain string) bool {
+	if plain == normalizeTag(AllTag) {
+		return true
+	}
+	for _, prefix := range []string{SegmentOfPrefix, SegmentPrefix, ImportChecksumPrefix} {
+		if strings.HasPrefix(plain, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/cryptag/cryptag/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListRowsExactTags(t *testing.T) {
+	defer func(orig int) { PadTagsTo = orig }(PadTagsTo)
+	PadTagsTo = 8
+
+	bk := newMemBackend(t)
+
+	// Listed Rows have no data, so tell them apart by random tags
+	names := map[string]string{}
+	create := func(name string, plaintags ...string) {
+		names[rowKey(mustCreateRow(t, bk, name, plaintags...))] = name
+	}
+	create("exact", "type:note", "project:a")
+	create("extra", "type:note", "project:a", "urgent")
+	create("fewer", "type:note")
+	create("system", "type:note", "project:a", "system:hidden")
+
+	exactRows := func(plaintags ...string) []string {
+		rows, err := ListRowsExactTags(bk, plaintags)
+		if err != nil {
+			t.Fatalf("Error from ListRowsExactTags: %v", err)
+		}
+		var found []string
+		for _, row := range rows {
+			found = append(found, names[rowKey(row)])
+		}
+		sort.Strings(found)
+		return found
+	}
+
+	assert.Equal(t, []string{"exact", "system"},
+		exactRows("project:a", "type:note"))
+	assert.Equal(t, []string{"fewer"}, exactRows("type:note"))
+	assert.Equal(t, []string{"extra"},
+		exactRows("type:note", "urgent", "project:a", "all"))
+
+	_, err := ListRowsExactTags(bk, []string{"urgent"})
+	assert.Equal(t, types.ErrRowsNotFound, err)
+}
@@ -0,0 +1,131 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cryptag/cryptag/types"
+)
+
+// QueryAllError is returned by QueryAll when querying some of its
+// Backends failed.
+type QueryAllError struct {
+	// Failed maps the name of each Backend that couldn't be queried
+	// to why
+	Failed map[string]error
+}
+
+func (e *QueryAllError) Error() string {
+	var failed []string
+	for name, err := range e.Failed {
+		failed = append(failed, fmt.Sprintf("%s (%v)", name, err))
+	}
+	sort.Strings(failed)
+	return fmt.Sprintf("Error querying %d Backend(s): %s", len(failed),
+		strings.Join(failed, ", "))
+}
+
+// QueryAll concurrently fetches the Rows tagged with all of plaintags
+// from each of backends, resolving plaintags against each Backend's
+// own TagPairs, and returns them merged, in the order backends are
+// given.  Rows found in more than one Backend -- those with the same
+// id: tag, or, lacking one, the same data and plaintags -- are
+// returned once.
+//
+// If some Backends fail to be queried, the Rows from the rest are
+// still returned, along with a *QueryAllError; only if every Backend
+// fails are no Rows returned.  If there are no failures and no
+// matching Rows, types.ErrRowsNotFound is returned.
+func QueryAll(backends []Backend, plaintags []string) (types.Rows, error) {
+	results := make([]types.Rows, len(backends))
+	errs := make([]error, len(backends))
+
+	wg := &sync.WaitGroup{}
+	wg.Add(len(backends))
+
+	for i, bk := range backends {
+		go func(i int, bk Backend) {
+			defer wg.Done()
+			results[i], errs[i] = queryOne(bk, plaintags)
+		}(i, bk)
+	}
+
+	wg.Wait()
+
+	var merged types.Rows
+	seen := map[string]bool{}
+	failed := map[string]error{}
+
+	for i, rows := range results {
+		if errs[i] != nil {
+			failed[backends[i].Name()] = errs[i]
+			continue
+		}
+		for _, row := range rows {
+			key := federatedRowKey(row)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			merged = append(merged, row)
+		}
+	}
+
+	if len(failed) > 0 {
+		if len(failed) == len(backends) {
+			return nil, &QueryAllError{Failed: failed}
+		}
+		return merged, &QueryAllError{Failed: failed}
+	}
+
+	if len(merged) == 0 {
+		return nil, types.ErrRowsNotFound
+	}
+
+	return merged, nil
+}
+
+// queryOne returns the Rows in bk tagged with all of plaintags, or
+// none if bk lacks a TagPair for any of them
+func queryOne(bk Backend, plaintags []string) (types.Rows, error) {
+	pairs, err := bk.AllTagPairs(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	have := map[string]bool{}
+	for _, pair := range pairs {
+		have[pair.Plain()] = true
+	}
+	for _, plain := range normalizeTags(plaintags) {
+		if !have[plain] {
+			return nil, nil
+		}
+	}
+
+	rows, err := RowsFromPlainTags(bk, pairs, plaintags)
+	if err == types.ErrRowsNotFound {
+		return nil, nil
+	}
+	return rows, err
+}
+
+// federatedRowKey identifies row across Backends, whose random tags
+// for it differ
+func federatedRowKey(row *types.Row) string {
+	plaintags := append([]string{}, row.PlainTags()...)
+	sort.Strings(plaintags)
+
+	for _, plain := range plaintags {
+		if strings.HasPrefix(plain, "id:") {
+			return plain
+		}
+	}
+
+	return strings.Join(plaintags, "\x00") + "\x00\x00" + string(row.Decrypted())
+}
@@ -0,0 +1,97 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/cryptag/cryptag/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// downBackend is a memBackend that can't be queried
+type downBackend struct {
+	*memBackend
+}
+
+func (db *downBackend) AllTagPairs(oldPairs types.TagPairs) (types.TagPairs, error) {
+	return nil, errBackendDown
+}
+
+// mustCopyRow saves a copy of row, which has been decrypted, to bk,
+// tagged with the same plaintags (including its id: tag)
+func mustCopyRow(t *testing.T, bk Backend, row *types.Row) {
+	cp, err := types.NewRowSimple(row.Decrypted(), row.PlainTags())
+	if err != nil {
+		t.Fatalf("Error from NewRowSimple: %v", err)
+	}
+	if _, err = PopulateRowBeforeSave(bk, cp, nil); err != nil {
+		t.Fatalf("Error from PopulateRowBeforeSave: %v", err)
+	}
+	if err = bk.SaveRow(cp); err != nil {
+		t.Fatalf("Error from SaveRow: %v", err)
+	}
+}
+
+func federatedData(rows types.Rows) []string {
+	var data []string
+	for _, row := range rows {
+		data = append(data, string(row.Decrypted()))
+	}
+	sort.Strings(data)
+	return data
+}
+
+func TestQueryAll(t *testing.T) {
+	personal := newMemBackend(t)
+	work := newMemBackend(t)
+
+	shared := mustCreateRow(t, personal, "shared", "type:note", "project:x")
+	mustCopyRow(t, work, shared)
+	mustCreateRow(t, personal, "personal", "type:note", "project:x")
+	mustCreateRow(t, work, "work", "type:note", "project:x")
+	mustCreateRow(t, work, "other", "type:note", "project:y")
+
+	// Same logical tags, different random tags
+	assert.NotEqual(t, pairsRandom(t, personal, "project:x"),
+		pairsRandom(t, work, "project:x"))
+
+	rows, err := QueryAll([]Backend{personal, work}, []string{"project:x"})
+	if err != nil {
+		t.Fatalf("Error from QueryAll: %v", err)
+	}
+	assert.Equal(t, []string{"personal", "shared", "work"}, federatedData(rows))
+
+	// Only in work, which is the only Backend with project:y
+	rows, err = QueryAll([]Backend{personal, work}, []string{"project:y"})
+	if err != nil {
+		t.Fatalf("Error from QueryAll: %v", err)
+	}
+	assert.Equal(t, []string{"other"}, federatedData(rows))
+
+	_, err = QueryAll([]Backend{personal, work}, []string{"project:z"})
+	assert.Equal(t, types.ErrRowsNotFound, err)
+}
+
+func TestQueryAllFailure(t *testing.T) {
+	personal := newMemBackend(t)
+	down := &downBackend{newMemBackend(t)}
+
+	mustCreateRow(t, personal, "personal", "project:x")
+
+	rows, err := QueryAll([]Backend{personal, down}, []string{"project:x"})
+	assert.Equal(t, []string{"personal"}, federatedData(rows))
+
+	qerr, ok := err.(*QueryAllError)
+	if !ok {
+		t.Fatalf("Expected *QueryAllError, got %v", err)
+	}
+	assert.Equal(t, map[string]error{down.Name(): errBackendDown}, qerr.Failed)
+
+	// Every Backend failing fails the query
+	rows, err = QueryAll([]Backend{down}, []string{"project:x"})
+	assert.Nil(t, rows)
+	assert.IsType(t, &QueryAllError{}, err)
+}
@@ -0,0 +1,50 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+	"github.com/elimisteve/fun"
+)
+
+// rowsFromRandomTags is like bk.RowsFromRandomTags, but drops any Row
+// not tagged with every one of randtags, so that a Backend can't
+// answer a query with some other Row's record.
+func rowsFromRandomTags(bk Backend, randtags cryptag.RandomTags) (types.Rows, error) {
+	rows, err := bk.RowsFromRandomTags(randtags)
+	if err != nil {
+		return nil, err
+	}
+	return keepQueried(rows, randtags)
+}
+
+// listRows is like bk.ListRows, but drops any Row not tagged with
+// every one of randtags.
+func listRows(bk Backend, randtags cryptag.RandomTags) (types.Rows, error) {
+	rows, err := bk.ListRows(randtags)
+	if err != nil {
+		return nil, err
+	}
+	return keepQueried(rows, randtags)
+}
+
+func keepQueried(rows types.Rows, randtags cryptag.RandomTags) (types.Rows, error) {
+	var kept types.Rows
+	for _, row := range rows {
+		if hasQueriedTags(row, randtags) {
+			kept = append(kept, row)
+		}
+	}
+	if len(kept) == 0 && len(rows) > 0 {
+		return nil, types.ErrRowsNotFound
+	}
+	return kept, nil
+}
+
+// hasQueriedTags reports whether row is tagged with every one of
+// randtags, as every Row returned for a query on randtags must be.
+func hasQueriedTags(row *types.Row, randtags cryptag.RandomTags) bool {
+	return fun.SliceContainsAll(row.RandomTags, randtags)
+}
@@ -4,7 +4,8 @@
 package backend
 
 import (
-	"encoding/json"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -13,6 +14,7 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/cryptag/cryptag"
 	"github.com/cryptag/cryptag/types"
@@ -30,8 +32,38 @@ type FileSystem struct {
 	rowsPath string // subdirectory of dataPath
 	new      bool
 	key      *[32]byte
+	tagKey   *[32]byte // Encrypts TagPairs if set; see TagKey
+
+	// Row summaries, kept apart from rows so they can be read alone;
+	// subdirectory of dataPath
+	summariesPath string
+
+	// If set, row files are named by a hash of their random tags,
+	// which are kept in indexPath instead; see rowFilename
+	hashFilenames bool
+	indexPath     string // subdirectory of dataPath
+
+	// Serializes the row, summary, tag, and index files; see Config.Codec
+	codec Codec
 }
 
+// Contents of the files that FileSystem persists, apart from what's
+// in their names (see SaveRow and SaveTagPair)
+type (
+	rowFileData struct {
+		Encrypted []byte    `json:"data"`
+		Nonce     *[24]byte `json:"nonce"`
+	}
+	summaryFileData struct {
+		EncryptedSummary []byte    `json:"summary"`
+		SummaryNonce     *[24]byte `json:"summary_nonce"`
+	}
+	tagFileData struct {
+		PlainEncrypted []byte    `json:"plain_encrypted"`
+		Nonce          *[24]byte `json:"nonce"`
+	}
+)
+
 func NewFileSystem(conf *Config) (*FileSystem, error) {
 	if err := conf.Canonicalize(); err != nil {
 		return nil, err
@@ -44,7 +76,19 @@ func NewFileSystem(conf *Config) (*FileSystem, error) {
 		rowsPath: path.Join(conf.DataPath, "rows"),
 		new:      conf.New,
 		key:      conf.Key,
+		tagKey:   conf.TagKey,
+
+		summariesPath: path.Join(conf.DataPath, "summaries"),
+		indexPath:     path.Join(conf.DataPath, "index"),
+	}
+	fs.hashFilenames, _ = conf.Custom["HashFilenames"].(bool)
+
+	codec, err := conf.Codec()
+	if err != nil {
+		return nil, err
 	}
+	fs.codec = codec
+
 	if err := fs.init(); err != nil {
 		return nil, err
 	}
@@ -68,7 +112,7 @@ func (fs *FileSystem) init() error {
 	var err error
 	// TODO(elimisteve): Should this assume that cryptag.BackendPath
 	// already exists?
-	for _, path := range []string{fs.dataPath, fs.tagsPath, fs.rowsPath, cryptag.BackendPath} {
+	for _, path := range []string{fs.dataPath, fs.tagsPath, fs.rowsPath, fs.summariesPath, fs.indexPath, cryptag.BackendPath} {
 		err = os.MkdirAll(path, 0755)
 		if err == nil || os.IsExist(err) {
 			// Created successfully or already exists
@@ -144,8 +188,18 @@ func (fs *FileSystem) ToConfig() (*Config, error) {
 		Type:     TypeFileSystem,
 		New:      fs.new,
 		Key:      fs.key,
+		TagKey:   fs.tagKey,
 		DataPath: fs.dataPath,
 	}
+	if fs.hashFilenames || fs.codec.Name() != DefaultCodec.Name() {
+		config.Custom = map[string]interface{}{}
+	}
+	if fs.hashFilenames {
+		config.Custom["HashFilenames"] = true
+	}
+	if fs.codec.Name() != DefaultCodec.Name() {
+		config.Custom["Codec"] = fs.codec.Name()
+	}
 
 	return &config, nil
 }
@@ -154,20 +208,57 @@ func (fs *FileSystem) Key() *[32]byte {
 	return fs.key
 }
 
-func (fs *FileSystem) AllTagPairs(oldPairs types.TagPairs) (types.TagPairs, error) {
+// TagKey returns the key that fs's TagPairs are encrypted with, which
+// is fs.Key() unless a separate tag key has been set.
+func (fs *FileSystem) TagKey() *[32]byte {
+	if fs.tagKey != nil {
+		return fs.tagKey
+	}
+	return fs.key
+}
+
+// RowKey returns the key that fs's Rows are encrypted with.
+func (fs *FileSystem) RowKey() *[32]byte {
+	return fs.key
+}
+
+// SetTagKey sets the key that fs's TagPairs are encrypted with.
+// Implements TagKeySetter.
+func (fs *FileSystem) SetTagKey(key *[32]byte) {
+	fs.tagKey = key
+}
+
+func (fs *FileSystem) AllTagPairs(oldPairs types.TagPairs) (_ types.TagPairs, err error) {
+	defer annotateErr(&err, fs, "AllTagPairs")
+
 	tagFiles, err := filepath.Glob(path.Join(fs.tagsPath, "*"))
 	if err != nil {
 		return nil, fmt.Errorf("Error listing tags: %v", err)
 	}
 
 	var pairs types.TagPairs
+	ierr := &InvalidTagPairsError{Invalid: map[string]error{}}
+
 	for _, f := range tagFiles {
 		// filepath.Base(f) is of the form randtag1-randtag2-randtag3
 		// and its contents is {"plain_encrypted": ..., "nonce": ...}
-		pair, err := readTagFile(fs.Key(), f)
-		if err != nil {
+		pair, err := readTagFile(fs.codec, fs.TagKey(), f)
+		if os.IsNotExist(err) {
+			continue
+		}
+		var perr *os.PathError
+		if errors.As(err, &perr) {
 			return nil, err
 		}
+		if err != nil {
+			// Unparseable or undecryptable
+			ierr.Invalid[filepath.Base(f)] = err
+			continue
+		}
+		if pair.Plain() == "" {
+			ierr.Invalid[pair.Random] = ErrEmptyPlainTag
+			continue
+		}
 
 		pairs = append(pairs, pair)
 	}
@@ -177,15 +268,122 @@ func (fs *FileSystem) AllTagPairs(oldPairs types.TagPairs) (types.TagPairs, erro
 			len(pairs), len(pairs)-len(oldPairs))
 	}
 
+	return validTagPairs(pairs, ierr)
+}
+
+// TagPairsSince returns the TagPairs whose files were last modified at
+// or after since.  Implements TagPairsSincer.
+func (fs *FileSystem) TagPairsSince(since time.Time) (types.TagPairs, error) {
+	tagFiles, err := filepath.Glob(path.Join(fs.tagsPath, "*"))
+	if err != nil {
+		return nil, fmt.Errorf("Error listing tags: %v", err)
+	}
+
+	var pairs types.TagPairs
+	for _, f := range tagFiles {
+		info, err := os.Stat(f)
+		if err != nil {
+			return nil, err
+		}
+		if info.ModTime().Before(since) {
+			continue
+		}
+
+		pair, err := readTagFile(fs.codec, fs.TagKey(), f)
+		if err != nil {
+			return nil, err
+		}
+
+		pairs = append(pairs, pair)
+	}
+
 	return pairs, nil
 }
 
-func (fs *FileSystem) TagPairsFromRandomTags(randtags cryptag.RandomTags) (types.TagPairs, error) {
-	// TODO: This should grab files from disk with the names $BASE/tags/$randtag
-	return nil, errors.New("TagPairsFromRandomTags: NOT IMPLEMENTED")
+// TagPairsPaged returns one page of fs's TagPairs, ordered by random
+// tag, decrypting only those on the page.  Implements TagPairPager.
+func (fs *FileSystem) TagPairsPaged(offset, limit int) (types.TagPairs, bool, error) {
+	if offset < 0 || limit < 0 {
+		return nil, false, ErrNegativeLimit
+	}
+
+	// Tag files are named after their random tag, and Glob sorts them
+	tagFiles, err := filepath.Glob(path.Join(fs.tagsPath, "*"))
+	if err != nil {
+		return nil, false, fmt.Errorf("Error listing tags: %v", err)
+	}
+
+	if offset >= len(tagFiles) {
+		return nil, false, nil
+	}
+	tagFiles = tagFiles[offset:]
+
+	more := false
+	if limit > 0 && limit < len(tagFiles) {
+		tagFiles = tagFiles[:limit]
+		more = true
+	}
+
+	pairs := make(types.TagPairs, 0, len(tagFiles))
+	for _, f := range tagFiles {
+		pair, err := readTagFile(fs.codec, fs.TagKey(), f)
+		if err != nil {
+			return nil, false, err
+		}
+		pairs = append(pairs, pair)
+	}
+
+	return pairs, more, nil
+}
+
+func (fs *FileSystem) TagPairsFromRandomTags(randtags cryptag.RandomTags) (_ types.TagPairs, err error) {
+	defer annotateErr(&err, fs, "TagPairsFromRandomTags")
+
+	if len(randtags) == 0 {
+		return nil, fmt.Errorf("Can't get 0 tags")
+	}
+
+	var pairs types.TagPairs
+	ierr := &InvalidTagPairsError{Invalid: map[string]error{}}
+
+	for _, rand := range randtags {
+		if rand == "" || strings.ContainsAny(rand, `/\`) {
+			return nil, fmt.Errorf("Invalid random tag `%s`", rand)
+		}
+
+		// Tags are stored in files named $BASE/tags/$randtag
+		pair, err := readTagFile(fs.codec, fs.TagKey(), path.Join(fs.tagsPath, rand))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if _, ok := err.(*types.DecryptError); ok {
+			ierr.Invalid[rand] = err
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if pair.Plain() == "" {
+			ierr.Invalid[rand] = ErrEmptyPlainTag
+			continue
+		}
+
+		pairs = append(pairs, pair)
+	}
+
+	if len(ierr.Invalid) > 0 {
+		return pairs, ierr
+	}
+	if len(pairs) == 0 {
+		return nil, types.ErrTagPairNotFound
+	}
+
+	return pairs, nil
 }
 
-func (fs *FileSystem) SaveTagPair(pair *types.TagPair) error {
+func (fs *FileSystem) SaveTagPair(pair *types.TagPair) (err error) {
+	defer annotateErr(&err, fs, "SaveTagPair")
+
 	if len(pair.PlainEncrypted) == 0 || len(pair.Random) == 0 || pair.Nonce == nil || *pair.Nonce == [24]byte{} {
 		// TODO(elimisteve): Make error global?
 		return errors.New("Invalid tag pair; requires plain_encrypted, random, and nonce fields")
@@ -193,11 +391,11 @@ func (fs *FileSystem) SaveTagPair(pair *types.TagPair) error {
 
 	// Just save "plain_encrypted" and "nonce" to file ("random"
 	// contained in filename)
-	t := map[string]interface{}{
-		"plain_encrypted": pair.PlainEncrypted,
-		"nonce":           pair.Nonce,
+	t := tagFileData{
+		PlainEncrypted: pair.PlainEncrypted,
+		Nonce:          pair.Nonce,
 	}
-	b, err := json.Marshal(t)
+	b, err := fs.codec.Marshal(&t)
 	if err != nil {
 		return err
 	}
@@ -208,7 +406,18 @@ func (fs *FileSystem) SaveTagPair(pair *types.TagPair) error {
 	return ioutil.WriteFile(filepath, b, 0600)
 }
 
-func (fs *FileSystem) ListRows(randtags cryptag.RandomTags) (types.Rows, error) {
+// DeleteTagPair deletes the TagPair whose random tag is random.
+// Implements TagPairDeleter.
+func (fs *FileSystem) DeleteTagPair(random string) error {
+	if random == "" || strings.ContainsAny(random, `/\`) {
+		return fmt.Errorf("Invalid random tag `%s`", random)
+	}
+	return os.Remove(path.Join(fs.tagsPath, random))
+}
+
+func (fs *FileSystem) ListRows(randtags cryptag.RandomTags) (_ types.Rows, err error) {
+	defer annotateErr(&err, fs, "ListRows")
+
 	// TODO: Reduce code duplication between ListRows and
 	// RowsFromPlainTags
 
@@ -221,7 +430,9 @@ func (fs *FileSystem) ListRows(randtags cryptag.RandomTags) (types.Rows, error)
 	return fs.rowsFromRandomTags(randtags, false)
 }
 
-func (fs *FileSystem) RowsFromRandomTags(randtags cryptag.RandomTags) (types.Rows, error) {
+func (fs *FileSystem) RowsFromRandomTags(randtags cryptag.RandomTags) (_ types.Rows, err error) {
+	defer annotateErr(&err, fs, "RowsFromRandomTags")
+
 	if len(randtags) == 0 {
 		return nil, errors.New("Must query by 1 or more tags")
 	}
@@ -233,7 +444,28 @@ func (fs *FileSystem) RowsFromRandomTags(randtags cryptag.RandomTags) (types.Row
 	return fs.rowsFromRandomTags(randtags, true)
 }
 
-func (fs *FileSystem) SaveRow(row *types.Row) error {
+// ListRowsLimit is like ListRows, but only returns one page of Rows,
+// and stops looking once it's found them.  Implements Limiter.
+func (fs *FileSystem) ListRowsLimit(randtags cryptag.RandomTags, offset, limit int) (types.Rows, error) {
+	if len(randtags) == 0 {
+		return nil, errors.New("Must query by 1 or more tags")
+	}
+	return fs.rowsFromRandomTagsPage(randtags, false, offset, limit)
+}
+
+// RowsFromRandomTagsLimit is like RowsFromRandomTags, but only
+// returns (and only reads the files of) one page of Rows.  Implements
+// Limiter.
+func (fs *FileSystem) RowsFromRandomTagsLimit(randtags cryptag.RandomTags, offset, limit int) (types.Rows, error) {
+	if len(randtags) == 0 {
+		return nil, errors.New("Must query by 1 or more tags")
+	}
+	return fs.rowsFromRandomTagsPage(randtags, true, offset, limit)
+}
+
+func (fs *FileSystem) SaveRow(row *types.Row) (err error) {
+	defer annotateErr(&err, fs, "SaveRow")
+
 	if len(row.Encrypted) == 0 || len(row.RandomTags) == 0 || row.Nonce == nil || *row.Nonce == [24]byte{} {
 		if types.Debug {
 			log.Printf("Error saving row `%#v`\n", row)
@@ -244,24 +476,115 @@ func (fs *FileSystem) SaveRow(row *types.Row) error {
 
 	// Save row.{Encrypted,Nonce} to fs.rowsPath/randomtag1-randomtag2-randomtag3
 
-	rowData := map[string]interface{}{
-		"data":  row.Encrypted,
-		"nonce": row.Nonce,
+	rowData := rowFileData{
+		Encrypted: row.Encrypted,
+		Nonce:     row.Nonce,
 	}
-	b, err := json.Marshal(rowData)
+	b, err := fs.codec.Marshal(&rowData)
 	if err != nil {
 		return err
 	}
 
 	// Create row file fs.rowsPath/randomtag1-randomtag2-randomtag3-...
+	// (or fs.rowsPath/<hash>; see rowFilename)
+
+	filename, newIndex, err := fs.rowFilename(row.RandomTags)
+	if err != nil {
+		return err
+	}
 
-	filename := strings.Join(row.RandomTags, "-")
-	filepath := path.Join(fs.rowsPath, filename)
+	// Index first so the row file is never without its tags
+	if newIndex {
+		index, err := fs.codec.Marshal(&row.RandomTags)
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(path.Join(fs.indexPath, filename), index, 0600)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = ioutil.WriteFile(path.Join(fs.rowsPath, filename), b, 0600); err != nil {
+		return err
+	}
+
+	return fs.saveSummary(filename, row)
+}
+
+// saveSummary saves row's encrypted summary, if any, to
+// fs.summariesPath/filename, removing any old one
+func (fs *FileSystem) saveSummary(filename string, row *types.Row) error {
+	filepath := path.Join(fs.summariesPath, filename)
+
+	if len(row.EncryptedSummary) == 0 {
+		if err := os.Remove(filepath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	b, err := fs.codec.Marshal(&summaryFileData{
+		EncryptedSummary: row.EncryptedSummary,
+		SummaryNonce:     row.SummaryNonce,
+	})
+	if err != nil {
+		return err
+	}
 
 	return ioutil.WriteFile(filepath, b, 0600)
 }
 
-func (fs *FileSystem) DeleteRows(randTags cryptag.RandomTags) error {
+// ListRowSummaries is like ListRows, but also reads each Row's
+// encrypted summary (without reading its data).  Implements
+// SummaryLister.
+func (fs *FileSystem) ListRowSummaries(randtags cryptag.RandomTags) (types.Rows, error) {
+	if len(randtags) == 0 {
+		return nil, errors.New("Must query by 1 or more tags")
+	}
+
+	files, err := fs.matchingRowFiles(randtags, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make(types.Rows, 0, len(files))
+	for _, f := range files {
+		row := &types.Row{RandomTags: f.tags}
+		if err = fs.readSummary(f.name, row); err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// readSummary sets row.EncryptedSummary and row.SummaryNonce from the
+// summary file of row file filename, if it has one
+func (fs *FileSystem) readSummary(filename string, row *types.Row) error {
+	filepath := path.Join(fs.summariesPath, filename)
+
+	b, err := ioutil.ReadFile(filepath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var summary summaryFileData
+	if err = fs.codec.Unmarshal(b, &summary); err != nil {
+		return err
+	}
+	row.EncryptedSummary = summary.EncryptedSummary
+	row.SummaryNonce = summary.SummaryNonce
+	return nil
+}
+
+func (fs *FileSystem) DeleteRows(randTags cryptag.RandomTags) (err error) {
+	defer annotateErr(&err, fs, "DeleteRows")
+
 	if len(randTags) == 0 {
 		return fmt.Errorf("Must query by 1 or more tags")
 	}
@@ -271,18 +594,18 @@ func (fs *FileSystem) DeleteRows(randTags cryptag.RandomTags) error {
 	}
 
 	// Find rows matching given tags
-	rows, err := fs.rowsFromRandomTags(randTags, false)
+	files, err := fs.matchingRowFiles(randTags, 0, 0)
 	if err != nil {
 		return err
 	}
 
 	if types.Debug {
-		log.Printf("DeleteRows: deleting %d rows: %s\n", len(rows), rows)
+		log.Printf("DeleteRows: deleting %d rows\n", len(files))
 	}
 
 	// Delete
-	for _, row := range rows {
-		filename := path.Join(fs.rowsPath, strings.Join(row.RandomTags, "-"))
+	for _, f := range files {
+		filename := path.Join(fs.rowsPath, f.name)
 		if types.Debug {
 			log.Printf("Removing row file `%v`\n", filename)
 		}
@@ -290,6 +613,14 @@ func (fs *FileSystem) DeleteRows(randTags cryptag.RandomTags) error {
 		if err != nil {
 			return err
 		}
+
+		// Not every row has a summary or an index entry
+		for _, dir := range []string{fs.summariesPath, fs.indexPath} {
+			err = os.Remove(path.Join(dir, f.name))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
 	}
 
 	return nil
@@ -300,50 +631,189 @@ func (fs *FileSystem) DeleteRows(randTags cryptag.RandomTags) error {
 //
 
 func (fs *FileSystem) rowsFromRandomTags(randTags []string, includeFileBody bool) (types.Rows, error) {
+	offset, limit := 0, 0
+	return fs.rowsFromRandomTagsPage(randTags, includeFileBody, offset, limit)
+}
+
+// rowsFromRandomTagsPage skips the first offset Rows tagged with all
+// of randTags, then returns at most limit of them (all of them if
+// limit is 0)
+func (fs *FileSystem) rowsFromRandomTagsPage(randTags []string, includeFileBody bool, offset, limit int) (types.Rows, error) {
 	if types.Debug {
-		log.Printf("rowsFromRandomTags(%#v, %v)\n", randTags, includeFileBody)
+		log.Printf("rowsFromRandomTagsPage(%#v, %v, %d, %d)\n", randTags,
+			includeFileBody, offset, limit)
 	}
 
-	rowFiles, err := filepath.Glob(path.Join(fs.rowsPath, "*"))
+	files, err := fs.matchingRowFiles(randTags, offset, limit)
 	if err != nil {
 		return nil, err
 	}
 
-	var rows types.Rows
-
-	// For each row dir, if it has all tags, append to `rows`
-	for _, f := range rowFiles {
-		// Row filenames are of the form randtag1-randtag2-randtag3
-		rowTags := strings.Split(filepath.Base(f), "-")
-
-		if !fun.SliceContainsAll(rowTags, randTags) {
-			continue
-		}
+	rows := make(types.Rows, 0, len(files))
 
+	for _, f := range files {
 		var row *types.Row
 
 		// Load contents of row file, too
 		if includeFileBody {
-			row, err = readRowFile(fs, f, rowTags)
+			row, err = readRowFile(fs, f.name, f.tags)
 			if err != nil {
 				return nil, err
 			}
 		} else {
 			// Row is tagged with all queryTags; return to user
-			row = &types.Row{RandomTags: rowTags}
+			row = &types.Row{RandomTags: f.tags}
 		}
 
 		rows = append(rows, row)
 	}
 
-	if len(rows) == 0 {
+	return rows, nil
+}
+
+// rowFile is a file in fs.rowsPath along with the random tags of the
+// Row it holds
+type rowFile struct {
+	name string
+	tags []string
+}
+
+// matchingRowFiles skips the first offset row files tagged with all
+// of randTags, then returns at most limit of them (all of them if
+// limit is 0), or types.ErrRowsNotFound if there are none
+func (fs *FileSystem) matchingRowFiles(randTags []string, offset, limit int) ([]rowFile, error) {
+	names, err := filepath.Glob(path.Join(fs.rowsPath, "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	var files []rowFile
+	matched := 0
+
+	// For each row file, if it has all tags, append to `files`
+	for _, name := range names {
+		name = filepath.Base(name)
+
+		rowTags, err := fs.rowFileTags(name)
+		if err != nil {
+			return nil, err
+		}
+
+		if !fun.SliceContainsAll(rowTags, randTags) {
+			continue
+		}
+
+		include, done := inPage(matched, offset, limit)
+		matched++
+		if !include {
+			continue
+		}
+
+		files = append(files, rowFile{name: name, tags: rowTags})
+
+		if done {
+			break
+		}
+	}
+
+	if len(files) == 0 {
 		return nil, types.ErrRowsNotFound
 	}
 
-	return rows, nil
+	return files, nil
+}
+
+// rowFileTags returns the random tags of the Row in row file
+// filename, which are either in its index entry, if it has one (see
+// rowFilename), or else its filename, which is of the form
+// randtag1-randtag2-randtag3
+func (fs *FileSystem) rowFileTags(filename string) ([]string, error) {
+	if isHashedRowFilename(filename) {
+		b, err := ioutil.ReadFile(path.Join(fs.indexPath, filename))
+		if err == nil {
+			var rowTags []string
+			if err = fs.codec.Unmarshal(b, &rowTags); err != nil {
+				return nil, fmt.Errorf("Error parsing index entry `%s`: %v",
+					filename, err)
+			}
+			return rowTags, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	return strings.Split(filename, "-"), nil
 }
 
-func readTagFile(key *[32]byte, tagFile string) (*types.TagPair, error) {
+// rowFilename returns the name of the row file for a Row tagged with
+// randtags: that of its existing row file, if any, or else a new one.
+// New names are randtags joined by "-", or, if fs.hashFilenames is
+// set, the hex-encoded SHA-256 of randtags sorted, which is of fixed
+// length no matter how many tags there are (with ".1", ".2", etc.
+// appended in the unlikely event of a collision).  newIndex reports
+// whether the name is hashed and still needs an index entry listing
+// randtags.
+func (fs *FileSystem) rowFilename(randtags []string) (filename string, newIndex bool, err error) {
+	sorted := canonicalRandomTags(append([]string{}, randtags...))
+
+	sum := sha256.Sum256([]byte(strings.Join(sorted, "-")))
+	hashed := hex.EncodeToString(sum[:])
+
+	free := ""
+	for n := 0; ; n++ {
+		name := hashed
+		if n > 0 {
+			name = fmt.Sprintf("%s.%d", hashed, n)
+		}
+
+		b, err := ioutil.ReadFile(path.Join(fs.indexPath, name))
+		if os.IsNotExist(err) {
+			free = name
+			break
+		}
+		if err != nil {
+			return "", false, err
+		}
+
+		var indexed []string
+		if err = fs.codec.Unmarshal(b, &indexed); err != nil {
+			return "", false, fmt.Errorf("Error parsing index entry `%s`: %v",
+				name, err)
+		}
+		if strings.Join(canonicalRandomTags(indexed), "-") == strings.Join(sorted, "-") {
+			return name, false, nil
+		}
+	}
+
+	legacy := strings.Join(randtags, "-")
+	if !fs.hashFilenames {
+		return legacy, false, nil
+	}
+
+	// Rows saved before fs.hashFilenames was set keep their files
+	if _, err = os.Stat(path.Join(fs.rowsPath, legacy)); err == nil {
+		return legacy, false, nil
+	}
+
+	return free, true, nil
+}
+
+// isHashedRowFilename reports whether filename could be one chosen by
+// rowFilename with fs.hashFilenames set
+func isHashedRowFilename(filename string) bool {
+	const hashLen = 2 * sha256.Size
+
+	if len(filename) < hashLen {
+		return false
+	}
+	if _, err := hex.DecodeString(filename[:hashLen]); err != nil {
+		return false
+	}
+	return len(filename) == hashLen || filename[hashLen] == '.'
+}
+
+func readTagFile(codec Codec, key *[32]byte, tagFile string) (*types.TagPair, error) {
 	// TODO(elimisteve): Do streaming reads
 
 	// Set pair.{PlainEncrypted,Nonce} from file contents, pair.Random
@@ -355,36 +825,46 @@ func readTagFile(key *[32]byte, tagFile string) (*types.TagPair, error) {
 		return nil, err
 	}
 
-	pair := &types.TagPair{}
-	err = json.Unmarshal(b, pair)
-	if err != nil {
+	var t tagFileData
+	if err = codec.Unmarshal(b, &t); err != nil {
 		return nil, err
 	}
 
-	pair.Random = filepath.Base(tagFile)
+	pair := &types.TagPair{
+		PlainEncrypted: t.PlainEncrypted,
+		Random:         filepath.Base(tagFile),
+		Nonce:          t.Nonce,
+	}
 
-	// Populate pair.plain
+	// Populate pair.plain.  Return the *types.DecryptError as is so
+	// callers can tell a wrong key (see types.IsWrongKey).
 	if err = pair.Decrypt(key); err != nil {
-		return nil, fmt.Errorf("Error from pair.Decrypt: %v", err)
+		return nil, err
 	}
 
 	return pair, nil
 }
 
-func readRowFile(bk *FileSystem, rowFilePath string, rowTags []string) (*types.Row, error) {
-	b, err := ioutil.ReadFile(rowFilePath)
+func readRowFile(bk *FileSystem, filename string, rowTags []string) (*types.Row, error) {
+	b, err := ioutil.ReadFile(path.Join(bk.rowsPath, filename))
 	if err != nil {
 		return nil, err
 	}
 
-	var row types.Row
-	// This populates row.Encrypted and row.Nonce
-	err = json.Unmarshal(b, &row)
-	if err != nil {
+	var data rowFileData
+	if err = bk.codec.Unmarshal(b, &data); err != nil {
 		return nil, err
 	}
 
-	row.RandomTags = rowTags
+	row := types.Row{
+		Encrypted:  data.Encrypted,
+		RandomTags: rowTags,
+		Nonce:      data.Nonce,
+	}
+
+	if err = bk.readSummary(filename, &row); err != nil {
+		return nil, err
+	}
 
 	return &row, nil
 }
@@ -0,0 +1,169 @@
+// Steve Phillips / elimisteve
+// 2017.04.07
+
+package backend
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestFileSystem returns a new FileSystem Backend that stores its
+// data (and config) in a temporary directory, as well as a func that
+// removes said directory
+func newTestFileSystem(t *testing.T) (*FileSystem, func()) {
+	dir, err := ioutil.TempDir("", "cryptag-test-")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+
+	origBackendPath := cryptag.BackendPath
+	cryptag.BackendPath = path.Join(dir, "backends")
+
+	fs, err := NewFileSystem(&Config{
+		Name:     "test",
+		Type:     TypeFileSystem,
+		Local:    true,
+		DataPath: path.Join(dir, "data"),
+	})
+	if err != nil {
+		t.Fatalf("Error from NewFileSystem: %v", err)
+	}
+
+	cleanup := func() {
+		cryptag.BackendPath = origBackendPath
+		os.RemoveAll(dir)
+	}
+
+	return fs, cleanup
+}
+
+func TestFileSystemOddPlainTags(t *testing.T) {
+	fs, cleanup := newTestFileSystem(t)
+	defer cleanup()
+
+	// Random tags, not plaintags, end up in filenames, so slashes and
+	// dashes in plaintags are safe
+	plaintags := []string{
+		"filename:a/b/c-d.txt",
+		"url:https://example.com/x?y=z",
+		"title:Ünïcödé – 日本語",
+		"../../etc/passwd",
+	}
+
+	mustCreateRow(t, fs, "odd", plaintags...)
+	mustCreateRow(t, fs, "other", "filename:a/b")
+
+	for _, plain := range plaintags {
+		assert.Equal(t, []string{"odd"}, rowData(t, fs, plain))
+	}
+
+	rows, err := RowsFromPlainTags(fs, nil, plaintags[:1])
+	if err != nil {
+		t.Fatalf("Error from RowsFromPlainTags: %v", err)
+	}
+	for _, plain := range plaintags {
+		assert.True(t, rows[0].HasPlainTag(plain), "Missing plaintag %q", plain)
+	}
+}
+
+func TestFileSystemHashFilenames(t *testing.T) {
+	fs, cleanup := newTestFileSystem(t)
+	defer cleanup()
+	fs.hashFilenames = true
+
+	// Long enough that joined random tags would exceed NAME_MAX
+	plaintags := plaintagsN("tag:", 100)
+	mustCreateSummaryRow(t, fs, "sum", "many", plaintags...)
+	mustCreateRow(t, fs, "few", "tag:0")
+
+	names, err := filepath.Glob(path.Join(fs.rowsPath, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, names, 2)
+	for _, name := range names {
+		assert.Len(t, filepath.Base(name), 2*sha256.Size)
+	}
+
+	assert.Equal(t, []string{"many"}, rowData(t, fs, "tag:99"))
+	assert.Equal(t, []string{"few", "many"}, rowData(t, fs, "tag:0"))
+
+	rows, err := fs.ListRowSummaries([]string{pairsRandom(t, fs, "tag:42")})
+	if err != nil {
+		t.Fatalf("Error from ListRowSummaries: %v", err)
+	}
+	if err = rows[0].DecryptSummary(fs.RowKey()); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "sum", string(rows[0].Summary()))
+
+	if err = fs.DeleteRows([]string{pairsRandom(t, fs, "tag:99")}); err != nil {
+		t.Fatalf("Error from DeleteRows: %v", err)
+	}
+	entries, err := ioutil.ReadDir(fs.indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, entries, 1)
+	assert.Equal(t, []string{"few"}, rowData(t, fs, "tag:0"))
+}
+
+func TestFileSystemHashFilenameCollision(t *testing.T) {
+	fs, cleanup := newTestFileSystem(t)
+	defer cleanup()
+	fs.hashFilenames = true
+
+	row := mustCreateRow(t, fs, "first", "a")
+	first, _, err := fs.rowFilename(row.RandomTags)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate another tag set hashing to the name the next Row will
+	// get by claiming it in the index ahead of time
+	tags := append(append([]string{}, row.RandomTags...), "someothertag")
+	row2, err := types.NewRow([]byte("second"), []string{"b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pairs, err := fs.AllTagPairs(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = PopulateRowBeforeSave(fs, row2, pairs); err != nil {
+		t.Fatal(err)
+	}
+	expected, newIndex, err := fs.rowFilename(row2.RandomTags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, newIndex)
+	assert.NotEqual(t, first, expected)
+
+	b, _ := json.Marshal(tags)
+	if err = ioutil.WriteFile(path.Join(fs.indexPath, expected), b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = fs.SaveRow(row2); err != nil {
+		t.Fatalf("Error from SaveRow: %v", err)
+	}
+
+	collided, _, err := fs.rowFilename(row2.RandomTags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, expected+".1", collided)
+	assert.Equal(t, []string{"second"}, rowData(t, fs, "b"))
+	assert.Equal(t, []string{"first"}, rowData(t, fs, "a"))
+}
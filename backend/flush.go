@@ -0,0 +1,47 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+// Flusher is implemented by Backends that buffer writes (such as
+// Archives opened with NewBufferedArchive), and by wrappers around
+// them.  Flush writes anything buffered to durable storage.
+type Flusher interface {
+	Flush() error
+}
+
+// Flush makes everything saved to bk so far durable, if bk buffers
+// writes (see Flusher); for every other Backend, saves are already
+// durable, so Flush does nothing.  Call Flush before exiting.
+func Flush(bk Backend) error {
+	if f, ok := bk.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+func (ro *ReadOnlyBackend) Flush() error {
+	return Flush(ro.Backend)
+}
+
+func (sb *scopedBackend) Flush() error {
+	return Flush(sb.Backend)
+}
+
+func (mb *ManifestBackend) Flush() error {
+	return Flush(mb.Backend)
+}
+
+func (tb *TimeoutBackend) Flush() error {
+	return tb.run(func(bk Backend) error {
+		return Flush(bk)
+	})
+}
+
+func (tb *TagCacheBackend) Flush() error {
+	return Flush(tb.Backend)
+}
+
+func (tb *TombstoneBackend) Flush() error {
+	return Flush(tb.Backend)
+}
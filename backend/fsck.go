@@ -0,0 +1,190 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+// fsckBatchSize is how many directory entries FsckFilesystem reads at
+// a time
+const fsckBatchSize = 256
+
+// FsckReport describes what FsckFilesystem found and fixed.  Files
+// are listed by their paths relative to the FileSystem's data path.
+type FsckReport struct {
+	Rows     int // Valid row files
+	TagPairs int // Valid tag files
+
+	// StaleSummaries are the summary files whose row file was gone;
+	// FsckFilesystem removes them
+	StaleSummaries []string
+
+	// StaleIndexEntries are the index entries (see
+	// FileSystem.rowFilename) whose row file was gone; FsckFilesystem
+	// removes them
+	StaleIndexEntries []string
+
+	// Orphaned are files that aren't valid rows, tag pairs, or
+	// summaries, e.g. ones left behind or added out of band.  They're
+	// left in place for the user to inspect.
+	Orphaned []string
+
+	// UnknownTags are the random tags that some row is tagged with
+	// but that have no TagPair, so those rows can't be found by (or
+	// show) that tag
+	UnknownTags []string
+}
+
+// FsckFilesystem checks bk, which must be a *FileSystem, for files
+// added or removed out of band: each Row's summary file (see
+// SummaryLister) and index entry (see FileSystem.rowFilename) must
+// have a row file, each row and tag file must be valid, and each
+// Row's random tags must have TagPairs.  Stale summaries and index
+// entries are removed; everything else is reported.  Directories are read a batch at a time, so huge
+// FileSystems don't have to fit in memory.
+func FsckFilesystem(bk Backend) (FsckReport, error) {
+	var report FsckReport
+
+	fs, ok := bk.(*FileSystem)
+	if !ok {
+		return report, ErrWrongBackendType
+	}
+
+	rel := func(dir, name string) string {
+		return path.Join(path.Base(dir), name)
+	}
+
+	// Stray files in the data dir itself
+	subdirs := map[string]bool{
+		path.Base(fs.tagsPath):      true,
+		path.Base(fs.rowsPath):      true,
+		path.Base(fs.summariesPath): true,
+		path.Base(fs.indexPath):     true,
+	}
+	err := eachDirEntry(fs.dataPath, func(name string) error {
+		if !subdirs[name] {
+			report.Orphaned = append(report.Orphaned, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	// Tag files
+	known := map[string]bool{}
+	err = eachDirEntry(fs.tagsPath, func(name string) error {
+		if _, err := readTagFile(fs.codec, fs.TagKey(), path.Join(fs.tagsPath, name)); err != nil {
+			report.Orphaned = append(report.Orphaned, rel(fs.tagsPath, name))
+			return nil
+		}
+		known[name] = true
+		report.TagPairs++
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	// Row files
+	unknown := map[string]bool{}
+	err = eachDirEntry(fs.rowsPath, func(name string) error {
+		rowTags, err := fs.rowFileTags(name)
+		if err != nil || !fs.validRowFile(path.Join(fs.rowsPath, name), rowTags) {
+			report.Orphaned = append(report.Orphaned, rel(fs.rowsPath, name))
+			return nil
+		}
+		report.Rows++
+
+		for _, randtag := range rowTags {
+			if !known[randtag] && !unknown[randtag] {
+				unknown[randtag] = true
+				report.UnknownTags = append(report.UnknownTags, randtag)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	// Summary files and index entries
+	err = removeStale(fs, fs.summariesPath, &report.StaleSummaries)
+	if err != nil {
+		return report, err
+	}
+	err = removeStale(fs, fs.indexPath, &report.StaleIndexEntries)
+
+	return report, err
+}
+
+// removeStale removes each file in dir whose row file is gone,
+// appending its path (relative to fs.dataPath) to *removed
+func removeStale(fs *FileSystem, dir string, removed *[]string) error {
+	return eachDirEntry(dir, func(name string) error {
+		_, err := os.Stat(path.Join(fs.rowsPath, name))
+		if err == nil {
+			return nil
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+
+		if err = os.Remove(path.Join(dir, name)); err != nil {
+			return err
+		}
+		*removed = append(*removed, path.Join(path.Base(dir), name))
+		return nil
+	})
+}
+
+// validRowFile reports whether rowTags, the random tags of row file
+// filename, are all non-empty and its contents is an encrypted Row
+func (fs *FileSystem) validRowFile(filename string, rowTags []string) bool {
+	for _, randtag := range rowTags {
+		if randtag == "" {
+			return false
+		}
+	}
+
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return false
+	}
+
+	var row rowFileData
+	if err = fs.codec.Unmarshal(b, &row); err != nil {
+		return false
+	}
+	return len(row.Encrypted) > 0 && row.Nonce != nil
+}
+
+// eachDirEntry calls fn with the name of each entry in dir, reading
+// fsckBatchSize entries at a time
+func eachDirEntry(dir string, fn func(name string) error) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for {
+		names, err := f.Readdirnames(fsckBatchSize)
+		for _, name := range names {
+			if err := fn(name); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
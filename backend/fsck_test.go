@@ -0,0 +1,84 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsckFilesystem(t *testing.T) {
+	fs, cleanup := newTestFileSystem(t)
+	defer cleanup()
+
+	mustCreateSummaryRow(t, fs, "Kept", "kept", "fsck")
+	mustCreateSummaryRow(t, fs, "Removed", "removed", "fsck", "gone")
+
+	report, err := FsckFilesystem(fs)
+	if err != nil {
+		t.Fatalf("Error from FsckFilesystem: %v", err)
+	}
+	assert.Equal(t, 2, report.Rows)
+	assert.Equal(t, 0, len(report.Orphaned))
+	assert.Equal(t, 0, len(report.StaleSummaries))
+	assert.Equal(t, 0, len(report.UnknownTags))
+
+	gone := pairsRandom(t, fs, "gone")
+	kept := pairsRandom(t, fs, "fsck")
+
+	// Remove a row file out of band, leaving its summary behind
+	rowFiles, _ := filepath.Glob(path.Join(fs.rowsPath, "*"+gone+"*"))
+	if len(rowFiles) != 1 {
+		t.Fatalf("Expected 1 row file tagged `gone`, got %d", len(rowFiles))
+	}
+	removed := path.Base(rowFiles[0])
+	if err = os.Remove(rowFiles[0]); err != nil {
+		t.Fatalf("Error removing row file: %v", err)
+	}
+
+	// Add stray files, and a copy of a row tagged with an unknown tag
+	stray := map[string]string{
+		"notes.txt":     "hi",
+		"rows/junk":     "not json",
+		"tags/badtag":   `{"plain_encrypted": "bm9wZQ==", "nonce": null}`,
+		"rows/a--b":     "{}",
+		"tags/garbage~": "",
+	}
+	for name, contents := range stray {
+		if err = ioutil.WriteFile(path.Join(fs.dataPath, name), []byte(contents), 0600); err != nil {
+			t.Fatalf("Error writing stray file: %v", err)
+		}
+	}
+
+	rowFiles, _ = filepath.Glob(path.Join(fs.rowsPath, "*"+kept+"*"))
+	b, _ := ioutil.ReadFile(rowFiles[0])
+	ioutil.WriteFile(path.Join(fs.rowsPath, "zzzzzzzzz-"+kept), b, 0600)
+
+	report, err = FsckFilesystem(fs)
+	if err != nil {
+		t.Fatalf("Error from FsckFilesystem: %v", err)
+	}
+
+	assert.Equal(t, 2, report.Rows)
+	assert.Equal(t, []string{path.Join("summaries", removed)}, report.StaleSummaries)
+	assert.Equal(t, []string{"zzzzzzzzz"}, report.UnknownTags)
+
+	sort.Strings(report.Orphaned)
+	assert.Equal(t, []string{"notes.txt", "rows/a--b", "rows/junk",
+		"tags/badtag", "tags/garbage~"}, report.Orphaned)
+
+	// Stale summaries were removed; the rest is left alone
+	report, _ = FsckFilesystem(fs)
+	assert.Equal(t, 0, len(report.StaleSummaries))
+	assert.Equal(t, 5, len(report.Orphaned))
+
+	_, err = FsckFilesystem(newMemBackend(t))
+	assert.Equal(t, ErrWrongBackendType, err)
+}
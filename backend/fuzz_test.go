@@ -0,0 +1,92 @@
+// Steve Phillips / elimisteve
+// 2017.04.15
+
+package backend
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+)
+
+func FuzzNewTagPair(f *testing.F) {
+	f.Add("")
+	f.Add("a")
+	f.Add("filename:notes:2017.txt")
+	f.Add("nul:\x00byte")
+	f.Add("invalid-utf8:\xff\xfe")
+	f.Add("café")
+	f.Add(strings.Repeat("huge", 1<<16))
+
+	key, _ := cryptag.RandomKey()
+
+	f.Fuzz(func(t *testing.T, plain string) {
+		pair, err := NewTagPair(key, plain)
+		if plain == "" {
+			if err != ErrEmptyPlainTag {
+				t.Fatalf("Expected ErrEmptyPlainTag, got %v", err)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("Error from NewTagPair(%q): %v", plain, err)
+		}
+
+		// Only what a Backend stores; plain must be recovered
+		stored := &types.TagPair{
+			PlainEncrypted: pair.PlainEncrypted,
+			Random:         pair.Random,
+			Nonce:          pair.Nonce,
+		}
+		if err = stored.Decrypt(key); err != nil {
+			t.Fatalf("Error decrypting TagPair for %q: %v", plain, err)
+		}
+		if stored.Plain() != plain {
+			t.Fatalf("Round trip failed: %q != %q", plain, stored.Plain())
+		}
+	})
+}
+
+func FuzzRowEncryptDecrypt(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte("hello"))
+	f.Add([]byte("nul\x00byte"))
+	f.Add([]byte("invalid-utf8:\xff\xfe"))
+	f.Add(bytes.Repeat([]byte{0}, 1<<20))
+
+	bk := newMemBackend(f)
+	pair, err := CreateTag(bk, "fuzz")
+	if err != nil {
+		f.Fatal(err)
+	}
+	pairs := types.TagPairs{pair}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		row, err := types.NewRowSimple(data, []string{"fuzz"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = PopulateRowBeforeSave(bk, row, pairs); err != nil {
+			t.Fatalf("Error from PopulateRowBeforeSave: %v", err)
+		}
+
+		// Only what a Backend stores
+		stored := &types.Row{
+			Encrypted:  row.Encrypted,
+			RandomTags: row.RandomTags,
+			Nonce:      row.Nonce,
+		}
+		if err = stored.Populate(bk.RowKey(), pairs); err != nil {
+			t.Fatalf("Error from Populate: %v", err)
+		}
+		if !bytes.Equal(data, stored.Decrypted()) {
+			t.Fatalf("Round trip failed for %d bytes", len(data))
+		}
+		if !stored.HasPlainTag("fuzz") {
+			t.Fatalf("Plaintag lost: %q", stored.PlainTags())
+		}
+	})
+}
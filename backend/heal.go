@@ -0,0 +1,173 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cryptag/cryptag/types"
+)
+
+// HealReport describes what HealPartialSaves found and, if asked to,
+// repaired.
+type HealReport struct {
+	// BrokenRows are the Rows (listed by their random tags joined by
+	// "-") tagged with random tags that have no TagPair
+	BrokenRows []string
+
+	// RepairedRows are the BrokenRows re-saved without their unknown
+	// random tags; empty unless repairing
+	RepairedRows []string
+
+	// UnknownTags are the random tags, found on Rows, that had no
+	// TagPair
+	UnknownTags []string
+
+	// RemovedTagPairs are the plaintags of the unused TagPairs
+	// removed; empty unless repairing
+	RemovedTagPairs []string
+
+	// UnremovedTagPairs are the plaintags of the unused TagPairs that
+	// would have been removed if repairing and if the Backend could
+	// delete TagPairs (see TagPairDeleter)
+	UnremovedTagPairs []string
+}
+
+// HealPartialSaves finds, and if repair is true repairs, what saves
+// cut short (e.g., by a crash or a lost connection) can leave behind
+// in bk:
+//
+// Rows tagged with random tags that have no TagPair, which can't be
+// found by (or show) those tags.  The plaintags of those random tags
+// can't be recovered, so repairing re-saves such Rows without them
+// so that they're consistent again, permanently dropping those tags;
+// do a dry run first and check report.UnknownTags, since it's better
+// to recreate their TagPairs (see PopulateRowRecover) if you know
+// what they were.  Decoy tags
+// (see PadTagsTo) are left alone.
+//
+// TagPairs for plaintags generated for a single Row -- those starting
+// with one of StrictAutoTagPrefixes, like "id:..." -- that no Row is
+// tagged with, which is what's left when a Row's tags are created but
+// the Row itself is never saved.  Repairing deletes these.  Other
+// unused TagPairs are kept, since they may have been created on
+// purpose (e.g., with CreateTag or ImportTags).
+//
+// With repair false, HealPartialSaves is a dry run that changes
+// nothing and just reports.
+//
+// Rows are found via bk's TagPairs, so a Row none of whose random
+// tags have a TagPair can't be found, and isn't repaired.  Don't save
+// to bk while it's being healed.
+func HealPartialSaves(bk Backend, repair bool) (*HealReport, error) {
+	report := &HealReport{}
+
+	pairs, err := bk.AllTagPairs(nil)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool, len(pairs))
+	for _, pair := range pairs {
+		known[pair.Random] = true
+	}
+
+	keys, err := allRowKeys(bk)
+	if err != nil {
+		return nil, err
+	}
+
+	used := map[string]bool{}
+	unknownSeen := map[string]bool{}
+
+	for _, key := range sortedBoolKeys(keys) {
+		randtags := strings.Split(key, "-")
+
+		var good, unknown []string
+		for _, randtag := range randtags {
+			if known[randtag] || types.IsDecoyTag(bk.RowKey(), randtag) {
+				good = append(good, randtag)
+				used[randtag] = true
+			} else {
+				unknown = append(unknown, randtag)
+			}
+		}
+		if len(unknown) == 0 {
+			continue
+		}
+
+		report.BrokenRows = append(report.BrokenRows, key)
+		for _, randtag := range unknown {
+			if !unknownSeen[randtag] {
+				unknownSeen[randtag] = true
+				report.UnknownTags = append(report.UnknownTags, randtag)
+			}
+		}
+
+		if !repair {
+			continue
+		}
+		if err = dropRowTags(bk, key, good); err != nil {
+			return report, fmt.Errorf("Error repairing row `%s`: %v", key, err)
+		}
+		report.RepairedRows = append(report.RepairedRows, key)
+	}
+
+	deleter, canDelete := bk.(TagPairDeleter)
+
+	for _, pair := range pairs {
+		if used[pair.Random] || !isAutoTag(pair.Plain()) {
+			continue
+		}
+		if !repair || !canDelete {
+			report.UnremovedTagPairs = append(report.UnremovedTagPairs, pair.Plain())
+			continue
+		}
+		if err = deleter.DeleteTagPair(pair.Random); err != nil {
+			return report, fmt.Errorf("Error deleting unused tag `%s`: %v",
+				pair.Plain(), err)
+		}
+		report.RemovedTagPairs = append(report.RemovedTagPairs, pair.Plain())
+	}
+
+	return report, nil
+}
+
+// dropRowTags re-saves the Row(s) whose key (see rowKey) is key with
+// just the random tags in keep, then deletes the originals.  keep
+// being a subset of the original tags, deleting those doesn't delete
+// the re-saved Row.
+func dropRowTags(bk Backend, key string, keep []string) error {
+	randtags := strings.Split(key, "-")
+
+	rows, err := rowsFromRandomTags(bk, randtags)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		if rowKey(row) != key {
+			continue
+		}
+		if err = rebindRow(bk, row, append([]string{}, keep...)); err != nil {
+			return err
+		}
+		if err = bk.SaveRow(row); err != nil {
+			return err
+		}
+	}
+
+	return bk.DeleteRows(randtags)
+}
+
+// isAutoTag reports whether plain starts with one of
+// StrictAutoTagPrefixes
+func isAutoTag(plain string) bool {
+	for _, prefix := range StrictAutoTagPrefixes {
+		if strings.HasPrefix(plain, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealPartialSaves(t *testing.T) {
+	mem := newMemBackend(t)
+
+	mustCreateRow(t, mem, "healthy", "note")
+
+	// A row whose "lost" TagPair is gone
+	mustCreateRow(t, mem, "half", "note", "lost")
+	lostRand := pairsRandom(t, mem, "lost")
+	if err := mem.DeleteTagPair(lostRand); err != nil {
+		t.Fatal(err)
+	}
+
+	// Tags created for a row that was never saved, and a vocabulary
+	// tag that's unused on purpose
+	createTags(t, mem, "id:never-saved", "created:20170418000000", "vocab")
+
+	// A dry run changes nothing
+	npairs := len(mem.pairs)
+	report, err := HealPartialSaves(mem, false)
+	if err != nil {
+		t.Fatalf("Error from HealPartialSaves: %v", err)
+	}
+	assert.Len(t, report.BrokenRows, 1)
+	assert.Empty(t, report.RepairedRows)
+	assert.Equal(t, []string{lostRand}, report.UnknownTags)
+	assert.Empty(t, report.RemovedTagPairs)
+	assert.Equal(t, []string{"id:never-saved", "created:20170418000000"},
+		report.UnremovedTagPairs)
+	assert.Len(t, mem.pairs, npairs)
+	var stillLost bool
+	for _, row := range mem.rows {
+		stillLost = stillLost || row.HasRandomTag(lostRand)
+	}
+	assert.True(t, stillLost)
+
+	report, err = HealPartialSaves(mem, true)
+	if err != nil {
+		t.Fatalf("Error from HealPartialSaves: %v", err)
+	}
+
+	assert.Len(t, report.RepairedRows, 1)
+	assert.Equal(t, []string{lostRand}, report.UnknownTags)
+	assert.Equal(t, []string{"id:never-saved", "created:20170418000000"},
+		report.RemovedTagPairs)
+	assert.Empty(t, report.UnremovedTagPairs)
+
+	// The repaired row is intact and consistent
+	assert.Equal(t, []string{"half", "healthy"}, rowData(t, mem, "note"))
+	for _, row := range mem.rows {
+		assert.False(t, row.HasRandomTag(lostRand))
+	}
+	assert.Len(t, mem.rows, 2)
+
+	// The vocabulary tag is kept
+	pairsRandom(t, mem, "vocab")
+
+	// Healing again finds nothing to do
+	report, err = HealPartialSaves(mem, true)
+	if err != nil {
+		t.Fatalf("Error from HealPartialSaves: %v", err)
+	}
+	assert.Empty(t, report.BrokenRows)
+	assert.Empty(t, report.RepairedRows)
+	assert.Empty(t, report.RemovedTagPairs)
+}
@@ -25,10 +25,20 @@ func ListRowsFromPlainTags(bk Backend, pairs types.TagPairs, plaintags cryptag.P
 	return getRows(bk, pairs, plaintags, bk.ListRows)
 }
 
+// ListAllRows lists every Row in bk, relying on every Row being tagged
+// with AllTag (see AddAllTag).  Rows saved with SkipAllTag set are not
+// included.
+func ListAllRows(bk Backend, pairs types.TagPairs) (types.Rows, error) {
+	return ListRowsFromPlainTags(bk, pairs, cryptag.PlainTags{AllTag})
+}
+
+// getRows fetches the Rows in bk tagged with all of plaintags and
+// decrypts them.  If only some fail to decrypt, the ones that didn't
+// are returned along with the *types.RowsError.
 func getRows(bk Backend, pairs types.TagPairs, plaintags cryptag.PlainTags, fetchByRandom func(cryptag.RandomTags) (types.Rows, error)) (types.Rows, error) {
 	if pairs == nil {
 		var err error
-		pairs, err = bk.AllTagPairs(nil)
+		pairs, err = partialTagPairs(bk.AllTagPairs(nil))
 		if err != nil {
 			return nil, err
 		}
@@ -38,12 +48,14 @@ func getRows(bk Backend, pairs types.TagPairs, plaintags cryptag.PlainTags, fetc
 		return nil, types.ErrTagPairNotFound
 	}
 
-	matches, err := pairs.WithAllPlainTags(plaintags)
+	matches, err := pairs.WithAllPlainTags(normalizeTags(plaintags))
 	if err != nil {
 		return nil, err
 	}
 
-	rows, err := fetchByRandom(matches.AllRandom())
+	randtags := matches.AllRandom()
+
+	rows, err := fetchByRandom(randtags)
 	if err != nil {
 		return nil, err
 	}
@@ -52,8 +64,44 @@ func getRows(bk Backend, pairs types.TagPairs, plaintags cryptag.PlainTags, fetc
 		return nil, types.ErrRowsNotFound
 	}
 
-	if err := rows.Populate(bk.Key(), pairs); err != nil {
-		return nil, err
+	// A Row not tagged with every queried tag is some other Row's
+	// record being passed off as a match
+	errs := make([]error, len(rows))
+	var queried types.Rows
+	for i, row := range rows {
+		if !hasQueriedTags(row, randtags) {
+			errs[i] = types.ErrTagsMismatch
+			continue
+		}
+		queried = append(queried, row)
+	}
+
+	var popErrs []error
+	if err := queried.Populate(bk.RowKey(), pairs); err != nil {
+		rowsErr, ok := err.(*types.RowsError)
+		if !ok {
+			return nil, err
+		}
+		popErrs = rowsErr.Errs
+	}
+
+	var good types.Rows
+	var failed bool
+	for i, j := 0, 0; i < len(rows); i++ {
+		if errs[i] == nil {
+			if popErrs != nil {
+				errs[i] = popErrs[j]
+			}
+			j++
+		}
+		if errs[i] != nil {
+			failed = true
+			continue
+		}
+		good = append(good, rows[i])
+	}
+	if failed {
+		return good, types.NewRowsError(errs)
 	}
 
 	return rows, nil
@@ -62,13 +110,13 @@ func getRows(bk Backend, pairs types.TagPairs, plaintags cryptag.PlainTags, fetc
 func DeleteRows(bk Backend, pairs types.TagPairs, plaintags cryptag.PlainTags) error {
 	if pairs == nil {
 		var err error
-		pairs, err = bk.AllTagPairs(nil)
+		pairs, err = partialTagPairs(bk.AllTagPairs(nil))
 		if err != nil {
 			return err
 		}
 	}
 
-	matches, err := pairs.WithAllPlainTags(plaintags)
+	matches, err := pairs.WithAllPlainTags(normalizeTags(plaintags))
 	if err != nil {
 		return err
 	}
@@ -84,6 +132,19 @@ func DeleteRows(bk Backend, pairs types.TagPairs, plaintags cryptag.PlainTags) e
 }
 
 func CreateRow(bk Backend, pairs types.TagPairs, rowData []byte, plaintags []string) (*types.Row, error) {
+	skipAllTag := false
+	return createRow(bk, pairs, rowData, plaintags, skipAllTag)
+}
+
+// CreatePrivateRow is like CreateRow, but the Row created isn't
+// tagged with AllTag (see types.Row.SkipAllTag), so it won't show up
+// in ListAllRows; it can only be found by its other tags.
+func CreatePrivateRow(bk Backend, pairs types.TagPairs, rowData []byte, plaintags []string) (*types.Row, error) {
+	skipAllTag := true
+	return createRow(bk, pairs, rowData, plaintags, skipAllTag)
+}
+
+func createRow(bk Backend, pairs types.TagPairs, rowData []byte, plaintags []string, skipAllTag bool) (*types.Row, error) {
 	if types.Debug {
 		log.Printf("Creating row with data of length %d and tags `%#v`\n",
 			len(rowData), plaintags)
@@ -93,9 +154,10 @@ func CreateRow(bk Backend, pairs types.TagPairs, rowData []byte, plaintags []str
 	if err != nil {
 		return nil, err
 	}
+	row.SkipAllTag = skipAllTag
 
 	if pairs == nil {
-		pairs, err = bk.AllTagPairs(nil)
+		pairs, err = partialTagPairs(bk.AllTagPairs(nil))
 		if err != nil {
 			return nil, err
 		}
@@ -148,7 +210,7 @@ func CreateJSONRow(bk Backend, pairs types.TagPairs, obj interface{}, plaintags
 func UpdateRow(bk Backend, pairs types.TagPairs, prevIDTag string, newData []byte) (*types.Row, error) {
 	var err error
 	if pairs == nil {
-		pairs, err = bk.AllTagPairs(nil)
+		pairs, err = partialTagPairs(bk.AllTagPairs(nil))
 		if err != nil {
 			return nil, err
 		}
@@ -227,7 +289,7 @@ func UpdateRowAdvanced(bk Backend, pairs types.TagPairs, oldRow *types.Row, newD
 func UpdateFileRow(bk Backend, pairs types.TagPairs, prevIDTag string, newFilename string) (*types.Row, error) {
 	var err error
 	if pairs == nil {
-		pairs, err = bk.AllTagPairs(nil)
+		pairs, err = partialTagPairs(bk.AllTagPairs(nil))
 		if err != nil {
 			return nil, err
 		}
@@ -0,0 +1,90 @@
+// Steve Phillips / elimisteve
+// 2017.04.02
+
+package backend
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultHTTPConfig is used by HTTP-based Backends whose Config
+	// doesn't specify an HTTPConfig.
+	DefaultHTTPConfig = HTTPConfig{
+		Timeout:             HttpGetTimeout,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 10,
+	}
+)
+
+// HTTPConfig configures the HTTP client used by HTTP-based Backends
+// (e.g., WebserverBackend, DropboxRemote).  Backends with identical
+// HTTPConfigs share one *http.Client and therefore one connection
+// pool.
+type HTTPConfig struct {
+	// Timeout is the total time limit for each request, including
+	// reading the response body.  Zero means DefaultHTTPConfig.Timeout.
+	Timeout time.Duration
+
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+
+	// InsecureSkipVerify disables TLS certificate verification.  Only
+	// useful for talking to test servers with self-signed certs!
+	InsecureSkipVerify bool `json:",omitempty"`
+}
+
+// A clientMap stores the *http.Client values shared between Backends,
+// keyed by the HTTPConfig used to create them
+type clientMap struct {
+	mu sync.Mutex
+	m  map[HTTPConfig]*http.Client
+}
+
+var clients = clientMap{m: map[HTTPConfig]*http.Client{}}
+
+// HTTPClient returns the shared *http.Client configured by hc,
+// creating it if need be.  If hc is nil, DefaultHTTPConfig is used.
+func HTTPClient(hc *HTTPConfig) *http.Client {
+	cfg := DefaultHTTPConfig
+	if hc != nil {
+		cfg = *hc
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultHTTPConfig.Timeout
+	}
+
+	clients.mu.Lock()
+	defer clients.mu.Unlock()
+
+	if c, exists := clients.m[cfg]; exists {
+		return c
+	}
+
+	c := newHTTPClient(cfg)
+	clients.m[cfg] = c
+	return c
+}
+
+func newHTTPClient(cfg HTTPConfig) *http.Client {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		Dial: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).Dial,
+		TLSHandshakeTimeout: 10 * time.Second,
+		MaxIdleConns:        cfg.MaxIdleConns,
+		MaxIdleConnsPerHost: cfg.MaxIdleConnsPerHost,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	if cfg.InsecureSkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	return &http.Client{Transport: transport, Timeout: cfg.Timeout}
+}
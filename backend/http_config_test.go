@@ -0,0 +1,65 @@
+// Steve Phillips / elimisteve
+// 2017.04.02
+
+package backend
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cryptag/cryptag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPConfigTimeout(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+		w.Write([]byte("[]"))
+	}))
+	defer slow.Close()
+
+	key, _ := cryptag.RandomKey()
+
+	cfg := &Config{
+		Name: "slow-webserver",
+		Type: TypeWebserver,
+		Key:  key,
+		Custom: WebserverConfigToMap(WebserverConfig{
+			AuthToken: "token",
+			BaseURL:   slow.URL,
+		}),
+		HTTP: &HTTPConfig{Timeout: 50 * time.Millisecond},
+	}
+
+	ws, err := WebserverFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("Error from WebserverFromConfig: %v", err)
+	}
+
+	_, err = ws.AllTagPairs(nil)
+	if err == nil {
+		t.Fatal("Request to slow server didn't time out, should have")
+	}
+
+	// Same config with a generous timeout succeeds
+	ws.SetHTTPConfig(&HTTPConfig{Timeout: 5 * time.Second})
+
+	pairs, err := ws.AllTagPairs(nil)
+	if err != nil {
+		t.Fatalf("Error from AllTagPairs: %v", err)
+	}
+	assert.Equal(t, 0, len(pairs))
+}
+
+func TestHTTPClientShared(t *testing.T) {
+	hc := &HTTPConfig{Timeout: 3 * time.Second, MaxIdleConns: 7}
+	hc2 := *hc
+
+	assert.True(t, HTTPClient(hc) == HTTPClient(&hc2),
+		"Identical HTTPConfigs should share one *http.Client")
+	assert.True(t, HTTPClient(nil) == HTTPClient(&DefaultHTTPConfig))
+	assert.False(t, HTTPClient(hc) == HTTPClient(nil))
+	assert.Equal(t, 3*time.Second, HTTPClient(hc).Timeout)
+}
@@ -0,0 +1,137 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cryptag/cryptag/types"
+)
+
+var (
+	// ImportChecksumPrefix prefixes the tag that ImportDir tags each
+	// imported Row with, followed by the hex-encoded SHA-256 of the
+	// file it was imported from.
+	ImportChecksumPrefix = "sha256:"
+)
+
+// ImportDir creates a Row for each file in dir (and its
+// subdirectories) whose data is the file's contents and whose tags are
+// returned by tagFromPath, which is passed the file's path relative to
+// dir.  If tagFromPath is nil, ImportTagsFromPath is used.
+//
+// Each Row is also tagged with the file's checksum (see
+// ImportChecksumPrefix), and files for which a Row tagged with both
+// that checksum and the tags from tagFromPath already exists are
+// skipped, so ImportDir can safely be re-run on the same dir, while
+// identical files at different paths are each imported.  Returns the
+// number of Rows created.
+func ImportDir(bk Backend, dir string, tagFromPath func(path string) []string) (int, error) {
+	if tagFromPath == nil {
+		tagFromPath = ImportTagsFromPath
+	}
+
+	pairs, err := bk.AllTagPairs(nil)
+	if err != nil {
+		return 0, err
+	}
+
+	imported := 0
+
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("Error reading file `%s`: %v", path, err)
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		sumTag := ImportChecksumPrefix + importChecksum(data)
+		plaintags := append(tagFromPath(filepath.ToSlash(rel)), sumTag)
+
+		done, err := alreadyImported(bk, pairs, plaintags)
+		if err != nil {
+			return err
+		}
+		if done {
+			if types.Debug {
+				log.Printf("Skipping already-imported file `%s`\n", path)
+			}
+			return nil
+		}
+
+		row, err := types.NewRow(data, plaintags)
+		if err != nil {
+			return err
+		}
+
+		newPairs, err := PopulateRowBeforeSave(bk, row, pairs)
+		if err != nil {
+			return fmt.Errorf("Error importing file `%s`: %v", path, err)
+		}
+		pairs = append(pairs, newPairs...)
+
+		if err = bk.SaveRow(row); err != nil {
+			return fmt.Errorf("Error importing file `%s`: %v", path, err)
+		}
+
+		imported++
+		return nil
+	})
+
+	return imported, err
+}
+
+// ImportTagsFromPath is ImportDir's default tagFromPath.  It tags each
+// Row with the name of the file it was imported from (without its
+// extension) and with "filename:" followed by its full filename.
+func ImportTagsFromPath(path string) []string {
+	base := filepath.Base(path)
+	name := strings.TrimSuffix(base, filepath.Ext(base))
+	if name == "" {
+		return []string{"filename:" + base}
+	}
+	return []string{name, "filename:" + base}
+}
+
+// alreadyImported reports whether any Row in bk is tagged with all of
+// plaintags
+func alreadyImported(bk Backend, pairs types.TagPairs, plaintags []string) (bool, error) {
+	matches, err := pairs.WithAllPlainTags(normalizeTags(plaintags))
+	if err != nil || len(matches) == 0 {
+		// Some tag doesn't exist, so no such Row
+		return false, nil
+	}
+
+	rows, err := listRows(bk, matches.AllRandom())
+	if err == types.ErrRowsNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return len(rows) > 0, nil
+}
+
+func importChecksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,120 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cryptag/cryptag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cryptag-import-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"groceries.txt":      "eggs, milk",
+		"work/standup.md":    "Ship the importer",
+		"work/ideas/todo.md": "Write more tests",
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bk := newMemBackend(t)
+
+	n, err := ImportDir(bk, dir, nil)
+	if err != nil {
+		t.Fatalf("Error from ImportDir: %v", err)
+	}
+	assert.Equal(t, 3, n)
+
+	rows, err := RowsFromPlainTags(bk, nil, cryptag.PlainTags{"standup",
+		"filename:standup.md"})
+	if err != nil {
+		t.Fatalf("Error from RowsFromPlainTags: %v", err)
+	}
+	assert.Equal(t, 1, len(rows))
+	assert.Equal(t, "Ship the importer", string(rows[0].Decrypted()))
+	assert.Equal(t, 1, len(filterPrefix(rows[0].PlainTags(), ImportChecksumPrefix)))
+
+	// Re-running imports nothing new
+	n, err = ImportDir(bk, dir, nil)
+	if err != nil {
+		t.Fatalf("Error from second ImportDir: %v", err)
+	}
+	assert.Equal(t, 0, n)
+
+	all, _ := ListAllRows(bk, nil)
+	assert.Equal(t, 3, len(all))
+
+	// Only new and changed files are imported, including copies of
+	// already-imported files at other paths
+	err = ioutil.WriteFile(filepath.Join(dir, "groceries.txt"),
+		[]byte("eggs, milk, bread"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "standup-copy.md"),
+		[]byte(files["work/standup.md"]), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err = ImportDir(bk, dir, nil)
+	if err != nil {
+		t.Fatalf("Error from third ImportDir: %v", err)
+	}
+	assert.Equal(t, 2, n)
+
+	rows, err = RowsFromPlainTags(bk, nil, cryptag.PlainTags{"filename:standup-copy.md"})
+	if err != nil {
+		t.Fatalf("Error from RowsFromPlainTags: %v", err)
+	}
+	assert.Equal(t, 1, len(rows))
+	assert.Equal(t, "Ship the importer", string(rows[0].Decrypted()))
+
+	// Files are tagged by tagFromPath
+	tagFromPath := func(path string) []string {
+		return []string{"imported", "path:" + path}
+	}
+	bk = newMemBackend(t)
+	n, err = ImportDir(bk, dir, tagFromPath)
+	if err != nil {
+		t.Fatalf("Error from fourth ImportDir: %v", err)
+	}
+	assert.Equal(t, 4, n)
+
+	rows, err = RowsFromPlainTags(bk, nil, cryptag.PlainTags{"imported",
+		"path:groceries.txt"})
+	if err != nil {
+		t.Fatalf("Error from RowsFromPlainTags: %v", err)
+	}
+	assert.Equal(t, 1, len(rows))
+	assert.Equal(t, "eggs, milk, bread", string(rows[0].Decrypted()))
+}
+
+func filterPrefix(plaintags []string, prefix string) []string {
+	var matches []string
+	for _, plain := range plaintags {
+		if strings.HasPrefix(plain, prefix) {
+			matches = append(matches, plain)
+		}
+	}
+	return matches
+}
@@ -0,0 +1,82 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"sort"
+
+	"github.com/cryptag/cryptag/types"
+)
+
+// TagInfo describes one TagPair in a Backend and how many Rows are
+// tagged with it.
+type TagInfo struct {
+	Plain  string
+	Random string
+	Rows   int
+}
+
+// TagInventory returns a TagInfo for every TagPair in bk, including
+// those no Row is tagged with (whose Rows is 0), sorted by usage, most
+// used first (then by plaintag).  System tags (see IsSystemTag) are
+// left out; use TagInventoryWithSystem to include them.
+//
+// Usage is counted with one ListRows call per TagPair, so every Row
+// is counted, whether or not it's tagged with AllTag (see AddAllTag
+// and types.Row.SkipAllTag).
+func TagInventory(bk Backend) ([]TagInfo, error) {
+	includeSystem := false
+	return tagInventory(bk, includeSystem)
+}
+
+// TagInventoryWithSystem is like TagInventory, but includes system
+// tags.
+func TagInventoryWithSystem(bk Backend) ([]TagInfo, error) {
+	includeSystem := true
+	return tagInventory(bk, includeSystem)
+}
+
+func tagInventory(bk Backend, includeSystem bool) ([]TagInfo, error) {
+	pairs, err := bk.AllTagPairs(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	inventory := make([]TagInfo, 0, len(pairs))
+	for _, pair := range pairs {
+		if !includeSystem && IsSystemTag(pair.Plain()) {
+			continue
+		}
+
+		rows, err := listRows(bk, []string{pair.Random})
+		if err != nil && err != types.ErrRowsNotFound {
+			return nil, err
+		}
+
+		inventory = append(inventory, TagInfo{
+			Plain:  pair.Plain(),
+			Random: pair.Random,
+			Rows:   len(rows),
+		})
+	}
+
+	sort.Sort(byUsage(inventory))
+
+	return inventory, nil
+}
+
+type byUsage []TagInfo
+
+func (infos byUsage) Len() int      { return len(infos) }
+func (infos byUsage) Swap(i, j int) { infos[i], infos[j] = infos[j], infos[i] }
+
+func (infos byUsage) Less(i, j int) bool {
+	if infos[i].Rows != infos[j].Rows {
+		return infos[i].Rows > infos[j].Rows
+	}
+	if infos[i].Plain != infos[j].Plain {
+		return infos[i].Plain < infos[j].Plain
+	}
+	return infos[i].Random < infos[j].Random
+}
@@ -0,0 +1,60 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTagInventory(t *testing.T) {
+	bk := newMemBackend(t)
+
+	mustCreateRow(t, bk, "one", "work", "urgent")
+	mustCreateRow(t, bk, "two", "work")
+	mustCreateRow(t, bk, "three", "work", "home", "system:pinned")
+	createTags(t, bk, "unused")
+
+	// Rows without AllTag are counted too
+	if _, err := CreatePrivateRow(bk, nil, []byte("four"), []string{"work"}); err != nil {
+		t.Fatalf("Error from CreatePrivateRow: %v", err)
+	}
+
+	inventory, err := TagInventoryWithSystem(bk)
+	if err != nil {
+		t.Fatalf("Error from TagInventoryWithSystem: %v", err)
+	}
+
+	counts := map[string]int{}
+	for _, info := range inventory {
+		assert.NotEqual(t, "", info.Random)
+		counts[info.Plain] = info.Rows
+	}
+
+	assert.Equal(t, 3, counts[AllTag])
+	assert.Equal(t, 4, counts["work"])
+	assert.Equal(t, 1, counts["urgent"])
+	assert.Equal(t, 1, counts["home"])
+
+	count, ok := counts["unused"]
+	assert.True(t, ok, "Unused tag missing from inventory")
+	assert.Equal(t, 0, count)
+
+	// Most used first
+	assert.Equal(t, 4, inventory[0].Rows)
+	assert.Equal(t, "unused", inventory[len(inventory)-1].Plain)
+	for i := 1; i < len(inventory); i++ {
+		assert.True(t, inventory[i-1].Rows >= inventory[i].Rows)
+	}
+
+	assert.Equal(t, 1, counts["system:pinned"])
+
+	// System tags left out by default
+	inventory, _ = TagInventory(bk)
+	for _, info := range inventory {
+		assert.NotEqual(t, "system:pinned", info.Plain)
+	}
+	assert.Equal(t, 4, inventory[0].Rows)
+}
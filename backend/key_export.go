@@ -0,0 +1,169 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/cryptag/cryptag/types"
+)
+
+// keyExportVersion is the version of the format ExportForKey writes
+const keyExportVersion = 1
+
+type keyExport struct {
+	Version  int              `json:"version"`
+	TagPairs []*types.TagPair `json:"tag_pairs"`
+	Rows     []*types.Row     `json:"rows"`
+}
+
+// ExportForKey writes every TagPair and Row in bk to w, decrypted
+// with bk's keys and re-encrypted with newKey, so that whoever holds
+// newKey (e.g., a collaborator) can load them into their own Backend
+// with ImportForKey.  Random tags are kept, except for decoys (see
+// PadTagsTo), which are replaced with decoys for newKey.
+//
+// Nothing is written unencrypted, but the export reveals as much as
+// a Backend would: how many Rows and TagPairs there are, and which
+// random tags each Row has.
+func ExportForKey(bk Backend, newKey *[32]byte, w io.Writer) error {
+	pairs, err := bk.AllTagPairs(nil)
+	if err != nil {
+		return err
+	}
+	sort.Sort(byRandom(pairs))
+
+	export := keyExport{
+		Version:  keyExportVersion,
+		TagPairs: make([]*types.TagPair, 0, len(pairs)),
+	}
+
+	known := knownRandomTags(pairs)
+	for _, pair := range pairs {
+		moved, err := reencryptTagPair(pair, newKey)
+		if err != nil {
+			return err
+		}
+		export.TagPairs = append(export.TagPairs, moved)
+	}
+
+	keys, err := allRowKeys(bk)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range sortedBoolKeys(keys) {
+		row, err := rowByKey(bk, key)
+		if err != nil {
+			return err
+		}
+
+		randtags, err := rekeyDecoys(row.RandomTags, known, bk.RowKey(), newKey)
+		if err != nil {
+			return err
+		}
+
+		moved, err := reencryptRow(row, bk.RowKey(), newKey, randtags)
+		if err != nil {
+			return fmt.Errorf("Error re-encrypting row `%s`: %v", key, err)
+		}
+		export.Rows = append(export.Rows, moved)
+	}
+
+	return json.NewEncoder(w).Encode(export)
+}
+
+// ImportForKey saves to bk the TagPairs and Rows written to r by
+// ExportForKey, which must have been given bk's key.  TagPairs whose
+// plaintag bk already has are skipped, and the imported Rows tagged
+// with them re-tagged with bk's; Rows bk already has are skipped, so
+// importing is safe to repeat.
+func ImportForKey(bk Backend, r io.Reader) error {
+	var export keyExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return fmt.Errorf("Error parsing export: %v", err)
+	}
+	if export.Version != keyExportVersion {
+		return fmt.Errorf("Export is of unsupported version %d", export.Version)
+	}
+
+	existing, err := bk.AllTagPairs(nil)
+	if err != nil {
+		return err
+	}
+	byPlain := map[string]string{}
+	byRandom := map[string]string{}
+	for _, pair := range existing {
+		byPlain[pair.Plain()] = pair.Random
+		byRandom[pair.Random] = pair.Plain()
+	}
+
+	// Imported random tag -> bk's random tag for the same plaintag
+	remap := map[string]string{}
+
+	for _, pair := range export.TagPairs {
+		if err = pair.Decrypt(bk.TagKey()); err != nil {
+			return fmt.Errorf("Error decrypting imported tag `%s` (was it"+
+				" exported for a different key?): %v", pair.Random, err)
+		}
+		plain := pair.Plain()
+
+		if random, ok := byPlain[plain]; ok {
+			if random != pair.Random {
+				remap[pair.Random] = random
+			}
+			continue
+		}
+		if other, ok := byRandom[pair.Random]; ok {
+			return fmt.Errorf("Random tag `%s` of imported tag `%s` is"+
+				" already used by tag `%s`", pair.Random, plain, other)
+		}
+
+		if err = bk.SaveTagPair(pair); err != nil {
+			return fmt.Errorf("Error saving imported tag `%s`: %v", plain, err)
+		}
+		byPlain[plain] = pair.Random
+		byRandom[pair.Random] = plain
+	}
+
+	have, err := allRowKeys(bk)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range export.Rows {
+		if err = row.Decrypt(bk.RowKey()); err != nil {
+			return fmt.Errorf("Error decrypting imported row: %v", err)
+		}
+
+		randtags := make([]string, 0, len(row.RandomTags))
+		remapped := false
+		for _, randtag := range row.RandomTags {
+			if random, ok := remap[randtag]; ok {
+				randtag = random
+				remapped = true
+			}
+			randtags = append(randtags, randtag)
+		}
+		if remapped {
+			err = rebindRow(bk, row, canonicalRandomTags(randtags))
+			if err != nil {
+				return err
+			}
+		}
+
+		if have[rowKey(row)] {
+			continue
+		}
+		if err = bk.SaveRow(row); err != nil {
+			return fmt.Errorf("Error saving imported row: %v", err)
+		}
+		have[rowKey(row)] = true
+	}
+
+	return nil
+}
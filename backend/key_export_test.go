@@ -0,0 +1,88 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportImportForKey(t *testing.T) {
+	src := newMemBackend(t)
+	dst := newMemBackend(t)
+
+	mustCreateRow(t, src, "one", "shared", "only:src")
+	mustCreateSummaryRow(t, src, "sum", "two", "shared", "type:note")
+
+	// dst already has a tag for "shared", with a different random tag
+	mustCreateRow(t, dst, "theirs", "shared")
+
+	var buf bytes.Buffer
+	if err := ExportForKey(src, dst.Key(), &buf); err != nil {
+		t.Fatalf("Error from ExportForKey: %v", err)
+	}
+
+	// Nothing in the export is readable with src's key
+	if err := ImportForKey(src, bytes.NewReader(buf.Bytes())); err == nil {
+		t.Fatal("Expected error importing with the wrong key")
+	}
+
+	if err := ImportForKey(dst, bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("Error from ImportForKey: %v", err)
+	}
+
+	assert.Equal(t, []string{"one", "theirs", "two"}, rowData(t, dst, "shared"))
+	assert.Equal(t, []string{"one"}, rowData(t, dst, "only:src"))
+
+	rows, err := RowsFromPlainTags(dst, nil, []string{"type:note"})
+	if err != nil {
+		t.Fatalf("Error from RowsFromPlainTags: %v", err)
+	}
+	if err = rows[0].DecryptSummary(dst.RowKey()); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "sum", string(rows[0].Summary()))
+
+	// No duplicate tags, and importing again adds nothing
+	dups, err := FindDuplicateTags(dst)
+	assert.Nil(t, err)
+	assert.Empty(t, dups)
+
+	nrows := len(dst.rows)
+	if err = ImportForKey(dst, bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("Error from ImportForKey: %v", err)
+	}
+	assert.Equal(t, nrows, len(dst.rows))
+}
+
+func TestExportForKeyDecoys(t *testing.T) {
+	defer func(orig int) { PadTagsTo = orig }(PadTagsTo)
+	PadTagsTo = 8
+
+	src := newMemBackend(t)
+	dst := newMemBackend(t)
+
+	mustCreateRow(t, src, "padded", "tag")
+
+	var buf bytes.Buffer
+	if err := ExportForKey(src, dst.Key(), &buf); err != nil {
+		t.Fatalf("Error from ExportForKey: %v", err)
+	}
+	if err := ImportForKey(dst, &buf); err != nil {
+		t.Fatalf("Error from ImportForKey: %v", err)
+	}
+
+	assert.Equal(t, []string{"padded"}, rowData(t, dst, "tag"))
+
+	// The decoys' TagPairs came along
+	pairs, _ := dst.AllTagPairs(nil)
+	known := knownRandomTags(pairs)
+	row := dst.rows[0]
+	assert.Len(t, row.RandomTags, 8)
+	for _, randtag := range row.RandomTags {
+		assert.True(t, known[randtag], "No TagPair for %s", randtag)
+	}
+}
@@ -0,0 +1,147 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// LeakageTopN is how many of the most-used random tags and most
+// common pairs of them AnalyzeLeakage lists.
+var LeakageTopN = 10
+
+// LeakageReport describes the metadata a Backend's operator can see
+// despite never seeing a plaintag: how many Rows there are, how many
+// random tags each has, how often each random tag is used, and which
+// random tags tend to appear together.  See AnalyzeLeakage.
+type LeakageReport struct {
+	Rows           int
+	TagPairs       int
+	UsedTags       int // Random tags on at least one Row
+	UnusedTagPairs int
+
+	// TagsPerRow maps a number of random tags to how many Rows have
+	// that many.  Rows with an unusual number of tags stand out.
+	TagsPerRow map[int]int
+
+	// UsageHistogram maps a number of Rows to how many random tags
+	// are on exactly that many Rows.
+	UsageHistogram map[int]int
+
+	// UsageEntropy is the Shannon entropy, in bits, of which random
+	// tag a tag on a Row is.  The lower it is relative to
+	// log2(UsedTags), the more skewed -- and so the more telling --
+	// tag usage is.
+	UsageEntropy float64
+
+	// TopTags are the LeakageTopN most-used random tags, with their
+	// plaintags (which the adversary doesn't see) filled in where
+	// known
+	TopTags []TagInfo
+
+	// TopCooccurrences are the LeakageTopN pairs of random tags found
+	// together on the most Rows
+	TopCooccurrences []TagCooccurrence
+}
+
+// TagCooccurrence is how many Rows two random tags are both on.
+type TagCooccurrence struct {
+	Random1, Random2 string
+	Rows             int
+}
+
+// AnalyzeLeakage reports what an adversary with access to bk's stored
+// data could learn from its unencrypted metadata alone -- random tag
+// counts and co-occurrence -- e.g. to decide whether padding tag sets
+// is worthwhile.  Nothing is decrypted or modified.
+func AnalyzeLeakage(bk Backend) (LeakageReport, error) {
+	report := LeakageReport{
+		TagsPerRow:     map[int]int{},
+		UsageHistogram: map[int]int{},
+	}
+
+	pairs, err := bk.AllTagPairs(nil)
+	if err != nil {
+		return report, err
+	}
+	report.TagPairs = len(pairs)
+
+	keys, err := allRowKeys(bk)
+	if err != nil {
+		return report, err
+	}
+	report.Rows = len(keys)
+
+	usage := map[string]int{}
+	cooccur := map[[2]string]int{}
+	total := 0
+
+	for key := range keys {
+		randtags := canonicalRandomTags(strings.Split(key, "-"))
+		report.TagsPerRow[len(randtags)]++
+
+		for i, randtag := range randtags {
+			usage[randtag]++
+			total++
+			for _, other := range randtags[i+1:] {
+				cooccur[[2]string{randtag, other}]++
+			}
+		}
+	}
+
+	report.UsedTags = len(usage)
+	plain := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		plain[pair.Random] = pair.Plain()
+		if usage[pair.Random] == 0 {
+			report.UnusedTagPairs++
+		}
+	}
+
+	for randtag, n := range usage {
+		report.UsageHistogram[n]++
+
+		p := float64(n) / float64(total)
+		report.UsageEntropy -= p * math.Log2(p)
+
+		report.TopTags = append(report.TopTags, TagInfo{
+			Plain:  plain[randtag],
+			Random: randtag,
+			Rows:   n,
+		})
+	}
+	sort.Sort(byUsage(report.TopTags))
+	if len(report.TopTags) > LeakageTopN {
+		report.TopTags = report.TopTags[:LeakageTopN]
+	}
+
+	for both, n := range cooccur {
+		report.TopCooccurrences = append(report.TopCooccurrences,
+			TagCooccurrence{Random1: both[0], Random2: both[1], Rows: n})
+	}
+	sort.Sort(byCooccurrence(report.TopCooccurrences))
+	if len(report.TopCooccurrences) > LeakageTopN {
+		report.TopCooccurrences = report.TopCooccurrences[:LeakageTopN]
+	}
+
+	return report, nil
+}
+
+// byCooccurrence sorts by number of Rows, descending, then by random
+// tags
+type byCooccurrence []TagCooccurrence
+
+func (c byCooccurrence) Len() int      { return len(c) }
+func (c byCooccurrence) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+func (c byCooccurrence) Less(i, j int) bool {
+	if c[i].Rows != c[j].Rows {
+		return c[i].Rows > c[j].Rows
+	}
+	if c[i].Random1 != c[j].Random1 {
+		return c[i].Random1 < c[j].Random1
+	}
+	return c[i].Random2 < c[j].Random2
+}
@@ -0,0 +1,69 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"testing"
+
+	"github.com/cryptag/cryptag/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyzeLeakage(t *testing.T) {
+	mem := newMemBackend(t)
+
+	pairs := createTags(t, mem, "a", "b", "c", "unused")
+	a, b, c := pairs[0].Random, pairs[1].Random, pairs[2].Random
+
+	// a is on every row, b on half, c on one; each row also has its
+	// own id tag, like those types.NewRow adds
+	tagSets := [][]string{{a, b}, {a, b}, {a, b}, {a, c}, {a}, {a}}
+	for i, randtags := range tagSets {
+		id := createTags(t, mem, fmt.Sprintf("id:%d", i))[0]
+		err := mem.SaveRow(&types.Row{
+			Encrypted:  []byte{byte(i)},
+			Nonce:      &[24]byte{byte(i) + 1},
+			RandomTags: append(randtags, id.Random),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := AnalyzeLeakage(mem)
+	if err != nil {
+		t.Fatalf("Error from AnalyzeLeakage: %v", err)
+	}
+
+	assert.Equal(t, 6, report.Rows)
+	assert.Equal(t, 10, report.TagPairs)
+	assert.Equal(t, 9, report.UsedTags)
+	assert.Equal(t, 1, report.UnusedTagPairs)
+	assert.Equal(t, map[int]int{3: 4, 2: 2}, report.TagsPerRow)
+	assert.Equal(t, map[int]int{6: 1, 3: 1, 1: 7}, report.UsageHistogram)
+
+	if assert.True(t, len(report.TopTags) >= 2) {
+		assert.Equal(t, TagInfo{Plain: "a", Random: a, Rows: 6}, report.TopTags[0])
+		assert.Equal(t, TagInfo{Plain: "b", Random: b, Rows: 3}, report.TopTags[1])
+	}
+
+	if assert.NotEmpty(t, report.TopCooccurrences) {
+		ab := []string{a, b}
+		sort.Strings(ab)
+		top := report.TopCooccurrences[0]
+		assert.Equal(t, TagCooccurrence{Random1: ab[0], Random2: ab[1], Rows: 3}, top)
+	}
+
+	// Usage counts are 6, 3, and seven 1s, out of 16 tags total
+	want := 0.0
+	for _, n := range []float64{6, 3, 1, 1, 1, 1, 1, 1, 1} {
+		want -= n / 16 * math.Log2(n/16)
+	}
+	assert.InDelta(t, want, report.UsageEntropy, 1e-9)
+	assert.True(t, report.UsageEntropy < math.Log2(9),
+		"Skewed usage should have less than maximal entropy")
+}
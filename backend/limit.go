@@ -0,0 +1,107 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"errors"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+)
+
+var (
+	ErrNegativeLimit = errors.New("backend: offset and limit must not be negative")
+)
+
+// Limiter is implemented by Backends that can stop looking for Rows
+// once they've found a page's worth, rather than fetching every match
+// just for the caller to throw most of them away.
+//
+// Each method skips the first offset matching Rows, then returns at
+// most limit Rows, in the same order as ListRows and
+// RowsFromRandomTags.  A limit of 0 means no limit.
+type Limiter interface {
+	ListRowsLimit(randtags cryptag.RandomTags, offset, limit int) (types.Rows, error)
+	RowsFromRandomTagsLimit(randtags cryptag.RandomTags, offset, limit int) (types.Rows, error)
+}
+
+// ListRowsLimit is like bk.ListRows, but skips the first offset
+// matching Rows and returns at most limit Rows, or every Row after
+// offset if limit is 0.  If bk doesn't implement Limiter, every match
+// is fetched then trimmed.  Returns types.ErrRowsNotFound if no Rows
+// are left after offset.
+func ListRowsLimit(bk Backend, randtags cryptag.RandomTags, offset, limit int) (types.Rows, error) {
+	if offset < 0 || limit < 0 {
+		return nil, ErrNegativeLimit
+	}
+	if lim, ok := bk.(Limiter); ok {
+		return lim.ListRowsLimit(randtags, offset, limit)
+	}
+
+	rows, err := listRows(bk, randtags)
+	if err != nil {
+		return nil, err
+	}
+	return applyLimit(rows, offset, limit)
+}
+
+// RowsFromRandomTagsLimit is like ListRowsLimit, but fetches the Rows'
+// data, too (see Backend.RowsFromRandomTags).
+func RowsFromRandomTagsLimit(bk Backend, randtags cryptag.RandomTags, offset, limit int) (types.Rows, error) {
+	if offset < 0 || limit < 0 {
+		return nil, ErrNegativeLimit
+	}
+	if lim, ok := bk.(Limiter); ok {
+		return lim.RowsFromRandomTagsLimit(randtags, offset, limit)
+	}
+
+	rows, err := rowsFromRandomTags(bk, randtags)
+	if err != nil {
+		return nil, err
+	}
+	return applyLimit(rows, offset, limit)
+}
+
+// RowsFromPlainTagsLimit is like RowsFromPlainTags, but returns one
+// page of results; see ListRowsLimit.
+func RowsFromPlainTagsLimit(bk Backend, pairs types.TagPairs, plaintags cryptag.PlainTags, offset, limit int) (types.Rows, error) {
+	return getRows(bk, pairs, plaintags, func(randtags cryptag.RandomTags) (types.Rows, error) {
+		return RowsFromRandomTagsLimit(bk, randtags, offset, limit)
+	})
+}
+
+// ListRowsFromPlainTagsLimit is like ListRowsFromPlainTags, but
+// returns one page of results; see ListRowsLimit.
+func ListRowsFromPlainTagsLimit(bk Backend, pairs types.TagPairs, plaintags cryptag.PlainTags, offset, limit int) (types.Rows, error) {
+	return getRows(bk, pairs, plaintags, func(randtags cryptag.RandomTags) (types.Rows, error) {
+		return ListRowsLimit(bk, randtags, offset, limit)
+	})
+}
+
+// applyLimit returns the page of rows starting at offset of at most
+// limit Rows (or all of them if limit is 0)
+func applyLimit(rows types.Rows, offset, limit int) (types.Rows, error) {
+	if offset >= len(rows) {
+		return nil, types.ErrRowsNotFound
+	}
+	rows = rows[offset:]
+
+	if limit > 0 && limit < len(rows) {
+		rows = rows[:limit]
+	}
+	return rows, nil
+}
+
+// inPage reports whether the nth (0-indexed) matching Row belongs in
+// the page starting at offset of at most limit Rows, and whether the
+// page is complete after it (so the caller can stop looking)
+func inPage(n, offset, limit int) (include, done bool) {
+	if n < offset {
+		return false, false
+	}
+	if limit == 0 {
+		return true, false
+	}
+	return n < offset+limit, n >= offset+limit-1
+}
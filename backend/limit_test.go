@@ -0,0 +1,91 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRowsFromPlainTagsLimit(t *testing.T) {
+	fs, cleanup := newTestFileSystem(t)
+	defer cleanup()
+
+	for i := 0; i < 5; i++ {
+		mustCreateRow(t, fs, fmt.Sprintf("row %d", i), "page")
+	}
+
+	all, err := RowsFromPlainTags(fs, nil, cryptag.PlainTags{"page"})
+	if err != nil {
+		t.Fatalf("Error from RowsFromPlainTags: %v", err)
+	}
+
+	// FileSystem implements Limiter; ReadOnly hides that, so trimming
+	// happens after fetching every Row
+	backends := []Backend{fs, ReadOnly(fs)}
+
+	for _, bk := range backends {
+		page := func(offset, limit int) []string {
+			rows, err := RowsFromPlainTagsLimit(bk, nil, cryptag.PlainTags{"page"},
+				offset, limit)
+			if err != nil {
+				t.Fatalf("Error from RowsFromPlainTagsLimit(%d, %d): %v",
+					offset, limit, err)
+			}
+			var data []string
+			for _, row := range rows {
+				data = append(data, string(row.Decrypted()))
+			}
+			return data
+		}
+
+		want := func(rows types.Rows) []string {
+			var data []string
+			for _, row := range rows {
+				data = append(data, string(row.Decrypted()))
+			}
+			return data
+		}
+
+		assert.Equal(t, want(all[:2]), page(0, 2))
+		assert.Equal(t, want(all[2:4]), page(2, 2))
+		assert.Equal(t, want(all[4:]), page(4, 2))
+
+		// Limit of 0 means no limit
+		assert.Equal(t, want(all), page(0, 0))
+		assert.Equal(t, want(all[3:]), page(3, 0))
+
+		_, err = RowsFromPlainTagsLimit(bk, nil, cryptag.PlainTags{"page"}, 5, 2)
+		assert.Equal(t, types.ErrRowsNotFound, err)
+
+		_, err = RowsFromPlainTagsLimit(bk, nil, cryptag.PlainTags{"page"}, -1, 2)
+		assert.Equal(t, ErrNegativeLimit, err)
+
+		// Listing doesn't include data
+		rows, err := ListRowsFromPlainTagsLimit(bk, nil, cryptag.PlainTags{"page"}, 1, 3)
+		if err != nil {
+			t.Fatalf("Error from ListRowsFromPlainTagsLimit: %v", err)
+		}
+		assert.Equal(t, 3, len(rows))
+		assert.Nil(t, rows[0].Encrypted)
+	}
+}
+
+func TestInPage(t *testing.T) {
+	var included []int
+	for n := 0; n < 10; n++ {
+		include, done := inPage(n, 3, 4)
+		if include {
+			included = append(included, n)
+		}
+		if done {
+			break
+		}
+	}
+	assert.Equal(t, []int{3, 4, 5, 6}, included)
+}
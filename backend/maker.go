@@ -36,6 +36,9 @@ var makers = makerMap{
 		TypeSandstorm: func(cfg *Config) (Backend, error) {
 			return SandstormFromConfig(cfg)
 		},
+		TypeArchive: func(cfg *Config) (Backend, error) {
+			return NewArchive(cfg)
+		},
 	},
 }
 
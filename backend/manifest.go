@@ -0,0 +1,331 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+)
+
+var (
+	ErrManifestNotFound = errors.New("backend: No manifest found for Backend")
+	ErrManifestMAC      = errors.New("backend: Manifest failed authentication;" +
+		" wrong key or manifest was tampered with")
+)
+
+// Manifest lists the checksum of every Row and TagPair stored in a
+// Backend, so that VerifyManifest can detect a Backend that silently
+// drops, alters, or adds objects.  Rows are listed by their random
+// tags joined by "-", TagPairs by their random tag.
+//
+// Manifests are stored locally, next to Backend configs (see
+// ManifestPath), rather than in the Backend they vouch for, and are
+// authenticated with the Backend's key.
+type Manifest struct {
+	Rows     map[string]string `json:"rows"`
+	TagPairs map[string]string `json:"tag_pairs"`
+	MAC      []byte            `json:"mac"`
+}
+
+// ManifestBackend wraps a Backend so that its Manifest is updated
+// whenever anything is saved or deleted through it.
+type ManifestBackend struct {
+	Backend
+
+	mu       sync.Mutex
+	manifest *Manifest
+}
+
+// WithManifest returns a ManifestBackend that wraps bk, loading bk's
+// existing Manifest, if any.  If bk already contains data, call
+// BuildManifest to list it in the manifest.
+func WithManifest(bk Backend) (*ManifestBackend, error) {
+	m, err := LoadManifest(bk)
+	if err == ErrManifestNotFound {
+		m = &Manifest{Rows: map[string]string{}, TagPairs: map[string]string{}}
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ManifestBackend{Backend: bk, manifest: m}, nil
+}
+
+// ManifestPath returns where bk's Manifest is stored.
+func ManifestPath(bk Backend) string {
+	return path.Join(cryptag.BackendPath, bk.Name()+".manifest")
+}
+
+// LoadManifest reads and authenticates bk's Manifest.
+func LoadManifest(bk Backend) (*Manifest, error) {
+	b, err := ioutil.ReadFile(ManifestPath(bk))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrManifestNotFound
+		}
+		return nil, err
+	}
+
+	var m Manifest
+	if err = json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("Error parsing manifest: %v", err)
+	}
+	if m.Rows == nil {
+		m.Rows = map[string]string{}
+	}
+	if m.TagPairs == nil {
+		m.TagPairs = map[string]string{}
+	}
+
+	if !hmac.Equal(m.MAC, m.mac(bk.Key())) {
+		return nil, ErrManifestMAC
+	}
+
+	return &m, nil
+}
+
+// save authenticates and saves m as bk's Manifest
+func (m *Manifest) save(bk Backend) error {
+	m.MAC = m.mac(bk.Key())
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(ManifestPath(bk), b)
+}
+
+// mac returns the HMAC of m's contents (not including m.MAC)
+func (m *Manifest) mac(key *[32]byte) []byte {
+	// Maps are marshaled with sorted keys, so this is canonical
+	b, _ := json.Marshal(struct {
+		Rows     map[string]string `json:"rows"`
+		TagPairs map[string]string `json:"tag_pairs"`
+	}{m.Rows, m.TagPairs})
+
+	h := hmac.New(sha256.New, key[:])
+	h.Write(b)
+	return h.Sum(nil)
+}
+
+func (mb *ManifestBackend) SaveTagPair(pair *types.TagPair) error {
+	if err := mb.Backend.SaveTagPair(pair); err != nil {
+		return err
+	}
+
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	mb.manifest.TagPairs[pair.Random] = checksum(pair.PlainEncrypted, pair.Nonce)
+	return mb.manifest.save(mb.Backend)
+}
+
+func (mb *ManifestBackend) SaveRow(row *types.Row) error {
+	if err := mb.Backend.SaveRow(row); err != nil {
+		return err
+	}
+
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	mb.manifest.Rows[rowKey(row)] = checksum(row.Encrypted, row.Nonce)
+	return mb.manifest.save(mb.Backend)
+}
+
+func (mb *ManifestBackend) DeleteRows(randtags cryptag.RandomTags) error {
+	rows, err := mb.Backend.ListRows(randtags)
+	if err != nil {
+		return err
+	}
+
+	if err = mb.Backend.DeleteRows(randtags); err != nil {
+		return err
+	}
+
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	for _, row := range rows {
+		delete(mb.manifest.Rows, rowKey(row))
+	}
+	return mb.manifest.save(mb.Backend)
+}
+
+// DeleteTagPair deletes the TagPair whose random tag is random from
+// the wrapped Backend, which must implement TagPairDeleter.
+func (mb *ManifestBackend) DeleteTagPair(random string) error {
+	deleter, ok := mb.Backend.(TagPairDeleter)
+	if !ok {
+		return ErrCannotDeleteTagPairs
+	}
+
+	if err := deleter.DeleteTagPair(random); err != nil {
+		return err
+	}
+
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	delete(mb.manifest.TagPairs, random)
+	return mb.manifest.save(mb.Backend)
+}
+
+// BuildManifest (re)builds bk's Manifest from everything bk currently
+// stores, trusting bk's current contents.
+func BuildManifest(bk Backend) error {
+	if mb, ok := bk.(*ManifestBackend); ok {
+		mb.mu.Lock()
+		defer mb.mu.Unlock()
+
+		m, err := snapshotManifest(mb.Backend, nil)
+		if err != nil {
+			return err
+		}
+		mb.manifest = m
+		return m.save(mb.Backend)
+	}
+
+	m, err := snapshotManifest(bk, nil)
+	if err != nil {
+		return err
+	}
+	return m.save(bk)
+}
+
+// ManifestError reports each way a Backend's contents differ from its
+// Manifest.
+type ManifestError struct {
+	Missing    []string // Listed in the manifest, but not in the Backend
+	Altered    []string // Checksum doesn't match the manifest's
+	Unexpected []string // In the Backend, but not listed in the manifest
+}
+
+func (e *ManifestError) Error() string {
+	return fmt.Sprintf("Backend doesn't match its manifest: %d missing (%s),"+
+		" %d altered (%s), %d unexpected (%s)",
+		len(e.Missing), strings.Join(e.Missing, ", "),
+		len(e.Altered), strings.Join(e.Altered, ", "),
+		len(e.Unexpected), strings.Join(e.Unexpected, ", "))
+}
+
+// VerifyManifest checks every Row and TagPair in bk against bk's
+// Manifest (see WithManifest), returning a *ManifestError listing any
+// objects that are missing, altered, or unexpected.  TagPairs are
+// listed by random tag and Rows by their random tags joined by "-",
+// each prefixed with "tag:" or "row:".
+func VerifyManifest(bk Backend) error {
+	return VerifyManifestProgress(bk, nil)
+}
+
+// VerifyManifestProgress is like VerifyManifest, but reports progress
+// through bk's TagPairs (and the Rows tagged with each) to progress,
+// if it's non-nil.
+func VerifyManifestProgress(bk Backend, progress types.ProgressFunc) error {
+	if mb, ok := bk.(*ManifestBackend); ok {
+		bk = mb.Backend
+	}
+
+	m, err := LoadManifest(bk)
+	if err != nil {
+		return err
+	}
+
+	actual, err := snapshotManifest(bk, progress)
+	if err != nil {
+		return err
+	}
+
+	merr := &ManifestError{}
+	compareChecksums(merr, "tag:", m.TagPairs, actual.TagPairs)
+	compareChecksums(merr, "row:", m.Rows, actual.Rows)
+
+	if len(merr.Missing)+len(merr.Altered)+len(merr.Unexpected) > 0 {
+		return merr
+	}
+	return nil
+}
+
+// snapshotManifest returns a Manifest listing everything bk stores,
+// reporting progress through bk's TagPairs to progress.  Rows are
+// found via each TagPair, since every Row is tagged with at least one.
+func snapshotManifest(bk Backend, progress types.ProgressFunc) (*Manifest, error) {
+	m := &Manifest{Rows: map[string]string{}, TagPairs: map[string]string{}}
+
+	pairs, err := bk.AllTagPairs(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pair := range pairs {
+		m.TagPairs[pair.Random] = checksum(pair.PlainEncrypted, pair.Nonce)
+	}
+
+	prog := types.NewProgress(progress, len(pairs))
+
+	for _, pair := range pairs {
+		rows, err := rowsFromRandomTags(bk, []string{pair.Random})
+		if err != nil && err != types.ErrRowsNotFound {
+			return nil, err
+		}
+		for _, row := range rows {
+			m.Rows[rowKey(row)] = checksum(row.Encrypted, row.Nonce)
+		}
+		prog.Add(1)
+	}
+
+	return m, nil
+}
+
+func compareChecksums(merr *ManifestError, prefix string, expected, actual map[string]string) {
+	for _, key := range sortedKeys(expected) {
+		sum, ok := actual[key]
+		if !ok {
+			merr.Missing = append(merr.Missing, prefix+key)
+		} else if sum != expected[key] {
+			merr.Altered = append(merr.Altered, prefix+key)
+		}
+	}
+	for _, key := range sortedKeys(actual) {
+		if _, ok := expected[key]; !ok {
+			merr.Unexpected = append(merr.Unexpected, prefix+key)
+		}
+	}
+}
+
+// checksum returns the hex-encoded SHA-256 of enc followed by nonce
+func checksum(enc []byte, nonce *[24]byte) string {
+	h := sha256.New()
+	h.Write(enc)
+	if nonce != nil {
+		h.Write(nonce[:])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func rowKey(row *types.Row) string {
+	return strings.Join(row.RandomTags, "-")
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
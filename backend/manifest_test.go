@@ -0,0 +1,136 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyManifest(t *testing.T) {
+	fs, cleanup := newTestFileSystem(t)
+	defer cleanup()
+
+	mb, err := WithManifest(fs)
+	if err != nil {
+		t.Fatalf("Error from WithManifest: %v", err)
+	}
+
+	mustCreateRow(t, mb, "one", "manifested")
+	mustCreateRow(t, mb, "two", "manifested", "second")
+
+	if err = VerifyManifest(mb); err != nil {
+		t.Fatalf("Error verifying untouched backend: %v", err)
+	}
+
+	// Remove a Row out-of-band
+	pairs, _ := fs.AllTagPairs(nil)
+	second, _ := pairs.WithAllPlainTags([]string{"second"})
+	rows, _ := fs.ListRows(second.AllRandom())
+	rowFile := path.Join(fs.rowsPath, strings.Join(rows[0].RandomTags, "-"))
+	if err = os.Remove(rowFile); err != nil {
+		t.Fatal(err)
+	}
+
+	err = VerifyManifest(mb)
+	merr, ok := err.(*ManifestError)
+	if !ok {
+		t.Fatalf("Expected *ManifestError, got %T: %v", err, err)
+	}
+	assert.Equal(t, []string{"row:" + strings.Join(rows[0].RandomTags, "-")},
+		merr.Missing)
+	assert.Equal(t, 0, len(merr.Altered))
+	assert.Equal(t, 0, len(merr.Unexpected))
+
+	// Add one out-of-band
+	mustCreateRow(t, fs, "sneaky", "manifested")
+
+	err = VerifyManifest(fs)
+	merr = err.(*ManifestError)
+	assert.Equal(t, 1, len(merr.Missing))
+	// The Row plus its new id:... and created:... TagPairs
+	assert.Equal(t, 3, len(merr.Unexpected))
+
+	// Trust the backend's current contents again
+	if err = BuildManifest(mb); err != nil {
+		t.Fatalf("Error from BuildManifest: %v", err)
+	}
+	assert.Nil(t, VerifyManifest(mb))
+}
+
+func TestVerifyManifestAltered(t *testing.T) {
+	fs, cleanup := newTestFileSystem(t)
+	defer cleanup()
+
+	mb, _ := WithManifest(fs)
+	mustCreateRow(t, mb, "original", "altered")
+
+	// Swap one tag file's contents for another's
+	pairs, _ := fs.AllTagPairs(nil)
+	b, _ := ioutil.ReadFile(path.Join(fs.tagsPath, pairs[1].Random))
+	ioutil.WriteFile(path.Join(fs.tagsPath, pairs[0].Random), b, 0600)
+
+	err := VerifyManifest(mb)
+	merr, ok := err.(*ManifestError)
+	if !ok {
+		t.Fatalf("Expected *ManifestError, got %T: %v", err, err)
+	}
+	assert.Equal(t, []string{"tag:" + pairs[0].Random}, merr.Altered)
+}
+
+func TestManifestTampered(t *testing.T) {
+	fs, cleanup := newTestFileSystem(t)
+	defer cleanup()
+
+	mb, _ := WithManifest(fs)
+	mustCreateRow(t, mb, "data", "tampered")
+
+	m, err := LoadManifest(fs)
+	if err != nil {
+		t.Fatalf("Error from LoadManifest: %v", err)
+	}
+
+	// Drop a TagPair from the manifest itself, keeping the old MAC
+	for rand := range m.TagPairs {
+		delete(m.TagPairs, rand)
+		break
+	}
+	b, _ := json.Marshal(m)
+	if err = ioutil.WriteFile(ManifestPath(fs), b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, ErrManifestMAC, VerifyManifest(fs))
+
+	_, err = WithManifest(fs)
+	assert.Equal(t, ErrManifestMAC, err)
+}
+
+func TestVerifyManifestProgress(t *testing.T) {
+	fs, cleanup := newTestFileSystem(t)
+	defer cleanup()
+
+	mb, _ := WithManifest(fs)
+	mustCreateRow(t, mb, "data", "progress")
+
+	pairs, _ := fs.AllTagPairs(nil)
+
+	last := 0
+	progress := func(done, total int) {
+		assert.Equal(t, len(pairs), total)
+		assert.True(t, done > last, "done went from %d to %d", last, done)
+		last = done
+	}
+
+	if err := VerifyManifestProgress(mb, progress); err != nil {
+		t.Fatalf("Error from VerifyManifestProgress: %v", err)
+	}
+	assert.Equal(t, len(pairs), last)
+}
@@ -0,0 +1,212 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+	"github.com/elimisteve/fun"
+)
+
+// MemoryBackend is an in-memory Backend, useful in tests and for
+// scratch data.  It stores only what real Backends store (ciphertexts,
+// nonces, and random tags), so everything read from it must be
+// decrypted.  Saving a Row never replaces an existing one.
+type MemoryBackend struct {
+	name string
+	key  *[32]byte
+
+	mu    sync.RWMutex
+	pairs types.TagPairs
+	rows  types.Rows
+}
+
+var memoryBackendCount int32
+
+// NewMemoryBackend returns an empty MemoryBackend named name that
+// encrypts with key.  If name is empty, a unique one is generated; if
+// key is nil, a new random key is used.
+func NewMemoryBackend(name string, key *[32]byte) (*MemoryBackend, error) {
+	if key == nil {
+		var err error
+		if key, err = cryptag.RandomKey(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Unique names so that caches keyed by name don't collide
+	if name == "" {
+		n := atomic.AddInt32(&memoryBackendCount, 1)
+		name = fmt.Sprintf("mem%d", n)
+	}
+
+	return &MemoryBackend{name: name, key: key}, nil
+}
+
+// Pairs returns the number of TagPairs stored in mb.
+func (mb *MemoryBackend) Pairs() int {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	return len(mb.pairs)
+}
+
+// Rows returns the number of Rows stored in mb.
+func (mb *MemoryBackend) Rows() int {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	return len(mb.rows)
+}
+
+func (mb *MemoryBackend) Name() string      { return mb.name }
+func (mb *MemoryBackend) Key() *[32]byte    { return mb.key }
+func (mb *MemoryBackend) TagKey() *[32]byte { return mb.key }
+func (mb *MemoryBackend) RowKey() *[32]byte { return mb.key }
+
+func (mb *MemoryBackend) AllTagPairs(oldPairs types.TagPairs) (types.TagPairs, error) {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+
+	return mb.decryptPairs(mb.pairs)
+}
+
+func (mb *MemoryBackend) TagPairsFromRandomTags(randtags cryptag.RandomTags) (types.TagPairs, error) {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+
+	var matches types.TagPairs
+	for _, pair := range mb.pairs {
+		if fun.SliceContains(randtags, pair.Random) {
+			matches = append(matches, pair)
+		}
+	}
+	return mb.decryptPairs(matches)
+}
+
+func (mb *MemoryBackend) decryptPairs(stored types.TagPairs) (types.TagPairs, error) {
+	pairs := make(types.TagPairs, 0, len(stored))
+	for _, p := range stored {
+		pair := &types.TagPair{
+			PlainEncrypted: p.PlainEncrypted,
+			Random:         p.Random,
+			Nonce:          p.Nonce,
+		}
+		if err := pair.Decrypt(mb.key); err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs, nil
+}
+
+func (mb *MemoryBackend) SaveTagPair(pair *types.TagPair) error {
+	if len(pair.PlainEncrypted) == 0 || pair.Random == "" || pair.Nonce == nil {
+		return errors.New("Invalid tag pair")
+	}
+
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	mb.pairs = append(mb.pairs, &types.TagPair{
+		PlainEncrypted: pair.PlainEncrypted,
+		Random:         pair.Random,
+		Nonce:          pair.Nonce,
+	})
+	return nil
+}
+
+func (mb *MemoryBackend) DeleteTagPair(random string) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	for i, pair := range mb.pairs {
+		if pair.Random == random {
+			mb.pairs = append(mb.pairs[:i], mb.pairs[i+1:]...)
+			return nil
+		}
+	}
+	return types.ErrTagPairNotFound
+}
+
+func (mb *MemoryBackend) ListRows(randtags cryptag.RandomTags) (types.Rows, error) {
+	return mb.rowsFromRandomTags(randtags, false)
+}
+
+func (mb *MemoryBackend) RowsFromRandomTags(randtags cryptag.RandomTags) (types.Rows, error) {
+	return mb.rowsFromRandomTags(randtags, true)
+}
+
+func (mb *MemoryBackend) rowsFromRandomTags(randtags cryptag.RandomTags, includeFileBody bool) (types.Rows, error) {
+	if len(randtags) == 0 {
+		return nil, errors.New("Must query by 1 or more tags")
+	}
+
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+
+	var rows types.Rows
+	for _, r := range mb.rows {
+		if !fun.SliceContainsAll(r.RandomTags, randtags) {
+			continue
+		}
+		row := &types.Row{RandomTags: r.RandomTags}
+		if includeFileBody {
+			row.Encrypted = r.Encrypted
+			row.Nonce = r.Nonce
+			row.EncryptedSummary = r.EncryptedSummary
+			row.SummaryNonce = r.SummaryNonce
+		}
+		rows = append(rows, row)
+	}
+
+	if len(rows) == 0 {
+		return nil, types.ErrRowsNotFound
+	}
+
+	return rows, nil
+}
+
+func (mb *MemoryBackend) SaveRow(row *types.Row) error {
+	if len(row.RandomTags) == 0 || row.Nonce == nil {
+		return errors.New("Invalid row; requires RandomTags, Nonce fields")
+	}
+
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	mb.rows = append(mb.rows, &types.Row{
+		Encrypted:        row.Encrypted,
+		RandomTags:       append([]string{}, row.RandomTags...),
+		Nonce:            row.Nonce,
+		EncryptedSummary: row.EncryptedSummary,
+		SummaryNonce:     row.SummaryNonce,
+	})
+	return nil
+}
+
+func (mb *MemoryBackend) DeleteRows(randtags cryptag.RandomTags) error {
+	if len(randtags) == 0 {
+		return errors.New("Must query by 1 or more tags")
+	}
+
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	kept := mb.rows[:0]
+	for _, r := range mb.rows {
+		if !fun.SliceContainsAll(r.RandomTags, randtags) {
+			kept = append(kept, r)
+		}
+	}
+	mb.rows = kept
+	return nil
+}
+
+func (mb *MemoryBackend) ToConfig() (*Config, error) {
+	return &Config{Name: mb.name, Key: mb.key}, nil
+}
@@ -0,0 +1,139 @@
+// Steve Phillips / elimisteve
+// 2017.04.05
+
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/cryptag/cryptag/types"
+)
+
+var (
+	ErrCannotDeleteTagPairs = errors.New("backend: Backend cannot delete TagPairs")
+)
+
+// TagPairDeleter is implemented by Backends that can delete
+// individual TagPairs.
+type TagPairDeleter interface {
+	DeleteTagPair(random string) error
+}
+
+// MergeTags re-tags every Row tagged with the plaintag from so that
+// it is tagged with into instead (unless it already was).  Both are
+// normalized first (see NormalizeTag).  into's
+// TagPair is created if it doesn't already exist.  from's TagPair is
+// left intact; use MergeTagsAndDelete to delete it, too.
+func MergeTags(bk Backend, from, into string) error {
+	deleteFrom := false
+	return mergeTags(bk, from, into, deleteFrom)
+}
+
+// MergeTagsAndDelete does the same thing as MergeTags, then deletes
+// from's TagPair.  Returns ErrCannotDeleteTagPairs if bk doesn't
+// implement TagPairDeleter.
+func MergeTagsAndDelete(bk Backend, from, into string) error {
+	deleteFrom := true
+	return mergeTags(bk, from, into, deleteFrom)
+}
+
+func mergeTags(bk Backend, from, into string, deleteFrom bool) error {
+	from, into = normalizeTag(from), normalizeTag(into)
+	if from == into {
+		return fmt.Errorf("Cannot merge tag `%s` into itself", from)
+	}
+
+	deleter, canDelete := bk.(TagPairDeleter)
+	if deleteFrom && !canDelete {
+		return ErrCannotDeleteTagPairs
+	}
+
+	pairs, err := partialTagPairs(bk.AllTagPairs(nil))
+	if err != nil {
+		return err
+	}
+
+	fromPairs, err := pairs.WithAllPlainTags([]string{from})
+	if err != nil {
+		return err
+	}
+	if len(fromPairs) == 0 {
+		return types.ErrTagPairNotFound
+	}
+	fromRand := fromPairs[0].Random
+
+	newPairs, err := CreateTagsFromPlain(bk, []string{into}, pairs)
+	if err != nil {
+		return err
+	}
+	intoPairs, err := append(pairs, newPairs...).WithAllPlainTags([]string{into})
+	if err != nil {
+		return err
+	}
+	intoRand := intoPairs[0].Random
+
+	rows, err := rowsFromRandomTags(bk, []string{fromRand})
+	if err != nil && err != types.ErrRowsNotFound {
+		return err
+	}
+
+	for _, row := range rows {
+		if err = retagRow(bk, row, fromRand, intoRand); err != nil {
+			return err
+		}
+	}
+
+	if types.Debug {
+		log.Printf("MergeTags: re-tagged %d rows from `%s` to `%s`\n",
+			len(rows), from, into)
+	}
+
+	if deleteFrom {
+		return deleter.DeleteTagPair(fromRand)
+	}
+
+	return nil
+}
+
+// retagRow saves a copy of row with the random tag oldRand replaced
+// by newRand (which isn't added twice), then deletes row.
+func retagRow(bk Backend, row *types.Row, oldRand, newRand string) error {
+	oldTags := row.RandomTags
+
+	newTags := make([]string, 0, len(oldTags))
+	for _, randtag := range oldTags {
+		if randtag == oldRand {
+			if row.HasRandomTag(newRand) {
+				continue
+			}
+			randtag = newRand
+		}
+		newTags = append(newTags, randtag)
+	}
+
+	newRow := &types.Row{
+		Encrypted:        row.Encrypted,
+		RandomTags:       oldTags,
+		Nonce:            row.Nonce,
+		EncryptedSummary: row.EncryptedSummary,
+		SummaryNonce:     row.SummaryNonce,
+	}
+	if err := rebindRow(bk, newRow, newTags); err != nil {
+		return err
+	}
+
+	// Save new Row before deleting the old one so that no data is
+	// lost if the deletion fails
+	if err := bk.SaveRow(newRow); err != nil {
+		return fmt.Errorf("Error saving re-tagged row: %v", err)
+	}
+
+	// newTags lacks oldRand, so this won't delete newRow
+	if err := bk.DeleteRows(oldTags); err != nil {
+		return fmt.Errorf("Error deleting original row: %v", err)
+	}
+
+	return nil
+}
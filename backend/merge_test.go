@@ -0,0 +1,131 @@
+// Steve Phillips / elimisteve
+// 2017.04.05
+
+package backend
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/cryptag/cryptag/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// mustCreateRow creates a Row whose data is data, fetching bk's
+// latest TagPairs first
+func mustCreateRow(t *testing.T, bk Backend, data string, plaintags ...string) *types.Row {
+	row, err := CreateRow(bk, nil, []byte(data), plaintags)
+	if err != nil {
+		t.Fatalf("Error from CreateRow: %v", err)
+	}
+	return row
+}
+
+// rowData returns the sorted decrypted contents of the Rows in bk
+// tagged with all of plaintags
+func rowData(t *testing.T, bk Backend, plaintags ...string) []string {
+	rows, err := RowsFromPlainTags(bk, nil, plaintags)
+	if err == types.ErrRowsNotFound {
+		return nil
+	}
+	if err != nil {
+		t.Fatalf("Error from RowsFromPlainTags(%v): %v", plaintags, err)
+	}
+
+	var data []string
+	for _, row := range rows {
+		data = append(data, string(row.Decrypted()))
+	}
+	sort.Strings(data)
+	return data
+}
+
+func TestMergeTags(t *testing.T) {
+	bk := newMemBackend(t)
+
+	mustCreateRow(t, bk, "only bug", "bug")
+	mustCreateRow(t, bk, "only defect", "defect", "urgent")
+	mustCreateRow(t, bk, "both", "bug", "defect")
+
+	if err := MergeTags(bk, "defect", "bug"); err != nil {
+		t.Fatalf("Error from MergeTags: %v", err)
+	}
+
+	assert.Equal(t, []string{"both", "only bug", "only defect"},
+		rowData(t, bk, "bug"))
+	assert.Equal(t, []string{"only defect"}, rowData(t, bk, "bug", "urgent"))
+	assert.Nil(t, rowData(t, bk, "defect"))
+
+	// "bug" not duplicated on the Row that already had it
+	rows, _ := RowsFromPlainTags(bk, nil, []string{"bug"})
+	for _, row := range rows {
+		n := 0
+		for _, plain := range row.PlainTags() {
+			if plain == "bug" {
+				n++
+			}
+		}
+		assert.Equal(t, 1, n, "Row %q tagged with `bug` %d times",
+			row.Decrypted(), n)
+	}
+
+	// "defect" TagPair still exists
+	pairs, _ := bk.AllTagPairs(nil)
+	_, err := pairs.WithAllPlainTags([]string{"defect"})
+	assert.Nil(t, err)
+}
+
+func TestMergeTagsNormalized(t *testing.T) {
+	NormalizeTag = LowerTrimTag
+	defer func() { NormalizeTag = IdentityTag }()
+
+	bk := newMemBackend(t)
+	mustCreateRow(t, bk, "defect", "defect")
+
+	if err := MergeTags(bk, "Defect", " BUG "); err != nil {
+		t.Fatalf("Error from MergeTags: %v", err)
+	}
+	assert.Equal(t, []string{"defect"}, rowData(t, bk, "bug"))
+
+	err := MergeTags(bk, "Bug", "bug")
+	assert.NotNil(t, err, "Merging a tag into itself should fail")
+}
+
+func TestMergeTagsKeepsSummary(t *testing.T) {
+	bk := newMemBackend(t)
+
+	mustCreateSummaryRow(t, bk, "Short", "A very long body...", "defect")
+
+	if err := MergeTags(bk, "defect", "bug"); err != nil {
+		t.Fatalf("Error from MergeTags: %v", err)
+	}
+
+	rows, err := ListRowSummariesFromPlainTags(bk, nil, []string{"bug"})
+	if err != nil {
+		t.Fatalf("Error from ListRowSummariesFromPlainTags: %v", err)
+	}
+	assert.Equal(t, 1, len(rows))
+	assert.Equal(t, "Short", string(rows[0].Summary()))
+}
+
+func TestMergeTagsAndDelete(t *testing.T) {
+	bk := newMemBackend(t)
+
+	assert.Equal(t, types.ErrTagPairNotFound, MergeTags(bk, "color", "colour"))
+
+	mustCreateRow(t, bk, "one", "color")
+
+	// "colour" doesn't exist yet; should be created
+	if err := MergeTagsAndDelete(bk, "color", "colour"); err != nil {
+		t.Fatalf("Error from MergeTagsAndDelete: %v", err)
+	}
+
+	assert.Equal(t, []string{"one"}, rowData(t, bk, "colour"))
+
+	pairs, _ := bk.AllTagPairs(nil)
+	_, err := pairs.WithAllPlainTags([]string{"color"})
+	assert.NotNil(t, err, "`color` TagPair should have been deleted")
+
+	assert.NotNil(t, MergeTags(bk, "colour", "colour"))
+	assert.NotNil(t, MergeTags(bk, "nonexistent", "colour"))
+}
@@ -0,0 +1,160 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+)
+
+// BackendMetaTag tags the (private) Row holding a Backend's
+// BackendMeta; see SaveBackendMeta.
+const BackendMetaTag = "system:meta"
+
+var ErrBackendMetaNotFound = errors.New("backend: Backend has no BackendMeta")
+
+// TagNormalizers maps the names BackendMeta can give NormalizeTag to
+// the TagNormalizers they stand for.  Register more as needed.
+var TagNormalizers = map[string]TagNormalizer{
+	"identity":   IdentityTag,
+	"lower-trim": LowerTrimTag,
+}
+
+// BackendMeta holds settings that every client of a Backend should
+// agree on, stored in the Backend itself (see SaveBackendMeta) rather
+// than in each client's Config.  Nil and empty fields are left unset.
+type BackendMeta struct {
+	// NormalizeTag names the TagNormalizer (see TagNormalizers) to
+	// set NormalizeTag to
+	NormalizeTag string `json:"normalize_tag,omitempty"`
+
+	AddAllTag *bool `json:"add_all_tag,omitempty"`
+	PadTagsTo *int  `json:"pad_tags_to,omitempty"`
+
+	// Settings holds any other, app-specific settings
+	Settings map[string]string `json:"settings,omitempty"`
+
+	SavedAt time.Time `json:"saved_at"`
+}
+
+// Apply sets NormalizeTag, AddAllTag, and PadTagsTo to the values
+// meta gives them, leaving the rest as they are.
+//
+// These are package-level variables, so Apply changes them for every
+// Backend in the process, not just the one meta was loaded from.  A
+// program using several Backends whose BackendMetas disagree must
+// Apply the right one before each operation (and not use the Backends
+// concurrently), or leave Apply alone and configure them itself.
+func (meta *BackendMeta) Apply() error {
+	if meta.NormalizeTag != "" {
+		normalize, ok := TagNormalizers[meta.NormalizeTag]
+		if !ok {
+			return fmt.Errorf("Unknown tag normalizer `%s`", meta.NormalizeTag)
+		}
+		NormalizeTag = normalize
+	}
+	if meta.AddAllTag != nil {
+		AddAllTag = *meta.AddAllTag
+	}
+	if meta.PadTagsTo != nil {
+		PadTagsTo = *meta.PadTagsTo
+	}
+	return nil
+}
+
+// SaveBackendMeta saves meta to bk as a private Row tagged with
+// BackendMetaTag, encrypted like any other, replacing the BackendMeta
+// bk had before, if any.
+func SaveBackendMeta(bk Backend, meta *BackendMeta) error {
+	old, _, err := backendMetaRows(bk)
+	if err != nil {
+		return err
+	}
+
+	saved := *meta
+	saved.SavedAt = cryptag.Now()
+
+	b, err := json.Marshal(&saved)
+	if err != nil {
+		return err
+	}
+
+	pairs, err := bk.AllTagPairs(nil)
+	if err != nil {
+		return err
+	}
+	_, err = CreatePrivateRow(bk, pairs, b, []string{BackendMetaTag})
+	if err != nil {
+		return fmt.Errorf("Error saving backend meta: %v", err)
+	}
+
+	// Only once the new one is saved, so bk is never without one
+	for _, row := range old {
+		err = bk.DeleteRows(row.RandomTags)
+		if err != nil && err != types.ErrRowsNotFound {
+			return fmt.Errorf("Error deleting old backend meta: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// LoadBackendMeta returns the BackendMeta saved to bk with
+// SaveBackendMeta, or ErrBackendMetaNotFound if there is none.  If
+// clients saved several at once, the newest wins.
+func LoadBackendMeta(bk Backend) (*BackendMeta, error) {
+	_, metas, err := backendMetaRows(bk)
+	if err != nil {
+		return nil, err
+	}
+	if len(metas) == 0 {
+		return nil, ErrBackendMetaNotFound
+	}
+
+	newest := metas[0]
+	for _, meta := range metas[1:] {
+		if meta.SavedAt.After(newest.SavedAt) {
+			newest = meta
+		}
+	}
+
+	return newest, nil
+}
+
+// backendMetaRows returns bk's BackendMeta Rows along with the
+// BackendMeta each contains
+func backendMetaRows(bk Backend) (types.Rows, []*BackendMeta, error) {
+	pairs, err := bk.AllTagPairs(nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var rows types.Rows
+	for _, metaRand := range randomTagsOf(pairs, BackendMetaTag) {
+		found, err := rowsFromRandomTags(bk, []string{metaRand})
+		if err != nil && err != types.ErrRowsNotFound {
+			return nil, nil, err
+		}
+		rows = append(rows, found...)
+	}
+
+	metas := make([]*BackendMeta, 0, len(rows))
+	for _, row := range rows {
+		if err = row.Decrypt(bk.RowKey()); err != nil {
+			return nil, nil, err
+		}
+		var meta BackendMeta
+		if err = json.Unmarshal(row.Decrypted(), &meta); err != nil {
+			return nil, nil, fmt.Errorf("Error parsing backend meta: %v", err)
+		}
+		metas = append(metas, &meta)
+	}
+
+	return rows, metas, nil
+}
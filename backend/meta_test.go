@@ -0,0 +1,92 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cryptag/cryptag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackendMeta(t *testing.T) {
+	defer func(normalize TagNormalizer, addAll bool, pad int) {
+		NormalizeTag, AddAllTag, PadTagsTo = normalize, addAll, pad
+	}(NormalizeTag, AddAllTag, PadTagsTo)
+
+	fs, cleanup := newTestFileSystem(t)
+	defer cleanup()
+
+	_, err := LoadBackendMeta(fs)
+	assert.Equal(t, ErrBackendMetaNotFound, err)
+
+	addAll, pad := true, 4
+	meta := &BackendMeta{
+		NormalizeTag: "lower-trim",
+		AddAllTag:    &addAll,
+		PadTagsTo:    &pad,
+		Settings:     map[string]string{"theme": "dark"},
+	}
+	if err = SaveBackendMeta(fs, meta); err != nil {
+		t.Fatalf("Error from SaveBackendMeta: %v", err)
+	}
+
+	// Replacing it leaves just the new one
+	pad = 8
+	if err = SaveBackendMeta(fs, meta); err != nil {
+		t.Fatalf("Error from SaveBackendMeta: %v", err)
+	}
+	rows, _, err := backendMetaRows(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, rows, 1)
+
+	// Hidden from ListAllRows
+	_, err = ListAllRows(fs, nil)
+	assert.NotNil(t, err)
+
+	// A second client opening the same Backend agrees
+	conf, err := fs.ToConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewFileSystem(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadBackendMeta(other)
+	if err != nil {
+		t.Fatalf("Error from LoadBackendMeta: %v", err)
+	}
+	assert.Equal(t, "dark", loaded.Settings["theme"])
+	assert.False(t, loaded.SavedAt.IsZero())
+
+	if err = loaded.Apply(); err != nil {
+		t.Fatalf("Error from Apply: %v", err)
+	}
+	assert.Equal(t, "foo", NormalizeTag(" Foo "))
+	assert.True(t, AddAllTag)
+	assert.Equal(t, 8, PadTagsTo)
+
+	loaded.NormalizeTag = "nonexistent"
+	assert.NotNil(t, loaded.Apply())
+}
+
+func TestBackendMetaClockOffset(t *testing.T) {
+	cryptag.SetClockOffset(time.Hour)
+	defer cryptag.SetClockOffset(0)
+
+	mem := newMemBackend(t)
+	if err := SaveBackendMeta(mem, &BackendMeta{}); err != nil {
+		t.Fatalf("Error from SaveBackendMeta: %v", err)
+	}
+	loaded, err := LoadBackendMeta(mem)
+	if err != nil {
+		t.Fatalf("Error from LoadBackendMeta: %v", err)
+	}
+	assert.True(t, loaded.SavedAt.After(time.Now().Add(30*time.Minute)),
+		"SavedAt should include ClockOffset")
+}
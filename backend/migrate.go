@@ -0,0 +1,163 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/cryptag/cryptag/types"
+)
+
+// MigrateState records how far a Migrate got, so that an interrupted
+// Migrate can be resumed where it left off rather than started over.
+// It's meant to be persisted by the caller (e.g., as JSON) between
+// runs.  The zero value starts a Migrate from the beginning.
+type MigrateState struct {
+	// LastTagPair is the random tag of the last TagPair copied;
+	// TagPairs are copied in order of random tag
+	LastTagPair string `json:"last_tag_pair"`
+
+	// TagPairsDone is set once every TagPair has been copied
+	TagPairsDone bool `json:"tag_pairs_done"`
+
+	// LastRow is the random tags, joined by "-", of the last Row
+	// copied; Rows are copied in that order
+	LastRow string `json:"last_row"`
+
+	// Done is set once every Row has been copied, too
+	Done bool `json:"done"`
+}
+
+// Migrate copies every TagPair and then every Row from src to dst,
+// re-encrypting them (and replacing their decoys; see rekeyDecoys) if
+// dst's keys differ from src's, and records its progress in state as
+// it goes.  TagPairs whose plaintag dst already has aren't copied;
+// Rows tagged with them are re-tagged with dst's TagPair instead.  If checkpoint is non-nil, it is
+// called with state after each TagPair and Row is copied, e.g. to
+// persist it; an error from it stops the Migrate.
+//
+// If Migrate stops early, calling it again with the same state picks
+// up after the last TagPair or Row copied, so nothing is copied to dst
+// twice.  Objects added to src in the meantime are only copied if
+// they sort after that point; run a fresh Migrate (or SyncRows) to
+// catch those.
+func Migrate(src, dst Backend, state *MigrateState, checkpoint func(*MigrateState) error) error {
+	if state.Done {
+		return nil
+	}
+
+	save := func() error {
+		if checkpoint == nil {
+			return nil
+		}
+		return checkpoint(state)
+	}
+
+	pairs, err := src.AllTagPairs(nil)
+	if err != nil {
+		return err
+	}
+	sort.Sort(byRandom(pairs))
+
+	// Recomputed on resume, which gives the same result, since the
+	// TagPairs remapped are the ones never copied
+	remap, err := migrateRemap(pairs, dst)
+	if err != nil {
+		return err
+	}
+
+	if !state.TagPairsDone {
+		err = migrateTagPairs(pairs, src, dst, remap, state, save)
+		if err != nil {
+			return err
+		}
+		state.TagPairsDone = true
+		if err = save(); err != nil {
+			return err
+		}
+	}
+
+	keys, err := allRowKeys(src)
+	if err != nil {
+		return err
+	}
+
+	known := knownRandomTags(pairs)
+
+	for _, key := range sortedBoolKeys(keys) {
+		if key <= state.LastRow {
+			continue
+		}
+		if _, err = copyRow(src, dst, key, known, remap); err != nil {
+			return fmt.Errorf("Error copying row `%s`: %v", key, err)
+		}
+		state.LastRow = key
+		if err = save(); err != nil {
+			return err
+		}
+	}
+
+	state.Done = true
+
+	return save()
+}
+
+// migrateRemap maps the random tag of each of pairs whose plaintag
+// dst already has a different TagPair for to dst's random tag for it
+func migrateRemap(pairs types.TagPairs, dst Backend) (map[string]string, error) {
+	existing, err := dst.AllTagPairs(nil)
+	if err != nil {
+		return nil, err
+	}
+	byPlain := make(map[string]string, len(existing))
+	for _, pair := range existing {
+		byPlain[pair.Plain()] = pair.Random
+	}
+
+	remap := map[string]string{}
+	for _, pair := range pairs {
+		random, ok := byPlain[pair.Plain()]
+		if ok && random != pair.Random {
+			remap[pair.Random] = random
+		}
+	}
+	return remap, nil
+}
+
+func migrateTagPairs(pairs types.TagPairs, src, dst Backend, remap map[string]string, state *MigrateState, save func() error) error {
+	existing, err := dst.AllTagPairs(nil)
+	if err != nil {
+		return err
+	}
+	have := knownRandomTags(existing)
+
+	sameKey := bytes.Equal(src.TagKey()[:], dst.TagKey()[:])
+
+	for _, pair := range pairs {
+		if pair.Random <= state.LastTagPair {
+			continue
+		}
+		if have[pair.Random] || remap[pair.Random] != "" {
+			continue
+		}
+
+		if !sameKey {
+			if pair, err = reencryptTagPair(pair, dst.TagKey()); err != nil {
+				return err
+			}
+		}
+		if err = dst.SaveTagPair(pair); err != nil {
+			return fmt.Errorf("Error copying tag `%s`: %v", pair.Random, err)
+		}
+
+		state.LastTagPair = pair.Random
+		if err = save(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
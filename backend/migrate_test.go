@@ -0,0 +1,108 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/cryptag/cryptag/types"
+	"github.com/stretchr/testify/assert"
+)
+
+var errInterrupted = errors.New("interrupted")
+
+// interruptedBackend fails every SaveRow after the first allowed
+type interruptedBackend struct {
+	*memBackend
+	allowed int
+}
+
+func (ib *interruptedBackend) SaveRow(row *types.Row) error {
+	if ib.allowed == 0 {
+		return errInterrupted
+	}
+	ib.allowed--
+	return ib.memBackend.SaveRow(row)
+}
+
+func TestMigrateResume(t *testing.T) {
+	src := newMemBackend(t)
+	dst := newMemBackend(t)
+
+	for _, data := range []string{"a", "b", "c", "d", "e"} {
+		mustCreateRow(t, src, data, "type:note", "letter:"+data)
+	}
+
+	// Persisted as the caller would between runs
+	var persisted []byte
+	checkpoint := func(state *MigrateState) error {
+		var err error
+		persisted, err = json.Marshal(state)
+		return err
+	}
+
+	var state MigrateState
+	err := Migrate(src, &interruptedBackend{dst, 3}, &state, checkpoint)
+	assert.Contains(t, err.Error(), errInterrupted.Error())
+	assert.Len(t, dst.rows, 3)
+	assert.True(t, state.TagPairsDone)
+	assert.False(t, state.Done)
+
+	var resumed MigrateState
+	if err = json.Unmarshal(persisted, &resumed); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, state, resumed)
+
+	if err = Migrate(src, dst, &resumed, checkpoint); err != nil {
+		t.Fatalf("Error from Migrate: %v", err)
+	}
+	assert.True(t, resumed.Done)
+
+	// Everything copied exactly once, re-encrypted for dst
+	assert.Len(t, dst.pairs, len(src.pairs))
+	assert.Len(t, dst.rows, len(src.rows))
+
+	keys := map[string]bool{}
+	for _, row := range dst.rows {
+		assert.False(t, keys[rowKey(row)], "Row %s copied twice", rowKey(row))
+		keys[rowKey(row)] = true
+	}
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, rowData(t, dst, "type:note"))
+
+	// Nothing left to do
+	assert.Nil(t, Migrate(src, dst, &resumed, nil))
+	assert.Len(t, dst.rows, len(src.rows))
+}
+
+func TestMigratePaddedAcrossKeys(t *testing.T) {
+	defer func(orig int) { PadTagsTo = orig }(PadTagsTo)
+	PadTagsTo = 8
+
+	src := newMemBackend(t)
+	dst := newMemBackend(t)
+
+	mustCreateRow(t, src, "one", "type:note", "shared")
+	mustCreateRow(t, src, "two", "type:note")
+
+	// dst already has its own TagPair for "shared"
+	mustCreateRow(t, dst, "theirs", "shared")
+	npairs := len(dst.pairs)
+
+	var state MigrateState
+	if err := Migrate(src, dst, &state, nil); err != nil {
+		t.Fatalf("Error from Migrate: %v", err)
+	}
+
+	assert.Equal(t, []string{"one", "two"}, rowData(t, dst, "type:note"))
+	assert.Equal(t, []string{"one", "theirs"}, rowData(t, dst, "shared"))
+
+	// Neither "shared" nor "all" was copied over dst's own
+	dups, err := FindDuplicateTags(dst)
+	assert.Nil(t, err)
+	assert.Empty(t, dups)
+	assert.Len(t, dst.pairs, npairs+len(src.pairs)-2)
+}
@@ -0,0 +1,94 @@
+// Steve Phillips / elimisteve
+// 2017.04.09
+
+package backend
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/cryptag/cryptag/types"
+)
+
+// TagNormalizer maps a plaintag to its canonical form, so that, e.g.,
+// "Project:Foo" and "project:foo" can be treated as the same tag.
+type TagNormalizer func(plaintag string) string
+
+// NormalizeTag is applied to plaintags before tags are created or
+// looked up -- by CreateTag, PopulateRowBeforeSave (and so CreateRow),
+// RowsFromPlainTags, ListRowsFromPlainTags, and DeleteRows -- so saves
+// and queries always agree.  ValidTagRules' whitespace rules are
+// applied after it, in the same places.  Defaults to IdentityTag; set
+// it to LowerTrimTag to make tags case-insensitive.
+//
+// TagPairs created before NormalizeTag was changed keep their
+// original plaintags, so, e.g., an existing "Foo" tag won't match the
+// normalized query "foo".
+var NormalizeTag TagNormalizer = IdentityTag
+
+// IdentityTag is a TagNormalizer that leaves plaintags unchanged.
+func IdentityTag(plaintag string) string {
+	return plaintag
+}
+
+// LowerTrimTag is a TagNormalizer that lower-cases plaintags and trims
+// surrounding whitespace.
+func LowerTrimTag(plaintag string) string {
+	return strings.ToLower(strings.TrimSpace(plaintag))
+}
+
+// normalizeTag passes plaintag through NormalizeTag, then trims (or
+// collapses) its whitespace as ValidTagRules say to, so that lookups
+// agree with what ValidateTags saved.
+func normalizeTag(plaintag string) string {
+	if NormalizeTag != nil {
+		plaintag = NormalizeTag(plaintag)
+	}
+	return ValidTagRules.normalize(plaintag)
+}
+
+// normalizeTags returns a new slice containing each of plaintags
+// passed through NormalizeTag.
+func normalizeTags(plaintags []string) []string {
+	normalized := make([]string, len(plaintags))
+	for i, plain := range plaintags {
+		normalized[i] = normalizeTag(plain)
+	}
+	return normalized
+}
+
+// PreviewNormalizationCollisions finds the TagPairs in bk that would
+// stand for the same tag if NormalizeTag were set to normalizer, e.g.
+// "Foo" and "foo" under LowerTrimTag, so they can be merged (see
+// MergeTags) before normalizer is enabled.  Returns a map from each
+// normalized form that two or more distinct plaintags map to, to their
+// TagPairs, sorted by plaintag.
+func PreviewNormalizationCollisions(bk Backend, normalizer TagNormalizer) (map[string]types.TagPairs, error) {
+	if normalizer == nil {
+		normalizer = IdentityTag
+	}
+
+	pairs, err := bk.AllTagPairs(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := map[string]types.TagPairs{}
+	for _, pair := range pairs {
+		norm := normalizer(pair.Plain())
+		groups[norm] = append(groups[norm], pair)
+	}
+
+	collisions := map[string]types.TagPairs{}
+	for norm, group := range groups {
+		for _, pair := range group[1:] {
+			if pair.Plain() != group[0].Plain() {
+				sort.Sort(byPlain(group))
+				collisions[norm] = group
+				break
+			}
+		}
+	}
+
+	return collisions, nil
+}
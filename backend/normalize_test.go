@@ -0,0 +1,118 @@
+// Steve Phillips / elimisteve
+// 2017.04.09
+
+package backend
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLowerTrimTag(t *testing.T) {
+	assert.Equal(t, "project:foo", LowerTrimTag("  Project:FOO\n"))
+	assert.Equal(t, "Project:FOO", IdentityTag("Project:FOO"))
+}
+
+func TestNormalizeTagCollapsesCase(t *testing.T) {
+	NormalizeTag = LowerTrimTag
+	defer func() { NormalizeTag = IdentityTag }()
+
+	bk := newMemBackend(t)
+
+	mustCreateRow(t, bk, "first", "Project:Foo")
+	mustCreateRow(t, bk, "second", "project:foo")
+	mustCreateRow(t, bk, "third", "PROJECT:FOO ")
+
+	pairs, err := bk.AllTagPairs(nil)
+	if err != nil {
+		t.Fatalf("Error from AllTagPairs: %v", err)
+	}
+	matches, err := pairs.WithAllPlainTags([]string{"project:foo"})
+	if err != nil {
+		t.Fatalf("Error from WithAllPlainTags: %v", err)
+	}
+	assert.Equal(t, 1, len(matches), "Expected one TagPair for all 3 spellings")
+
+	// Queries are normalized, too
+	for _, query := range []string{"project:foo", "Project:Foo", "PROJECT:FOO"} {
+		assert.Equal(t, []string{"first", "second", "third"}, rowData(t, bk, query))
+	}
+
+	if err = DeleteRows(bk, nil, []string{"Project:FOO"}); err != nil {
+		t.Fatalf("Error from DeleteRows: %v", err)
+	}
+	assert.Nil(t, rowData(t, bk, "project:foo"))
+}
+
+func TestNormalizeTagIdentityByDefault(t *testing.T) {
+	bk := newMemBackend(t)
+
+	mustCreateRow(t, bk, "upper", "Foo")
+	mustCreateRow(t, bk, "lower", "foo")
+
+	assert.Equal(t, []string{"upper"}, rowData(t, bk, "Foo"))
+	assert.Equal(t, []string{"lower"}, rowData(t, bk, "foo"))
+
+	_, err := RowsFromPlainTags(bk, nil, []string{"FOO"})
+	assert.NotNil(t, err)
+}
+
+func TestPreviewNormalizationCollisions(t *testing.T) {
+	bk := newMemBackend(t)
+
+	createTags(t, bk, "Foo", "foo", "Bar", "baz", "Baz", "qux")
+
+	// Saved before plaintags were trimmed
+	untrimmed, err := NewTagPair(bk.TagKey(), " FOO")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = bk.SaveTagPair(untrimmed); err != nil {
+		t.Fatal(err)
+	}
+
+	collisions, err := PreviewNormalizationCollisions(bk, LowerTrimTag)
+	if err != nil {
+		t.Fatalf("Error from PreviewNormalizationCollisions: %v", err)
+	}
+
+	plains := map[string][]string{}
+	for norm, pairs := range collisions {
+		plains[norm] = pairs.AllPlain()
+	}
+	assert.Equal(t, map[string][]string{
+		"foo": {" FOO", "Foo", "foo"},
+		"baz": {"Baz", "baz"},
+	}, plains)
+
+	// Nothing collides with itself
+	collisions, err = PreviewNormalizationCollisions(bk, IdentityTag)
+	assert.Nil(t, err)
+	assert.Empty(t, collisions)
+}
+
+func TestCreateTagsFromPlainNormalizes(t *testing.T) {
+	NormalizeTag = LowerTrimTag
+	defer func() { NormalizeTag = IdentityTag }()
+
+	bk := newMemBackend(t)
+
+	newPairs, err := CreateTagsFromPlain(bk, []string{"Foo", "foo", " FOO "}, nil)
+	if err != nil {
+		t.Fatalf("Error from CreateTagsFromPlain: %v", err)
+	}
+	assert.Equal(t, 1, len(newPairs))
+	assert.Equal(t, "foo", newPairs[0].Plain())
+
+	pairs, err := bk.AllTagPairs(nil)
+	if err != nil {
+		t.Fatalf("Error from AllTagPairs: %v", err)
+	}
+	newPairs, err = CreateTagsFromPlain(bk, []string{"Foo"}, pairs)
+	if err != nil {
+		t.Fatalf("Error from CreateTagsFromPlain: %v", err)
+	}
+	assert.Empty(t, newPairs)
+	assert.Equal(t, 1, len(bk.pairs))
+}
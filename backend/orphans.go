@@ -0,0 +1,72 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/cryptag/cryptag/types"
+)
+
+// ListAllRandomTags returns every random tag that at least one Row in
+// bk is tagged with, sorted, including decoys (see PadTagsTo).  Unlike
+// ListAllRows, it finds Rows saved with SkipAllTag set, too.
+func ListAllRandomTags(bk Backend) ([]string, error) {
+	keys, err := allRowKeys(bk)
+	if err != nil {
+		return nil, err
+	}
+
+	used := map[string]bool{}
+	for key := range keys {
+		for _, randtag := range strings.Split(key, "-") {
+			used[randtag] = true
+		}
+	}
+
+	return sortedBoolKeys(used), nil
+}
+
+// ListOrphanTags returns the TagPairs in bk that no Row is tagged
+// with, sorted by plaintag, e.g. to review before pruning them with
+// DeleteTagPairs.
+func ListOrphanTags(bk Backend) (types.TagPairs, error) {
+	pairs, err := bk.AllTagPairs(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	randtags, err := ListAllRandomTags(bk)
+	if err != nil {
+		return nil, err
+	}
+	used := make(map[string]bool, len(randtags))
+	for _, randtag := range randtags {
+		used[randtag] = true
+	}
+
+	var orphans types.TagPairs
+	for _, pair := range pairs {
+		if !used[pair.Random] {
+			orphans = append(orphans, pair)
+		}
+	}
+
+	sort.Sort(byPlain(orphans))
+
+	return orphans, nil
+}
+
+type byPlain types.TagPairs
+
+func (pairs byPlain) Len() int      { return len(pairs) }
+func (pairs byPlain) Swap(i, j int) { pairs[i], pairs[j] = pairs[j], pairs[i] }
+
+func (pairs byPlain) Less(i, j int) bool {
+	if pairs[i].Plain() != pairs[j].Plain() {
+		return pairs[i].Plain() < pairs[j].Plain()
+	}
+	return pairs[i].Random < pairs[j].Random
+}
@@ -0,0 +1,44 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListOrphanTags(t *testing.T) {
+	bk := newMemBackend(t)
+
+	mustCreateRow(t, bk, "one", "used", "type:note")
+	if _, err := CreatePrivateRow(bk, nil, []byte("two"), []string{"private"}); err != nil {
+		t.Fatalf("Error from CreatePrivateRow: %v", err)
+	}
+	createTags(t, bk, "orphan:b", "orphan:a")
+
+	randtags, err := ListAllRandomTags(bk)
+	if err != nil {
+		t.Fatalf("Error from ListAllRandomTags: %v", err)
+	}
+	assert.Contains(t, randtags, pairsRandom(t, bk, "private"))
+	assert.NotContains(t, randtags, pairsRandom(t, bk, "orphan:a"))
+
+	orphans, err := ListOrphanTags(bk)
+	if err != nil {
+		t.Fatalf("Error from ListOrphanTags: %v", err)
+	}
+	assert.Equal(t, []string{"orphan:a", "orphan:b"}, orphans.AllPlain())
+
+	if err = DeleteTagPairs(bk, orphans); err != nil {
+		t.Fatalf("Error from DeleteTagPairs: %v", err)
+	}
+
+	orphans, err = ListOrphanTags(bk)
+	if err != nil {
+		t.Fatalf("Error from ListOrphanTags: %v", err)
+	}
+	assert.Empty(t, orphans)
+	assert.Equal(t, []string{"one"}, rowData(t, bk, "used"))
+}
@@ -0,0 +1,295 @@
+// Steve Phillips / elimisteve
+// 2017.04.08
+
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+)
+
+var (
+	// OutboxMinBackoff is how long an Outbox's background worker
+	// waits before retrying after its first failed attempt to flush.
+	// The wait doubles after each subsequent failure, up to
+	// OutboxMaxBackoff.
+	OutboxMinBackoff = 1 * time.Second
+	OutboxMaxBackoff = 5 * time.Minute
+
+	ErrOutboxRunning = errors.New("backend: Outbox worker already running")
+)
+
+// Outbox wraps a Backend so that Rows and TagPairs that fail to save
+// are queued on disk (in dir) rather than lost, then saved later,
+// either by calling Flush or by the background worker started with
+// Start.  Queued saves survive process restarts, since NewOutbox
+// loads any saves queued by a previous Outbox using the same dir.
+//
+// Saves happen in the order they were made; once anything is queued,
+// subsequent saves are queued behind it, so a Row is never saved
+// before the TagPairs it is tagged with.
+//
+// Outbox implements Backend; every method but SaveRow and SaveTagPair
+// is passed straight through to the wrapped Backend.
+type Outbox struct {
+	Backend
+
+	dir string
+
+	mu      sync.Mutex
+	pending []string // Filenames of queued saves, oldest first
+	seq     int
+
+	kick chan struct{}
+	stop chan struct{}
+}
+
+// outboxItem is what gets persisted to disk for each queued save
+type outboxItem struct {
+	Row     *types.Row     `json:"row,omitempty"`
+	TagPair *types.TagPair `json:"tag_pair,omitempty"`
+}
+
+// NewOutbox returns an Outbox that wraps bk and persists queued saves
+// to dir (which is created if need be).
+func NewOutbox(bk Backend, dir string) (*Outbox, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("Error making outbox dir `%s`: %v", dir, err)
+	}
+
+	files, err := filepath.Glob(path.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(byOutboxSeq(files))
+
+	// Carry on numbering after the saves already queued
+	var seq int
+	for _, filename := range files {
+		if n := outboxSeq(filename); n > seq {
+			seq = n
+		}
+	}
+
+	ob := &Outbox{
+		Backend: bk,
+		dir:     dir,
+		pending: files,
+		seq:     seq,
+		kick:    make(chan struct{}, 1),
+	}
+
+	return ob, nil
+}
+
+func (ob *Outbox) SaveRow(row *types.Row) error {
+	return ob.save(&outboxItem{Row: row})
+}
+
+func (ob *Outbox) SaveTagPair(pair *types.TagPair) error {
+	return ob.save(&outboxItem{TagPair: pair})
+}
+
+// save saves item to the wrapped Backend unless there are already
+// saves queued or the save fails, in which case item is queued.
+func (ob *Outbox) save(item *outboxItem) error {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	if len(ob.pending) == 0 {
+		err := ob.saveItem(item)
+		if err == nil {
+			return nil
+		}
+		log.Printf("Outbox: error saving to %s; queueing: %v\n",
+			ob.Backend.Name(), err)
+	}
+
+	return ob.enqueue(item)
+}
+
+func (ob *Outbox) saveItem(item *outboxItem) error {
+	if item.TagPair != nil {
+		return ob.Backend.SaveTagPair(item.TagPair)
+	}
+	if item.Row != nil {
+		return ob.Backend.SaveRow(item.Row)
+	}
+	return errors.New("Empty outbox item")
+}
+
+// enqueue persists item to disk.  ob.mu must be held.
+func (ob *Outbox) enqueue(item *outboxItem) error {
+	b, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+
+	// Numbered, rather than timestamped, so that the order queued
+	// survives the clock going backwards
+	ob.seq++
+	filename := path.Join(ob.dir, fmt.Sprintf("%012d.json", ob.seq))
+
+	if err = ioutil.WriteFile(filename, b, 0600); err != nil {
+		return fmt.Errorf("Error queueing save: %v", err)
+	}
+
+	ob.pending = append(ob.pending, filename)
+
+	// Wake up the worker, if running
+	select {
+	case ob.kick <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// outboxSeq returns the sequence number of the save queued in
+// filename, or 0 if it was queued under the old
+// "<timestamp>-<number>.json" naming, and so before any numbered one.
+func outboxSeq(filename string) int {
+	name := strings.TrimSuffix(filepath.Base(filename), ".json")
+	seq, err := strconv.Atoi(name)
+	if err != nil {
+		return 0
+	}
+	return seq
+}
+
+// byOutboxSeq sorts the filenames of queued saves in the order they
+// were queued: by sequence number (see outboxSeq), then by name
+type byOutboxSeq []string
+
+func (files byOutboxSeq) Len() int      { return len(files) }
+func (files byOutboxSeq) Swap(i, j int) { files[i], files[j] = files[j], files[i] }
+func (files byOutboxSeq) Less(i, j int) bool {
+	si, sj := outboxSeq(files[i]), outboxSeq(files[j])
+	if si != sj {
+		return si < sj
+	}
+	return files[i] < files[j]
+}
+
+// Pending returns the number of queued saves.
+func (ob *Outbox) Pending() int {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	return len(ob.pending)
+}
+
+// Flush tries to save every queued item, oldest first, stopping at
+// (and returning) the first error, then flushes the wrapped Backend
+// (see Flusher).
+func (ob *Outbox) Flush() error {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	for len(ob.pending) > 0 {
+		filename := ob.pending[0]
+
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return fmt.Errorf("Error reading queued save: %v", err)
+		}
+
+		var item outboxItem
+		if err = json.Unmarshal(b, &item); err != nil {
+			return fmt.Errorf("Error parsing queued save `%s`: %v", filename, err)
+		}
+
+		if err = ob.saveItem(&item); err != nil {
+			return err
+		}
+
+		if err = os.Remove(filename); err != nil {
+			return err
+		}
+
+		ob.pending = ob.pending[1:]
+	}
+
+	return Flush(ob.Backend)
+}
+
+func (ob *Outbox) Warm(queries []cryptag.RandomTags) error {
+	return Warm(ob.Backend, queries)
+}
+
+// Start starts a background worker that flushes queued saves
+// whenever there are any, backing off (see OutboxMinBackoff) while
+// flushing keeps failing.
+func (ob *Outbox) Start() error {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	if ob.stop != nil {
+		return ErrOutboxRunning
+	}
+	ob.stop = make(chan struct{})
+
+	go ob.loop(ob.stop)
+
+	return nil
+}
+
+// Stop stops the background worker started by Start.
+func (ob *Outbox) Stop() {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	if ob.stop != nil {
+		close(ob.stop)
+		ob.stop = nil
+	}
+}
+
+func (ob *Outbox) loop(stop chan struct{}) {
+	backoff := OutboxMinBackoff
+
+	for {
+		if ob.Pending() > 0 {
+			if err := ob.Flush(); err != nil {
+				if types.Debug {
+					log.Printf("Outbox: flush failed; retrying in %v: %v\n",
+						backoff, err)
+				}
+
+				select {
+				case <-stop:
+					return
+				case <-time.After(backoff):
+				}
+
+				backoff *= 2
+				if backoff > OutboxMaxBackoff {
+					backoff = OutboxMaxBackoff
+				}
+				continue
+			}
+			backoff = OutboxMinBackoff
+		}
+
+		// Wait for something new to be queued
+		select {
+		case <-stop:
+			return
+		case <-ob.kick:
+		}
+	}
+}
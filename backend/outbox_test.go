@@ -0,0 +1,177 @@
+// Steve Phillips / elimisteve
+// 2017.04.08
+
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyBackend is a memBackend whose saves fail while it's down
+type flakyBackend struct {
+	*memBackend
+	down int32
+}
+
+var errBackendDown = errors.New("backend down")
+
+func (fb *flakyBackend) setDown(down bool) {
+	var n int32
+	if down {
+		n = 1
+	}
+	atomic.StoreInt32(&fb.down, n)
+}
+
+func (fb *flakyBackend) SaveRow(row *types.Row) error {
+	if atomic.LoadInt32(&fb.down) == 1 {
+		return errBackendDown
+	}
+	return fb.memBackend.SaveRow(row)
+}
+
+func (fb *flakyBackend) SaveTagPair(pair *types.TagPair) error {
+	if atomic.LoadInt32(&fb.down) == 1 {
+		return errBackendDown
+	}
+	return fb.memBackend.SaveTagPair(pair)
+}
+
+func TestOutboxFlush(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cryptag-outbox-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	flaky := &flakyBackend{memBackend: newMemBackend(t)}
+	flaky.setDown(true)
+
+	ob, err := NewOutbox(flaky, dir)
+	if err != nil {
+		t.Fatalf("Error from NewOutbox: %v", err)
+	}
+
+	// New TagPairs ("queued", "id:...", "created:...", "all") and the
+	// Row itself all get queued
+	_, err = CreateRow(ob, nil, []byte("offline"), []string{"queued"})
+	if err != nil {
+		t.Fatalf("CreateRow failed rather than queueing: %v", err)
+	}
+	assert.Equal(t, 5, ob.Pending())
+
+	assert.Equal(t, errBackendDown, ob.Flush())
+	assert.Equal(t, 5, ob.Pending())
+
+	// Queue survives a restart
+	ob, err = NewOutbox(flaky, dir)
+	if err != nil {
+		t.Fatalf("Error from NewOutbox: %v", err)
+	}
+	assert.Equal(t, 5, ob.Pending())
+
+	flaky.setDown(false)
+
+	if err = ob.Flush(); err != nil {
+		t.Fatalf("Error from Flush: %v", err)
+	}
+	assert.Equal(t, 0, ob.Pending())
+	assert.Equal(t, []string{"offline"}, rowData(t, flaky, "queued"))
+}
+
+func TestOutboxOrderAcrossRestarts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cryptag-outbox-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	flaky := &flakyBackend{memBackend: newMemBackend(t)}
+	flaky.setDown(true)
+
+	// Queued under the old timestamped naming
+	legacy := filepath.Join(dir, "20991231235959000000000-000001.json")
+	pair, err := NewTagPair(flaky.TagKey(), "legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(outboxItem{TagPair: pair})
+	if err = ioutil.WriteFile(legacy, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ob, err := NewOutbox(flaky, dir)
+	if err != nil {
+		t.Fatalf("Error from NewOutbox: %v", err)
+	}
+	mustCreateRow(t, ob, "first", "one")
+
+	// Neither a restart nor the clock going backwards reorders the
+	// queue
+	defer cryptag.SetClockOffset(0)
+	cryptag.SetClockOffset(-24 * time.Hour)
+
+	for i := 0; i < 2; i++ {
+		ob, err = NewOutbox(flaky, dir)
+		if err != nil {
+			t.Fatalf("Error from NewOutbox: %v", err)
+		}
+		mustCreateRow(t, ob, "later", "one")
+	}
+	queued := append([]string{}, ob.pending...)
+	assert.Equal(t, legacy, queued[0])
+	assert.Len(t, queued, 1+3*5)
+
+	ob, err = NewOutbox(flaky, dir)
+	if err != nil {
+		t.Fatalf("Error from NewOutbox: %v", err)
+	}
+	assert.Equal(t, queued, ob.pending)
+}
+
+func TestOutboxWorker(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cryptag-outbox-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	origBackoff := OutboxMinBackoff
+	OutboxMinBackoff = 10 * time.Millisecond
+	defer func() { OutboxMinBackoff = origBackoff }()
+
+	flaky := &flakyBackend{memBackend: newMemBackend(t)}
+	flaky.setDown(true)
+
+	ob, _ := NewOutbox(flaky, dir)
+	if err = ob.Start(); err != nil {
+		t.Fatalf("Error from Start: %v", err)
+	}
+	defer ob.Stop()
+
+	assert.Equal(t, ErrOutboxRunning, ob.Start())
+
+	mustCreateRow(t, ob, "eventually", "retried")
+	assert.True(t, ob.Pending() > 0)
+
+	flaky.setDown(false)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for ob.Pending() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.Equal(t, 0, ob.Pending())
+	assert.Equal(t, []string{"eventually"}, rowData(t, flaky, "retried"))
+}
@@ -0,0 +1,104 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/cryptag/cryptag/types"
+)
+
+// decoyTags creates enough decoys to pad n random tags to the next
+// multiple of PadTagsTo, each with a TagPair of its own (saved to bk)
+// for a random plaintag starting with types.DecoyTagPrefix, so that
+// the decoys look to bk just like the real tags
+func decoyTags(bk Backend, n int) (types.TagPairs, error) {
+	var decoys types.TagPairs
+
+	for (n+len(decoys))%PadTagsTo != 0 {
+		suffix, err := randomTag()
+		if err != nil {
+			return nil, err
+		}
+		pair, err := CreateTag(bk, types.DecoyTagPrefix+suffix)
+		if err != nil {
+			return nil, err
+		}
+		decoys = append(decoys, pair)
+	}
+
+	return decoys, nil
+}
+
+// newDecoyTags returns count new decoy tags for key with no TagPair
+// (see types.IsDecoyTag), to replace those of Rows padded before
+// decoys got TagPairs
+func newDecoyTags(key *[32]byte, count int) ([]string, error) {
+	var decoys []string
+
+	for len(decoys) < count {
+		randtag, err := randomTag()
+		if err != nil {
+			return nil, err
+		}
+		if types.IsDecoyTag(key, randtag) {
+			decoys = append(decoys, randtag)
+		}
+	}
+
+	return decoys, nil
+}
+
+// knownRandomTags returns the set of the random tags of pairs
+func knownRandomTags(pairs types.TagPairs) map[string]bool {
+	known := make(map[string]bool, len(pairs))
+	for _, pair := range pairs {
+		known[pair.Random] = true
+	}
+	return known
+}
+
+// stripDecoys returns randtags minus its decoys for key, along with
+// how many decoys there were.  Random tags in known (those of actual
+// TagPairs) are never taken for decoys.
+func stripDecoys(key *[32]byte, known map[string]bool, randtags []string) (real []string, decoys int) {
+	for _, randtag := range randtags {
+		if !known[randtag] && types.IsDecoyTag(key, randtag) {
+			decoys++
+			continue
+		}
+		real = append(real, randtag)
+	}
+	return real, decoys
+}
+
+// rekeyDecoys returns randtags, sorted, with its decoys for oldKey
+// that have no TagPair replaced by as many new ones for newKey.  Such
+// a decoy is only a decoy under the key it was made for, so a Row
+// re-encrypted with another key needs new ones, or populating it fails
+// on tags with no TagPair.  Decoys with TagPairs (see decoyTags) are
+// kept, along with their TagPairs, like any other tag.
+func rekeyDecoys(randtags []string, known map[string]bool, oldKey, newKey *[32]byte) ([]string, error) {
+	real, decoys := stripDecoys(oldKey, known, randtags)
+	if decoys == 0 {
+		return randtags, nil
+	}
+
+	newDecoys, err := newDecoyTags(newKey, decoys)
+	if err != nil {
+		return nil, err
+	}
+	return canonicalRandomTags(append(real, newDecoys...)), nil
+}
+
+// decoyFreeKey returns the key (see rowKey) of a Row tagged with
+// randtags, leaving out its decoys for key.  Unlike the Row's key, it
+// stays the same when the Row is copied to a Backend with another key
+// (see rekeyDecoys).
+func decoyFreeKey(key *[32]byte, known map[string]bool, randtags []string) string {
+	real, _ := stripDecoys(key, known, randtags)
+	sort.Strings(real)
+	return strings.Join(real, "-")
+}
@@ -0,0 +1,117 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"testing"
+
+	"github.com/cryptag/cryptag/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPadTagsTo(t *testing.T) {
+	defer func(orig int) { PadTagsTo = orig }(PadTagsTo)
+	PadTagsTo = 4
+
+	mem := newMemBackend(t)
+
+	// Plus id:..., created:..., and all
+	tagSets := [][]string{
+		{"a"},
+		{"a", "b"},
+		{"a", "b", "c"},
+		{"a", "b", "c", "d", "e"},
+	}
+	for _, plaintags := range tagSets {
+		mustCreateRow(t, mem, plaintags[len(plaintags)-1], plaintags...)
+	}
+
+	for _, row := range mem.rows {
+		assert.Equal(t, 0, len(row.RandomTags)%PadTagsTo,
+			"Row has %d tags", len(row.RandomTags))
+	}
+
+	report, err := AnalyzeLeakage(mem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, map[int]int{4: 1, 8: 3}, report.TagsPerRow)
+
+	assert.Equal(t, []string{"a", "b", "c", "e"}, rowData(t, mem, "a"))
+	assert.Equal(t, []string{"c", "e"}, rowData(t, mem, "c"))
+	assert.Equal(t, []string{"e"}, rowData(t, mem, "e"))
+
+	rows, err := RowsFromPlainTags(mem, nil, []string{"d"})
+	if err != nil {
+		t.Fatalf("Error from RowsFromPlainTags: %v", err)
+	}
+	// Decoys don't show up as plaintags
+	assert.Len(t, rows[0].PlainTags(), 5+3)
+}
+
+func TestPadTagsToDecoysHaveTagPairs(t *testing.T) {
+	defer func(orig int) { PadTagsTo = orig }(PadTagsTo)
+	PadTagsTo = 8
+
+	mem := newMemBackend(t)
+	mustCreateRow(t, mem, "padded", "a")
+
+	// As mem sees them, decoys are random tags with encrypted
+	// TagPairs, just like the real tags
+	stored := map[string]bool{}
+	for _, pair := range mem.pairs {
+		assert.NotEmpty(t, pair.PlainEncrypted)
+		assert.Empty(t, pair.Plain())
+		stored[pair.Random] = true
+	}
+	row := mem.rows[0]
+	assert.Len(t, row.RandomTags, 8)
+	assert.Len(t, stored, 8)
+	for _, randtag := range row.RandomTags {
+		assert.True(t, stored[randtag], "No TagPair for %s", randtag)
+	}
+
+	// Decrypted, they're decoys, and left out of the Row's plaintags
+	rows, err := RowsFromPlainTags(mem, nil, []string{"a"})
+	if err != nil {
+		t.Fatalf("Error from RowsFromPlainTags: %v", err)
+	}
+	// a, id:..., created:..., and all
+	assert.Len(t, rows[0].PlainTags(), 4)
+	for _, plain := range rows[0].PlainTags() {
+		assert.False(t, types.IsDecoyPlainTag(plain))
+	}
+}
+
+// addLegacyDecoys pads the Row in bk whose key (see rowKey) is key
+// with count decoys that have no TagPair, as PadTagsTo once did
+func addLegacyDecoys(t *testing.T, bk *memBackend, key string, count int) {
+	decoys, err := newDecoyTags(bk.RowKey(), count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range bk.rows {
+		if rowKey(row) != key {
+			continue
+		}
+		padded := append(append([]string{}, row.RandomTags...), decoys...)
+		if err = rebindRow(bk, row, canonicalRandomTags(padded)); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	t.Fatalf("Row `%s` not found", key)
+}
+
+func TestLegacyDecoys(t *testing.T) {
+	mem := newMemBackend(t)
+	addLegacyDecoys(t, mem, rowKey(mustCreateRow(t, mem, "legacy", "a")), 4)
+
+	rows, err := RowsFromPlainTags(mem, nil, []string{"a"})
+	if err != nil {
+		t.Fatalf("Error from RowsFromPlainTags: %v", err)
+	}
+	assert.Len(t, rows[0].RandomTags, 8)
+	assert.Len(t, rows[0].PlainTags(), 4)
+}
@@ -0,0 +1,116 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+)
+
+// Pool bounds how many operations may run against Backends at once,
+// across every Backend it wraps (see Wrap) and every goroutine using
+// them.  Since each Row saved may create several TagPairs
+// concurrently (see CreateTagsFromPlain), many saves in flight can
+// otherwise overwhelm a remote Backend.
+type Pool struct {
+	sem chan struct{}
+}
+
+// NewPool returns a Pool that lets at most size operations run at
+// once.  size must be at least 1.
+func NewPool(size int) *Pool {
+	if size < 1 {
+		size = 1
+	}
+	return &Pool{sem: make(chan struct{}, size)}
+}
+
+// Wrap returns bk wrapped so that its operations run in p.
+func (p *Pool) Wrap(bk Backend) *PoolBackend {
+	return &PoolBackend{Backend: bk, pool: p}
+}
+
+// run waits for a free slot in p, then calls fn
+func (p *Pool) run(fn func() error) error {
+	p.sem <- struct{}{}
+	defer func() { <-p.sem }()
+
+	return fn()
+}
+
+// PoolBackend wraps a Backend so that each operation that talks to
+// storage waits for a free slot in its Pool first.  Every other
+// method is passed straight through to the wrapped Backend.
+type PoolBackend struct {
+	Backend
+
+	pool *Pool
+}
+
+// WithPool wraps bk in a new Pool of size size; see Pool.Wrap.
+func WithPool(bk Backend, size int) *PoolBackend {
+	return NewPool(size).Wrap(bk)
+}
+
+func (pb *PoolBackend) AllTagPairs(oldPairs types.TagPairs) (pairs types.TagPairs, err error) {
+	err = pb.pool.run(func() error {
+		pairs, err = pb.Backend.AllTagPairs(oldPairs)
+		return err
+	})
+	return pairs, err
+}
+
+func (pb *PoolBackend) TagPairsFromRandomTags(randtags cryptag.RandomTags) (pairs types.TagPairs, err error) {
+	err = pb.pool.run(func() error {
+		pairs, err = pb.Backend.TagPairsFromRandomTags(randtags)
+		return err
+	})
+	return pairs, err
+}
+
+func (pb *PoolBackend) SaveTagPair(pair *types.TagPair) error {
+	return pb.pool.run(func() error {
+		return pb.Backend.SaveTagPair(pair)
+	})
+}
+
+func (pb *PoolBackend) ListRows(randtags cryptag.RandomTags) (rows types.Rows, err error) {
+	err = pb.pool.run(func() error {
+		rows, err = pb.Backend.ListRows(randtags)
+		return err
+	})
+	return rows, err
+}
+
+func (pb *PoolBackend) RowsFromRandomTags(randtags cryptag.RandomTags) (rows types.Rows, err error) {
+	err = pb.pool.run(func() error {
+		rows, err = pb.Backend.RowsFromRandomTags(randtags)
+		return err
+	})
+	return rows, err
+}
+
+func (pb *PoolBackend) SaveRow(row *types.Row) error {
+	return pb.pool.run(func() error {
+		return pb.Backend.SaveRow(row)
+	})
+}
+
+func (pb *PoolBackend) DeleteRows(randtags cryptag.RandomTags) error {
+	return pb.pool.run(func() error {
+		return pb.Backend.DeleteRows(randtags)
+	})
+}
+
+func (pb *PoolBackend) Flush() error {
+	return pb.pool.run(func() error {
+		return Flush(pb.Backend)
+	})
+}
+
+func (pb *PoolBackend) Warm(queries []cryptag.RandomTags) error {
+	return pb.pool.run(func() error {
+		return Warm(pb.Backend, queries)
+	})
+}
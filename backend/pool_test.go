@@ -0,0 +1,91 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cryptag/cryptag/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// concurrencyBackend is a slow memBackend that records the most saves
+// ever in flight at once
+type concurrencyBackend struct {
+	*memBackend
+	inFlight int32
+	max      int32
+}
+
+func (cb *concurrencyBackend) track(fn func() error) error {
+	n := atomic.AddInt32(&cb.inFlight, 1)
+	defer atomic.AddInt32(&cb.inFlight, -1)
+
+	for {
+		max := atomic.LoadInt32(&cb.max)
+		if n <= max || atomic.CompareAndSwapInt32(&cb.max, max, n) {
+			break
+		}
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	return fn()
+}
+
+func (cb *concurrencyBackend) SaveTagPair(pair *types.TagPair) error {
+	return cb.track(func() error { return cb.memBackend.SaveTagPair(pair) })
+}
+
+func (cb *concurrencyBackend) SaveRow(row *types.Row) error {
+	return cb.track(func() error { return cb.memBackend.SaveRow(row) })
+}
+
+func TestPoolBoundsConcurrency(t *testing.T) {
+	const limit = 3
+
+	cb := &concurrencyBackend{memBackend: newMemBackend(t)}
+	pool := NewPool(limit)
+
+	// So that concurrent saves don't each create their own
+	createTags(t, cb, AllTag)
+
+	// Two wrappers sharing one Pool share its limit
+	bks := []Backend{pool.Wrap(cb), pool.Wrap(cb)}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			bk := bks[i%len(bks)]
+			_, err := CreateRow(bk, nil, []byte("data"), []string{
+				fmt.Sprintf("a%d", i), fmt.Sprintf("b%d", i),
+				fmt.Sprintf("c%d", i)})
+			if err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("Error from CreateRow: %v", err)
+	}
+
+	assert.True(t, atomic.LoadInt32(&cb.max) <= limit,
+		"%d saves were in flight at once; limit is %d", cb.max, limit)
+
+	rows, err := ListAllRows(cb, nil)
+	if err != nil {
+		t.Fatalf("Error from ListAllRows: %v", err)
+	}
+	assert.Equal(t, 20, len(rows))
+}
@@ -0,0 +1,191 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+	"github.com/elimisteve/fun"
+)
+
+// QueryCacheMaxEntries is how many query results a QueryCacheBackend
+// holds before it empties its cache and starts over.
+var QueryCacheMaxEntries = 1000
+
+// QueryCacheBackend wraps a Backend, caching the results of ListRows
+// and RowsFromRandomTags so repeating a query doesn't hit the wrapped
+// Backend again.  Results are keyed by the query's random tags sorted
+// and deduplicated, so the same tags in any order share a result.
+//
+// A cached result is dropped when a Row the query would match is
+// saved, or when a Row it includes is deleted, through the
+// QueryCacheBackend.  Changes made to the wrapped Backend any other
+// way (e.g., by another process) aren't noticed until Invalidate is
+// called.
+type QueryCacheBackend struct {
+	Backend
+
+	mu      sync.Mutex
+	results map[queryCacheKey]types.Rows
+}
+
+type queryCacheKey struct {
+	randtags string // Sorted, deduplicated, joined by "-"
+	full     bool   // RowsFromRandomTags, not ListRows
+}
+
+// WithQueryCache returns a QueryCacheBackend wrapping bk.
+func WithQueryCache(bk Backend) *QueryCacheBackend {
+	return &QueryCacheBackend{
+		Backend: bk,
+		results: map[queryCacheKey]types.Rows{},
+	}
+}
+
+// Invalidate empties qc's cache.
+func (qc *QueryCacheBackend) Invalidate() {
+	qc.mu.Lock()
+	defer qc.mu.Unlock()
+
+	qc.results = map[queryCacheKey]types.Rows{}
+}
+
+func (qc *QueryCacheBackend) ListRows(randtags cryptag.RandomTags) (types.Rows, error) {
+	full := false
+	return qc.query(randtags, full)
+}
+
+func (qc *QueryCacheBackend) RowsFromRandomTags(randtags cryptag.RandomTags) (types.Rows, error) {
+	full := true
+	return qc.query(randtags, full)
+}
+
+// query returns the result of ListRows (or, if full is true,
+// RowsFromRandomTags) for randtags from cache, querying the wrapped
+// Backend on a miss.  Copies of the cached Rows are returned so
+// callers can decrypt them and such without affecting the cache.
+func (qc *QueryCacheBackend) query(randtags cryptag.RandomTags, full bool) (types.Rows, error) {
+	key := queryCacheKey{randtags: queryKey(randtags), full: full}
+
+	qc.mu.Lock()
+	rows, ok := qc.results[key]
+	qc.mu.Unlock()
+	if ok {
+		return copyRows(rows), nil
+	}
+
+	fetch := qc.Backend.ListRows
+	if full {
+		fetch = qc.Backend.RowsFromRandomTags
+	}
+	rows, err := fetch(randtags)
+	if err != nil {
+		return nil, err
+	}
+
+	qc.mu.Lock()
+	if len(qc.results) >= QueryCacheMaxEntries {
+		qc.results = map[queryCacheKey]types.Rows{}
+	}
+	qc.results[key] = copyRows(rows)
+	qc.mu.Unlock()
+
+	return rows, nil
+}
+
+// queryKey returns randtags sorted, deduplicated, and joined by "-"
+func queryKey(randtags cryptag.RandomTags) string {
+	return strings.Join(canonicalRandomTags(append([]string{}, randtags...)), "-")
+}
+
+// SaveRow saves row to the wrapped Backend, then drops the cached
+// results of every query that row matches.
+func (qc *QueryCacheBackend) SaveRow(row *types.Row) error {
+	if err := qc.Backend.SaveRow(row); err != nil {
+		return err
+	}
+
+	qc.mu.Lock()
+	defer qc.mu.Unlock()
+
+	for key := range qc.results {
+		if fun.SliceContainsAll(row.RandomTags, strings.Split(key.randtags, "-")) {
+			delete(qc.results, key)
+		}
+	}
+
+	return nil
+}
+
+// DeleteRows deletes from the wrapped Backend, then drops the cached
+// results that include any of the deleted Rows.
+func (qc *QueryCacheBackend) DeleteRows(randtags cryptag.RandomTags) error {
+	err := qc.Backend.DeleteRows(randtags)
+
+	// Even a failed delete may have deleted some Rows
+	qc.mu.Lock()
+	defer qc.mu.Unlock()
+
+	for key, rows := range qc.results {
+		for _, row := range rows {
+			if fun.SliceContainsAll(row.RandomTags, randtags) {
+				delete(qc.results, key)
+				break
+			}
+		}
+	}
+
+	return err
+}
+
+// Warm caches the results of RowsFromRandomTags, and so also of
+// ListRows, for each of queries.  Implements Warmer.
+func (qc *QueryCacheBackend) Warm(queries []cryptag.RandomTags) error {
+	if err := Warm(qc.Backend, queries); err != nil {
+		return err
+	}
+
+	for _, randtags := range queries {
+		full := true
+		rows, err := qc.query(randtags, full)
+		if err == types.ErrRowsNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		// ListRows returns Rows with only their random tags
+		listed := make(types.Rows, len(rows))
+		for i, row := range rows {
+			listed[i] = &types.Row{RandomTags: row.RandomTags}
+		}
+		key := queryCacheKey{randtags: queryKey(randtags), full: false}
+
+		qc.mu.Lock()
+		if _, ok := qc.results[key]; !ok {
+			qc.results[key] = listed
+		}
+		qc.mu.Unlock()
+	}
+
+	return nil
+}
+
+func (qc *QueryCacheBackend) Flush() error {
+	return Flush(qc.Backend)
+}
+
+// copyRows returns shallow copies of rows
+func copyRows(rows types.Rows) types.Rows {
+	copies := make(types.Rows, len(rows))
+	for i, row := range rows {
+		c := *row
+		copies[i] = &c
+	}
+	return copies
+}
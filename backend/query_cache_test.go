@@ -0,0 +1,82 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"testing"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// queryCountingBackend counts row queries
+type queryCountingBackend struct {
+	*memBackend
+	queries int
+}
+
+func (qb *queryCountingBackend) ListRows(randtags cryptag.RandomTags) (types.Rows, error) {
+	qb.queries++
+	return qb.memBackend.ListRows(randtags)
+}
+
+func (qb *queryCountingBackend) RowsFromRandomTags(randtags cryptag.RandomTags) (types.Rows, error) {
+	qb.queries++
+	return qb.memBackend.RowsFromRandomTags(randtags)
+}
+
+func TestQueryCache(t *testing.T) {
+	counter := &queryCountingBackend{memBackend: newMemBackend(t)}
+	bk := WithQueryCache(counter)
+
+	mustCreateRow(t, bk, "first", "todo", "home")
+	mustCreateRow(t, bk, "other", "work")
+
+	todo, home := pairsRandom(t, bk, "todo"), pairsRandom(t, bk, "home")
+
+	// Repeated queries, with the tags in any order, are served from
+	// cache
+	rows, err := bk.RowsFromRandomTags([]string{todo, home})
+	if err != nil {
+		t.Fatalf("Error from RowsFromRandomTags: %v", err)
+	}
+	assert.Equal(t, 1, len(rows))
+	assert.Equal(t, 1, counter.queries)
+
+	rows, _ = bk.RowsFromRandomTags([]string{home, todo, home})
+	assert.Equal(t, 1, len(rows))
+	assert.Equal(t, 1, counter.queries)
+
+	// Decrypting a result doesn't affect the cache
+	assert.Nil(t, rows[0].Decrypt(bk.RowKey()))
+	rows, _ = bk.RowsFromRandomTags([]string{todo, home})
+	assert.Nil(t, rows[0].Decrypted())
+
+	// ListRows results are cached separately
+	bk.ListRows([]string{todo})
+	bk.ListRows([]string{todo})
+	assert.Equal(t, 2, counter.queries)
+
+	// An irrelevant write leaves the cache alone...
+	mustCreateRow(t, bk, "unrelated", "work")
+	bk.RowsFromRandomTags([]string{todo, home})
+	assert.Equal(t, 2, counter.queries)
+
+	// ...but a relevant one invalidates it
+	mustCreateRow(t, bk, "second", "todo", "home")
+	rows, _ = bk.RowsFromRandomTags([]string{todo, home})
+	assert.Equal(t, 3, counter.queries)
+	assert.Equal(t, 2, len(rows))
+
+	rows, _ = bk.ListRows([]string{todo})
+	assert.Equal(t, 4, counter.queries)
+	assert.Equal(t, 2, len(rows))
+
+	// So does deleting a Row in a cached result
+	assert.Nil(t, DeleteRows(bk, nil, []string{"todo"}))
+	_, err = bk.RowsFromRandomTags([]string{todo, home})
+	assert.Equal(t, types.ErrRowsNotFound, err)
+	assert.Equal(t, 5, counter.queries)
+}
@@ -0,0 +1,173 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+)
+
+var (
+	// QuotaTagPairGrace is how many bytes past its MaxBytes a
+	// QuotaBackend lets TagPairs take up, so that a Row's new tags can
+	// still be created (and the Row then rejected cleanly by SaveRow)
+	// when a Backend is right at its quota.
+	QuotaTagPairGrace int64 = 4096
+
+	ErrQuotaExceeded = errors.New("backend: quota exceeded")
+)
+
+// QuotaBackend wraps a Backend, rejecting writes that would make it
+// store more than MaxBytes (as measured by BackendStats) with
+// ErrQuotaExceeded.  Reads and deletes always work, and deletes free
+// up space.
+//
+// Usage is counted once, by WithQuota, then kept up to date as Rows
+// and TagPairs are saved and deleted through the QuotaBackend.
+// Saving a Row with the same random tags as an existing one counts
+// only the difference in size, since Backends (e.g., FileSystem) store
+// it in place of the old one.  Call Recount after changes made any
+// other way.
+type QuotaBackend struct {
+	Backend
+	MaxBytes int64
+
+	mu   sync.Mutex
+	used int64
+}
+
+// WithQuota returns a QuotaBackend limiting bk to maxBytes, counting
+// what bk already stores.
+func WithQuota(bk Backend, maxBytes int64) (*QuotaBackend, error) {
+	qb := &QuotaBackend{Backend: bk, MaxBytes: maxBytes}
+	if err := qb.Recount(); err != nil {
+		return nil, err
+	}
+	return qb, nil
+}
+
+// Used returns how many bytes qb's Backend stores.
+func (qb *QuotaBackend) Used() int64 {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	return qb.used
+}
+
+// Recount recounts how many bytes qb's Backend stores.
+func (qb *QuotaBackend) Recount() error {
+	stats, err := BackendStats(qb.Backend)
+	if err != nil {
+		return err
+	}
+
+	qb.mu.Lock()
+	qb.used = stats.Bytes
+	qb.mu.Unlock()
+
+	return nil
+}
+
+func (qb *QuotaBackend) SaveTagPair(pair *types.TagPair) error {
+	return qb.save(tagPairSize(pair), QuotaTagPairGrace, func() error {
+		return qb.Backend.SaveTagPair(pair)
+	})
+}
+
+func (qb *QuotaBackend) SaveRow(row *types.Row) error {
+	var replaced int64
+	old, err := rowByKey(qb.Backend, rowKey(row))
+	switch err {
+	case nil:
+		replaced = rowSize(old)
+	case types.ErrRowsNotFound:
+	default:
+		return err
+	}
+
+	return qb.save(rowSize(row)-replaced, 0, func() error {
+		return qb.Backend.SaveRow(row)
+	})
+}
+
+// save calls saveFn if storing size more bytes keeps qb within
+// MaxBytes plus grace, then counts them as used
+func (qb *QuotaBackend) save(size, grace int64, saveFn func() error) error {
+	// Held throughout so concurrent saves can't together exceed the
+	// quota
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+
+	if qb.used+size > qb.MaxBytes+grace {
+		return ErrQuotaExceeded
+	}
+
+	if err := saveFn(); err != nil {
+		return err
+	}
+	qb.used += size
+
+	return nil
+}
+
+// DeleteRows deletes the Rows tagged with all of randtags, freeing up
+// the space they took.
+func (qb *QuotaBackend) DeleteRows(randtags cryptag.RandomTags) error {
+	rows, err := qb.Backend.RowsFromRandomTags(randtags)
+	if err != nil {
+		return err
+	}
+
+	if err = qb.Backend.DeleteRows(randtags); err != nil {
+		return err
+	}
+
+	var freed int64
+	for _, row := range rows {
+		freed += rowSize(row)
+	}
+
+	qb.mu.Lock()
+	qb.used -= freed
+	qb.mu.Unlock()
+
+	return nil
+}
+
+// DeleteTagPair deletes the TagPair whose random tag is random from
+// qb's Backend, which must implement TagPairDeleter, freeing up the
+// space it took.
+func (qb *QuotaBackend) DeleteTagPair(random string) error {
+	deleter, ok := qb.Backend.(TagPairDeleter)
+	if !ok {
+		return ErrCannotDeleteTagPairs
+	}
+
+	pairs, err := qb.Backend.TagPairsFromRandomTags([]string{random})
+	if err != nil {
+		return err
+	}
+
+	if err = deleter.DeleteTagPair(random); err != nil {
+		return err
+	}
+
+	qb.mu.Lock()
+	for _, pair := range pairs {
+		qb.used -= tagPairSize(pair)
+	}
+	qb.mu.Unlock()
+
+	return nil
+}
+
+func (qb *QuotaBackend) Flush() error {
+	return Flush(qb.Backend)
+}
+
+func (qb *QuotaBackend) Warm(queries []cryptag.RandomTags) error {
+	return Warm(qb.Backend, queries)
+}
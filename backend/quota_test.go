@@ -0,0 +1,92 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuotaBackend(t *testing.T) {
+	mem := newMemBackend(t)
+	existing := strings.Repeat("e", 1000)
+	mustCreateRow(t, mem, existing, "note")
+
+	stats, err := BackendStats(mem)
+	if err != nil {
+		t.Fatalf("Error from BackendStats: %v", err)
+	}
+	assert.Equal(t, 1, stats.Rows)
+
+	qb, err := WithQuota(mem, stats.Bytes+2000)
+	if err != nil {
+		t.Fatalf("Error from WithQuota: %v", err)
+	}
+	assert.Equal(t, stats.Bytes, qb.Used())
+
+	// Under quota
+	small := strings.Repeat("s", 1000)
+	mustCreateRow(t, qb, small, "note")
+
+	// Over quota; its tags can still be created, within the grace
+	big := []byte(strings.Repeat("b", 1500))
+	_, err = CreateRow(qb, nil, big, []string{"big"})
+	assert.Equal(t, ErrQuotaExceeded, err)
+	assert.Nil(t, rowData(t, qb, "big"))
+
+	// Reads still work
+	assert.Equal(t, []string{existing, small}, rowData(t, qb, "note"))
+
+	// Deleting frees up space
+	before := qb.Used()
+	if err = qb.DeleteRows([]string{pairsRandom(t, qb, "note")}); err != nil {
+		t.Fatalf("Error from DeleteRows: %v", err)
+	}
+	assert.True(t, qb.Used() < before-2000)
+
+	if _, err = CreateRow(qb, nil, big, []string{"big"}); err != nil {
+		t.Fatalf("Error from CreateRow after freeing space: %v", err)
+	}
+
+	// Usage stays in sync with what's stored
+	stats, err = BackendStats(mem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, stats.Bytes, qb.Used())
+}
+
+func TestQuotaBackendReplaceRow(t *testing.T) {
+	fs, cleanup := newTestFileSystem(t)
+	defer cleanup()
+
+	qb, err := WithQuota(fs, 1<<20)
+	if err != nil {
+		t.Fatalf("Error from WithQuota: %v", err)
+	}
+
+	row, err := CreateRow(qb, nil, []byte(strings.Repeat("a", 1000)), []string{"note"})
+	if err != nil {
+		t.Fatalf("Error from CreateRow: %v", err)
+	}
+	afterCreate := qb.Used()
+
+	// Same random tags, so the FileSystem replaces the Row
+	if err = row.EncryptPlaintext([]byte(strings.Repeat("b", 500)), fs.RowKey()); err != nil {
+		t.Fatal(err)
+	}
+	if err = qb.SaveRow(row); err != nil {
+		t.Fatalf("Error from SaveRow: %v", err)
+	}
+	assert.True(t, qb.Used() < afterCreate, "Replaced Row still counted")
+
+	stats, err := BackendStats(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, stats.Rows)
+	assert.Equal(t, stats.Bytes, qb.Used())
+}
@@ -0,0 +1,126 @@
+// Steve Phillips / elimisteve
+// 2017.04.12
+
+package backend
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cryptag/cryptag/types"
+)
+
+var (
+	ErrNotFinite = errors.New("backend: Numeric tag values and range" +
+		" bounds must be finite (not NaN or infinite)")
+)
+
+// NumericTag returns the plaintag "key:value", formatting value so
+// that ParseNumericTag (and therefore RangeQuery) can parse it.
+// Returns ErrNotFinite if value is NaN or infinite.
+func NumericTag(key string, value float64) (string, error) {
+	if !isFinite(value) {
+		return "", ErrNotFinite
+	}
+	return key + ":" + strconv.FormatFloat(value, 'f', -1, 64), nil
+}
+
+// ParseNumericTag splits plaintag at its first colon and parses the
+// value as a number.  ok is false if plaintag has no colon or its value
+// isn't a finite number (so "key:NaN" and "key:Inf" aren't numeric).
+func ParseNumericTag(plaintag string) (key string, value float64, ok bool) {
+	i := strings.Index(plaintag, ":")
+	if i == -1 {
+		return "", 0, false
+	}
+
+	value, err := strconv.ParseFloat(plaintag[i+1:], 64)
+	if err != nil || !isFinite(value) {
+		return "", 0, false
+	}
+
+	return plaintag[:i], value, true
+}
+
+// RangeQuery returns every Row in bk tagged with a plaintag of the form
+// "key:value", where value is a number between min and max
+// (inclusive).  Plaintags with the given key but non-numeric values
+// (e.g., "priority:high") are ignored.  Rows are fetched and decrypted
+// client-side, since the Backend can't see plaintags, and are ordered
+// by value.  Returns ErrNotFinite if min or max is NaN or infinite.
+func RangeQuery(bk Backend, key string, min, max float64) (types.Rows, error) {
+	if !isFinite(min) || !isFinite(max) {
+		return nil, ErrNotFinite
+	}
+
+	pairs, err := bk.AllTagPairs(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []numericPair
+	for _, pair := range pairs {
+		k, value, ok := ParseNumericTag(pair.Plain())
+		if !ok || k != key || value < min || value > max {
+			continue
+		}
+		matches = append(matches, numericPair{pair.Random, value})
+	}
+
+	if len(matches) == 0 {
+		return nil, types.ErrRowsNotFound
+	}
+
+	sort.Stable(byValue(matches))
+
+	// A Row can have more than one matching tag (e.g., "priority:2"
+	// and "priority:3"); only include it once
+	seen := map[string]bool{}
+	var rows types.Rows
+
+	for _, match := range matches {
+		matchRows, err := rowsFromRandomTags(bk, []string{match.random})
+		if err == types.ErrRowsNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range matchRows {
+			id := strings.Join(row.RandomTags, "-")
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			rows = append(rows, row)
+		}
+	}
+
+	if len(rows) == 0 {
+		return nil, types.ErrRowsNotFound
+	}
+
+	if err = rows.Populate(bk.RowKey(), pairs); err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+func isFinite(f float64) bool {
+	return !math.IsNaN(f) && !math.IsInf(f, 0)
+}
+
+type numericPair struct {
+	random string
+	value  float64
+}
+
+type byValue []numericPair
+
+func (pairs byValue) Len() int           { return len(pairs) }
+func (pairs byValue) Swap(i, j int)      { pairs[i], pairs[j] = pairs[j], pairs[i] }
+func (pairs byValue) Less(i, j int) bool { return pairs[i].value < pairs[j].value }
@@ -0,0 +1,102 @@
+// Steve Phillips / elimisteve
+// 2017.04.12
+
+package backend
+
+import (
+	"math"
+	"testing"
+
+	"github.com/cryptag/cryptag/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseNumericTag(t *testing.T) {
+	key, value, ok := ParseNumericTag("priority:2.5")
+	assert.True(t, ok)
+	assert.Equal(t, "priority", key)
+	assert.Equal(t, 2.5, value)
+
+	_, _, ok = ParseNumericTag("priority:high")
+	assert.False(t, ok)
+
+	_, _, ok = ParseNumericTag("nocolon")
+	assert.False(t, ok)
+
+	for _, bad := range []string{"NaN", "nan", "Inf", "+Inf", "-Inf", "infinity"} {
+		_, _, ok = ParseNumericTag("priority:" + bad)
+		assert.False(t, ok, bad)
+	}
+
+	tag, err := NumericTag("priority", -1.5)
+	assert.Nil(t, err)
+	assert.Equal(t, "priority:-1.5", tag)
+	tag, err = NumericTag("priority", 3)
+	assert.Nil(t, err)
+	assert.Equal(t, "priority:3", tag)
+
+	for _, bad := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		_, err = NumericTag("priority", bad)
+		assert.Equal(t, ErrNotFinite, err)
+	}
+}
+
+func TestRangeQuery(t *testing.T) {
+	bk := newMemBackend(t)
+
+	mustCreateRow(t, bk, "p0", "priority:0")
+	p1, _ := NumericTag("priority", 1)
+	mustCreateRow(t, bk, "p1", p1)
+	mustCreateRow(t, bk, "p2", "priority:2")
+	mustCreateRow(t, bk, "p2.5", "priority:2.5")
+	mustCreateRow(t, bk, "p3", "priority:3")
+	mustCreateRow(t, bk, "p10", "priority:10")
+	mustCreateRow(t, bk, "high", "priority:high")
+	mustCreateRow(t, bk, "other key", "urgency:2")
+	mustCreateRow(t, bk, "nan", "priority:NaN")
+	mustCreateRow(t, bk, "inf", "priority:-Inf")
+
+	data := func(rows types.Rows) []string {
+		var d []string
+		for _, row := range rows {
+			d = append(d, string(row.Decrypted()))
+		}
+		return d
+	}
+
+	rows, err := RangeQuery(bk, "priority", 2, 3)
+	if err != nil {
+		t.Fatalf("Error from RangeQuery: %v", err)
+	}
+	assert.Equal(t, []string{"p2", "p2.5", "p3"}, data(rows))
+
+	rows, err = RangeQuery(bk, "priority", -100, 1)
+	if err != nil {
+		t.Fatalf("Error from RangeQuery: %v", err)
+	}
+	assert.Equal(t, []string{"p0", "p1"}, data(rows))
+
+	rows, err = RangeQuery(bk, "priority", 3, 1000)
+	if err != nil {
+		t.Fatalf("Error from RangeQuery: %v", err)
+	}
+	assert.Equal(t, []string{"p3", "p10"}, data(rows))
+
+	_, err = RangeQuery(bk, "priority", 4, 9)
+	assert.Equal(t, types.ErrRowsNotFound, err)
+
+	// A row matching twice is only returned once
+	mustCreateRow(t, bk, "both", "priority:5", "priority:6")
+	rows, err = RangeQuery(bk, "priority", 4, 9)
+	if err != nil {
+		t.Fatalf("Error from RangeQuery: %v", err)
+	}
+	assert.Equal(t, []string{"both"}, data(rows))
+
+	for _, bounds := range [][2]float64{
+		{math.NaN(), 1}, {0, math.NaN()}, {math.Inf(-1), 0}, {0, math.Inf(1)},
+	} {
+		_, err = RangeQuery(bk, "priority", bounds[0], bounds[1])
+		assert.Equal(t, ErrNotFinite, err)
+	}
+}
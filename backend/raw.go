@@ -0,0 +1,55 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+)
+
+var (
+	ErrInvalidRawRow = errors.New("backend: Raw row requires data, tags," +
+		" and nonce fields")
+)
+
+// GetRawRow returns the one Row in bk tagged with all of randtags
+// exactly as bk stores it -- still encrypted, JSON-encoded -- so that
+// it can be copied to another Backend with SaveRawRow without ever
+// being decrypted (or the key being needed).  Returns
+// types.ErrRowsNotFound if no Row matches and ErrMultipleRows if more
+// than one does.
+func GetRawRow(bk Backend, randtags cryptag.RandomTags) ([]byte, error) {
+	rows, err := rowsFromRandomTags(bk, randtags)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, types.ErrRowsNotFound
+	}
+	if len(rows) > 1 {
+		return nil, ErrMultipleRows
+	}
+
+	return json.Marshal(rows[0])
+}
+
+// SaveRawRow saves raw, a Row as returned by GetRawRow, to bk as-is.
+// The Row can only be found by tag in bk if bk also has the TagPairs
+// for its random tags, and can only be decrypted with the key of the
+// Backend raw came from.
+func SaveRawRow(bk Backend, raw []byte) error {
+	row, err := types.NewRowFromBytes(raw)
+	if err != nil {
+		return err
+	}
+
+	if len(row.Encrypted) == 0 || len(row.RandomTags) == 0 || row.Nonce == nil {
+		return ErrInvalidRawRow
+	}
+
+	return bk.SaveRow(row)
+}
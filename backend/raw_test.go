@@ -0,0 +1,76 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"testing"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRawRowTransport(t *testing.T) {
+	src := newMemBackend(t)
+	row := mustCreateRow(t, src, "carried unopened", "parcel")
+
+	raw, err := GetRawRow(src, row.RandomTags)
+	if err != nil {
+		t.Fatalf("Error from GetRawRow: %v", err)
+	}
+
+	// Still encrypted
+	assert.NotContains(t, string(raw), "carried unopened")
+
+	dst := newMemBackend(t)
+	if err = SaveRawRow(dst, raw); err != nil {
+		t.Fatalf("Error from SaveRawRow: %v", err)
+	}
+
+	// Decryptable with the source Backend's key
+	copied, err := dst.RowsFromRandomTags(row.RandomTags)
+	if err != nil {
+		t.Fatalf("Error from RowsFromRandomTags: %v", err)
+	}
+	assert.Equal(t, 1, len(copied))
+	if err = copied[0].Decrypt(src.RowKey()); err != nil {
+		t.Fatalf("Error decrypting copied row: %v", err)
+	}
+	assert.Equal(t, "carried unopened", string(copied[0].Decrypted()))
+
+	// ...and findable by tag once the TagPairs are copied, too
+	shared := newMemBackend(t)
+	shared.key = src.key
+	pairs, _ := src.AllTagPairs(nil)
+	for _, pair := range pairs {
+		if err = shared.SaveTagPair(pair); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = SaveRawRow(shared, raw); err != nil {
+		t.Fatalf("Error from SaveRawRow: %v", err)
+	}
+	assert.Equal(t, []string{"carried unopened"}, rowData(t, shared, "parcel"))
+
+	assert.Equal(t, ErrInvalidRawRow, SaveRawRow(dst, []byte(`{"tags":["x"]}`)))
+
+	mustCreateRow(t, src, "second parcel", "parcel")
+	_, err = GetRawRow(src, cryptag.RandomTags{pairsRandom(t, src, "parcel")})
+	assert.Equal(t, ErrMultipleRows, err)
+
+	_, err = GetRawRow(newMemBackend(t), cryptag.RandomTags{pairsRandom(t, src, "parcel")})
+	assert.Equal(t, types.ErrRowsNotFound, err)
+}
+
+func pairsRandom(t *testing.T, bk Backend, plain string) string {
+	pairs, err := bk.AllTagPairs(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches, err := pairs.WithAllPlainTags([]string{plain})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matches[0].Random
+}
@@ -0,0 +1,40 @@
+// Steve Phillips / elimisteve
+// 2017.04.10
+
+package backend
+
+import (
+	"errors"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+)
+
+var (
+	ErrReadOnly = errors.New("backend: read-only")
+)
+
+// ReadOnlyBackend wraps a Backend so that it can be queried but not
+// modified: SaveRow, SaveTagPair, and DeleteRows always return
+// ErrReadOnly, and every other method is passed straight through to
+// the wrapped Backend.
+type ReadOnlyBackend struct {
+	Backend
+}
+
+// ReadOnly returns a read-only view of bk.
+func ReadOnly(bk Backend) *ReadOnlyBackend {
+	return &ReadOnlyBackend{Backend: bk}
+}
+
+func (ro *ReadOnlyBackend) SaveTagPair(pair *types.TagPair) error {
+	return ErrReadOnly
+}
+
+func (ro *ReadOnlyBackend) SaveRow(row *types.Row) error {
+	return ErrReadOnly
+}
+
+func (ro *ReadOnlyBackend) DeleteRows(randtags cryptag.RandomTags) error {
+	return ErrReadOnly
+}
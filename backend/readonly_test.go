@@ -0,0 +1,49 @@
+// Steve Phillips / elimisteve
+// 2017.04.10
+
+package backend
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadOnly(t *testing.T) {
+	bk := newMemBackend(t)
+	row := mustCreateRow(t, bk, "visible", "public")
+
+	ro := ReadOnly(bk)
+
+	// Reads pass through
+	assert.Equal(t, bk.Name(), ro.Name())
+	assert.Equal(t, []string{"visible"}, rowData(t, ro, "public"))
+
+	pairs, err := ro.AllTagPairs(nil)
+	if err != nil {
+		t.Fatalf("Error from AllTagPairs: %v", err)
+	}
+	assert.NotEmpty(t, pairs)
+
+	rows, err := ro.ListRows(row.RandomTags[:1])
+	if err != nil {
+		t.Fatalf("Error from ListRows: %v", err)
+	}
+	assert.Equal(t, 1, len(rows))
+
+	// Writes don't
+	assert.Equal(t, ErrReadOnly, ro.SaveRow(row))
+	assert.Equal(t, ErrReadOnly, ro.SaveTagPair(pairs[0]))
+	assert.Equal(t, ErrReadOnly, ro.DeleteRows(row.RandomTags))
+
+	_, err = CreateRow(ro, nil, []byte("nope"), []string{"public"})
+	assert.NotNil(t, err)
+
+	assert.Equal(t, ErrReadOnly, DeleteRows(ro, nil, []string{"public"}))
+
+	// Nothing changed underneath
+	assert.Equal(t, []string{"visible"}, rowData(t, bk, "public"))
+
+	after, _ := bk.AllTagPairs(nil)
+	assert.Equal(t, len(pairs), len(after))
+}
@@ -0,0 +1,75 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/cryptag/cryptag/types"
+)
+
+var ErrRandomTagsNotDeterministic = errors.New("Random tags are not" +
+	" deterministic; set DeterministicTagEncryption and" +
+	" DeterministicRandomTags")
+
+// RebuildTagIndex recreates the TagPairs of bk that were lost (e.g.,
+// deleted or corrupted) but whose plaintags are among
+// candidatePlainTags.  Each candidate's random tag is recomputed from
+// it and bk's tag key (see DeterministicRandomTag), and its TagPair
+// saved if at least one Row in bk is tagged with that random tag and
+// bk doesn't already have it.  Returns the TagPairs saved, sorted by
+// plaintag.
+//
+// Only works for tags created while DeterministicTagEncryption and
+// DeterministicRandomTags were both set, which they must still be.
+func RebuildTagIndex(bk Backend, candidatePlainTags []string) (types.TagPairs, error) {
+	if !DeterministicTagEncryption || !DeterministicRandomTags {
+		return nil, ErrRandomTagsNotDeterministic
+	}
+
+	existing, err := bk.AllTagPairs(nil)
+	if err != nil {
+		return nil, err
+	}
+	have := make(map[string]bool, len(existing))
+	for _, pair := range existing {
+		have[pair.Random] = true
+	}
+
+	var rebuilt types.TagPairs
+	for _, plain := range normalizeTags(candidatePlainTags) {
+		if plain == "" {
+			continue
+		}
+
+		pair, err := NewTagPairDeterministic(bk.TagKey(), plain)
+		if err != nil {
+			return rebuilt, err
+		}
+		if have[pair.Random] {
+			continue
+		}
+
+		_, err = listRows(bk, []string{pair.Random})
+		if err == types.ErrRowsNotFound {
+			continue
+		}
+		if err != nil {
+			return rebuilt, err
+		}
+
+		if err = bk.SaveTagPair(pair); err != nil {
+			return rebuilt, fmt.Errorf("Error saving rebuilt tag `%s`: %v",
+				plain, err)
+		}
+		have[pair.Random] = true
+		rebuilt = append(rebuilt, pair)
+	}
+
+	sort.Sort(byPlain(rebuilt))
+
+	return rebuilt, nil
+}
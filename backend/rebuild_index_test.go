@@ -0,0 +1,88 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func withDeterministicRandomTags() func() {
+	DeterministicTagEncryption = true
+	DeterministicRandomTags = true
+	return func() {
+		DeterministicTagEncryption = false
+		DeterministicRandomTags = false
+	}
+}
+
+func TestDeterministicRandomTag(t *testing.T) {
+	bk := newMemBackend(t)
+	other := newMemBackend(t)
+
+	r1, err := DeterministicRandomTag(bk.TagKey(), "project:cryptag")
+	if err != nil {
+		t.Fatalf("Error from DeterministicRandomTag: %v", err)
+	}
+	r2, _ := DeterministicRandomTag(bk.TagKey(), "project:cryptag")
+	r3, _ := DeterministicRandomTag(bk.TagKey(), "project:other")
+	r4, _ := DeterministicRandomTag(other.TagKey(), "project:cryptag")
+
+	assert.Equal(t, r1, r2)
+	assert.NotEqual(t, r1, r3)
+	assert.NotEqual(t, r1, r4)
+	assert.Len(t, r1, RANDOM_TAG_LENGTH)
+
+	defer withDeterministicRandomTags()()
+
+	pair, err := NewTagPair(bk.TagKey(), "project:cryptag")
+	if err != nil {
+		t.Fatalf("Error from NewTagPair: %v", err)
+	}
+	assert.Equal(t, r1, pair.Random)
+}
+
+func TestRebuildTagIndex(t *testing.T) {
+	bk := newMemBackend(t)
+
+	_, err := RebuildTagIndex(bk, []string{"all"})
+	assert.Equal(t, ErrRandomTagsNotDeterministic, err)
+
+	defer withDeterministicRandomTags()()
+
+	mustCreateRow(t, bk, "one", "type:note", "project:a")
+	mustCreateRow(t, bk, "two", "type:note", "project:b")
+	want := pairsRandom(t, bk, "type:note")
+
+	// Lose every TagPair
+	bk.pairs = nil
+
+	candidates := []string{"project:a", "type:note", "unused", "project:b",
+		"all", "type:note"}
+	rebuilt, err := RebuildTagIndex(bk, candidates)
+	if err != nil {
+		t.Fatalf("Error from RebuildTagIndex: %v", err)
+	}
+
+	var plains []string
+	for _, pair := range rebuilt {
+		plains = append(plains, pair.Plain())
+	}
+	assert.Equal(t, []string{"all", "project:a", "project:b", "type:note"}, plains)
+	assert.Equal(t, want, pairsRandom(t, bk, "type:note"))
+
+	// Rows are findable by plaintag again
+	rows, err := bk.ListRows([]string{pairsRandom(t, bk, "project:b")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, rows, 1)
+
+	// Already-present TagPairs aren't saved again
+	rebuilt, err = RebuildTagIndex(bk, candidates)
+	assert.Nil(t, err)
+	assert.Empty(t, rebuilt)
+	assert.Len(t, bk.pairs, 4)
+}
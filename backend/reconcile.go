@@ -0,0 +1,113 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cryptag/cryptag/types"
+)
+
+// TagConflictError is returned by ReconcileTags when Backends disagree
+// about which plaintag a random tag stands for.
+type TagConflictError struct {
+	// Conflicts maps each such random tag to the plaintags it stands
+	// for in the various Backends, sorted
+	Conflicts map[string][]string
+}
+
+func (e *TagConflictError) Error() string {
+	var descs []string
+	for _, rand := range sortedKeysConflicts(e.Conflicts) {
+		descs = append(descs, fmt.Sprintf("`%s` is one of %q", rand,
+			e.Conflicts[rand]))
+	}
+	return fmt.Sprintf("%d random tags have conflicting plaintags: %s",
+		len(e.Conflicts), strings.Join(descs, "; "))
+}
+
+// ReconcileTags copies TagPairs between bks (e.g., the Backends that
+// mirror each other's Rows) until every one of them has every TagPair
+// any of them has, so that any Row read from any of them can have all
+// its tags resolved.  Copies are re-encrypted with the destination
+// Backend's TagKey and keep the same random tag.
+//
+// (There is no Multi Backend type in this package, so the Backends to
+// reconcile are passed in directly.)
+//
+// A random tag that stands for different plaintags in different
+// Backends isn't copied anywhere; once everything else has been
+// copied, a *TagConflictError listing each such random tag is
+// returned.
+func ReconcileTags(bks ...Backend) error {
+	all := make([]types.TagPairs, len(bks))
+	for i, bk := range bks {
+		pairs, err := bk.AllTagPairs(nil)
+		if err != nil {
+			return fmt.Errorf("Error fetching TagPairs from %s: %v", bk.Name(), err)
+		}
+		all[i] = pairs
+	}
+
+	// Random tag -> TagPair, and random tag -> set of plaintags
+	union := map[string]*types.TagPair{}
+	plains := map[string]map[string]bool{}
+
+	for _, pairs := range all {
+		for _, pair := range pairs {
+			if _, ok := union[pair.Random]; !ok {
+				union[pair.Random] = pair
+				plains[pair.Random] = map[string]bool{}
+			}
+			plains[pair.Random][pair.Plain()] = true
+		}
+	}
+
+	conflicts := map[string][]string{}
+	for rand, set := range plains {
+		if len(set) > 1 {
+			for plain := range set {
+				conflicts[rand] = append(conflicts[rand], plain)
+			}
+			sort.Strings(conflicts[rand])
+		}
+	}
+
+	for i, bk := range bks {
+		has := make(map[string]bool, len(all[i]))
+		for _, pair := range all[i] {
+			has[pair.Random] = true
+		}
+
+		for _, rand := range sortedKeysPairs(union) {
+			if has[rand] || conflicts[rand] != nil {
+				continue
+			}
+
+			pair, err := reencryptTagPair(union[rand], bk.TagKey())
+			if err != nil {
+				return err
+			}
+			if err = bk.SaveTagPair(pair); err != nil {
+				return fmt.Errorf("Error copying TagPair to %s: %v", bk.Name(), err)
+			}
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return &TagConflictError{Conflicts: conflicts}
+	}
+	return nil
+}
+
+func sortedKeysConflicts(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
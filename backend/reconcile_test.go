@@ -0,0 +1,74 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sortedPlain(t *testing.T, bk Backend) []string {
+	pairs, err := bk.AllTagPairs(nil)
+	if err != nil {
+		t.Fatalf("Error from AllTagPairs: %v", err)
+	}
+	plain := pairs.AllPlain()
+	sort.Strings(plain)
+	return plain
+}
+
+func TestReconcileTags(t *testing.T) {
+	a, b, c := newMemBackend(t), newMemBackend(t), newMemBackend(t)
+
+	createTags(t, a, "work", "home")
+	createTags(t, b, "travel")
+	shared, _ := CreateTag(a, "shared")
+	copied, _ := reencryptTagPair(shared, b.TagKey())
+	b.SaveTagPair(copied)
+
+	if err := ReconcileTags(a, b, c); err != nil {
+		t.Fatalf("Error from ReconcileTags: %v", err)
+	}
+
+	want := []string{"home", "shared", "travel", "work"}
+	for _, bk := range []Backend{a, b, c} {
+		assert.Equal(t, want, sortedPlain(t, bk), "Backend %s", bk.Name())
+	}
+
+	// Random tags carry over, so each child resolves the same tags
+	pairsA, _ := a.AllTagPairs(nil)
+	for _, bk := range []Backend{b, c} {
+		pairs, err := bk.TagPairsFromRandomTags(pairsA.AllRandom())
+		if err != nil {
+			t.Fatalf("Error from TagPairsFromRandomTags: %v", err)
+		}
+		assert.Equal(t, len(pairsA), len(pairs))
+	}
+}
+
+func TestReconcileTagsConflict(t *testing.T) {
+	a, b := newMemBackend(t), newMemBackend(t)
+
+	pair, _ := CreateTag(a, "mine")
+	createTags(t, a, "ok")
+
+	// Same random tag, different plaintag
+	theirs, _ := NewTagPair(b.TagKey(), "theirs")
+	theirs.Random = pair.Random
+	b.SaveTagPair(theirs)
+
+	err := ReconcileTags(a, b)
+	cerr, ok := err.(*TagConflictError)
+	if !ok {
+		t.Fatalf("Expected *TagConflictError, got %T: %v", err, err)
+	}
+	assert.Equal(t, map[string][]string{pair.Random: {"mine", "theirs"}},
+		cerr.Conflicts)
+
+	// Everything else was still copied; the conflict wasn't
+	assert.Equal(t, []string{"mine", "ok"}, sortedPlain(t, a))
+	assert.Equal(t, []string{"ok", "theirs"}, sortedPlain(t, b))
+}
@@ -0,0 +1,85 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"fmt"
+
+	"github.com/cryptag/cryptag/types"
+	"github.com/elimisteve/fun"
+)
+
+// PopulateRowRecover is like PopulateRowBeforeSave, but for re-saving
+// a Row whose TagPairs may have gone missing (e.g., after a partial
+// restore), so that some of row.RandomTags can't be resolved to
+// plaintags.  Given row's plaintags (see types.Row.ReplacePlainTags),
+// TagPairs are recreated for those of them missing from pairs.
+//
+// Which orphaned random tag belonged to which plaintag can't be
+// known, so it's never guessed: recovered maps each orphaned random
+// tag the caller knows the plaintag of to that plaintag, and for
+// those TagPairs are recreated, keeping the random tag (so that other
+// Rows tagged with it become findable by it again).  New random tags
+// are created for other missing plaintags, as usual, and the orphaned
+// random tags not in recovered are returned, for the caller to map
+// and recover later.
+//
+// Unlike PopulateRowStrict, which refuses plaintags without TagPairs,
+// PopulateRowRecover always creates them.  Returns every TagPair
+// created, recreated ones included.
+func PopulateRowRecover(bk Backend, row *types.Row, pairs types.TagPairs, recovered map[string]string) (newPairs types.TagPairs, orphaned []string, err error) {
+	plaintags, err := rowPlainTags(row)
+	if err != nil {
+		return nil, nil, err
+	}
+	row.ReplacePlainTags(plaintags)
+
+	knownRandom := make(map[string]bool, len(pairs))
+	for _, pair := range pairs {
+		knownRandom[pair.Random] = true
+	}
+
+	for randtag, plain := range recovered {
+		if knownRandom[randtag] || !row.HasRandomTag(randtag) {
+			return nil, nil, fmt.Errorf("Random tag `%s` isn't an orphaned"+
+				" tag of this row", randtag)
+		}
+		if !fun.SliceContains(plaintags, plain) {
+			return nil, nil, fmt.Errorf("Tag `%s` isn't one of this row's"+
+				" tags", plain)
+		}
+	}
+
+	for _, randtag := range row.RandomTags {
+		if knownRandom[randtag] || fun.SliceContains(orphaned, randtag) {
+			continue
+		}
+		plain, ok := recovered[randtag]
+		if !ok {
+			orphaned = append(orphaned, randtag)
+			continue
+		}
+
+		pair, err := reencryptTagPair(
+			types.NewTagPair(nil, randtag, nil, plain), bk.TagKey())
+		if err != nil {
+			return nil, nil, err
+		}
+		if err = bk.SaveTagPair(pair); err != nil {
+			return nil, nil, fmt.Errorf("Error recreating TagPair for tag"+
+				" `%s`: %v", plain, err)
+		}
+		newPairs = append(newPairs, pair)
+
+		pairs = append(append(types.TagPairs{}, pairs...), pair)
+		knownRandom[randtag] = true
+	}
+
+	strict := false
+	res, err := populateRowTags(bk, row, plaintags, pairs, strict)
+	if res != nil {
+		newPairs = append(newPairs, res.NewPairs...)
+	}
+	return newPairs, orphaned, err
+}
@@ -0,0 +1,133 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPopulateRowRecover(t *testing.T) {
+	mem := newMemBackend(t)
+
+	orig := mustCreateRow(t, mem, "data", "keep", "lost")
+	lostRand := pairsRandom(t, mem, "lost")
+	keepRand := pairsRandom(t, mem, "keep")
+
+	if err := mem.DeleteTagPair(lostRand); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := mem.RowsFromRandomTags([]string{keepRand})
+	if err != nil {
+		t.Fatalf("Error from RowsFromRandomTags: %v", err)
+	}
+	row := rows[0]
+	if err = row.Decrypt(mem.RowKey()); err != nil {
+		t.Fatal(err)
+	}
+	row.ReplacePlainTags(orig.PlainTags())
+
+	pairs, err := mem.AllTagPairs(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Strict mode refuses the missing tag
+	strictRow := *row
+	_, err = PopulateRowStrict(mem, &strictRow, pairs)
+	if _, ok := err.(*UnknownTagsError); !ok {
+		t.Errorf("Expected *UnknownTagsError from PopulateRowStrict, got %v", err)
+	}
+
+	// Nothing is guessed without a mapping; the orphan is returned
+	guessRow := *row
+	newPairs, orphaned, err := PopulateRowRecover(mem, &guessRow, pairs, nil)
+	if err != nil {
+		t.Fatalf("Error from PopulateRowRecover: %v", err)
+	}
+	assert.Equal(t, []string{lostRand}, orphaned)
+	assert.False(t, guessRow.HasRandomTag(lostRand))
+	for _, pair := range newPairs {
+		assert.NotEqual(t, lostRand, pair.Random)
+		if err = mem.DeleteTagPair(pair.Random); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Bad mappings are refused
+	_, _, err = PopulateRowRecover(mem, row, pairs,
+		map[string]string{keepRand: "lost"})
+	assert.NotNil(t, err)
+	_, _, err = PopulateRowRecover(mem, row, pairs,
+		map[string]string{lostRand: "nope"})
+	assert.NotNil(t, err)
+
+	oldTags := append([]string{}, row.RandomTags...)
+	newPairs, orphaned, err = PopulateRowRecover(mem, row, pairs,
+		map[string]string{lostRand: "lost"})
+	if err != nil {
+		t.Fatalf("Error from PopulateRowRecover: %v", err)
+	}
+	assert.Len(t, newPairs, 1)
+	assert.Empty(t, orphaned)
+	assert.Equal(t, oldTags, row.RandomTags)
+
+	if err = mem.DeleteRows(oldTags); err != nil {
+		t.Fatal(err)
+	}
+	if err = mem.SaveRow(row); err != nil {
+		t.Fatalf("Error from SaveRow: %v", err)
+	}
+
+	assert.Equal(t, lostRand, pairsRandom(t, mem, "lost"))
+	assert.Equal(t, []string{"data"}, rowData(t, mem, "lost"))
+	assert.Equal(t, []string{"data"}, rowData(t, mem, "keep"))
+}
+
+func TestPopulateRowRecoverAmbiguous(t *testing.T) {
+	mem := newMemBackend(t)
+
+	orig := mustCreateRow(t, mem, "data", "keep", "lost1", "lost2")
+	keepRand := pairsRandom(t, mem, "keep")
+	lostRands := []string{pairsRandom(t, mem, "lost1"), pairsRandom(t, mem, "lost2")}
+	for _, lost := range lostRands {
+		if err := mem.DeleteTagPair(lost); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rows, err := mem.RowsFromRandomTags([]string{keepRand})
+	if err != nil {
+		t.Fatalf("Error from RowsFromRandomTags: %v", err)
+	}
+	row := rows[0]
+	if err = row.Decrypt(mem.RowKey()); err != nil {
+		t.Fatal(err)
+	}
+	row.ReplacePlainTags(orig.PlainTags())
+
+	pairs, err := mem.AllTagPairs(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Which random tag goes with which plaintag is unknown, so new
+	// ones are created and the orphans returned
+	newPairs, orphaned, err := PopulateRowRecover(mem, row, pairs, nil)
+	if err != nil {
+		t.Fatalf("Error from PopulateRowRecover: %v", err)
+	}
+	assert.Len(t, newPairs, 2)
+	assert.Len(t, orphaned, 2)
+	for _, lost := range lostRands {
+		assert.False(t, row.HasRandomTag(lost))
+	}
+
+	if err = mem.SaveRow(row); err != nil {
+		t.Fatalf("Error from SaveRow: %v", err)
+	}
+	assert.Equal(t, []string{"data"}, rowData(t, mem, "lost1", "lost2"))
+}
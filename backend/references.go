@@ -0,0 +1,74 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/cryptag/cryptag/types"
+)
+
+var (
+	ErrNoIDTag = errors.New("backend: Row has no id:... tag to reference it by")
+)
+
+// RowRef returns the reference to row (which must have its plaintags
+// set) to pass to types.Row.SetReferences: the random tag of row's
+// id:... tag, which no other Row has.
+func RowRef(bk Backend, row *types.Row) (string, error) {
+	for _, plain := range row.PlainTags() {
+		if !strings.HasPrefix(plain, "id:") {
+			continue
+		}
+
+		randtags, _, err := ResolveRandomTags(bk, []string{plain})
+		if err != nil {
+			return "", err
+		}
+		if len(randtags) == 0 {
+			return "", types.ErrTagPairNotFound
+		}
+		return randtags[0], nil
+	}
+
+	return "", ErrNoIDTag
+}
+
+// GetReferencedRows fetches and populates the Rows that row
+// references (see types.Row.SetReferences), in order.  References to
+// Rows that no longer exist are skipped.
+func GetReferencedRows(bk Backend, row *types.Row) (types.Rows, error) {
+	refs := row.References()
+	if len(refs) == 0 {
+		return nil, nil
+	}
+
+	var rows types.Rows
+	for _, ref := range refs {
+		matches, err := rowsFromRandomTags(bk, []string{ref})
+		if err == types.ErrRowsNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, matches...)
+	}
+
+	if len(rows) == 0 {
+		return nil, types.ErrRowsNotFound
+	}
+
+	pairs, err := bk.AllTagPairs(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = rows.Populate(bk.RowKey(), pairs); err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
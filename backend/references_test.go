@@ -0,0 +1,63 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetReferencedRows(t *testing.T) {
+	bk := newMemBackend(t)
+
+	project := mustCreateRow(t, bk, "Launch the website", "type:project")
+	docs := mustCreateRow(t, bk, "Write the docs", "type:project")
+
+	projectRef, err := RowRef(bk, project)
+	if err != nil {
+		t.Fatalf("Error from RowRef: %v", err)
+	}
+	docsRef, _ := RowRef(bk, docs)
+
+	task, _ := types.NewRow([]byte("Buy a domain"), []string{"type:task"})
+	task.SetReferences([]string{projectRef, docsRef})
+
+	pairs, _ := bk.AllTagPairs(nil)
+	if _, err = PopulateRowBeforeSave(bk, task, pairs); err != nil {
+		t.Fatalf("Error from PopulateRowBeforeSave: %v", err)
+	}
+	if err = bk.SaveRow(task); err != nil {
+		t.Fatalf("Error from SaveRow: %v", err)
+	}
+
+	// References are encrypted
+	assert.False(t, bytes.Contains(task.Encrypted, []byte(projectRef)))
+
+	rows, err := RowsFromPlainTags(bk, nil, cryptag.PlainTags{"type:task"})
+	if err != nil {
+		t.Fatalf("Error from RowsFromPlainTags: %v", err)
+	}
+	fetched := rows[0]
+
+	// Data is unaffected by references
+	assert.Equal(t, "Buy a domain", string(fetched.Decrypted()))
+	assert.Equal(t, []string{projectRef, docsRef}, fetched.References())
+
+	linked, err := GetReferencedRows(bk, fetched)
+	if err != nil {
+		t.Fatalf("Error from GetReferencedRows: %v", err)
+	}
+	assert.Equal(t, 2, len(linked))
+	assert.Equal(t, "Launch the website", string(linked[0].Decrypted()))
+	assert.Equal(t, "Write the docs", string(linked[1].Decrypted()))
+
+	// Rows without references
+	linked, err = GetReferencedRows(bk, linked[0])
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(linked))
+}
@@ -0,0 +1,122 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+	"github.com/elimisteve/fun"
+)
+
+// ReplaceRowTags replaces the tags of the one Row tagged with all of
+// randtags with newPlainTags (creating TagPairs for them as needed),
+// e.g. to move a task from one status to another in one step.  The
+// Row keeps its id:... and created:... tags (see
+// StrictAutoTagPrefixes) unless newPlainTags has its own.
+//
+// Since a Row's data is bound to its tags, the Row is re-encrypted
+// and saved anew, then the original is deleted.  If either step
+// fails, the original is left (or put back) as it was, so the Row is
+// never left with some old tags and some new.
+func ReplaceRowTags(bk Backend, randtags cryptag.RandomTags, newPlainTags []string) error {
+	rows, err := rowsFromRandomTags(bk, randtags)
+	if err != nil {
+		return err
+	}
+	if len(rows) != 1 {
+		return fmt.Errorf("Random tags `%s` matched %d Rows, not 1",
+			strings.Join(randtags, " "), len(rows))
+	}
+	old := rows[0]
+
+	// Kept to put the original back if need be
+	orig := &types.Row{
+		Encrypted:        old.Encrypted,
+		RandomTags:       old.RandomTags,
+		Nonce:            old.Nonce,
+		EncryptedSummary: old.EncryptedSummary,
+		SummaryNonce:     old.SummaryNonce,
+	}
+
+	pairs, err := bk.AllTagPairs(nil)
+	if err != nil {
+		return err
+	}
+	if err = old.Populate(bk.RowKey(), pairs); err != nil {
+		return err
+	}
+
+	plaintags := append([]string{}, newPlainTags...)
+	for _, prefix := range StrictAutoTagPrefixes {
+		if tagWithPrefix(newPlainTags, prefix) != "" {
+			continue
+		}
+		if tag := tagWithPrefix(old.PlainTags(), prefix); tag != "" {
+			plaintags = append(plaintags, tag)
+		}
+	}
+
+	// Same data, summary, and references; new tags
+	replaced := *old
+	replaced.ReplacePlainTags(plaintags)
+	if _, err = PopulateRowBeforeSave(bk, &replaced, pairs); err != nil {
+		return err
+	}
+
+	oldTags, newTags := orig.RandomTags, replaced.RandomTags
+
+	if fun.SliceContainsAll(newTags, oldTags) {
+		if len(newTags) == len(oldTags) {
+			return nil // Same tags
+		}
+
+		// Deleting the original would also delete the replacement,
+		// so delete it first, then put it back if saving fails
+		if err = bk.DeleteRows(oldTags); err != nil {
+			return err
+		}
+		if err = bk.SaveRow(&replaced); err != nil {
+			if restoreErr := bk.SaveRow(orig); restoreErr != nil {
+				log.Printf("ReplaceRowTags: error restoring original row: %v\n",
+					restoreErr)
+			}
+			return fmt.Errorf("Error saving re-tagged row: %v", err)
+		}
+		return nil
+	}
+
+	// Save the replacement first so that no data is lost if the
+	// deletion fails; deleting oldTags won't delete it
+	if err = bk.SaveRow(&replaced); err != nil {
+		return fmt.Errorf("Error saving re-tagged row: %v", err)
+	}
+	if err = bk.DeleteRows(oldTags); err != nil {
+		// Deleting newTags would also delete the original if it has
+		// all of them
+		if !fun.SliceContainsAll(oldTags, newTags) {
+			if undoErr := bk.DeleteRows(newTags); undoErr != nil {
+				log.Printf("ReplaceRowTags: error deleting re-tagged row: %v\n",
+					undoErr)
+			}
+		}
+		return fmt.Errorf("Error deleting original row: %v", err)
+	}
+
+	return nil
+}
+
+// tagWithPrefix returns the first of plaintags starting with prefix,
+// or "" if there isn't one
+func tagWithPrefix(plaintags []string, prefix string) string {
+	for _, plain := range plaintags {
+		if strings.HasPrefix(plain, prefix) {
+			return plain
+		}
+	}
+	return ""
+}
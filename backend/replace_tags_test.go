@@ -0,0 +1,82 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cryptag/cryptag/types"
+)
+
+func TestReplaceRowTags(t *testing.T) {
+	mem := newMemBackend(t)
+
+	row := mustCreateRow(t, mem, "write tests", "task", "status:todo")
+	mustCreateRow(t, mem, "other", "task", "status:todo")
+
+	var id string
+	for _, plain := range row.PlainTags() {
+		if strings.HasPrefix(plain, "id:") {
+			id = plain
+		}
+	}
+
+	idRand := pairsRandom(t, mem, id)
+	err := ReplaceRowTags(mem, []string{idRand}, []string{"task", "status:done"})
+	if err != nil {
+		t.Fatalf("Error from ReplaceRowTags: %v", err)
+	}
+
+	_, err = RowsFromPlainTags(mem, nil, []string{id, "status:todo"})
+	if err != types.ErrRowsNotFound {
+		t.Errorf("Expected old tags to no longer match, got err == %v", err)
+	}
+
+	if data := rowData(t, mem, id, "status:done"); len(data) != 1 || data[0] != "write tests" {
+		t.Errorf("Expected re-tagged row by new tags and kept id, got %q", data)
+	}
+	if data := rowData(t, mem, "status:todo"); len(data) != 1 || data[0] != "other" {
+		t.Errorf("Expected only the other row to still be todo, got %q", data)
+	}
+}
+
+func TestReplaceRowTagsSuperset(t *testing.T) {
+	mem := newMemBackend(t)
+
+	mustCreateRow(t, mem, "write tests", "task")
+	taskRand := pairsRandom(t, mem, "task")
+
+	err := ReplaceRowTags(mem, []string{taskRand}, []string{"task", "urgent"})
+	if err != nil {
+		t.Fatalf("Error from ReplaceRowTags: %v", err)
+	}
+
+	if data := rowData(t, mem, "task", "urgent"); len(data) != 1 || data[0] != "write tests" {
+		t.Errorf("Expected 1 row tagged task and urgent, got %q", data)
+	}
+	if data := rowData(t, mem, "task"); len(data) != 1 {
+		t.Errorf("Expected the original to be replaced, got %q", data)
+	}
+}
+
+func TestReplaceRowTagsSaveFails(t *testing.T) {
+	mem := newMemBackend(t)
+
+	mustCreateRow(t, mem, "write tests", "task", "status:todo")
+	todoRand := pairsRandom(t, mem, "status:todo")
+
+	bk := &crashingBackend{Backend: mem, saves: 0}
+	err := ReplaceRowTags(bk, []string{todoRand}, []string{"task", "status:done"})
+	if err == nil {
+		t.Fatal("Expected error from ReplaceRowTags, got nil")
+	}
+
+	if data := rowData(t, mem, "task", "status:todo"); len(data) != 1 || data[0] != "write tests" {
+		t.Errorf("Expected original row intact, got %q", data)
+	}
+	if data := rowData(t, mem, "status:done"); data != nil {
+		t.Errorf("Expected no row with the new tags, got %q", data)
+	}
+}
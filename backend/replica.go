@@ -0,0 +1,138 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"errors"
+	"log"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+)
+
+var (
+	ErrReplicaStale = errors.New("backend: replica is behind primary")
+)
+
+// ReplicaBackend wraps a primary Backend, directing Row queries to
+// Replica, a read replica of it (with the same keys), to take load off
+// of the primary.  Whenever Replica errs -- say, it's down -- or looks
+// stale, the query is retried against the primary.  All writes go to
+// the primary.
+//
+// Replica is considered stale if it finds no Rows, or lacks a TagPair
+// for any of the random tags queried, as happens when those tags were
+// created after it last caught up.  A lagging Replica that has every
+// TagPair queried but not every matching Row can't be told apart from
+// an up-to-date one, though, and its answer is returned as is; only
+// use a Replica whose lag is acceptable to callers.
+//
+// AllTagPairs always queries the primary, since Rows saved using a
+// stale list of TagPairs would get duplicate tags (see
+// PopulateRowBeforeSave).
+type ReplicaBackend struct {
+	Backend
+	Replica Backend
+}
+
+// ReplicaRead returns a ReplicaBackend that writes to primary and
+// reads from replica when it can.
+func ReplicaRead(primary, replica Backend) *ReplicaBackend {
+	return &ReplicaBackend{Backend: primary, Replica: replica}
+}
+
+func (rb *ReplicaBackend) TagPairsFromRandomTags(randtags cryptag.RandomTags) (types.TagPairs, error) {
+	pairs, err := rb.Replica.TagPairsFromRandomTags(randtags)
+	if err == nil && hasAllRandom(pairs, randtags) {
+		return pairs, nil
+	}
+	rb.fellBack("TagPairsFromRandomTags", err)
+	return rb.Backend.TagPairsFromRandomTags(randtags)
+}
+
+func (rb *ReplicaBackend) ListRows(randtags cryptag.RandomTags) (types.Rows, error) {
+	rows, err := rb.Replica.ListRows(randtags)
+	if err == nil {
+		err = rb.checkFresh(rows, randtags)
+	}
+	if err == nil {
+		return rows, nil
+	}
+	rb.fellBack("ListRows", err)
+	return rb.Backend.ListRows(randtags)
+}
+
+func (rb *ReplicaBackend) RowsFromRandomTags(randtags cryptag.RandomTags) (types.Rows, error) {
+	rows, err := rb.Replica.RowsFromRandomTags(randtags)
+	if err == nil {
+		err = rb.checkFresh(rows, randtags)
+	}
+	if err == nil {
+		return rows, nil
+	}
+	rb.fellBack("RowsFromRandomTags", err)
+	return rb.Backend.RowsFromRandomTags(randtags)
+}
+
+// DeleteTagPair deletes the TagPair whose random tag is random from
+// the primary, which must implement TagPairDeleter.
+func (rb *ReplicaBackend) DeleteTagPair(random string) error {
+	deleter, ok := rb.Backend.(TagPairDeleter)
+	if !ok {
+		return ErrCannotDeleteTagPairs
+	}
+	return deleter.DeleteTagPair(random)
+}
+
+func (rb *ReplicaBackend) Flush() error {
+	return Flush(rb.Backend)
+}
+
+// Warm warms both Replica, which is read from first, and the primary,
+// which reads fall back to
+func (rb *ReplicaBackend) Warm(queries []cryptag.RandomTags) error {
+	if err := Warm(rb.Replica, queries); err != nil {
+		return err
+	}
+	return Warm(rb.Backend, queries)
+}
+
+// checkFresh returns ErrReplicaStale unless rows, which Replica
+// returned for randtags, is non-empty and Replica has a TagPair for
+// each of randtags
+func (rb *ReplicaBackend) checkFresh(rows types.Rows, randtags []string) error {
+	if len(rows) == 0 {
+		return ErrReplicaStale
+	}
+	pairs, err := rb.Replica.TagPairsFromRandomTags(randtags)
+	if err != nil {
+		return err
+	}
+	if !hasAllRandom(pairs, randtags) {
+		return ErrReplicaStale
+	}
+	return nil
+}
+
+func (rb *ReplicaBackend) fellBack(method string, err error) {
+	if types.Debug {
+		log.Printf("%s: replica %s missed (err == %v); querying primary %s\n",
+			method, rb.Replica.Name(), err, rb.Backend.Name())
+	}
+}
+
+// hasAllRandom reports whether pairs includes a TagPair for each of
+// randtags
+func hasAllRandom(pairs types.TagPairs, randtags []string) bool {
+	found := make(map[string]bool, len(pairs))
+	for _, pair := range pairs {
+		found[pair.Random] = true
+	}
+	for _, randtag := range randtags {
+		if !found[randtag] {
+			return false
+		}
+	}
+	return true
+}
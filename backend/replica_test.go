@@ -0,0 +1,86 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newReplicaPair(t *testing.T) (primary, replica *memBackend) {
+	primary = newMemBackend(t)
+	replica = newMemBackend(t)
+	replica.key = primary.key
+	return primary, replica
+}
+
+func TestReplicaReadFallsBackToPrimary(t *testing.T) {
+	primary, replica := newReplicaPair(t)
+	rb := ReplicaRead(primary, replica)
+
+	// Writes go to the primary only
+	mustCreateRow(t, rb, "new", "note")
+	assert.Len(t, primary.rows, 1)
+	assert.Len(t, replica.rows, 0)
+
+	assert.Equal(t, []string{"new"}, rowData(t, rb, "note"))
+
+	noteRand := pairsRandom(t, primary, "note")
+	pairs, err := rb.TagPairsFromRandomTags([]string{noteRand})
+	if err != nil {
+		t.Fatalf("Error from TagPairsFromRandomTags: %v", err)
+	}
+	assert.Len(t, pairs, 1)
+}
+
+func TestReplicaReadPrefersReplica(t *testing.T) {
+	primary, replica := newReplicaPair(t)
+	rb := ReplicaRead(primary, replica)
+
+	// A row only the replica has is served by it; its TagPairs, like
+	// all TagPairs, are read from the primary
+	mustCreateRow(t, replica, "replicated", "note")
+	for _, pair := range replica.pairs {
+		if err := primary.SaveTagPair(pair); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Len(t, primary.rows, 0)
+
+	assert.Equal(t, []string{"replicated"}, rowData(t, rb, "note"))
+}
+
+func TestReplicaReadDetectsStaleReplica(t *testing.T) {
+	primary, replica := newReplicaPair(t)
+	rb := ReplicaRead(primary, replica)
+
+	mustCreateRow(t, primary, "first", "urgent")
+	urgentRand := pairsRandom(t, primary, "urgent")
+
+	// The replica has the first Row but neither the "urgent" TagPair
+	// nor the Row saved after it
+	rows, err := primary.RowsFromRandomTags([]string{urgentRand})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if err = replica.SaveRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mustCreateRow(t, primary, "second", "urgent")
+
+	got, err := rb.RowsFromRandomTags([]string{urgentRand})
+	if err != nil {
+		t.Fatalf("Error from RowsFromRandomTags: %v", err)
+	}
+	assert.Len(t, got, 2, "Stale replica's answer should have been rejected")
+
+	got, err = rb.ListRows([]string{urgentRand})
+	if err != nil {
+		t.Fatalf("Error from ListRows: %v", err)
+	}
+	assert.Len(t, got, 2, "Stale replica's answer should have been rejected")
+}
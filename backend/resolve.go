@@ -0,0 +1,157 @@
+// Steve Phillips / elimisteve
+// 2017.04.17
+
+package backend
+
+import (
+	"sort"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+)
+
+var (
+	// BatchResolveTagsSize is the most random tags BatchResolveTags
+	// asks a Backend to resolve per TagPairsFromRandomTags call (which,
+	// for remote Backends, keeps request URLs a reasonable length).
+	BatchResolveTagsSize = 500
+)
+
+// BatchResolveTags fetches the TagPairs for randtags in as few
+// TagPairsFromRandomTags calls as possible, skipping duplicates, and
+// returns them keyed by random tag.  Random tags with no TagPair are
+// left out of the map rather than causing an error.
+func BatchResolveTags(bk Backend, randtags cryptag.RandomTags) (map[string]*types.TagPair, error) {
+	resolved := make(map[string]*types.TagPair, len(randtags))
+
+	// Dedupe
+	seen := make(map[string]bool, len(randtags))
+	unique := make(cryptag.RandomTags, 0, len(randtags))
+	for _, rand := range randtags {
+		if !seen[rand] {
+			seen[rand] = true
+			unique = append(unique, rand)
+		}
+	}
+
+	for start := 0; start < len(unique); start += BatchResolveTagsSize {
+		end := start + BatchResolveTagsSize
+		if end > len(unique) {
+			end = len(unique)
+		}
+
+		pairs, err := bk.TagPairsFromRandomTags(unique[start:end])
+		if err == types.ErrTagPairNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, pair := range pairs {
+			resolved[pair.Random] = pair
+		}
+	}
+
+	return resolved, nil
+}
+
+// TagPairsForRows fetches just the TagPairs needed to display rows
+// (e.g., to populate them; see types.Rows.Populate): those of the
+// random tags any of rows has, resolved together with
+// BatchResolveTags rather than by fetching every TagPair with
+// AllTagPairs.  Random tags with no TagPair (e.g., decoys from before
+// decoys got TagPairs; see PadTagsTo) are skipped.  The TagPairs are returned sorted by plaintag.
+func TagPairsForRows(bk Backend, rows types.Rows) (types.TagPairs, error) {
+	var randtags cryptag.RandomTags
+	for _, row := range rows {
+		randtags = append(randtags, row.RandomTags...)
+	}
+	if len(randtags) == 0 {
+		return types.TagPairs{}, nil
+	}
+
+	resolved, err := BatchResolveTags(bk, randtags)
+	if err != nil {
+		return nil, err
+	}
+
+	pairs := make(types.TagPairs, 0, len(resolved))
+	for _, pair := range resolved {
+		pairs = append(pairs, pair)
+	}
+	sort.Sort(byPlain(pairs))
+
+	return pairs, nil
+}
+
+// ResolveRandomTags resolves plaintags (normalized with NormalizeTag)
+// to their random tags, in order, without fetching any Rows -- the
+// first half of querying (e.g., for building cache keys).  Plaintags
+// with no TagPair are returned as unresolved rather than causing an
+// error.
+func ResolveRandomTags(bk Backend, plaintags []string) (randtags cryptag.RandomTags, unresolved []string, err error) {
+	pairs, err := partialTagPairs(bk.AllTagPairs(nil))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// plaintag -> random tag, preferring the first TagPair found
+	random := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		if _, ok := random[pair.Plain()]; !ok {
+			random[pair.Plain()] = pair.Random
+		}
+	}
+
+	for _, plain := range normalizeTags(plaintags) {
+		if rand, ok := random[plain]; ok {
+			randtags = append(randtags, rand)
+		} else {
+			unresolved = append(unresolved, plain)
+		}
+	}
+
+	return randtags, unresolved, nil
+}
+
+// ResolveMixedTags is like ResolveRandomTags, but tags may be a mix of
+// random tags and plaintags (e.g., a query built from both tags the
+// UI already resolved and ones the user typed).  Each of tags that is
+// the random tag of some TagPair is passed through as is; the rest are
+// resolved as plaintags.  The resulting random tags are returned in
+// order, along with the plaintags that couldn't be resolved.
+//
+// A plaintag that happens to equal an existing random tag is taken to
+// be that random tag.
+func ResolveMixedTags(bk Backend, tags []string) (randtags cryptag.RandomTags, unresolved []string, err error) {
+	pairs, err := partialTagPairs(bk.AllTagPairs(nil))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	isRandom := make(map[string]bool, len(pairs))
+	random := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		isRandom[pair.Random] = true
+		if _, ok := random[pair.Plain()]; !ok {
+			random[pair.Plain()] = pair.Random
+		}
+	}
+
+	for _, tag := range tags {
+		if isRandom[tag] {
+			randtags = append(randtags, tag)
+			continue
+		}
+
+		plain := normalizeTags([]string{tag})[0]
+		if rand, ok := random[plain]; ok {
+			randtags = append(randtags, rand)
+		} else {
+			unresolved = append(unresolved, plain)
+		}
+	}
+
+	return randtags, unresolved, nil
+}
@@ -0,0 +1,197 @@
+// Steve Phillips / elimisteve
+// 2017.04.17
+
+package backend
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingBackend counts calls to TagPairsFromRandomTags and the
+// random tags passed to it
+type countingBackend struct {
+	*memBackend
+
+	mu        sync.Mutex
+	calls     int
+	requested int
+}
+
+func (cb *countingBackend) TagPairsFromRandomTags(randtags cryptag.RandomTags) (types.TagPairs, error) {
+	cb.mu.Lock()
+	cb.calls++
+	cb.requested += len(randtags)
+	cb.mu.Unlock()
+	return cb.memBackend.TagPairsFromRandomTags(randtags)
+}
+
+func (cb *countingBackend) counts() (calls, requested int) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.calls, cb.requested
+}
+
+func (cb *countingBackend) reset() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.calls, cb.requested = 0, 0
+}
+
+func TestBatchResolveTags(t *testing.T) {
+	bk := &countingBackend{memBackend: newMemBackend(t)}
+	pairs := createTags(t, bk, plaintagsN("tag", 10)...)
+
+	// Don't count CreateTag's checks for random tag collisions
+	bk.reset()
+
+	// Every random tag 3 times, plus one that doesn't exist
+	var randtags []string
+	for i := 0; i < 3; i++ {
+		randtags = append(randtags, pairs.AllRandom()...)
+	}
+	randtags = append(randtags, "nonexistent")
+
+	resolved, err := BatchResolveTags(bk, randtags)
+	if err != nil {
+		t.Fatalf("Error from BatchResolveTags: %v", err)
+	}
+
+	calls, requested := bk.counts()
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, 11, requested, "Duplicates should be requested once")
+
+	assert.Equal(t, 10, len(resolved))
+	for _, pair := range pairs {
+		assert.Equal(t, pair.Plain(), resolved[pair.Random].Plain())
+	}
+	assert.Nil(t, resolved["nonexistent"])
+
+	// Big inputs are split into batches
+	orig := BatchResolveTagsSize
+	BatchResolveTagsSize = 4
+	defer func() { BatchResolveTagsSize = orig }()
+
+	bk.reset()
+	resolved, _ = BatchResolveTags(bk, randtags)
+	calls, _ = bk.counts()
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, 10, len(resolved))
+}
+
+func TestTagPairsForRows(t *testing.T) {
+	defer func(orig int) { PadTagsTo = orig }(PadTagsTo)
+	PadTagsTo = 8
+
+	bk := &countingBackend{memBackend: newMemBackend(t)}
+
+	one := mustCreateRow(t, bk, "one", "type:note", "project:a")
+	two := mustCreateRow(t, bk, "two", "type:note", "project:b")
+	mustCreateRow(t, bk, "three", "type:todo", "project:c")
+
+	bk.reset()
+
+	pairs, err := TagPairsForRows(bk, types.Rows{one, two})
+	if err != nil {
+		t.Fatalf("Error from TagPairsForRows: %v", err)
+	}
+	calls, _ := bk.counts()
+	assert.Equal(t, 1, calls)
+
+	// Just the tags of one and two, each once, plus their decoys
+	var plains []string
+	for _, plain := range pairs.AllPlain() {
+		if !isAutoTag(plain) && !types.IsDecoyPlainTag(plain) {
+			plains = append(plains, plain)
+		}
+	}
+	assert.Equal(t, []string{"all", "project:a", "project:b", "type:note"}, plains)
+	assert.Len(t, pairs, 8+2*3)
+
+	pairs, err = TagPairsForRows(bk, nil)
+	assert.Nil(t, err)
+	assert.Empty(t, pairs)
+}
+
+func TestFileSystemTagPairsFromRandomTags(t *testing.T) {
+	fs, cleanup := newTestFileSystem(t)
+	defer cleanup()
+
+	pairs := createTags(t, fs, "a", "b", "c")
+
+	found, err := fs.TagPairsFromRandomTags([]string{pairs[2].Random,
+		"nonexistent", pairs[0].Random})
+	if err != nil {
+		t.Fatalf("Error from TagPairsFromRandomTags: %v", err)
+	}
+	assert.Equal(t, []string{"c", "a"}, found.AllPlain())
+
+	_, err = fs.TagPairsFromRandomTags([]string{"nonexistent"})
+	assert.Equal(t, types.ErrTagPairNotFound, err)
+
+	_, err = fs.TagPairsFromRandomTags([]string{"../rows"})
+	assert.NotNil(t, err)
+}
+
+func BenchmarkBatchResolveTags(b *testing.B) {
+	bk := newMemBackend(b)
+	pairs := createTags(b, bk, plaintagsN("tag", 200)...)
+
+	// As if resolving the tags of many Rows that share most tags
+	var randtags []string
+	for i := 0; i < 50; i++ {
+		randtags = append(randtags, pairs.AllRandom()...)
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := BatchResolveTags(bk, randtags); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestResolveRandomTags(t *testing.T) {
+	bk := newMemBackend(t)
+	pairs := createTags(t, bk, "work", "urgent")
+
+	randtags, unresolved, err := ResolveRandomTags(bk,
+		[]string{"urgent", "nope", "work", "nada"})
+	if err != nil {
+		t.Fatalf("Error from ResolveRandomTags: %v", err)
+	}
+	assert.Equal(t, cryptag.RandomTags{pairs[1].Random, pairs[0].Random}, randtags)
+	assert.Equal(t, []string{"nope", "nada"}, unresolved)
+
+	// Nothing resolvable isn't an error
+	randtags, unresolved, err = ResolveRandomTags(bk, []string{"nope"})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(randtags))
+	assert.Equal(t, []string{"nope"}, unresolved)
+}
+
+func TestResolveMixedTags(t *testing.T) {
+	bk := newMemBackend(t)
+	pairs := createTags(t, bk, "work", "urgent", "home")
+
+	randtags, unresolved, err := ResolveMixedTags(bk,
+		[]string{pairs[2].Random, "urgent", "nope", pairs[0].Random})
+	if err != nil {
+		t.Fatalf("Error from ResolveMixedTags: %v", err)
+	}
+	assert.Equal(t, cryptag.RandomTags{pairs[2].Random, pairs[1].Random,
+		pairs[0].Random}, randtags)
+	assert.Equal(t, []string{"nope"}, unresolved)
+
+	// Results can be queried by directly
+	mustCreateRow(t, bk, "report", "work", "urgent")
+	rows, err := bk.ListRows(randtags[1:])
+	if err != nil {
+		t.Fatalf("Error from ListRows: %v", err)
+	}
+	assert.Len(t, rows, 1)
+}
@@ -0,0 +1,217 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+)
+
+var (
+	ErrRetagPending = errors.New("backend: An interrupted bulk re-tag must" +
+		" be resumed (ResumeRetag) or rolled back (RollbackRetag) first")
+	ErrNoRetagPending = errors.New("backend: No interrupted bulk re-tag to" +
+		" resume or roll back")
+)
+
+// retagJournal records a bulk re-tag (see AddTagToRows) so that it
+// can be finished or undone if it's interrupted.  Since Backends only
+// delete Rows by subset of random tags, the original of each re-tagged
+// Row can't be deleted without also deleting its re-tagged copy, so
+// applying (and undoing) the re-tag deletes then re-saves each Row;
+// the journal holds each Row's (encrypted) contents in the meantime.
+type retagJournal struct {
+	NewRandom string     `json:"new_random"`
+	Rows      types.Rows `json:"rows"` // Originals, before re-tagging
+
+	// Applying is set once the Backend may have been modified
+	Applying bool `json:"applying"`
+}
+
+// RetagJournalPath returns where the journal of bk's in-progress bulk
+// re-tag, if any, is stored.
+func RetagJournalPath(bk Backend) string {
+	return path.Join(cryptag.BackendPath, bk.Name()+".retag")
+}
+
+// AddTagToRows tags every Row tagged with all of plaintags with newTag,
+// too, creating newTag's TagPair if need be, and returns the number of
+// Rows re-tagged.
+//
+// Either every Row is re-tagged or none are: the re-tag is first
+// journaled to disk (see RetagJournalPath), then applied.  If
+// AddTagToRows fails or is interrupted partway through, call
+// ResumeRetag to finish the re-tag or RollbackRetag to undo it;
+// AddTagToRows returns ErrRetagPending until then.
+func AddTagToRows(bk Backend, pairs types.TagPairs, plaintags cryptag.PlainTags, newTag string) (int, error) {
+	if _, err := loadRetagJournal(bk); err != ErrNoRetagPending {
+		if err == nil {
+			err = ErrRetagPending
+		}
+		return 0, err
+	}
+
+	if pairs == nil {
+		var err error
+		pairs, err = bk.AllTagPairs(nil)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	newPairs, err := CreateTagsFromPlain(bk, []string{newTag}, pairs)
+	if err != nil {
+		return 0, err
+	}
+	pairs = append(pairs, newPairs...)
+
+	query := append(append([]string{}, plaintags...), newTag)
+
+	matches, err := pairs.WithAllPlainTags(normalizeTags(query))
+	if err != nil {
+		return 0, err
+	}
+	newRand := matches[len(matches)-1].Random
+
+	rows, err := rowsFromRandomTags(bk, matches[:len(matches)-1].AllRandom())
+	if err == types.ErrRowsNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	journal := &retagJournal{NewRandom: newRand}
+	for _, row := range rows {
+		if !row.HasRandomTag(newRand) {
+			journal.Rows = append(journal.Rows, row)
+		}
+	}
+	if len(journal.Rows) == 0 {
+		return 0, nil
+	}
+
+	// Stage
+	if err = journal.save(bk); err != nil {
+		return 0, fmt.Errorf("Error journaling re-tag: %v", err)
+	}
+
+	return ResumeRetag(bk)
+}
+
+// ResumeRetag finishes the bulk re-tag started by an AddTagToRows call
+// that failed or was interrupted, returning the number of Rows
+// re-tagged.  Returns ErrNoRetagPending if there's nothing to resume.
+func ResumeRetag(bk Backend) (int, error) {
+	journal, err := loadRetagJournal(bk)
+	if err != nil {
+		return 0, err
+	}
+
+	if !journal.Applying {
+		journal.Applying = true
+		if err = journal.save(bk); err != nil {
+			return 0, err
+		}
+	}
+
+	for _, row := range journal.Rows {
+		retagged := &types.Row{
+			Encrypted:        row.Encrypted,
+			RandomTags:       row.RandomTags,
+			Nonce:            row.Nonce,
+			EncryptedSummary: row.EncryptedSummary,
+			SummaryNonce:     row.SummaryNonce,
+		}
+		newTags := append([]string{journal.NewRandom}, row.RandomTags...)
+		if err = rebindRow(bk, retagged, canonicalRandomTags(newTags)); err != nil {
+			return 0, err
+		}
+		if err = replaceRow(bk, row.RandomTags, retagged); err != nil {
+			return 0, err
+		}
+	}
+
+	if types.Debug {
+		log.Printf("ResumeRetag: re-tagged %d rows\n", len(journal.Rows))
+	}
+
+	return len(journal.Rows), removeRetagJournal(bk)
+}
+
+// RollbackRetag undoes whatever part of the bulk re-tag started by an
+// AddTagToRows call that failed or was interrupted was done, leaving
+// every Row tagged as it was.  newTag's TagPair is left intact.
+// Returns ErrNoRetagPending if there's nothing to roll back.
+func RollbackRetag(bk Backend) error {
+	journal, err := loadRetagJournal(bk)
+	if err != nil {
+		return err
+	}
+
+	if journal.Applying {
+		for _, row := range journal.Rows {
+			if err = replaceRow(bk, row.RandomTags, row); err != nil {
+				return err
+			}
+		}
+	}
+
+	return removeRetagJournal(bk)
+}
+
+// replaceRow deletes whichever Rows are tagged with all of randtags,
+// if any, then saves row.  Safe to repeat.  Rows created with
+// types.NewRow each have a unique id:... tag, so only the Row tagged
+// with exactly randtags and its re-tagged copy are deleted.
+func replaceRow(bk Backend, randtags cryptag.RandomTags, row *types.Row) error {
+	err := bk.DeleteRows(randtags)
+	if err != nil && err != types.ErrRowsNotFound {
+		return fmt.Errorf("Error deleting row: %v", err)
+	}
+	if err = bk.SaveRow(row); err != nil {
+		return fmt.Errorf("Error saving row: %v", err)
+	}
+	return nil
+}
+
+func loadRetagJournal(bk Backend) (*retagJournal, error) {
+	b, err := ioutil.ReadFile(RetagJournalPath(bk))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNoRetagPending
+		}
+		return nil, err
+	}
+
+	var journal retagJournal
+	if err = json.Unmarshal(b, &journal); err != nil {
+		return nil, fmt.Errorf("Error parsing re-tag journal: %v", err)
+	}
+	return &journal, nil
+}
+
+func (journal *retagJournal) save(bk Backend) error {
+	b, err := json.Marshal(journal)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(RetagJournalPath(bk), b)
+}
+
+func removeRetagJournal(bk Backend) error {
+	err := os.Remove(RetagJournalPath(bk))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// crashingBackend simulates a crash partway through a bulk operation:
+// after saves more Rows are saved, SaveRow fails
+type crashingBackend struct {
+	Backend
+	saves int
+}
+
+func (cb *crashingBackend) SaveRow(row *types.Row) error {
+	if cb.saves <= 0 {
+		return errBackendDown
+	}
+	cb.saves--
+	return cb.Backend.SaveRow(row)
+}
+
+func createRetagRows(t *testing.T, bk Backend, n int) []string {
+	var data []string
+	for i := 0; i < n; i++ {
+		d := fmt.Sprintf("task %d", i)
+		mustCreateRow(t, bk, d, "task")
+		data = append(data, d)
+	}
+	return data
+}
+
+func sortedRowData(t *testing.T, bk Backend, plaintags ...string) []string {
+	rows, err := RowsFromPlainTags(bk, nil, cryptag.PlainTags(plaintags))
+	if err == types.ErrRowsNotFound {
+		return nil
+	}
+	if err != nil {
+		t.Fatalf("Error from RowsFromPlainTags(%v): %v", plaintags, err)
+	}
+
+	var data []string
+	for _, row := range rows {
+		data = append(data, string(row.Decrypted()))
+	}
+	sort.Strings(data)
+	return data
+}
+
+func TestAddTagToRows(t *testing.T) {
+	fs, cleanup := newTestFileSystem(t)
+	defer cleanup()
+
+	data := createRetagRows(t, fs, 5)
+
+	n, err := AddTagToRows(fs, nil, cryptag.PlainTags{"task"}, "urgent")
+	if err != nil {
+		t.Fatalf("Error from AddTagToRows: %v", err)
+	}
+	assert.Equal(t, 5, n)
+	assert.Equal(t, data, sortedRowData(t, fs, "task", "urgent"))
+	assert.Equal(t, data, sortedRowData(t, fs, "task"))
+
+	// Already tagged
+	n, err = AddTagToRows(fs, nil, cryptag.PlainTags{"task"}, "urgent")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	assert.Equal(t, ErrNoRetagPending, RollbackRetag(fs))
+}
+
+func TestAddTagToRowsRollback(t *testing.T) {
+	fs, cleanup := newTestFileSystem(t)
+	defer cleanup()
+
+	data := createRetagRows(t, fs, 5)
+
+	crashing := &crashingBackend{Backend: fs, saves: 2}
+	_, err := AddTagToRows(crashing, nil, cryptag.PlainTags{"task"}, "urgent")
+	assert.NotNil(t, err)
+
+	// Partially applied
+	assert.Equal(t, 2, len(sortedRowData(t, fs, "urgent")))
+
+	// Nothing else can be re-tagged until this one's dealt with
+	_, err = AddTagToRows(fs, nil, cryptag.PlainTags{"task"}, "later")
+	assert.Equal(t, ErrRetagPending, err)
+
+	if err = RollbackRetag(fs); err != nil {
+		t.Fatalf("Error from RollbackRetag: %v", err)
+	}
+
+	assert.Equal(t, data, sortedRowData(t, fs, "task"))
+	assert.Nil(t, sortedRowData(t, fs, "urgent"))
+	assert.Equal(t, ErrNoRetagPending, RollbackRetag(fs))
+}
+
+func TestAddTagToRowsResume(t *testing.T) {
+	fs, cleanup := newTestFileSystem(t)
+	defer cleanup()
+
+	data := createRetagRows(t, fs, 5)
+
+	crashing := &crashingBackend{Backend: fs, saves: 3}
+	_, err := AddTagToRows(crashing, nil, cryptag.PlainTags{"task"}, "urgent")
+	assert.NotNil(t, err)
+
+	// Resuming again after another crash is fine, too
+	crashing.saves = 1
+	_, err = ResumeRetag(crashing)
+	assert.NotNil(t, err)
+
+	n, err := ResumeRetag(fs)
+	if err != nil {
+		t.Fatalf("Error from ResumeRetag: %v", err)
+	}
+	assert.Equal(t, 5, n)
+
+	assert.Equal(t, data, sortedRowData(t, fs, "task", "urgent"))
+	assert.Equal(t, data, sortedRowData(t, fs, "task"))
+
+	_, err = ResumeRetag(fs)
+	assert.Equal(t, ErrNoRetagPending, err)
+}
@@ -0,0 +1,75 @@
+// Steve Phillips / elimisteve
+// 2017.04.10
+
+package backend
+
+import (
+	"fmt"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+)
+
+// RowWithTags is a decrypted Row along with its plaintags, in the same
+// order as Row.RandomTags, minus decoys (see PadTagsTo).
+type RowWithTags struct {
+	Row       *types.Row
+	PlainTags []string
+}
+
+// RowsWithTags fetches the Rows tagged with all of randtags, then
+// decrypts each Row and resolves its plaintags.  The TagPairs for
+// every Row are fetched together (see BatchResolveTags), rather than
+// calling AllTagPairs or fetching them Row by Row.
+func RowsWithTags(bk Backend, randtags cryptag.RandomTags) ([]RowWithTags, error) {
+	rows, err := rowsFromRandomTags(bk, randtags)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rows) == 0 {
+		return nil, types.ErrRowsNotFound
+	}
+
+	var allRand []string
+	for _, row := range rows {
+		allRand = append(allRand, row.RandomTags...)
+	}
+
+	// Each random tag only needs to be resolved once, no matter how
+	// many Rows share it
+	pairs, err := BatchResolveTags(bk, allRand)
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching rows' TagPairs: %v", err)
+	}
+
+	withTags := make([]RowWithTags, 0, len(rows))
+
+	for _, row := range rows {
+		if err = row.Decrypt(bk.RowKey()); err != nil {
+			return nil, err
+		}
+
+		plaintags := make([]string, 0, len(row.RandomTags))
+		for _, rand := range row.RandomTags {
+			pair, ok := pairs[rand]
+			if !ok {
+				// Decoys from before decoys got TagPairs have none
+				if types.IsDecoyTag(bk.RowKey(), rand) {
+					continue
+				}
+				return nil, fmt.Errorf("No TagPair found for random tag `%s`",
+					rand)
+			}
+			if types.IsDecoyPlainTag(pair.Plain()) {
+				continue
+			}
+			plaintags = append(plaintags, pair.Plain())
+		}
+		row.ReplacePlainTags(plaintags)
+
+		withTags = append(withTags, RowWithTags{Row: row, PlainTags: plaintags})
+	}
+
+	return withTags, nil
+}
@@ -0,0 +1,84 @@
+// Steve Phillips / elimisteve
+// 2017.04.10
+
+package backend
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRowsWithTags(t *testing.T) {
+	bk := newMemBackend(t)
+
+	want := map[string][]string{
+		"one":   {"shared", "only-one"},
+		"two":   {"shared", "only-two", "extra"},
+		"three": {"unshared"},
+	}
+	for data, plaintags := range want {
+		mustCreateRow(t, bk, data, plaintags...)
+	}
+
+	pairs, _ := bk.AllTagPairs(nil)
+	shared, err := pairs.WithAllPlainTags([]string{"shared"})
+	if err != nil {
+		t.Fatalf("Error from WithAllPlainTags: %v", err)
+	}
+
+	rows, err := RowsWithTags(bk, shared.AllRandom())
+	if err != nil {
+		t.Fatalf("Error from RowsWithTags: %v", err)
+	}
+	assert.Equal(t, 2, len(rows))
+
+	for _, rwt := range rows {
+		data := string(rwt.Row.Decrypted())
+		plaintags, ok := want[data]
+		if !ok {
+			t.Fatalf("Unexpected row data `%s`", data)
+		}
+
+		// NewRow adds "id:...", "created:...", and "all"
+		assert.Equal(t, len(plaintags)+3, len(rwt.PlainTags))
+		for _, plain := range append(plaintags, "all") {
+			assert.Contains(t, rwt.PlainTags, plain)
+		}
+		assert.Equal(t, rwt.PlainTags, rwt.Row.PlainTags())
+		assert.Equal(t, len(rwt.Row.RandomTags), len(rwt.PlainTags))
+	}
+}
+
+func TestRowsWithTagsPadded(t *testing.T) {
+	defer func(orig int) { PadTagsTo = orig }(PadTagsTo)
+	PadTagsTo = 8
+
+	bk := newMemBackend(t)
+	mustCreateRow(t, bk, "padded", "shared")
+
+	// Padded before decoys had TagPairs
+	PadTagsTo = 0
+	addLegacyDecoys(t, bk, rowKey(mustCreateRow(t, bk, "legacy", "shared")), 4)
+
+	pairs, _ := bk.AllTagPairs(nil)
+	shared, err := pairs.WithAllPlainTags([]string{"shared"})
+	if err != nil {
+		t.Fatalf("Error from WithAllPlainTags: %v", err)
+	}
+
+	rows, err := RowsWithTags(bk, shared.AllRandom())
+	if err != nil {
+		t.Fatalf("Error from RowsWithTags: %v", err)
+	}
+	assert.Equal(t, 2, len(rows))
+
+	for _, rwt := range rows {
+		assert.Len(t, rwt.Row.RandomTags, 8)
+
+		// Just "shared", "id:...", "created:...", and "all"
+		assert.Len(t, rwt.PlainTags, 4)
+		assert.Contains(t, rwt.PlainTags, "shared")
+		assert.Equal(t, rwt.PlainTags, rwt.Row.PlainTags())
+	}
+}
@@ -0,0 +1,80 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/cryptag/cryptag"
+)
+
+var (
+	ErrDeleteChanged = errors.New("backend: Rows to delete changed since" +
+		" PrepareDelete; not deleting anything")
+)
+
+// DeleteToken describes exactly which Rows a call to
+// DeleteRowsConfirmed will delete; see PrepareDelete.
+type DeleteToken struct {
+	RandomTags cryptag.RandomTags
+
+	// Rows lists each Row to be deleted by its random tags joined by
+	// "-", sorted
+	Rows []string
+}
+
+// PrepareDelete returns a DeleteToken listing the Rows tagged with
+// all of randtags, i.e. those bk.DeleteRows(randtags) would delete,
+// so the caller can show the user what's about to be deleted before
+// calling DeleteRowsConfirmed.
+func PrepareDelete(bk Backend, randtags cryptag.RandomTags) (*DeleteToken, error) {
+	keys, err := rowKeys(bk, randtags)
+	if err != nil {
+		return nil, err
+	}
+	return &DeleteToken{RandomTags: randtags, Rows: keys}, nil
+}
+
+// DeleteRowsConfirmed deletes the Rows described by token (see
+// PrepareDelete), unless the Rows tagged with token.RandomTags have
+// changed since, e.g. because more were saved, in which case nothing
+// is deleted and ErrDeleteChanged is returned.
+//
+// Rows saved in between the check and the deletion itself are still
+// deleted; this guards against stale previews, not concurrent writers.
+func DeleteRowsConfirmed(bk Backend, token *DeleteToken) error {
+	keys, err := rowKeys(bk, token.RandomTags)
+	if err != nil {
+		return err
+	}
+
+	if len(keys) != len(token.Rows) {
+		return ErrDeleteChanged
+	}
+	for i := range keys {
+		if keys[i] != token.Rows[i] {
+			return ErrDeleteChanged
+		}
+	}
+
+	return bk.DeleteRows(token.RandomTags)
+}
+
+// rowKeys returns the sorted keys (see rowKey) of the Rows tagged with
+// all of randtags
+func rowKeys(bk Backend, randtags cryptag.RandomTags) ([]string, error) {
+	rows, err := listRows(bk, randtags)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(rows))
+	for _, row := range rows {
+		keys = append(keys, rowKey(row))
+	}
+	sort.Strings(keys)
+
+	return keys, nil
+}
@@ -0,0 +1,45 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"testing"
+
+	"github.com/cryptag/cryptag/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeleteRowsConfirmed(t *testing.T) {
+	bk := newMemBackend(t)
+	mustCreateRow(t, bk, "old 1", "trash")
+	mustCreateRow(t, bk, "old 2", "trash")
+	mustCreateRow(t, bk, "keep", "keep")
+
+	trash := pairsRandom(t, bk, "trash")
+
+	token, err := PrepareDelete(bk, []string{trash})
+	if err != nil {
+		t.Fatalf("Error from PrepareDelete: %v", err)
+	}
+	assert.Equal(t, 2, len(token.Rows))
+
+	// A Row appears after the preview
+	mustCreateRow(t, bk, "new", "trash")
+
+	assert.Equal(t, ErrDeleteChanged, DeleteRowsConfirmed(bk, token))
+	assert.Equal(t, 3, len(rowData(t, bk, "trash")))
+
+	// Fresh preview
+	token, _ = PrepareDelete(bk, []string{trash})
+	if err = DeleteRowsConfirmed(bk, token); err != nil {
+		t.Fatalf("Error from DeleteRowsConfirmed: %v", err)
+	}
+
+	_, err = bk.ListRows([]string{trash})
+	assert.Equal(t, types.ErrRowsNotFound, err)
+	assert.Equal(t, []string{"keep"}, rowData(t, bk, "keep"))
+
+	// Already deleted
+	assert.Equal(t, types.ErrRowsNotFound, DeleteRowsConfirmed(bk, token))
+}
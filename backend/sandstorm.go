@@ -31,7 +31,15 @@ func SandstormFromConfig(cfg *Config) (*WebserverBackend, error) {
 	}
 	baseURL, authToken := info[0], info[1]
 
-	return NewWebserverBackend((*cfg.Key)[:], cfg.Name, baseURL, authToken)
+	ws, err := NewWebserverBackend((*cfg.Key)[:], cfg.Name, baseURL, authToken)
+	if err != nil {
+		return nil, err
+	}
+
+	ws.SetHTTPConfig(cfg.HTTP)
+	ws.SetTagKey(cfg.TagKey)
+
+	return ws, nil
 }
 
 func CreateSandstormWebserver(key []byte, bkName, webkey string) (*WebserverBackend, error) {
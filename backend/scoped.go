@@ -0,0 +1,155 @@
+// Steve Phillips / elimisteve
+// 2017.04.11
+
+package backend
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+)
+
+// scopedBackend is what Scoped returns
+type scopedBackend struct {
+	Backend
+
+	plain string
+
+	mu     sync.Mutex
+	random string // Random tag for plain, once known
+}
+
+// Scoped returns a view of bk restricted to the Rows tagged with
+// requiredPlainTag: every query only matches (and every list only
+// includes) Rows with that tag, every saved Row is tagged with it, and
+// DeleteRows only deletes Rows with it.  The TagPair for
+// requiredPlainTag is created the first time a Row is saved, if need
+// be.
+//
+// TagPairs are not scoped, so a caller can still see which plaintags
+// exist.
+func Scoped(bk Backend, requiredPlainTag string) Backend {
+	return &scopedBackend{Backend: bk, plain: requiredPlainTag}
+}
+
+// scopeTag returns the random tag corresponding to sb.plain, creating
+// it if create is true and it doesn't exist yet.  Returns "" (and no
+// error) if it doesn't exist and create is false.
+func (sb *scopedBackend) scopeTag(create bool) (string, error) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	if sb.random != "" {
+		return sb.random, nil
+	}
+
+	pairs, err := sb.Backend.AllTagPairs(nil)
+	if err != nil {
+		return "", err
+	}
+
+	plain := normalizeTags([]string{sb.plain})[0]
+
+	for _, pair := range pairs {
+		if pair.Plain() == plain {
+			sb.random = pair.Random
+			return sb.random, nil
+		}
+	}
+
+	if !create {
+		return "", nil
+	}
+
+	pair, err := CreateTag(sb.Backend, plain)
+	if err != nil {
+		return "", err
+	}
+	sb.random = pair.Random
+
+	return sb.random, nil
+}
+
+// withScope returns a copy of randtags that also includes scope
+func withScope(randtags cryptag.RandomTags, scope string) cryptag.RandomTags {
+	scoped := make(cryptag.RandomTags, 0, len(randtags)+1)
+	scoped = append(scoped, scope)
+	for _, rand := range randtags {
+		if rand != scope {
+			scoped = append(scoped, rand)
+		}
+	}
+	return scoped
+}
+
+func (sb *scopedBackend) ListRows(randtags cryptag.RandomTags) (types.Rows, error) {
+	return sb.rows(randtags, sb.Backend.ListRows)
+}
+
+func (sb *scopedBackend) RowsFromRandomTags(randtags cryptag.RandomTags) (types.Rows, error) {
+	return sb.rows(randtags, sb.Backend.RowsFromRandomTags)
+}
+
+func (sb *scopedBackend) rows(randtags cryptag.RandomTags, fetch func(cryptag.RandomTags) (types.Rows, error)) (types.Rows, error) {
+	scope, err := sb.scopeTag(false)
+	if err != nil {
+		return nil, err
+	}
+	if scope == "" {
+		return nil, types.ErrRowsNotFound
+	}
+
+	rows, err := fetch(withScope(randtags, scope))
+	if err != nil {
+		return nil, err
+	}
+
+	// Don't trust the Backend to have filtered
+	var inScope types.Rows
+	for _, row := range rows {
+		if row.HasRandomTag(scope) {
+			inScope = append(inScope, row)
+		}
+	}
+
+	if len(inScope) == 0 {
+		return nil, types.ErrRowsNotFound
+	}
+
+	return inScope, nil
+}
+
+func (sb *scopedBackend) SaveRow(row *types.Row) error {
+	scope, err := sb.scopeTag(true)
+	if err != nil {
+		return err
+	}
+
+	if !row.HasRandomTag(scope) {
+		randtags := append([]string{scope}, row.RandomTags...)
+		if err = rebindRow(sb.Backend, row, canonicalRandomTags(randtags)); err != nil {
+			return err
+		}
+	}
+
+	return sb.Backend.SaveRow(row)
+}
+
+func (sb *scopedBackend) DeleteRows(randtags cryptag.RandomTags) error {
+	if len(randtags) == 0 {
+		return errors.New("Must query by 1 or more tags")
+	}
+
+	scope, err := sb.scopeTag(false)
+	if err != nil {
+		return err
+	}
+	if scope == "" {
+		// No Rows in scope, so nothing to delete
+		return nil
+	}
+
+	return sb.Backend.DeleteRows(withScope(randtags, scope))
+}
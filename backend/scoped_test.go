@@ -0,0 +1,53 @@
+// Steve Phillips / elimisteve
+// 2017.04.11
+
+package backend
+
+import (
+	"testing"
+
+	"github.com/cryptag/cryptag/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScoped(t *testing.T) {
+	bk := newMemBackend(t)
+
+	mustCreateRow(t, bk, "alice's", "tenant:alice", "note")
+	mustCreateRow(t, bk, "bob's", "tenant:bob", "note")
+
+	alice := Scoped(bk, "tenant:alice")
+	bob := Scoped(bk, "tenant:bob")
+
+	// Saving through a scope tags the Row with the scope, even when
+	// the caller doesn't
+	mustCreateRow(t, alice, "alice's too", "note")
+
+	assert.Equal(t, []string{"alice's", "alice's too"}, rowData(t, alice, "note"))
+	assert.Equal(t, []string{"bob's"}, rowData(t, bob, "note"))
+	assert.Equal(t, []string{"alice's", "alice's too", "bob's"}, rowData(t, bk, "note"))
+
+	// Out-of-scope tags match nothing
+	assert.Nil(t, rowData(t, alice, "tenant:bob"))
+
+	// Deleting through a scope leaves other Rows alone
+	if err := DeleteRows(alice, nil, []string{"note"}); err != nil {
+		t.Fatalf("Error from DeleteRows: %v", err)
+	}
+	assert.Nil(t, rowData(t, alice, "note"))
+	assert.Equal(t, []string{"bob's"}, rowData(t, bk, "note"))
+	assert.Equal(t, []string{"bob's"}, rowData(t, bob, "note"))
+}
+
+func TestScopedNoScopeTagYet(t *testing.T) {
+	bk := newMemBackend(t)
+	mustCreateRow(t, bk, "unscoped", "note")
+
+	empty := Scoped(bk, "tenant:nobody")
+
+	_, err := RowsFromPlainTags(empty, nil, []string{"note"})
+	assert.Equal(t, types.ErrRowsNotFound, err)
+
+	assert.Nil(t, DeleteRows(empty, nil, []string{"note"}))
+	assert.Equal(t, []string{"unscoped"}, rowData(t, bk, "note"))
+}
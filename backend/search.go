@@ -0,0 +1,191 @@
+// Steve Phillips / elimisteve
+// 2017.04.04
+
+package backend
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cryptag/cryptag/types"
+)
+
+var (
+	// TagSearchCacheTTL is how long SearchTags reuses the TagPairs it
+	// last fetched from a given Backend before fetching them again, so
+	// tags created in the meantime may take this long to show up.
+	TagSearchCacheTTL = 30 * time.Second
+)
+
+// SearchTags returns the plaintags in bk that match query, ranked by
+// relevance: tags that begin with query come first, then tags that
+// contain query, then tags containing the characters of query in
+// order (a fuzzy match, so "pgm" matches "programming").  Matching is
+// case-insensitive.
+//
+// Useful for autocompleting tags as the user types. bk's TagPairs
+// are cached for TagSearchCacheTTL to keep this fast.  System tags
+// (see IsSystemTag) are left out; use SearchTagsWithSystem to include
+// them.
+func SearchTags(bk Backend, query string) ([]string, error) {
+	includeSystem := false
+	return searchBackendTags(bk, query, includeSystem)
+}
+
+// SearchTagsWithSystem is like SearchTags, but includes system tags.
+func SearchTagsWithSystem(bk Backend, query string) ([]string, error) {
+	includeSystem := true
+	return searchBackendTags(bk, query, includeSystem)
+}
+
+func searchBackendTags(bk Backend, query string, includeSystem bool) ([]string, error) {
+	pairs, err := searchCache.get(bk)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintags := pairs.AllPlain()
+	if !includeSystem {
+		plaintags = WithoutSystemTags(plaintags)
+	}
+
+	return SearchPlainTags(plaintags, query), nil
+}
+
+// SearchPlainTags ranks and filters plaintags just like SearchTags
+// does.  If query is empty, all plaintags are returned, sorted.
+func SearchPlainTags(plaintags []string, query string) []string {
+	query = strings.ToLower(query)
+
+	var matches []tagMatch
+
+	for _, plain := range plaintags {
+		if m, ok := matchTag(plain, query); ok {
+			matches = append(matches, m)
+		}
+	}
+
+	sort.Sort(byRelevance(matches))
+
+	results := make([]string, 0, len(matches))
+	for _, m := range matches {
+		results = append(results, m.plain)
+	}
+	return results
+}
+
+const (
+	matchPrefix = iota
+	matchSubstring
+	matchFuzzy
+)
+
+type tagMatch struct {
+	plain string
+	kind  int // matchPrefix, matchSubstring, or matchFuzzy
+	score int // Lower is better; compared within the same kind
+}
+
+func matchTag(plain, query string) (tagMatch, bool) {
+	lower := strings.ToLower(plain)
+
+	if strings.HasPrefix(lower, query) {
+		return tagMatch{plain, matchPrefix, len(lower)}, true
+	}
+	if i := strings.Index(lower, query); i != -1 {
+		return tagMatch{plain, matchSubstring, i}, true
+	}
+
+	// Fuzzy: every rune of query appears in lower, in order.  Score
+	// by how spread out the matching runes are.
+	first, last := -1, -1
+	pos := 0
+	for _, r := range query {
+		i := strings.IndexRune(lower[pos:], r)
+		if i == -1 {
+			return tagMatch{}, false
+		}
+		if first == -1 {
+			first = pos + i
+		}
+		last = pos + i
+		pos += i + len(string(r))
+	}
+	return tagMatch{plain, matchFuzzy, last - first}, true
+}
+
+type byRelevance []tagMatch
+
+func (ms byRelevance) Len() int      { return len(ms) }
+func (ms byRelevance) Swap(i, j int) { ms[i], ms[j] = ms[j], ms[i] }
+
+func (ms byRelevance) Less(i, j int) bool {
+	if ms[i].kind != ms[j].kind {
+		return ms[i].kind < ms[j].kind
+	}
+	if ms[i].score != ms[j].score {
+		return ms[i].score < ms[j].score
+	}
+	return ms[i].plain < ms[j].plain
+}
+
+//
+// TagPair cache
+//
+
+type cachedPairs struct {
+	pairs   types.TagPairs
+	fetched time.Time
+}
+
+// A pairCache stores each Backend's most recently-fetched TagPairs,
+// keyed by the Backend itself rather than its name, since different
+// Backends (e.g., FileSystems in different directories) may share a
+// name.  Backends whose dynamic type isn't comparable aren't cached.
+type pairCache struct {
+	mu sync.Mutex
+	m  map[Backend]cachedPairs
+}
+
+var searchCache = pairCache{m: map[Backend]cachedPairs{}}
+
+func (pc *pairCache) get(bk Backend) (types.TagPairs, error) {
+	cacheable := reflect.TypeOf(bk).Comparable()
+
+	var cached cachedPairs
+	var exists bool
+	if cacheable {
+		pc.mu.Lock()
+		cached, exists = pc.m[bk]
+		pc.mu.Unlock()
+
+		if exists && time.Since(cached.fetched) < TagSearchCacheTTL {
+			return cached.pairs, nil
+		}
+	}
+
+	pairs, err := partialTagPairs(bk.AllTagPairs(cached.pairs))
+	if err != nil {
+		return nil, err
+	}
+	if !cacheable {
+		return pairs, nil
+	}
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	// Drop expired entries so Backends no longer searched aren't
+	// kept around forever
+	for other, c := range pc.m {
+		if time.Since(c.fetched) >= TagSearchCacheTTL {
+			delete(pc.m, other)
+		}
+	}
+	pc.m[bk] = cachedPairs{pairs: pairs, fetched: time.Now()}
+
+	return pairs, nil
+}
@@ -0,0 +1,97 @@
+// Steve Phillips / elimisteve
+// 2017.04.04
+
+package backend
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var searchTags = []string{
+	"type:file",
+	"programming",
+	"program",
+	"golang",
+	"type:program",
+	"pragmatism",
+	"Prog:Lang",
+	"unrelated",
+}
+
+func TestSearchPlainTags(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		// Prefix matches rank first (shortest first), then substring
+		// (earliest first), then fuzzy (tightest first)
+		{"prog", []string{
+			"program", "Prog:Lang", "programming", "type:program",
+		}},
+		{"gram", []string{"program", "programming", "type:program"}},
+		{"pgm", []string{"pragmatism", "program", "programming", "type:program"}},
+		{"lang", []string{"golang", "Prog:Lang"}},
+		{"zzz", []string{}},
+	}
+
+	for _, tt := range tests {
+		got := SearchPlainTags(searchTags, tt.query)
+		assert.Equal(t, tt.want, got, "Query: %q", tt.query)
+	}
+}
+
+func TestSearchTags(t *testing.T) {
+	bk := newMemBackend(t)
+
+	_, err := CreateTagsFromPlain(bk, searchTags, nil)
+	if err != nil {
+		t.Fatalf("Error from CreateTagsFromPlain: %v", err)
+	}
+
+	got, err := SearchTags(bk, "type:")
+	if err != nil {
+		t.Fatalf("Error from SearchTags: %v", err)
+	}
+	assert.Equal(t, []string{"type:file", "type:program"}, got)
+
+	// Tags created after the first search are picked up once the
+	// cache expires
+	_, err = CreateTag(bk, "type:text")
+	if err != nil {
+		t.Fatalf("Error from CreateTag: %v", err)
+	}
+
+	got, _ = SearchTags(bk, "type:")
+	assert.Equal(t, 2, len(got), "Cached TagPairs should have been used")
+
+	origTTL := TagSearchCacheTTL
+	TagSearchCacheTTL = 0
+	defer func() { TagSearchCacheTTL = origTTL }()
+
+	got, _ = SearchTags(bk, "type:")
+	assert.Equal(t, []string{"type:file", "type:text", "type:program"}, got)
+}
+
+func TestSearchTagsSameName(t *testing.T) {
+	bk1 := newMemBackend(t)
+	bk2 := newMemBackend(t)
+	bk2.name = bk1.name
+
+	createTags(t, bk1, "color:red")
+	createTags(t, bk2, "color:blue")
+
+	got, err := SearchTags(bk1, "color:")
+	if err != nil {
+		t.Fatalf("Error from SearchTags: %v", err)
+	}
+	assert.Equal(t, []string{"color:red"}, got)
+
+	got, err = SearchTags(bk2, "color:")
+	if err != nil {
+		t.Fatalf("Error from SearchTags: %v", err)
+	}
+	assert.Equal(t, []string{"color:blue"}, got,
+		"Backends with the same name shouldn't share cached TagPairs")
+}
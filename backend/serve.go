@@ -0,0 +1,119 @@
+// Steve Phillips / elimisteve
+// 2017.04.16
+
+package backend
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+)
+
+var (
+	// ServeRowsFlushEvery is how many Rows ServeRows writes between
+	// flushes (when its io.Writer is an http.Flusher).
+	ServeRowsFlushEvery = 10
+)
+
+// servedRow is one line of ServeRows output.  Successful lines have
+// the same form as api/trusted.Row.
+type servedRow struct {
+	Unencrypted []byte   `json:"unencrypted,omitempty"`
+	PlainTags   []string `json:"plaintags,omitempty"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// ServeRows streams every Row tagged with all of randtags to w as
+// JSON Lines, each of the form {"unencrypted": ..., "plaintags": [...]},
+// fetching and decrypting one Row at a time so that memory use is
+// bounded by the largest Row, not the size of the result set.  (The
+// trade-off is one RowsFromRandomTags call per Row.)  If w is an
+// http.Flusher, it is flushed every ServeRowsFlushEvery Rows.
+//
+// If an error occurs once Rows have started being written, a final
+// line of the form {"error": "..."} is written and the error is
+// returned; clients must treat a stream ending in such a line as
+// incomplete.  Errors before anything is written (e.g.,
+// types.ErrRowsNotFound) are just returned, so an HTTP handler can
+// still respond with an appropriate status code.
+func ServeRows(bk Backend, randtags cryptag.RandomTags, w io.Writer) error {
+	// Just the Rows' random tags, not their contents
+	listed, err := listRows(bk, randtags)
+	if err != nil {
+		return err
+	}
+	if len(listed) == 0 {
+		return types.ErrRowsNotFound
+	}
+
+	pairs, err := bk.AllTagPairs(nil)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	flusher, canFlush := w.(http.Flusher)
+
+	written := 0
+	abort := func(err error) error {
+		if written == 0 {
+			return err
+		}
+		enc.Encode(servedRow{Error: err.Error()})
+		if canFlush {
+			flusher.Flush()
+		}
+		return err
+	}
+
+	for i, meta := range listed {
+		row, err := fetchExactRow(bk, meta.RandomTags)
+		if err != nil {
+			return abort(err)
+		}
+		if err = row.Populate(bk.RowKey(), pairs); err != nil {
+			return abort(err)
+		}
+
+		err = enc.Encode(servedRow{
+			Unencrypted: row.Decrypted(),
+			PlainTags:   row.PlainTags(),
+		})
+		if err != nil {
+			// Can't write, so can't report the error to the reader
+			return err
+		}
+		written++
+
+		if canFlush && (i+1)%ServeRowsFlushEvery == 0 {
+			flusher.Flush()
+		}
+	}
+
+	if canFlush {
+		flusher.Flush()
+	}
+
+	return nil
+}
+
+// fetchExactRow fetches the one Row whose random tags are exactly
+// randtags, in any order
+func fetchExactRow(bk Backend, randtags cryptag.RandomTags) (*types.Row, error) {
+	rows, err := rowsFromRandomTags(bk, randtags)
+	if err != nil {
+		return nil, err
+	}
+	want := canonicalRandomTags(append([]string{}, randtags...))
+	for _, row := range rows {
+		got := canonicalRandomTags(append([]string{}, row.RandomTags...))
+		if strings.Join(got, "-") == strings.Join(want, "-") {
+			return row, nil
+		}
+	}
+	return nil, types.ErrRowsNotFound
+}
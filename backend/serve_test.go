@@ -0,0 +1,171 @@
+// Steve Phillips / elimisteve
+// 2017.04.16
+
+package backend
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// flushCounter records the most bytes ever written between flushes
+type flushCounter struct {
+	http.ResponseWriter
+	unflushed    int
+	maxUnflushed int
+	flushes      int
+}
+
+func (fc *flushCounter) Write(b []byte) (int, error) {
+	fc.unflushed += len(b)
+	if fc.unflushed > fc.maxUnflushed {
+		fc.maxUnflushed = fc.unflushed
+	}
+	return fc.ResponseWriter.Write(b)
+}
+
+func (fc *flushCounter) Flush() {
+	fc.unflushed = 0
+	fc.flushes++
+	fc.ResponseWriter.(http.Flusher).Flush()
+}
+
+// failingFetches fails RowsFromRandomTags after ok calls
+type failingFetches struct {
+	Backend
+	ok int32
+}
+
+var errFetch = errors.New("fetch failed")
+
+func (ff *failingFetches) RowsFromRandomTags(randtags cryptag.RandomTags) (types.Rows, error) {
+	if atomic.AddInt32(&ff.ok, -1) < 0 {
+		return nil, errFetch
+	}
+	return ff.Backend.RowsFromRandomTags(randtags)
+}
+
+func serveAndRead(t *testing.T, bk Backend, randtags cryptag.RandomTags) (lines []servedRow, fc *flushCounter, serveErr error) {
+	fc = &flushCounter{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fc.ResponseWriter = w
+		serveErr = ServeRows(bk, randtags, fc)
+	}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Error from GET: %v", err)
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var line servedRow
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("Error parsing line `%s`: %v", scanner.Bytes(), err)
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("Error reading response: %v", err)
+	}
+
+	return lines, fc, serveErr
+}
+
+func TestServeRows(t *testing.T) {
+	bk := newMemBackend(t)
+
+	const nRows = 55
+	body := strings.Repeat("x", 1000)
+	for i := 0; i < nRows; i++ {
+		mustCreateRow(t, bk, body, "exported")
+	}
+
+	pairs, _ := bk.AllTagPairs(nil)
+	exported, _ := pairs.WithAllPlainTags([]string{"exported"})
+
+	lines, fc, err := serveAndRead(t, bk, exported.AllRandom())
+	if err != nil {
+		t.Fatalf("Error from ServeRows: %v", err)
+	}
+
+	assert.Equal(t, nRows, len(lines))
+	for _, line := range lines {
+		assert.Equal(t, body, string(line.Unencrypted))
+		assert.Contains(t, line.PlainTags, "exported")
+		assert.Equal(t, "", line.Error)
+	}
+
+	// Never more than ServeRowsFlushEvery rows' worth written without
+	// a flush
+	assert.True(t, fc.flushes >= nRows/ServeRowsFlushEvery)
+	maxRowLine := 2 * (len(body)*4/3 + 300)
+	assert.True(t, fc.maxUnflushed <= ServeRowsFlushEvery*maxRowLine,
+		"%d bytes written without flushing", fc.maxUnflushed)
+}
+
+func TestServeRowsErrorMidStream(t *testing.T) {
+	mem := newMemBackend(t)
+	for i := 0; i < 5; i++ {
+		mustCreateRow(t, mem, "data", "exported")
+	}
+	pairs, _ := mem.AllTagPairs(nil)
+	exported, _ := pairs.WithAllPlainTags([]string{"exported"})
+
+	bk := &failingFetches{Backend: mem, ok: 3}
+
+	lines, _, err := serveAndRead(t, bk, exported.AllRandom())
+	assert.Equal(t, errFetch, err)
+
+	assert.Equal(t, 4, len(lines))
+	assert.Equal(t, errFetch.Error(), lines[3].Error)
+	assert.Equal(t, "", lines[2].Error)
+
+	// Failing before any Row is written means nothing written
+	bk = &failingFetches{Backend: mem, ok: 0}
+	lines, _, err = serveAndRead(t, bk, exported.AllRandom())
+	assert.Equal(t, errFetch, err)
+	assert.Equal(t, 0, len(lines))
+
+	// Nothing found means nothing written
+	var sb strings.Builder
+	err = ServeRows(mem, []string{"nonexistent"}, &sb)
+	assert.Equal(t, types.ErrRowsNotFound, err)
+	assert.Equal(t, "", sb.String())
+}
+
+// fixedRows returns rows from every RowsFromRandomTags call
+type fixedRows struct {
+	Backend
+	rows types.Rows
+}
+
+func (fr *fixedRows) RowsFromRandomTags(randtags cryptag.RandomTags) (types.Rows, error) {
+	return fr.rows, nil
+}
+
+func TestFetchExactRow(t *testing.T) {
+	other := &types.Row{RandomTags: []string{"a", "c"}}
+	exact := &types.Row{RandomTags: []string{"b", "a"}}
+	bk := &fixedRows{rows: types.Rows{other, exact}}
+
+	row, err := fetchExactRow(bk, []string{"a", "b"})
+	assert.Nil(t, err)
+	assert.Equal(t, exact, row)
+
+	_, err = fetchExactRow(bk, []string{"a", "d"})
+	assert.Equal(t, types.ErrRowsNotFound, err)
+}
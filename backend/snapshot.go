@@ -0,0 +1,85 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"strings"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+)
+
+// RowSnapshot records the checksum (see Manifest) of each Row a query
+// returned, keyed by the Row's random tags joined by "-", so that
+// DiffSince can later tell which of them changed.
+type RowSnapshot struct {
+	Query     cryptag.RandomTags `json:"query"`
+	Checksums map[string]string  `json:"checksums"`
+}
+
+// RowsDiff is what changed about a query's results since a
+// RowSnapshot was taken.  Added and Modified Rows are still
+// encrypted, so only they need decrypting.
+type RowsDiff struct {
+	Added    types.Rows
+	Modified types.Rows
+	Deleted  []cryptag.RandomTags
+
+	// Snapshot is of the query's current results, to pass to the next
+	// call to DiffSince
+	Snapshot *RowSnapshot
+}
+
+// TakeSnapshot snapshots the Rows tagged with all of randtags without
+// decrypting them.
+func TakeSnapshot(bk Backend, randtags cryptag.RandomTags) (*RowSnapshot, error) {
+	snap, _, err := takeSnapshot(bk, randtags)
+	return snap, err
+}
+
+func takeSnapshot(bk Backend, randtags cryptag.RandomTags) (*RowSnapshot, types.Rows, error) {
+	rows, err := rowsFromRandomTags(bk, randtags)
+	if err != nil && err != types.ErrRowsNotFound {
+		return nil, nil, err
+	}
+
+	snap := &RowSnapshot{
+		Query:     append(cryptag.RandomTags{}, randtags...),
+		Checksums: make(map[string]string, len(rows)),
+	}
+	for _, row := range rows {
+		snap.Checksums[rowKey(row)] = checksum(row.Encrypted, row.Nonce)
+	}
+
+	return snap, rows, nil
+}
+
+// DiffSince re-runs snap's query, returning the Rows added, modified
+// (i.e., re-saved), and deleted since snap was taken.
+func DiffSince(bk Backend, snap *RowSnapshot) (*RowsDiff, error) {
+	current, rows, err := takeSnapshot(bk, snap.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &RowsDiff{Snapshot: current}
+
+	for _, row := range rows {
+		key := rowKey(row)
+		old, ok := snap.Checksums[key]
+		if !ok {
+			diff.Added = append(diff.Added, row)
+		} else if old != current.Checksums[key] {
+			diff.Modified = append(diff.Modified, row)
+		}
+	}
+
+	for _, key := range sortedKeys(snap.Checksums) {
+		if _, ok := current.Checksums[key]; !ok {
+			diff.Deleted = append(diff.Deleted, strings.Split(key, "-"))
+		}
+	}
+
+	return diff, nil
+}
@@ -0,0 +1,88 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffSince(t *testing.T) {
+	fs, cleanup := newTestFileSystem(t)
+	defer cleanup()
+
+	mustCreateRow(t, fs, "unchanged", "note")
+	modified := mustCreateRow(t, fs, "modified", "note")
+	deleted := mustCreateRow(t, fs, "deleted", "note")
+
+	query := []string{pairsRandom(t, fs, "note")}
+
+	snap, err := TakeSnapshot(fs, query)
+	if err != nil {
+		t.Fatalf("Error from TakeSnapshot: %v", err)
+	}
+	assert.Len(t, snap.Checksums, 3)
+
+	// Nothing changed yet
+	diff, err := DiffSince(fs, snap)
+	if err != nil {
+		t.Fatalf("Error from DiffSince: %v", err)
+	}
+	assert.Empty(t, diff.Added)
+	assert.Empty(t, diff.Modified)
+	assert.Empty(t, diff.Deleted)
+
+	added := mustCreateRow(t, fs, "added", "note")
+
+	// Re-save with the same tags (and a fresh nonce)
+	rows, err := fs.RowsFromRandomTags(modified.RandomTags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = rebindRow(fs, rows[0], rows[0].RandomTags); err != nil {
+		t.Fatal(err)
+	}
+	if err = fs.SaveRow(rows[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = fs.DeleteRows(deleted.RandomTags); err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err = DiffSince(fs, snap)
+	if err != nil {
+		t.Fatalf("Error from DiffSince: %v", err)
+	}
+
+	if assert.Len(t, diff.Added, 1) {
+		assert.Equal(t, added.RandomTags, diff.Added[0].RandomTags)
+		assert.Nil(t, diff.Added[0].Decrypt(fs.RowKey()))
+		assert.Equal(t, "added", string(diff.Added[0].Decrypted()))
+	}
+	if assert.Len(t, diff.Modified, 1) {
+		assert.Equal(t, rowKey(modified), rowKey(diff.Modified[0]))
+	}
+	if assert.Len(t, diff.Deleted, 1) {
+		assert.Equal(t, deleted.RandomTags, []string(diff.Deleted[0]))
+	}
+
+	// The new snapshot reflects the changes
+	diff, err = DiffSince(fs, diff.Snapshot)
+	if err != nil {
+		t.Fatalf("Error from DiffSince: %v", err)
+	}
+	assert.Empty(t, diff.Added)
+	assert.Empty(t, diff.Modified)
+	assert.Empty(t, diff.Deleted)
+
+	// No results is an empty snapshot, not an error
+	empty := createTags(t, fs, "empty")[0]
+	snap, err = TakeSnapshot(fs, []string{empty.Random})
+	if err != nil {
+		t.Fatalf("Error from TakeSnapshot: %v", err)
+	}
+	assert.Empty(t, snap.Checksums)
+}
@@ -0,0 +1,95 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+)
+
+// SplitBackend is a Backend composed of two others: TagPairs are
+// stored in Tags (e.g., something small and fast) and Rows in Rows
+// (e.g., cheap object storage).
+//
+// Its Name, Key, RowKey, and Config are those of Rows; its TagKey is
+// that of Tags.
+type SplitBackend struct {
+	Tags Backend
+	Rows Backend
+}
+
+// Split returns a SplitBackend storing TagPairs in tags and Rows in
+// rows.
+func Split(tags, rows Backend) *SplitBackend {
+	return &SplitBackend{Tags: tags, Rows: rows}
+}
+
+func (sb *SplitBackend) Name() string      { return sb.Rows.Name() }
+func (sb *SplitBackend) Key() *[32]byte    { return sb.Rows.Key() }
+func (sb *SplitBackend) TagKey() *[32]byte { return sb.Tags.TagKey() }
+func (sb *SplitBackend) RowKey() *[32]byte { return sb.Rows.RowKey() }
+
+func (sb *SplitBackend) AllTagPairs(oldPairs types.TagPairs) (types.TagPairs, error) {
+	return sb.Tags.AllTagPairs(oldPairs)
+}
+
+func (sb *SplitBackend) TagPairsFromRandomTags(randtags cryptag.RandomTags) (types.TagPairs, error) {
+	return sb.Tags.TagPairsFromRandomTags(randtags)
+}
+
+func (sb *SplitBackend) SaveTagPair(pair *types.TagPair) error {
+	return sb.Tags.SaveTagPair(pair)
+}
+
+// DeleteTagPair deletes the TagPair whose random tag is random from
+// sb.Tags, which must implement TagPairDeleter.
+func (sb *SplitBackend) DeleteTagPair(random string) error {
+	deleter, ok := sb.Tags.(TagPairDeleter)
+	if !ok {
+		return ErrCannotDeleteTagPairs
+	}
+	return deleter.DeleteTagPair(random)
+}
+
+// TagPairsPaged pages through sb.Tags' TagPairs.  Implements
+// TagPairPager.
+func (sb *SplitBackend) TagPairsPaged(offset, limit int) (types.TagPairs, bool, error) {
+	return TagPairsPaged(sb.Tags, offset, limit)
+}
+
+func (sb *SplitBackend) ListRows(randtags cryptag.RandomTags) (types.Rows, error) {
+	return sb.Rows.ListRows(randtags)
+}
+
+func (sb *SplitBackend) RowsFromRandomTags(randtags cryptag.RandomTags) (types.Rows, error) {
+	return sb.Rows.RowsFromRandomTags(randtags)
+}
+
+func (sb *SplitBackend) SaveRow(row *types.Row) error {
+	return sb.Rows.SaveRow(row)
+}
+
+func (sb *SplitBackend) DeleteRows(randtags cryptag.RandomTags) error {
+	return sb.Rows.DeleteRows(randtags)
+}
+
+func (sb *SplitBackend) ToConfig() (*Config, error) {
+	return sb.Rows.ToConfig()
+}
+
+// Flush flushes both sb.Tags and sb.Rows; see Flusher.
+func (sb *SplitBackend) Flush() error {
+	if err := Flush(sb.Tags); err != nil {
+		return err
+	}
+	return Flush(sb.Rows)
+}
+
+// Warm warms Tags' TagPairs and Rows' results of queries
+func (sb *SplitBackend) Warm(queries []cryptag.RandomTags) error {
+	if err := Warm(sb.Tags, nil); err != nil {
+		return err
+	}
+	return Warm(sb.Rows, queries)
+}
@@ -0,0 +1,47 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"testing"
+
+	"github.com/cryptag/cryptag/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitBackend(t *testing.T) {
+	tags, rows := newMemBackend(t), newMemBackend(t)
+
+	bk := Split(tags, rows)
+	mustCreateRow(t, bk, "in rows", "split")
+
+	assert.Equal(t, []string{"in rows"}, rowData(t, bk, "split"))
+
+	// TagPairs only in tags
+	pairs, err := tags.AllTagPairs(nil)
+	if err != nil {
+		t.Fatalf("Error from AllTagPairs: %v", err)
+	}
+	assert.True(t, len(pairs) > 0)
+	pairs, _ = rows.AllTagPairs(nil)
+	assert.Equal(t, 0, len(pairs))
+
+	// Rows only in rows
+	split := pairsRandom(t, tags, "split")
+
+	found, err := rows.ListRows([]string{split})
+	if err != nil {
+		t.Fatalf("Error from ListRows: %v", err)
+	}
+	assert.Equal(t, 1, len(found))
+	_, err = tags.ListRows([]string{split})
+	assert.Equal(t, types.ErrRowsNotFound, err)
+
+	// Deletes go to rows
+	assert.Nil(t, bk.DeleteRows([]string{split}))
+	_, err = rows.ListRows([]string{split})
+	assert.Equal(t, types.ErrRowsNotFound, err)
+
+	assert.Equal(t, rows.Name(), bk.Name())
+}
@@ -0,0 +1,80 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"strings"
+
+	"github.com/cryptag/cryptag/types"
+)
+
+// Stats describes how much a Backend stores.
+type Stats struct {
+	Rows     int
+	TagPairs int
+
+	// Bytes is roughly how much space the Rows and TagPairs take up:
+	// their ciphertext, nonces, and random tags (see rowSize and
+	// tagPairSize), not counting whatever overhead the Backend adds
+	Bytes int64
+}
+
+// BackendStats counts the Rows and TagPairs in bk and the bytes they
+// take up.  Every Row is fetched, so this can be slow for large
+// remote Backends.
+func BackendStats(bk Backend) (*Stats, error) {
+	pairs, err := bk.AllTagPairs(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &Stats{TagPairs: len(pairs)}
+	for _, pair := range pairs {
+		stats.Bytes += tagPairSize(pair)
+	}
+
+	keys, err := allRowKeys(bk)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range sortedBoolKeys(keys) {
+		rows, err := rowsFromRandomTags(bk, strings.Split(key, "-"))
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			if rowKey(row) == key {
+				stats.Rows++
+				stats.Bytes += rowSize(row)
+			}
+		}
+	}
+
+	return stats, nil
+}
+
+// rowSize returns how many bytes of row a Backend stores
+func rowSize(row *types.Row) int64 {
+	n := len(row.Encrypted) + len(row.EncryptedSummary)
+	if row.Nonce != nil {
+		n += len(row.Nonce)
+	}
+	if row.SummaryNonce != nil {
+		n += len(row.SummaryNonce)
+	}
+	for _, randtag := range row.RandomTags {
+		n += len(randtag)
+	}
+	return int64(n)
+}
+
+// tagPairSize returns how many bytes of pair a Backend stores
+func tagPairSize(pair *types.TagPair) int64 {
+	n := len(pair.PlainEncrypted) + len(pair.Random)
+	if pair.Nonce != nil {
+		n += len(pair.Nonce)
+	}
+	return int64(n)
+}
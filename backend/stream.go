@@ -0,0 +1,106 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+)
+
+// RowChunkSize is how much of its input SaveRowFromReader encrypts
+// and saves at a time.
+var RowChunkSize = 1 << 20
+
+// SaveRowFromReader saves everything read from r as one Row tagged
+// with plaintags, without holding more than RowChunkSize bytes of it
+// in memory at once: the first chunk is saved as the Row itself and
+// each one after that as a segment of it (see AppendToRow), so the
+// Row must be read with ReadAppendedRow.  The returned Row holds just
+// the first chunk.
+//
+// bk's TagPairs are fetched just once, and the segments all share the
+// same two tags, ordered by a sequence number in their summaries, so
+// saving a Row of n chunks takes O(n) time and creates O(1) TagPairs.
+//
+// If reading from r or saving a chunk fails, the chunks already saved
+// are left in place and the Row is returned along with the error.
+func SaveRowFromReader(bk Backend, r io.Reader, plaintags []string) (*types.Row, error) {
+	pairs, err := partialTagPairs(bk.AllTagPairs(nil))
+	if err != nil {
+		return nil, err
+	}
+
+	chunk, done, err := readChunk(r)
+	if err != nil {
+		return nil, err
+	}
+
+	row, err := types.NewRow(chunk, plaintags)
+	if err != nil {
+		return nil, err
+	}
+	if pairs, err = saveChunk(bk, row, pairs); err != nil {
+		return nil, err
+	}
+
+	id, err := rowID(types.Rows{row}, pairs)
+	if err != nil {
+		return row, err
+	}
+	segTags := []string{SegmentOfPrefix + id, SegmentPrefix + cryptag.NowStr()}
+
+	for seq := 0; !done; seq++ {
+		chunk, done, err = readChunk(r)
+		if err != nil {
+			return row, err
+		}
+		if len(chunk) == 0 {
+			break
+		}
+
+		segment, err := types.NewRowSimple(chunk, segTags)
+		if err != nil {
+			return row, err
+		}
+		segment.SkipAllTag = true
+		segment.SetSummary([]byte(fmt.Sprintf("%016d", seq)))
+
+		if pairs, err = saveChunk(bk, segment, pairs); err != nil {
+			return row, err
+		}
+	}
+
+	return row, nil
+}
+
+// saveChunk populates and saves row, returning pairs plus any
+// TagPairs created for it
+func saveChunk(bk Backend, row *types.Row, pairs types.TagPairs) (types.TagPairs, error) {
+	newPairs, err := PopulateRowBeforeSave(bk, row, pairs)
+	if err != nil {
+		return pairs, err
+	}
+	if err = bk.SaveRow(row); err != nil {
+		return pairs, err
+	}
+	return append(pairs, newPairs...), nil
+}
+
+// readChunk reads up to RowChunkSize bytes from r into a new slice
+// (not a reused one, since saved Rows may keep theirs), reporting
+// whether r is done
+func readChunk(r io.Reader) (chunk []byte, done bool, err error) {
+	chunk = make([]byte, RowChunkSize)
+	n, err := io.ReadFull(r, chunk)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return chunk[:n], true, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return chunk, false, nil
+}
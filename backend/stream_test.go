@@ -0,0 +1,124 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// patternReader generates size bytes on the fly, so a "file" of any
+// size can be read without being held in memory
+type patternReader struct {
+	read, size int
+}
+
+func (pr *patternReader) Read(p []byte) (int, error) {
+	if pr.read == pr.size {
+		return 0, io.EOF
+	}
+	n := 0
+	for ; n < len(p) && pr.read < pr.size; n++ {
+		p[n] = byte(pr.read*7 + pr.read/251)
+		pr.read++
+	}
+	return n, nil
+}
+
+func withRowChunkSize(size int) func() {
+	orig := RowChunkSize
+	RowChunkSize = size
+	return func() { RowChunkSize = orig }
+}
+
+func TestSaveRowFromReader(t *testing.T) {
+	defer withRowChunkSize(1024)()
+
+	bk := newMemBackend(t)
+
+	// 20 chunks' worth plus a partial one, far more than RowChunkSize
+	size := 20*RowChunkSize + 17
+
+	want := sha256.New()
+	r := io.TeeReader(&patternReader{size: size}, want)
+
+	row, err := SaveRowFromReader(bk, r, []string{"type:file"})
+	if err != nil {
+		t.Fatalf("Error from SaveRowFromReader: %v", err)
+	}
+	assert.Len(t, row.Decrypted(), RowChunkSize)
+
+	// No Row was saved with more than a chunk of data
+	for _, saved := range bk.rows {
+		assert.True(t, len(saved.Encrypted) < 2*RowChunkSize)
+	}
+	assert.Len(t, bk.rows, 21)
+
+	// The segments share their tags rather than each getting its own
+	assert.Len(t, bk.pairs, len(row.PlainTags())+2)
+
+	full, err := ReadAppendedRow(bk, row.RandomTags)
+	if err != nil {
+		t.Fatalf("Error from ReadAppendedRow: %v", err)
+	}
+	assert.Len(t, full.Decrypted(), size)
+
+	got := sha256.Sum256(full.Decrypted())
+	assert.Equal(t, want.Sum(nil), got[:])
+}
+
+func TestSaveRowFromReaderExactChunks(t *testing.T) {
+	defer withRowChunkSize(16)()
+
+	bk := newMemBackend(t)
+
+	row, err := SaveRowFromReader(bk, &patternReader{size: 32}, []string{"type:file"})
+	if err != nil {
+		t.Fatalf("Error from SaveRowFromReader: %v", err)
+	}
+
+	// No empty trailing segment
+	assert.Len(t, bk.rows, 2)
+
+	full, err := ReadAppendedRow(bk, row.RandomTags)
+	if err != nil {
+		t.Fatalf("Error from ReadAppendedRow: %v", err)
+	}
+	assert.Len(t, full.Decrypted(), 32)
+}
+
+type failingReader struct {
+	io.Reader
+}
+
+var errReadFailed = errors.New("read failed")
+
+func (fr *failingReader) Read(p []byte) (int, error) {
+	n, err := fr.Reader.Read(p)
+	if err == io.EOF {
+		return 0, errReadFailed
+	}
+	return n, err
+}
+
+func TestSaveRowFromReaderError(t *testing.T) {
+	defer withRowChunkSize(16)()
+
+	bk := newMemBackend(t)
+
+	r := &failingReader{&patternReader{size: 40}}
+	row, err := SaveRowFromReader(bk, r, []string{"type:file"})
+	assert.Equal(t, errReadFailed, err)
+
+	// The chunks read before the failure were saved
+	full, err := ReadAppendedRow(bk, row.RandomTags)
+	if err != nil {
+		t.Fatalf("Error from ReadAppendedRow: %v", err)
+	}
+	assert.Len(t, full.Decrypted(), 32)
+}
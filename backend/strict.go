@@ -0,0 +1,75 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cryptag/cryptag/types"
+)
+
+// StrictAutoTagPrefixes are the prefixes of plaintags that
+// PopulateRowStrict creates TagPairs for even if they don't exist
+// yet, since they're generated for each Row (see types.NewRow) rather
+// than typed in.  AllTag is allowed, too.
+var StrictAutoTagPrefixes = []string{"id:", "created:"}
+
+// UnknownTagsError is returned by PopulateRowStrict when a Row has
+// plaintags that don't have a TagPair yet.
+type UnknownTagsError struct {
+	PlainTags []string
+}
+
+func (e *UnknownTagsError) Error() string {
+	return fmt.Sprintf("Unknown tags (strict mode; not creating them): %s",
+		strings.Join(e.PlainTags, ", "))
+}
+
+// PopulateRowStrict is like PopulateRowBeforeSave, except that,
+// rather than creating new TagPairs for plaintags that don't have
+// one in pairs, it returns an *UnknownTagsError listing them (e.g., so
+// that a typo doesn't create a stray tag).  Plaintags starting with
+// one of StrictAutoTagPrefixes are exempt.  If pairs is nil, bk's
+// TagPairs are fetched.
+func PopulateRowStrict(bk Backend, row *types.Row, pairs types.TagPairs) (newPairs types.TagPairs, err error) {
+	strict := true
+	res, err := populateRow(bk, row, pairs, strict)
+	if res == nil {
+		return nil, err
+	}
+	return res.NewPairs, err
+}
+
+// unknownTags returns the plaintags that aren't in pairs and aren't
+// exempt from strict mode
+func unknownTags(plaintags []string, pairs types.TagPairs) []string {
+	existing := make(map[string]bool, len(pairs))
+	for _, pair := range pairs {
+		existing[pair.Plain()] = true
+	}
+
+	var all string
+	if AllTag != "" {
+		all = normalizeTags([]string{AllTag})[0]
+	}
+
+	var unknown []string
+
+PlainTags:
+	for _, plain := range plaintags {
+		if existing[plain] || plain == all {
+			continue
+		}
+		for _, prefix := range StrictAutoTagPrefixes {
+			if strings.HasPrefix(plain, prefix) {
+				continue PlainTags
+			}
+		}
+		existing[plain] = true // Only list each once
+		unknown = append(unknown, plain)
+	}
+
+	return unknown
+}
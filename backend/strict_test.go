@@ -0,0 +1,62 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"testing"
+
+	"github.com/cryptag/cryptag/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPopulateRowStrict(t *testing.T) {
+	bk := newMemBackend(t)
+
+	mustCreateRow(t, bk, "first", "work", "urgent")
+
+	pairs, _ := bk.AllTagPairs(nil)
+	numPairs := len(pairs)
+
+	// "urgnet" is a typo
+	row, _ := types.NewRow([]byte("second"), []string{"work", "urgnet", "urgnet"})
+
+	_, err := PopulateRowStrict(bk, row, pairs)
+	uerr, ok := err.(*UnknownTagsError)
+	if !ok {
+		t.Fatalf("Expected *UnknownTagsError, got %T: %v", err, err)
+	}
+	assert.Equal(t, []string{"urgnet"}, uerr.PlainTags)
+
+	pairs, _ = bk.AllTagPairs(nil)
+	assert.Equal(t, numPairs, len(pairs), "Strict mode created TagPairs")
+
+	// Known tags only; this Row's id:... and created:... tags are new
+	// but created anyway
+	row, _ = types.NewRow([]byte("second"), []string{"work", "urgent"})
+
+	newPairs, err := PopulateRowStrict(bk, row, pairs)
+	if err != nil {
+		t.Fatalf("Error from PopulateRowStrict: %v", err)
+	}
+	assert.Equal(t, 2, len(newPairs))
+
+	// Without pairs, bk's are fetched rather than every tag being
+	// considered unknown
+	row, _ = types.NewRow([]byte("second again"), []string{"work", "urgent"})
+
+	newPairs, err = PopulateRowStrict(bk, row, nil)
+	if err != nil {
+		t.Fatalf("Error from PopulateRowStrict without pairs: %v", err)
+	}
+	assert.Equal(t, 2, len(newPairs))
+
+	// Normal mode creates the unknown tag
+	row, _ = types.NewRow([]byte("third"), []string{"work", "urgnet"})
+
+	newPairs, err = PopulateRowBeforeSave(bk, row, pairs)
+	if err != nil {
+		t.Fatalf("Error from PopulateRowBeforeSave: %v", err)
+	}
+	assert.Equal(t, 3, len(newPairs))
+}
@@ -0,0 +1,48 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+)
+
+// SummaryLister is implemented by Backends that store Rows' summaries
+// (see types.Row.SetSummary) apart from their data, and so can list
+// Rows along with their summaries without fetching their data.
+type SummaryLister interface {
+	ListRowSummaries(randtags cryptag.RandomTags) (types.Rows, error)
+}
+
+// ListRowSummaries returns the Rows tagged with all of randtags,
+// including their encrypted summaries but not their data (e.g., for a
+// list view that only shows titles).  Backends that don't implement
+// SummaryLister have to fetch the Rows' data anyway, which is then
+// dropped.
+func ListRowSummaries(bk Backend, randtags cryptag.RandomTags) (types.Rows, error) {
+	if lister, ok := bk.(SummaryLister); ok {
+		return lister.ListRowSummaries(randtags)
+	}
+
+	rows, err := rowsFromRandomTags(bk, randtags)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		row.Encrypted = nil
+		row.Nonce = nil
+	}
+
+	return rows, nil
+}
+
+// ListRowSummariesFromPlainTags is like ListRowsFromPlainTags, but
+// each Row returned has its summary decrypted (see
+// types.Row.Summary) and no data.
+func ListRowSummariesFromPlainTags(bk Backend, pairs types.TagPairs, plaintags cryptag.PlainTags) (types.Rows, error) {
+	return getRows(bk, pairs, plaintags, func(randtags cryptag.RandomTags) (types.Rows, error) {
+		return ListRowSummaries(bk, randtags)
+	})
+}
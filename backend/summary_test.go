@@ -0,0 +1,68 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"testing"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func mustCreateSummaryRow(t *testing.T, bk Backend, summary, data string, plaintags ...string) {
+	row, err := types.NewRow([]byte(data), plaintags)
+	if err != nil {
+		t.Fatalf("Error from NewRow: %v", err)
+	}
+	row.SetSummary([]byte(summary))
+
+	pairs, _ := bk.AllTagPairs(nil)
+	if _, err = PopulateRowBeforeSave(bk, row, pairs); err != nil {
+		t.Fatalf("Error from PopulateRowBeforeSave: %v", err)
+	}
+	if err = bk.SaveRow(row); err != nil {
+		t.Fatalf("Error from SaveRow: %v", err)
+	}
+}
+
+func TestListRowSummaries(t *testing.T) {
+	fs, cleanup := newTestFileSystem(t)
+	defer cleanup()
+
+	mem := newMemBackend(t)
+
+	for _, bk := range []Backend{fs, mem} {
+		mustCreateSummaryRow(t, bk, "Meeting notes", "A very long body...", "notes")
+		mustCreateRow(t, bk, "No summary", "notes")
+
+		rows, err := ListRowSummariesFromPlainTags(bk, nil, cryptag.PlainTags{"notes"})
+		if err != nil {
+			t.Fatalf("Error from ListRowSummariesFromPlainTags: %v", err)
+		}
+		assert.Equal(t, 2, len(rows))
+
+		var summaries []string
+		for _, row := range rows {
+			assert.Nil(t, row.Encrypted, "Row data was listed")
+			assert.Equal(t, 0, len(row.Decrypted()))
+			assert.True(t, row.HasPlainTag("notes"))
+			if len(row.Summary()) > 0 {
+				summaries = append(summaries, string(row.Summary()))
+			}
+		}
+		assert.Equal(t, []string{"Meeting notes"}, summaries)
+
+		// Fetching the body on demand also gets the summary
+		rows, err = RowsFromPlainTags(bk, nil, cryptag.PlainTags{"notes"})
+		if err != nil {
+			t.Fatalf("Error from RowsFromPlainTags: %v", err)
+		}
+		for _, row := range rows {
+			if len(row.Summary()) > 0 {
+				assert.Equal(t, "A very long body...", string(row.Decrypted()))
+			}
+		}
+	}
+}
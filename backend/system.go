@@ -0,0 +1,69 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"sort"
+	"strings"
+)
+
+var (
+	// SystemTagPrefixes are the prefixes of plaintags that cryptag
+	// (or an app built on it) uses internally, which tag-listing
+	// functions (ListTags, SearchTags, TagInventory) hide from users
+	// by default.  Append to register more.  Tags that merely look
+	// internal, such as AllTag or ImportDir's checksum tags, aren't
+	// system tags, since users may have created the same tags
+	// themselves.
+	SystemTagPrefixes = []string{"system:"}
+)
+
+// IsSystemTag reports whether plain is a system tag (see
+// SystemTagPrefixes).  System tags can still be queried like any
+// other tag.
+func IsSystemTag(plain string) bool {
+	for _, prefix := range SystemTagPrefixes {
+		if prefix != "" && strings.HasPrefix(plain, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithoutSystemTags returns the members of plaintags that aren't
+// system tags (see IsSystemTag).
+func WithoutSystemTags(plaintags []string) []string {
+	var user []string
+	for _, plain := range plaintags {
+		if !IsSystemTag(plain) {
+			user = append(user, plain)
+		}
+	}
+	return user
+}
+
+// ListTags returns every distinct plaintag in bk, sorted, leaving out
+// system tags (see IsSystemTag) unless includeSystem is set.
+func ListTags(bk Backend, includeSystem bool) ([]string, error) {
+	pairs, err := bk.AllTagPairs(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(pairs))
+
+	var plaintags []string
+	for _, pair := range pairs {
+		plain := pair.Plain()
+		if seen[plain] || (!includeSystem && IsSystemTag(plain)) {
+			continue
+		}
+		seen[plain] = true
+		plaintags = append(plaintags, plain)
+	}
+
+	sort.Strings(plaintags)
+
+	return plaintags, nil
+}
@@ -0,0 +1,55 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"testing"
+
+	"github.com/cryptag/cryptag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSystemTags(t *testing.T) {
+	origPrefixes := SystemTagPrefixes
+	SystemTagPrefixes = append(SystemTagPrefixes, "deleted:")
+	defer func() { SystemTagPrefixes = origPrefixes }()
+
+	bk := newMemBackend(t)
+	mustCreateRow(t, bk, "gone", "note", "deleted:yes")
+	mustCreateRow(t, bk, "kept", "note", "system:pinned")
+
+	plaintags, err := ListTags(bk, false)
+	if err != nil {
+		t.Fatalf("Error from ListTags: %v", err)
+	}
+	for _, plain := range plaintags {
+		assert.False(t, IsSystemTag(plain), "System tag %q listed", plain)
+	}
+	assert.Contains(t, plaintags, "note")
+	assert.Contains(t, plaintags, AllTag)
+	assert.NotContains(t, plaintags, "deleted:yes")
+	assert.NotContains(t, plaintags, "system:pinned")
+
+	// Only registered prefixes make system tags
+	assert.False(t, IsSystemTag("sha256:abc123"))
+	assert.False(t, IsSystemTag(SegmentOfPrefix+"id:1"))
+
+	plaintags, _ = ListTags(bk, true)
+	assert.Contains(t, plaintags, AllTag)
+	assert.Contains(t, plaintags, "deleted:yes")
+	assert.Contains(t, plaintags, "system:pinned")
+
+	found, _ := SearchTags(bk, "deleted")
+	assert.Equal(t, 0, len(found))
+	found, _ = SearchTagsWithSystem(bk, "deleted")
+	assert.Equal(t, []string{"deleted:yes"}, found)
+
+	// Still usable in queries
+	rows, err := RowsFromPlainTags(bk, nil, cryptag.PlainTags{"deleted:yes"})
+	if err != nil {
+		t.Fatalf("Error querying by system tag: %v", err)
+	}
+	assert.Equal(t, "gone", string(rows[0].Decrypted()))
+	assert.Equal(t, 2, len(rowData(t, bk, AllTag)))
+}
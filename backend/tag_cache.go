@@ -0,0 +1,227 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"time"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+)
+
+// TagPairCacheTTL is how long CachedTagPairs trusts its on-disk cache
+// of a Backend's TagPairs, fetching only new TagPairs in the meantime,
+// before fetching them all again.  Since only a full fetch notices
+// deleted TagPairs, this bounds how long they linger in the cache.
+var TagPairCacheTTL = 24 * time.Hour
+
+// TagPairCacheSlack is how far before the last fetch CachedTagPairs
+// asks a TagPairsSincer for new TagPairs from, so that TagPairs aren't
+// missed because bk's clock (which timestamps them) is behind
+// cryptag.Now's, or because they were saved while the last fetch was
+// underway.  TagPairs fetched twice are only kept once.
+var TagPairCacheSlack = 5 * time.Minute
+
+// tagPairCacheVersion is bumped whenever the cache format changes,
+// invalidating existing caches
+const tagPairCacheVersion = 1
+
+// TagPairsSincer is implemented by Backends that can cheaply return
+// just the TagPairs saved since a given time, letting CachedTagPairs
+// fetch only what's new.
+type TagPairsSincer interface {
+	TagPairsSince(since time.Time) (types.TagPairs, error)
+}
+
+// tagPairCache is what's stored, encrypted, at TagPairCachePath
+type tagPairCache struct {
+	Version   int            `json:"version"`
+	FetchedAt time.Time      `json:"fetched_at"` // Last fetch of any kind
+	FullAt    time.Time      `json:"full_at"`    // Last full fetch
+	Pairs     types.TagPairs `json:"pairs"`
+}
+
+// TagPairCachePath returns where bk's TagPairs are cached.
+func TagPairCachePath(bk Backend) string {
+	return path.Join(cryptag.BackendPath, bk.Name()+".tagcache")
+}
+
+// ClearTagPairCache deletes bk's TagPair cache, if any, so that the
+// next call to CachedTagPairs fetches all of bk's TagPairs.
+func ClearTagPairCache(bk Backend) error {
+	err := os.Remove(TagPairCachePath(bk))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// CachedTagPairs returns all of bk's TagPairs, like bk.AllTagPairs,
+// but caches them on disk (encrypted with bk.Key()) between runs.
+// While the cache is younger than TagPairCacheTTL and bk implements
+// TagPairsSincer, only the TagPairs saved since the last fetch (less
+// TagPairCacheSlack) are fetched from bk.  A missing, expired, or
+// unreadable cache (e.g., one encrypted with a different key) results
+// in a full fetch.
+//
+// Backends that don't implement TagPairsSincer, which includes every
+// remote Backend so far, can't be asked for just the new TagPairs, so
+// for them every call is a full fetch and the cache saves nothing.
+func CachedTagPairs(bk Backend) (types.TagPairs, error) {
+	// Anything saved after the fetch starts is picked up next time
+	now := cryptag.Now()
+
+	cache := loadTagPairCache(bk)
+
+	sincer, ok := bk.(TagPairsSincer)
+	if cache == nil || !ok || now.Sub(cache.FullAt) > TagPairCacheTTL {
+		pairs, err := partialTagPairs(bk.AllTagPairs(nil))
+		if err != nil {
+			return nil, err
+		}
+		cache = &tagPairCache{FullAt: now, Pairs: pairs}
+	} else {
+		// Our clock may be ClockOffset away from bk's, too
+		slack := TagPairCacheSlack
+		if offset := cryptag.ClockOffset(); offset > 0 {
+			slack += offset
+		} else {
+			slack -= offset
+		}
+
+		newPairs, err := sincer.TagPairsSince(cache.FetchedAt.Add(-slack))
+		if err != nil {
+			return nil, err
+		}
+		cache.Pairs = mergeTagPairs(cache.Pairs, newPairs)
+
+		if types.Debug {
+			log.Printf("CachedTagPairs: %d cached pairs, %d fetched\n",
+				len(cache.Pairs), len(newPairs))
+		}
+	}
+
+	cache.FetchedAt = now
+	if err := saveTagPairCache(bk, cache); err != nil {
+		return nil, err
+	}
+
+	return cache.Pairs, nil
+}
+
+// loadTagPairCache returns bk's cached TagPairs, or nil if there's no
+// usable cache
+func loadTagPairCache(bk Backend) *tagPairCache {
+	b, err := ioutil.ReadFile(TagPairCachePath(bk))
+	if err != nil {
+		return nil
+	}
+
+	var sealed struct {
+		Encrypted []byte    `json:"encrypted"`
+		Nonce     *[24]byte `json:"nonce"`
+	}
+	if err = json.Unmarshal(b, &sealed); err != nil || sealed.Nonce == nil {
+		return nil
+	}
+
+	dec, err := cryptag.Decrypt(sealed.Encrypted, sealed.Nonce, bk.Key())
+	if err != nil {
+		return nil
+	}
+
+	var cache tagPairCache
+	if err = json.Unmarshal(dec, &cache); err != nil {
+		return nil
+	}
+	if cache.Version != tagPairCacheVersion {
+		return nil
+	}
+
+	for _, pair := range cache.Pairs {
+		if err = pair.Decrypt(bk.TagKey()); err != nil {
+			return nil
+		}
+	}
+
+	return &cache
+}
+
+func saveTagPairCache(bk Backend, cache *tagPairCache) error {
+	cache.Version = tagPairCacheVersion
+
+	b, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+
+	nonce, err := cryptag.RandomNonce()
+	if err != nil {
+		return err
+	}
+
+	enc, err := cryptag.Encrypt(b, nonce, bk.Key())
+	if err != nil {
+		return err
+	}
+
+	b, err = json.Marshal(map[string]interface{}{
+		"encrypted": enc,
+		"nonce":     nonce,
+	})
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(TagPairCachePath(bk), b)
+}
+
+// mergeTagPairs returns pairs plus each of newPairs whose random tag
+// isn't already in pairs
+func mergeTagPairs(pairs, newPairs types.TagPairs) types.TagPairs {
+	have := make(map[string]bool, len(pairs))
+	for _, pair := range pairs {
+		have[pair.Random] = true
+	}
+
+	for _, pair := range newPairs {
+		if !have[pair.Random] {
+			have[pair.Random] = true
+			pairs = append(pairs, pair)
+		}
+	}
+
+	return pairs
+}
+
+// TagCacheBackend wraps a Backend so that AllTagPairs is served from
+// an on-disk cache; see CachedTagPairs.
+type TagCacheBackend struct {
+	Backend
+}
+
+// WithTagPairCache returns a TagCacheBackend wrapping bk.  Only
+// Backends implementing TagPairsSincer benefit; see CachedTagPairs.
+func WithTagPairCache(bk Backend) *TagCacheBackend {
+	return &TagCacheBackend{Backend: bk}
+}
+
+func (tb *TagCacheBackend) AllTagPairs(oldPairs types.TagPairs) (types.TagPairs, error) {
+	return CachedTagPairs(tb.Backend)
+}
+
+// Warm refreshes tb's on-disk cache of TagPairs (see CachedTagPairs).
+// Implements Warmer.
+func (tb *TagCacheBackend) Warm(queries []cryptag.RandomTags) error {
+	if err := Warm(tb.Backend, queries); err != nil {
+		return err
+	}
+	_, err := CachedTagPairs(tb.Backend)
+	return err
+}
@@ -0,0 +1,144 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// fetchCountingFS counts full and incremental TagPair fetches
+type fetchCountingFS struct {
+	*FileSystem
+	all   int
+	since int
+}
+
+func (fc *fetchCountingFS) AllTagPairs(oldPairs types.TagPairs) (types.TagPairs, error) {
+	fc.all++
+	return fc.FileSystem.AllTagPairs(oldPairs)
+}
+
+func (fc *fetchCountingFS) TagPairsSince(since time.Time) (types.TagPairs, error) {
+	fc.since++
+	return fc.FileSystem.TagPairsSince(since)
+}
+
+func TestCachedTagPairs(t *testing.T) {
+	fs, cleanup := newTestFileSystem(t)
+	defer cleanup()
+
+	bk := &fetchCountingFS{FileSystem: fs}
+	createTags(t, bk, plaintagsN("tag", 5)...)
+
+	// Cold cache
+	pairs, err := CachedTagPairs(bk)
+	if err != nil {
+		t.Fatalf("Error from CachedTagPairs: %v", err)
+	}
+	assert.Equal(t, 5, len(pairs))
+	assert.Equal(t, 1, bk.all)
+
+	// Warm cache, plus a new tag
+	createTags(t, bk, "new")
+
+	pairs, err = CachedTagPairs(bk)
+	if err != nil {
+		t.Fatalf("Error from CachedTagPairs: %v", err)
+	}
+	assert.Equal(t, 1, bk.all, "Warm cache shouldn't fetch every TagPair")
+	assert.Equal(t, 1, bk.since)
+	assert.Equal(t, 6, len(pairs))
+
+	plains := map[string]bool{}
+	for _, pair := range pairs {
+		plains[pair.Plain()] = true
+	}
+	assert.True(t, plains["new"])
+	assert.True(t, plains["tag4"])
+
+	// Expired cache
+	orig := TagPairCacheTTL
+	TagPairCacheTTL = 0
+	defer func() { TagPairCacheTTL = orig }()
+
+	_, err = CachedTagPairs(bk)
+	if err != nil {
+		t.Fatalf("Error from CachedTagPairs: %v", err)
+	}
+	assert.Equal(t, 2, bk.all)
+}
+
+func TestCachedTagPairsWrongKey(t *testing.T) {
+	fs, cleanup := newTestFileSystem(t)
+	defer cleanup()
+
+	bk := &fetchCountingFS{FileSystem: fs}
+	createTags(t, bk, "a", "b")
+
+	if _, err := CachedTagPairs(bk); err != nil {
+		t.Fatalf("Error from CachedTagPairs: %v", err)
+	}
+
+	// A cache encrypted with another key is ignored; TagPairs are
+	// still readable, being encrypted with the tag key
+	key := *fs.key
+	fs.tagKey = fs.key
+	key[0]++
+	fs.key = &key
+
+	_, err := CachedTagPairs(bk)
+	if err != nil {
+		t.Fatalf("Error from CachedTagPairs: %v", err)
+	}
+	assert.Equal(t, 2, bk.all)
+
+	assert.Nil(t, ClearTagPairCache(bk))
+	assert.Nil(t, loadTagPairCache(bk))
+}
+
+func TestCachedTagPairsClockOffset(t *testing.T) {
+	fs, cleanup := newTestFileSystem(t)
+	defer cleanup()
+
+	// Our clock, as cryptag.Now reports it, is ahead of the Backend's
+	cryptag.SetClockOffset(time.Hour)
+	defer cryptag.SetClockOffset(0)
+
+	bk := &fetchCountingFS{FileSystem: fs}
+	createTags(t, bk, "old")
+	if _, err := CachedTagPairs(bk); err != nil {
+		t.Fatalf("Error from CachedTagPairs: %v", err)
+	}
+
+	createTags(t, bk, "new")
+
+	pairs, err := CachedTagPairs(bk)
+	if err != nil {
+		t.Fatalf("Error from CachedTagPairs: %v", err)
+	}
+	assert.Equal(t, 1, bk.all)
+	assert.Equal(t, 2, len(pairs), "TagPair saved after the last fetch missed")
+}
+
+// flushingBackend counts calls to Flush
+type flushingBackend struct {
+	*memBackend
+	flushed int
+}
+
+func (fb *flushingBackend) Flush() error {
+	fb.flushed++
+	return nil
+}
+
+func TestTagCacheBackendFlush(t *testing.T) {
+	fb := &flushingBackend{memBackend: newMemBackend(t)}
+	assert.Nil(t, Flush(WithTagPairCache(fb)))
+	assert.Equal(t, 1, fb.flushed)
+}
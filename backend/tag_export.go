@@ -0,0 +1,109 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/cryptag/cryptag/types"
+)
+
+// tagExportVersion is the version of the format ExportTags writes.
+// Version 1 exports contained unencrypted plaintags and are no longer
+// accepted.
+const tagExportVersion = 2
+
+type tagExport struct {
+	Version  int              `json:"version"`
+	TagPairs []*types.TagPair `json:"tag_pairs"`
+}
+
+// ExportTags writes every TagPair in bk -- but no Rows -- to w,
+// decrypted with bk's TagKey and re-encrypted with newKey, so that
+// another Backend using newKey can start out with the same tags and
+// random tags; see ImportTags.  No plaintag is written unencrypted.
+func ExportTags(bk Backend, newKey *[32]byte, w io.Writer) error {
+	pairs, err := bk.AllTagPairs(nil)
+	if err != nil {
+		return err
+	}
+	sort.Sort(byRandom(pairs))
+
+	export := tagExport{
+		Version:  tagExportVersion,
+		TagPairs: make([]*types.TagPair, 0, len(pairs)),
+	}
+	for _, pair := range pairs {
+		moved, err := reencryptTagPair(pair, newKey)
+		if err != nil {
+			return err
+		}
+		export.TagPairs = append(export.TagPairs, moved)
+	}
+
+	return json.NewEncoder(w).Encode(export)
+}
+
+// ImportTags saves to bk the TagPairs written to r by ExportTags,
+// which must have been given bk's TagKey, keeping their random tags so
+// that Rows tagged with them (e.g., copied over later) remain
+// findable.  Imported plaintags are passed through NormalizeTag, and
+// TagPairs whose normalized plaintag bk already has are skipped, so
+// importing never creates duplicate tags and is safe to repeat.
+func ImportTags(bk Backend, r io.Reader) error {
+	var export tagExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return fmt.Errorf("Error parsing exported tags: %v", err)
+	}
+	if export.Version != tagExportVersion {
+		return fmt.Errorf("Exported tags are of unsupported version %d",
+			export.Version)
+	}
+
+	existing, err := bk.AllTagPairs(nil)
+	if err != nil {
+		return err
+	}
+	havePlain := map[string]bool{}
+	haveRandom := map[string]string{}
+	for _, pair := range existing {
+		havePlain[normalizeTag(pair.Plain())] = true
+		haveRandom[pair.Random] = pair.Plain()
+	}
+
+	for _, pair := range export.TagPairs {
+		if err = pair.Decrypt(bk.TagKey()); err != nil {
+			return fmt.Errorf("Error decrypting imported tag `%s` (was it"+
+				" exported for a different key?): %v", pair.Random, err)
+		}
+		plain := normalizeTag(pair.Plain())
+
+		if havePlain[plain] {
+			continue
+		}
+		if other, ok := haveRandom[pair.Random]; ok {
+			return fmt.Errorf("Random tag `%s` of imported tag `%s` is"+
+				" already used by tag `%s`", pair.Random, plain, other)
+		}
+
+		if plain != pair.Plain() {
+			pair, err = reencryptTagPair(
+				types.NewTagPair(nil, pair.Random, nil, plain), bk.TagKey())
+			if err != nil {
+				return err
+			}
+		}
+
+		if err = bk.SaveTagPair(pair); err != nil {
+			return fmt.Errorf("Error saving imported tag `%s`: %v", plain, err)
+		}
+		havePlain[plain] = true
+		haveRandom[pair.Random] = plain
+	}
+
+	return nil
+}
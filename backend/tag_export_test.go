@@ -0,0 +1,116 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestExportImportTags(t *testing.T) {
+	src := newMemBackend(t)
+	dst := newMemBackend(t) // Different key
+
+	createTags(t, src, "task", "status:todo", "status:done")
+	mustCreateRow(t, src, "private data", "task", "secret")
+
+	var buf bytes.Buffer
+	if err := ExportTags(src, dst.TagKey(), &buf); err != nil {
+		t.Fatalf("Error from ExportTags: %v", err)
+	}
+	for _, plain := range []string{"private data", "status:todo", "secret"} {
+		if bytes.Contains(buf.Bytes(), []byte(plain)) {
+			t.Errorf("Export contains `%s` unencrypted", plain)
+		}
+	}
+
+	// Importing twice creates nothing the second time
+	exported := buf.Bytes()
+	for i := 0; i < 2; i++ {
+		if err := ImportTags(dst, bytes.NewReader(exported)); err != nil {
+			t.Fatalf("Error from ImportTags: %v", err)
+		}
+	}
+
+	srcPairs, err := src.AllTagPairs(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dstPairs, err := dst.AllTagPairs(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dstPairs) != len(srcPairs) {
+		t.Fatalf("Expected %d TagPairs imported, got %d", len(srcPairs), len(dstPairs))
+	}
+	for _, plain := range []string{"task", "status:todo", "secret"} {
+		if got, want := pairsRandom(t, dst, plain), pairsRandom(t, src, plain); got != want {
+			t.Errorf("Tag `%s` has random tag %s, expected %s", plain, got, want)
+		}
+	}
+
+	// Rows saved to dst reuse the imported tags
+	mustCreateRow(t, dst, "new task", "task", "status:todo")
+
+	after, err := dst.AllTagPairs(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, plain := range []string{"task", "status:todo", "all"} {
+		matches, err := after.WithAllPlainTags([]string{plain})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(matches) != 1 {
+			t.Errorf("Expected 1 TagPair for `%s`, got %d", plain, len(matches))
+		}
+	}
+	if data := rowData(t, dst, "status:todo"); len(data) != 1 || data[0] != "new task" {
+		t.Errorf("Expected new row by imported tag, got %q", data)
+	}
+}
+
+func TestImportTagsNormalizes(t *testing.T) {
+	src := newMemBackend(t)
+	dst := newMemBackend(t)
+
+	createTags(t, src, "Project:Foo")
+	createTags(t, dst, "project:foo")
+
+	var buf bytes.Buffer
+	if err := ExportTags(src, dst.TagKey(), &buf); err != nil {
+		t.Fatalf("Error from ExportTags: %v", err)
+	}
+
+	NormalizeTag = LowerTrimTag
+	defer func() { NormalizeTag = IdentityTag }()
+
+	if err := ImportTags(dst, &buf); err != nil {
+		t.Fatalf("Error from ImportTags: %v", err)
+	}
+
+	pairs, err := dst.AllTagPairs(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pair := range pairs {
+		if pair.Plain() == "Project:Foo" {
+			t.Errorf("Imported duplicate of existing tag as `%s`", pair.Plain())
+		}
+	}
+}
+
+func TestImportTagsWrongKey(t *testing.T) {
+	src := newMemBackend(t)
+	dst := newMemBackend(t)
+	createTags(t, src, "task")
+
+	var buf bytes.Buffer
+	if err := ExportTags(src, src.TagKey(), &buf); err != nil {
+		t.Fatalf("Error from ExportTags: %v", err)
+	}
+	if err := ImportTags(dst, &buf); err == nil {
+		t.Error("Expected error importing tags exported for another key")
+	}
+}
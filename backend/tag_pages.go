@@ -0,0 +1,59 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"sort"
+
+	"github.com/cryptag/cryptag/types"
+)
+
+// TagPairPager is implemented by Backends that can fetch one page of
+// their TagPairs at a time, rather than all of them at once.
+//
+// TagPairsPaged skips the first offset TagPairs, ordered by random
+// tag, then returns at most limit TagPairs (or every TagPair after
+// offset if limit is 0), and whether any TagPairs come after them.
+type TagPairPager interface {
+	TagPairsPaged(offset, limit int) (pairs types.TagPairs, more bool, err error)
+}
+
+// TagPairsPaged returns one page of bk's TagPairs, ordered by random
+// tag, and whether there are more; see TagPairPager.  If bk doesn't
+// implement TagPairPager, all of bk's TagPairs are fetched then
+// trimmed.  Returns no TagPairs (and no error) past the last page.
+//
+// Pages are only consistent with each other while no TagPairs are
+// saved or deleted in between fetching them.
+func TagPairsPaged(bk Backend, offset, limit int) (types.TagPairs, bool, error) {
+	if offset < 0 || limit < 0 {
+		return nil, false, ErrNegativeLimit
+	}
+	if pager, ok := bk.(TagPairPager); ok {
+		return pager.TagPairsPaged(offset, limit)
+	}
+
+	pairs, err := partialTagPairs(bk.AllTagPairs(nil))
+	if err != nil {
+		return nil, false, err
+	}
+	sort.Sort(byRandom(pairs))
+
+	return pageTagPairs(pairs, offset, limit)
+}
+
+// pageTagPairs returns the page of pairs starting at offset of at most
+// limit TagPairs (or all of them if limit is 0), and whether any
+// TagPairs come after it
+func pageTagPairs(pairs types.TagPairs, offset, limit int) (types.TagPairs, bool, error) {
+	if offset >= len(pairs) {
+		return nil, false, nil
+	}
+	pairs = pairs[offset:]
+
+	if limit > 0 && limit < len(pairs) {
+		return pairs[:limit], true, nil
+	}
+	return pairs, false, nil
+}
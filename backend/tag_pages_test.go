@@ -0,0 +1,59 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTagPairsPaged(t *testing.T) {
+	fs, cleanup := newTestFileSystem(t)
+	defer cleanup()
+
+	for _, bk := range []Backend{newMemBackend(t), fs} {
+		created := createTags(t, bk, plaintagsN("tag", 250)...)
+
+		var want []string
+		for _, pair := range created {
+			want = append(want, pair.Random)
+		}
+		sort.Strings(want)
+
+		var got []string
+		pages := 0
+		for offset, more := 0, true; more; offset += 100 {
+			pairs, m, err := TagPairsPaged(bk, offset, 100)
+			if err != nil {
+				t.Fatalf("Error from TagPairsPaged: %v", err)
+			}
+			more = m
+			pages++
+
+			for _, pair := range pairs {
+				assert.NotEqual(t, "", pair.Plain())
+				got = append(got, pair.Random)
+			}
+		}
+
+		assert.Equal(t, 3, pages, bk.Name())
+		assert.Equal(t, want, got, bk.Name())
+
+		// Past the end
+		pairs, more, err := TagPairsPaged(bk, 250, 100)
+		assert.Nil(t, err)
+		assert.False(t, more)
+		assert.Equal(t, 0, len(pairs))
+
+		// No limit
+		pairs, more, _ = TagPairsPaged(bk, 200, 0)
+		assert.False(t, more)
+		assert.Equal(t, 50, len(pairs))
+
+		_, _, err = TagPairsPaged(bk, -1, 10)
+		assert.Equal(t, ErrNegativeLimit, err)
+	}
+}
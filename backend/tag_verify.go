@@ -0,0 +1,110 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/cryptag/cryptag/types"
+)
+
+// InvalidTagPairsError is returned by AllTagPairs and
+// TagPairsFromRandomTags, along with the valid TagPairs found, when
+// some TagPairs don't decrypt to a well-formed plaintag (see
+// verifyTagPair), e.g. because their nonce or ciphertext was tampered
+// with.  Those TagPairs are left out rather than returned with garbage
+// or empty plaintags, so that the rest remain usable; see
+// partialTagPairs.
+type InvalidTagPairsError struct {
+	// Invalid maps the random tag of each rejected TagPair to why
+	Invalid map[string]error
+}
+
+func (e *InvalidTagPairsError) Error() string {
+	var invalid []string
+	for random, err := range e.Invalid {
+		invalid = append(invalid, fmt.Sprintf("%s (%v)", random, err))
+	}
+	sort.Strings(invalid)
+	return fmt.Sprintf("%d invalid TagPair(s): %s", len(invalid),
+		strings.Join(invalid, ", "))
+}
+
+// validTagPairs returns the valid TagPairs read by AllTagPairs, along
+// with ierr if any were invalid.  If none were valid, a wrong key is
+// the likeliest cause, so just the error for the first invalid
+// TagPair (by random tag) is returned, so that callers checking
+// types.IsWrongKey still can.
+func validTagPairs(valid types.TagPairs, ierr *InvalidTagPairsError) (types.TagPairs, error) {
+	if len(ierr.Invalid) == 0 {
+		return valid, nil
+	}
+	if len(valid) > 0 {
+		return valid, ierr
+	}
+
+	var randtags []string
+	for random := range ierr.Invalid {
+		randtags = append(randtags, random)
+	}
+	sort.Strings(randtags)
+
+	return nil, ierr.Invalid[randtags[0]]
+}
+
+// partialTagPairs returns pairs with a nil error if err is an
+// *InvalidTagPairsError and pairs holds at least one valid TagPair, so
+// that callers can carry on with just the valid TagPairs; Rows tagged
+// with an invalid one still can't be populated.  If no TagPair was
+// valid, a wrong key is the likelier cause, so err is returned as is.
+func partialTagPairs(pairs types.TagPairs, err error) (types.TagPairs, error) {
+	var ierr *InvalidTagPairsError
+	if err != nil && len(pairs) > 0 && errors.As(err, &ierr) {
+		if types.Debug {
+			log.Printf("Ignoring %v\n", err)
+		}
+		return pairs, nil
+	}
+	return pairs, err
+}
+
+// verifyTagPair decrypts pair with key, setting its plaintag, and
+// checks that the plaintag is well-formed (i.e., non-empty; any
+// bytes are allowed, but ValidateTags never lets an empty plaintag
+// through).  Since decryption is authenticated, a TagPair whose nonce
+// or ciphertext was altered fails to decrypt rather than decrypting
+// into garbage.
+func verifyTagPair(key *[32]byte, pair *types.TagPair) error {
+	if pair.Nonce == nil {
+		return fmt.Errorf("missing nonce")
+	}
+	if err := pair.Decrypt(key); err != nil {
+		return err
+	}
+	if pair.Plain() == "" {
+		return ErrEmptyPlainTag
+	}
+	return nil
+}
+
+// verifyTagPairs calls verifyTagPair on each of pairs, returning the
+// valid ones along with any error, as validTagPairs does
+func verifyTagPairs(key *[32]byte, pairs types.TagPairs) (types.TagPairs, error) {
+	valid := make(types.TagPairs, 0, len(pairs))
+	ierr := &InvalidTagPairsError{Invalid: map[string]error{}}
+
+	for _, pair := range pairs {
+		if err := verifyTagPair(key, pair); err != nil {
+			ierr.Invalid[pair.Random] = err
+			continue
+		}
+		valid = append(valid, pair)
+	}
+
+	return validTagPairs(valid, ierr)
+}
@@ -0,0 +1,134 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path"
+	"testing"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTagPairsFromRandomTagsRejectsTampered(t *testing.T) {
+	fs, cleanup := newTestFileSystem(t)
+	defer cleanup()
+
+	pairs := createTags(t, fs, "good", "tampered", "empty")
+	good, tampered, empty := pairs[0], pairs[1], pairs[2]
+
+	// Flip a bit of the tampered pair's nonce
+	nonce := *tampered.Nonce
+	nonce[0] ^= 1
+	writeTagFile(t, fs, tampered.Random, tampered.PlainEncrypted, &nonce)
+
+	// Replace the empty pair with one that decrypts to ""
+	emptyNonce, err := cryptag.RandomNonce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := cryptag.Encrypt([]byte{}, emptyNonce, fs.TagKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTagFile(t, fs, empty.Random, enc, emptyNonce)
+
+	found, err := fs.TagPairsFromRandomTags(
+		[]string{good.Random, tampered.Random, empty.Random})
+
+	var ierr *InvalidTagPairsError
+	if !errors.As(err, &ierr) {
+		t.Fatalf("Expected *InvalidTagPairsError, got %v", err)
+	}
+	assert.Len(t, ierr.Invalid, 2)
+	assert.True(t, types.IsWrongKey(ierr.Invalid[tampered.Random]))
+	assert.Equal(t, ErrEmptyPlainTag, ierr.Invalid[empty.Random])
+
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, "good", found[0].Plain())
+	}
+}
+
+func writeTagFile(t *testing.T, fs *FileSystem, random string, enc []byte, nonce *[24]byte) {
+	b, err := json.Marshal(&types.TagPair{PlainEncrypted: enc, Nonce: nonce})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(path.Join(fs.tagsPath, random), b, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAllTagPairsPartial(t *testing.T) {
+	fs, cleanup := newTestFileSystem(t)
+	defer cleanup()
+
+	mustCreateRow(t, fs, "fine", "good", "type:note")
+	pairs := createTags(t, fs, "tampered")
+	tampered := pairs[0]
+
+	nonce := *tampered.Nonce
+	nonce[0] ^= 1
+	writeTagFile(t, fs, tampered.Random, tampered.PlainEncrypted, &nonce)
+
+	found, err := fs.AllTagPairs(nil)
+
+	var ierr *InvalidTagPairsError
+	if !errors.As(err, &ierr) {
+		t.Fatalf("Expected *InvalidTagPairsError, got %v", err)
+	}
+	assert.Len(t, ierr.Invalid, 1)
+	assert.True(t, types.IsWrongKey(ierr.Invalid[tampered.Random]))
+
+	var plains []string
+	for _, pair := range found {
+		plains = append(plains, pair.Plain())
+	}
+	assert.NotContains(t, plains, "tampered")
+	assert.Contains(t, plains, "good")
+
+	// Querying and creating still work with the valid TagPairs
+	assert.Equal(t, []string{"fine"}, rowData(t, fs, "good"))
+
+	if _, err = CreateRow(fs, nil, []byte("new"), []string{"good", "new"}); err != nil {
+		t.Fatalf("Error from CreateRow: %v", err)
+	}
+	assert.Equal(t, []string{"fine", "new"}, rowData(t, fs, "good"))
+}
+
+func TestAllTagPairsPartialRemote(t *testing.T) {
+	key, _ := cryptag.RandomKey()
+	wrongKey, _ := cryptag.RandomKey()
+
+	pairs := remoteTagPairs(t, key, "good", "tampered")
+	tampered := *pairs[1]
+	nonce := *tampered.Nonce
+	nonce[0] ^= 1
+	tampered.Nonce = &nonce
+	pairs[1] = &tampered
+
+	for name, remote := range fakeRemotes {
+		srv := remote.serve(pairs)
+
+		found, err := remote.open(t, srv.URL, key).AllTagPairs(nil)
+		var ierr *InvalidTagPairsError
+		if !errors.As(err, &ierr) {
+			t.Fatalf("%s: expected *InvalidTagPairsError, got %v", name, err)
+		}
+		assert.Len(t, ierr.Invalid, 1, name)
+		if assert.Len(t, found, 1, name) {
+			assert.Equal(t, "good", found[0].Plain(), name)
+		}
+
+		// With no valid TagPairs, the decryption error is returned
+		_, err = remote.open(t, srv.URL, wrongKey).AllTagPairs(nil)
+		assert.True(t, types.IsWrongKey(err), "%s: %v", name, err)
+
+		srv.Close()
+	}
+}
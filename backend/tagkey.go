@@ -0,0 +1,98 @@
+// Steve Phillips / elimisteve
+// 2017.04.13
+
+package backend
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+)
+
+var (
+	ErrTagKeyUnsupported = errors.New("backend: Backend doesn't support a separate tag key")
+)
+
+// TagKeySetter is implemented by Backends whose TagPairs can be
+// encrypted with a different key (see Backend.TagKey) than their Rows.
+type TagKeySetter interface {
+	SetTagKey(key *[32]byte)
+}
+
+// RotateTagKey re-encrypts every TagPair in bk with newKey, keeping
+// each TagPair's random tag, then sets newKey as bk's tag key.  Rows
+// are left untouched, still encrypted with bk.RowKey().  bk must
+// implement TagKeySetter, and its SaveTagPair must replace the
+// existing TagPair with the same random tag (as FileSystem's does).
+//
+// Persist the new tag key (e.g., with bk.ToConfig then Config.Update),
+// or bk's TagPairs will be unreadable next time.
+func RotateTagKey(bk Backend, newKey *[32]byte) error {
+	return RotateTagKeyProgress(bk, newKey, nil)
+}
+
+// RotateTagKeyProgress is like RotateTagKey, but reports each
+// TagPair saved to progress, if it's non-nil.
+func RotateTagKeyProgress(bk Backend, newKey *[32]byte, progress types.ProgressFunc) error {
+	setter, ok := bk.(TagKeySetter)
+	if !ok {
+		return ErrTagKeyUnsupported
+	}
+
+	pairs, err := bk.AllTagPairs(nil)
+	if err != nil {
+		return err
+	}
+
+	// Encrypt everything before saving anything
+	rotated := make(types.TagPairs, 0, len(pairs))
+
+	for _, pair := range pairs {
+		newPair, err := reencryptTagPair(pair, newKey)
+		if err != nil {
+			return err
+		}
+		rotated = append(rotated, newPair)
+	}
+
+	prog := types.NewProgress(progress, len(rotated))
+
+	for i, pair := range rotated {
+		if err = bk.SaveTagPair(pair); err != nil {
+			return fmt.Errorf("Error saving re-encrypted TagPair %d of %d;"+
+				" %d TagPairs are now encrypted with the new tag key: %v",
+				i+1, len(rotated), i, err)
+		}
+		prog.Add(1)
+	}
+
+	setter.SetTagKey(newKey)
+
+	return nil
+}
+
+// reencryptTagPair returns a copy of pair, with the same random tag,
+// whose plaintag is encrypted with key
+func reencryptTagPair(pair *types.TagPair, key *[32]byte) (*types.TagPair, error) {
+	plain := []byte(pair.Plain())
+
+	var enc []byte
+	var nonce *[24]byte
+	var err error
+
+	if DeterministicTagEncryption {
+		enc, nonce, err = cryptag.EncryptDeterministic(plain, key)
+	} else {
+		nonce, err = cryptag.RandomNonce()
+		if err == nil {
+			enc, err = cryptag.Encrypt(plain, nonce, key)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error re-encrypting tag `%s`: %v", pair.Plain(), err)
+	}
+
+	return types.NewTagPair(enc, pair.Random, nonce, pair.Plain()), nil
+}
@@ -0,0 +1,135 @@
+// Steve Phillips / elimisteve
+// 2017.04.13
+
+package backend
+
+import (
+	"path"
+	"testing"
+
+	"github.com/cryptag/cryptag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotateTagKey(t *testing.T) {
+	fs, cleanup := newTestFileSystem(t)
+	defer cleanup()
+
+	row := mustCreateRow(t, fs, "secret", "rotated")
+
+	oldKey := fs.Key()
+	newKey, _ := cryptag.RandomKey()
+
+	before, _ := fs.AllTagPairs(nil)
+
+	if err := RotateTagKey(fs, newKey); err != nil {
+		t.Fatalf("Error from RotateTagKey: %v", err)
+	}
+	assert.Equal(t, newKey, fs.TagKey())
+	assert.Equal(t, oldKey, fs.Key())
+
+	// TagPairs decrypt with the new key, not the old one; random tags
+	// are unchanged
+	after, err := fs.AllTagPairs(nil)
+	if err != nil {
+		t.Fatalf("Error from AllTagPairs: %v", err)
+	}
+	assert.Equal(t, len(before), len(after))
+
+	for _, rand := range row.RandomTags {
+		tagFile := path.Join(fs.tagsPath, rand)
+
+		_, err := readTagFile(fs.codec, newKey, tagFile)
+		assert.Nil(t, err)
+
+		_, err = readTagFile(fs.codec, oldKey, tagFile)
+		assert.NotNil(t, err)
+	}
+
+	// Rows are still encrypted with the old key
+	rows, err := fs.RowsFromRandomTags(row.RandomTags)
+	if err != nil {
+		t.Fatalf("Error from RowsFromRandomTags: %v", err)
+	}
+	assert.NotNil(t, rows[0].Decrypt(newKey))
+	assert.Nil(t, rows[0].Decrypt(oldKey))
+
+	assert.Equal(t, []string{"secret"}, rowData(t, fs, "rotated"))
+
+	// New tags use the new tag key, too
+	mustCreateRow(t, fs, "another", "rotated", "new-tag")
+	assert.Equal(t, []string{"another"}, rowData(t, fs, "new-tag"))
+
+	conf, _ := fs.ToConfig()
+	assert.Equal(t, newKey, conf.TagKey)
+}
+
+func TestRotateTagKeyUnsupported(t *testing.T) {
+	newKey, _ := cryptag.RandomKey()
+	assert.Equal(t, ErrTagKeyUnsupported, RotateTagKey(newMemBackend(t), newKey))
+}
+
+func TestSeparateTagAndRowKeys(t *testing.T) {
+	fs, cleanup := newTestFileSystem(t)
+	defer cleanup()
+
+	tagKey, _ := cryptag.RandomKey()
+	fs.SetTagKey(tagKey)
+
+	assert.Equal(t, tagKey, fs.TagKey())
+	assert.Equal(t, fs.Key(), fs.RowKey())
+
+	mustCreateRow(t, fs, "narrowly shared", "widely:shared")
+	assert.Equal(t, []string{"narrowly shared"}, rowData(t, fs, "widely:shared"))
+
+	// A caller with only the tag key (and some other row key)
+	otherRowKey, _ := cryptag.RandomKey()
+	tagsOnly, err := NewFileSystem(&Config{
+		Name:     "tags-only",
+		Type:     TypeFileSystem,
+		Key:      otherRowKey,
+		TagKey:   tagKey,
+		DataPath: fs.dataPath,
+	})
+	if err != nil {
+		t.Fatalf("Error from NewFileSystem: %v", err)
+	}
+
+	pairs, err := tagsOnly.AllTagPairs(nil)
+	if err != nil {
+		t.Fatalf("Error listing tags with only the tag key: %v", err)
+	}
+	matches, err := pairs.WithAllPlainTags([]string{"widely:shared"})
+	if err != nil {
+		t.Fatalf("Tag not found with only the tag key: %v", err)
+	}
+
+	rows, err := tagsOnly.RowsFromRandomTags(matches.AllRandom())
+	if err != nil {
+		t.Fatalf("Error from RowsFromRandomTags: %v", err)
+	}
+	assert.Equal(t, 1, len(rows))
+	assert.NotNil(t, rows[0].Decrypt(tagsOnly.RowKey()))
+
+	_, err = RowsFromPlainTags(tagsOnly, nil, []string{"widely:shared"})
+	assert.NotNil(t, err, "Rows shouldn't decrypt without the row key")
+}
+
+func TestRotateTagKeyProgress(t *testing.T) {
+	fs, cleanup := newTestFileSystem(t)
+	defer cleanup()
+
+	createTags(t, fs, plaintagsN("tag", 5)...)
+
+	var calls [][2]int
+	progress := func(done, total int) {
+		calls = append(calls, [2]int{done, total})
+	}
+
+	newKey, _ := cryptag.RandomKey()
+	if err := RotateTagKeyProgress(fs, newKey, progress); err != nil {
+		t.Fatalf("Error from RotateTagKeyProgress: %v", err)
+	}
+
+	assert.Equal(t, [][2]int{{1, 5}, {2, 5}, {3, 5}, {4, 5}, {5, 5}}, calls)
+}
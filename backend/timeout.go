@@ -0,0 +1,141 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+	"golang.org/x/net/context"
+)
+
+var (
+	ErrTimeout = errors.New("backend: operation timed out")
+)
+
+// ContextBackend is implemented by Backends whose operations can be
+// cancelled.  WithContext returns a Backend whose operations are
+// abandoned once ctx is done.
+type ContextBackend interface {
+	WithContext(ctx context.Context) Backend
+}
+
+// TimeoutBackend wraps a Backend so that each operation that talks to
+// storage (listing and fetching Rows and TagPairs, saving, deleting)
+// returns ErrTimeout if it takes longer than Timeout.  A Timeout of 0
+// means no timeout.
+//
+// If the wrapped Backend implements ContextBackend, timed-out
+// operations are also cancelled.  Otherwise they are left to finish
+// in the background, and their results are discarded.
+type TimeoutBackend struct {
+	Backend
+
+	Timeout time.Duration
+}
+
+// WithTimeout returns a TimeoutBackend that bounds each of bk's
+// operations to timeout.
+func WithTimeout(bk Backend, timeout time.Duration) *TimeoutBackend {
+	return &TimeoutBackend{Backend: bk, Timeout: timeout}
+}
+
+// run calls fn with the wrapped Backend (bound to a context that
+// expires after tb.Timeout, if possible), returning ErrTimeout if fn
+// doesn't return in time
+func (tb *TimeoutBackend) run(fn func(bk Backend) error) error {
+	if tb.Timeout <= 0 {
+		return fn(tb.Backend)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), tb.Timeout)
+	defer cancel()
+
+	bk := tb.Backend
+	if cbk, ok := bk.(ContextBackend); ok {
+		bk = cbk.WithContext(ctx)
+	}
+
+	// Buffered so that fn's goroutine can exit even if no one is left
+	// to receive its result
+	done := make(chan error, 1)
+	go func() {
+		done <- fn(bk)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ErrTimeout
+	}
+}
+
+func (tb *TimeoutBackend) AllTagPairs(oldPairs types.TagPairs) (types.TagPairs, error) {
+	var pairs types.TagPairs
+	err := tb.run(func(bk Backend) (err error) {
+		pairs, err = bk.AllTagPairs(oldPairs)
+		return err
+	})
+	if err == ErrTimeout {
+		return nil, err
+	}
+	return pairs, err
+}
+
+func (tb *TimeoutBackend) TagPairsFromRandomTags(randtags cryptag.RandomTags) (types.TagPairs, error) {
+	var pairs types.TagPairs
+	err := tb.run(func(bk Backend) (err error) {
+		pairs, err = bk.TagPairsFromRandomTags(randtags)
+		return err
+	})
+	if err == ErrTimeout {
+		return nil, err
+	}
+	return pairs, err
+}
+
+func (tb *TimeoutBackend) SaveTagPair(pair *types.TagPair) error {
+	return tb.run(func(bk Backend) error {
+		return bk.SaveTagPair(pair)
+	})
+}
+
+func (tb *TimeoutBackend) ListRows(randtags cryptag.RandomTags) (types.Rows, error) {
+	var rows types.Rows
+	err := tb.run(func(bk Backend) (err error) {
+		rows, err = bk.ListRows(randtags)
+		return err
+	})
+	if err == ErrTimeout {
+		return nil, err
+	}
+	return rows, err
+}
+
+func (tb *TimeoutBackend) RowsFromRandomTags(randtags cryptag.RandomTags) (types.Rows, error) {
+	var rows types.Rows
+	err := tb.run(func(bk Backend) (err error) {
+		rows, err = bk.RowsFromRandomTags(randtags)
+		return err
+	})
+	if err == ErrTimeout {
+		return nil, err
+	}
+	return rows, err
+}
+
+func (tb *TimeoutBackend) SaveRow(row *types.Row) error {
+	return tb.run(func(bk Backend) error {
+		return bk.SaveRow(row)
+	})
+}
+
+func (tb *TimeoutBackend) DeleteRows(randtags cryptag.RandomTags) error {
+	return tb.run(func(bk Backend) error {
+		return bk.DeleteRows(randtags)
+	})
+}
@@ -0,0 +1,105 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// slowBackend is a memBackend that takes delay to do anything
+type slowBackend struct {
+	*memBackend
+	delay time.Duration
+}
+
+func (sb *slowBackend) AllTagPairs(oldPairs types.TagPairs) (types.TagPairs, error) {
+	time.Sleep(sb.delay)
+	return sb.memBackend.AllTagPairs(oldPairs)
+}
+
+func (sb *slowBackend) RowsFromRandomTags(randtags cryptag.RandomTags) (types.Rows, error) {
+	time.Sleep(sb.delay)
+	return sb.memBackend.RowsFromRandomTags(randtags)
+}
+
+func (sb *slowBackend) SaveRow(row *types.Row) error {
+	time.Sleep(sb.delay)
+	return sb.memBackend.SaveRow(row)
+}
+
+// hangingBackend is a memBackend whose AllTagPairs blocks until its
+// context is cancelled
+type hangingBackend struct {
+	*memBackend
+	ctx       context.Context
+	cancelled chan struct{}
+}
+
+func (hb *hangingBackend) WithContext(ctx context.Context) Backend {
+	return &hangingBackend{memBackend: hb.memBackend, ctx: ctx,
+		cancelled: hb.cancelled}
+}
+
+func (hb *hangingBackend) AllTagPairs(oldPairs types.TagPairs) (types.TagPairs, error) {
+	<-hb.ctx.Done()
+	close(hb.cancelled)
+	return nil, hb.ctx.Err()
+}
+
+func TestTimeoutBackend(t *testing.T) {
+	mem := newMemBackend(t)
+	mustCreateRow(t, mem, "data", "note")
+
+	slow := &slowBackend{memBackend: mem, delay: 200 * time.Millisecond}
+	tb := WithTimeout(slow, 20*time.Millisecond)
+
+	start := time.Now()
+
+	pairs, err := tb.AllTagPairs(nil)
+	assert.Equal(t, ErrTimeout, err)
+	assert.Nil(t, pairs)
+
+	_, err = tb.RowsFromRandomTags([]string{"whatever"})
+	assert.Equal(t, ErrTimeout, err)
+
+	row, _ := types.NewRow([]byte("more"), []string{"note"})
+	assert.Equal(t, ErrTimeout, tb.SaveRow(row))
+
+	if elapsed := time.Since(start); elapsed >= slow.delay {
+		t.Errorf("Timed out operations took %v; should have returned"+
+			" after ~%v each", elapsed, tb.Timeout)
+	}
+
+	// Fast enough
+	tb.Timeout = 2 * time.Second
+	pairs, err = tb.AllTagPairs(nil)
+	if err != nil {
+		t.Fatalf("Error from AllTagPairs: %v", err)
+	}
+	assert.NotEqual(t, 0, len(pairs))
+
+	// Methods that don't touch storage are passed straight through
+	assert.Equal(t, mem.Name(), tb.Name())
+}
+
+func TestTimeoutBackendCancels(t *testing.T) {
+	hang := &hangingBackend{memBackend: newMemBackend(t),
+		ctx: context.Background(), cancelled: make(chan struct{})}
+	tb := WithTimeout(hang, 20*time.Millisecond)
+
+	_, err := tb.AllTagPairs(nil)
+	assert.Equal(t, ErrTimeout, err)
+
+	select {
+	case <-hang.cancelled:
+	case <-time.After(2 * time.Second):
+		t.Errorf("Context-aware Backend was not cancelled after timeout")
+	}
+}
@@ -0,0 +1,396 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+)
+
+// TombstoneTag tags the (private) Rows that record deletions; see
+// DeleteRowsWithTombstone.
+const TombstoneTag = "system:tombstone"
+
+// Tombstone records that some Rows were deleted, so that SyncRows can
+// delete them from every other Backend too, rather than copying them
+// back.  Rows are listed by their random tags, minus decoys, joined by
+// "-" (see decoyFreeKey); older Tombstones may include decoys.
+type Tombstone struct {
+	Rows      []string  `json:"rows"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// TombstoneBackend wraps a Backend so that DeleteRows leaves a
+// Tombstone behind; see DeleteRowsWithTombstone.
+type TombstoneBackend struct {
+	Backend
+}
+
+// WithTombstones returns a TombstoneBackend wrapping bk.
+func WithTombstones(bk Backend) *TombstoneBackend {
+	return &TombstoneBackend{Backend: bk}
+}
+
+func (tb *TombstoneBackend) DeleteRows(randtags cryptag.RandomTags) error {
+	return DeleteRowsWithTombstone(tb.Backend, randtags)
+}
+
+// DeleteRowsWithTombstone saves a Tombstone (as a private Row tagged
+// with TombstoneTag, encrypted like any other) listing the Rows tagged
+// with all of randtags, then deletes them, so that the deletion
+// reaches the Backends bk is synced with (see SyncRows).
+func DeleteRowsWithTombstone(bk Backend, randtags cryptag.RandomTags) error {
+	rows, err := listRows(bk, randtags)
+	if err != nil {
+		return err
+	}
+
+	pairs, err := bk.AllTagPairs(nil)
+	if err != nil {
+		return err
+	}
+	tombRands := randomTagsOf(pairs, TombstoneTag)
+	known := knownRandomTags(pairs)
+
+	stone := &Tombstone{DeletedAt: cryptag.Now()}
+	for _, row := range rows {
+		// Tombstones themselves are deleted without a trace (see
+		// CollectTombstones)
+		if hasAnyRandomTag(row, tombRands) {
+			continue
+		}
+		stone.Rows = append(stone.Rows,
+			decoyFreeKey(bk.RowKey(), known, row.RandomTags))
+	}
+
+	if len(stone.Rows) > 0 {
+		b, err := json.Marshal(stone)
+		if err != nil {
+			return err
+		}
+		_, err = CreatePrivateRow(bk, pairs, b, []string{TombstoneTag})
+		if err != nil {
+			return fmt.Errorf("Error saving tombstone: %v", err)
+		}
+	}
+
+	return bk.DeleteRows(randtags)
+}
+
+// Tombstones returns every Tombstone saved to bk.
+func Tombstones(bk Backend) ([]*Tombstone, error) {
+	_, stones, err := tombstoneRows(bk)
+	return stones, err
+}
+
+// tombstoneRows returns bk's tombstone Rows along with the Tombstone
+// each contains
+func tombstoneRows(bk Backend) (types.Rows, []*Tombstone, error) {
+	pairs, err := bk.AllTagPairs(nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Backends synced with each other may each have created their
+	// own TagPair for TombstoneTag
+	var rows types.Rows
+	seen := map[string]bool{}
+	for _, tombRand := range randomTagsOf(pairs, TombstoneTag) {
+		found, err := rowsFromRandomTags(bk, []string{tombRand})
+		if err != nil && err != types.ErrRowsNotFound {
+			return nil, nil, err
+		}
+		for _, row := range found {
+			if !seen[rowKey(row)] {
+				seen[rowKey(row)] = true
+				rows = append(rows, row)
+			}
+		}
+	}
+
+	stones := make([]*Tombstone, 0, len(rows))
+	for _, row := range rows {
+		if err = row.Decrypt(bk.RowKey()); err != nil {
+			return nil, nil, err
+		}
+		var stone Tombstone
+		if err = json.Unmarshal(row.Decrypted(), &stone); err != nil {
+			return nil, nil, fmt.Errorf("Error parsing tombstone: %v", err)
+		}
+		stones = append(stones, &stone)
+	}
+
+	return rows, stones, nil
+}
+
+// CollectTombstones deletes bk's Tombstones of deletions made before
+// cutoff, returning how many it deleted.  A Backend that hasn't been
+// synced (see SyncRows) since before cutoff may then bring the Rows
+// those Tombstones record back, so pick a cutoff older than the
+// longest a device goes without syncing, and collect on each Backend.
+func CollectTombstones(bk Backend, cutoff time.Time) (int, error) {
+	rows, stones, err := tombstoneRows(bk)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for i, stone := range stones {
+		if !stone.DeletedAt.Before(cutoff) {
+			continue
+		}
+		// Each tombstone Row has its own id:... tag, so this only
+		// deletes the one
+		if err = bk.DeleteRows(rows[i].RandomTags); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+// SyncRows makes bks (e.g., the Backends of several devices) hold the
+// same Rows: TagPairs are reconciled (see ReconcileTags), every Row
+// listed in any Backend's Tombstones is deleted from every Backend,
+// then every remaining Row is copied to each Backend that lacks it,
+// re-encrypted with that Backend's RowKey if need be.  Tombstones are
+// themselves Rows, so they're copied too, which keeps each deletion
+// from being undone by a later sync.
+func SyncRows(bks ...Backend) error {
+	if err := ReconcileTags(bks...); err != nil {
+		return err
+	}
+
+	deleted := map[string]bool{}
+	for _, bk := range bks {
+		stones, err := Tombstones(bk)
+		if err != nil {
+			return fmt.Errorf("Error fetching tombstones from %s: %v", bk.Name(), err)
+		}
+		for _, stone := range stones {
+			for _, key := range stone.Rows {
+				deleted[key] = true
+			}
+		}
+	}
+
+	// The Rows each Backend holds, minus those just deleted, keyed by
+	// their decoy-free keys (which are the same in every Backend, even
+	// ones with different keys) and mapped to their keys in that
+	// Backend
+	have := make([]map[string]string, len(bks))
+	known := make([]map[string]bool, len(bks))
+	for i, bk := range bks {
+		pairs, err := bk.AllTagPairs(nil)
+		if err != nil {
+			return fmt.Errorf("Error fetching tags from %s: %v", bk.Name(), err)
+		}
+		known[i] = knownRandomTags(pairs)
+
+		keys, err := allRowKeys(bk)
+		if err != nil {
+			return fmt.Errorf("Error listing rows from %s: %v", bk.Name(), err)
+		}
+
+		have[i] = map[string]string{}
+		for key := range keys {
+			free := decoyFreeKey(bk.RowKey(), known[i], strings.Split(key, "-"))
+			if !deleted[key] && !deleted[free] {
+				have[i][free] = key
+				continue
+			}
+			if err = bk.DeleteRows(strings.Split(key, "-")); err != nil &&
+				err != types.ErrRowsNotFound {
+				return fmt.Errorf("Error deleting row from %s: %v", bk.Name(), err)
+			}
+		}
+	}
+
+	for i, src := range bks {
+		for _, free := range sortedKeys(have[i]) {
+			for j, dst := range bks {
+				if _, ok := have[j][free]; ok {
+					continue
+				}
+				key, err := copyRow(src, dst, have[i][free], known[i], nil)
+				if err != nil {
+					return fmt.Errorf("Error copying row from %s to %s: %v",
+						src.Name(), dst.Name(), err)
+				}
+				have[j][free] = key
+			}
+		}
+	}
+
+	return nil
+}
+
+// allRowKeys returns the key (see rowKey) of every Row in bk, found
+// via each of bk's TagPairs since every Row has at least one
+func allRowKeys(bk Backend) (map[string]bool, error) {
+	pairs, err := bk.AllTagPairs(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := map[string]bool{}
+	for _, pair := range pairs {
+		rows, err := listRows(bk, []string{pair.Random})
+		if err != nil && err != types.ErrRowsNotFound {
+			return nil, err
+		}
+		for _, row := range rows {
+			keys[rowKey(row)] = true
+		}
+	}
+
+	return keys, nil
+}
+
+// copyRow copies the Row whose key (see rowKey) is key from src to
+// dst, returning the key of the copy.  If their RowKeys differ, the
+// Row is re-encrypted and its decoys replaced with ones for dst (see
+// rekeyDecoys); known is the set of src's random tags that have
+// TagPairs.  Each of the Row's random tags in remap, if any, is
+// replaced with the one it maps to (e.g., dst's random tag for the
+// same plaintag).
+func copyRow(src, dst Backend, key string, known map[string]bool, remap map[string]string) (string, error) {
+	row, err := rowByKey(src, key)
+	if err != nil {
+		return "", err
+	}
+
+	sameKey := bytes.Equal(src.RowKey()[:], dst.RowKey()[:])
+
+	randtags := row.RandomTags
+	if !sameKey {
+		randtags, err = rekeyDecoys(randtags, known, src.RowKey(), dst.RowKey())
+		if err != nil {
+			return "", err
+		}
+	}
+
+	remapped := false
+	if len(remap) > 0 {
+		mapped := make([]string, len(randtags))
+		for i, randtag := range randtags {
+			if to, ok := remap[randtag]; ok {
+				randtag = to
+				remapped = true
+			}
+			mapped[i] = randtag
+		}
+		if remapped {
+			randtags = canonicalRandomTags(mapped)
+		}
+	}
+
+	if sameKey && !remapped {
+		return key, dst.SaveRow(&types.Row{
+			Encrypted:        row.Encrypted,
+			RandomTags:       row.RandomTags,
+			Nonce:            row.Nonce,
+			EncryptedSummary: row.EncryptedSummary,
+			SummaryNonce:     row.SummaryNonce,
+		})
+	}
+
+	copied, err := reencryptRow(row, src.RowKey(), dst.RowKey(), randtags)
+	if err != nil {
+		return "", err
+	}
+
+	return rowKey(copied), dst.SaveRow(copied)
+}
+
+// rowByKey fetches the Row in bk whose key (see rowKey) is key
+func rowByKey(bk Backend, key string) (*types.Row, error) {
+	rows, err := rowsFromRandomTags(bk, strings.Split(key, "-"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		if rowKey(row) == key {
+			return row, nil
+		}
+	}
+	return nil, types.ErrRowsNotFound
+}
+
+// reencryptRow returns a copy of row, which is encrypted with oldKey,
+// tagged with randtags and encrypted with newKey instead
+func reencryptRow(row *types.Row, oldKey, newKey *[32]byte, randtags []string) (*types.Row, error) {
+	if err := row.Decrypt(oldKey); err != nil {
+		return nil, err
+	}
+
+	// Bind the data to randtags rather than row's random tags
+	orig := row.RandomTags
+	row.RandomTags = randtags
+	plain, err := row.Plaintext()
+	row.RandomTags = orig
+	if err != nil {
+		return nil, err
+	}
+
+	copied := &types.Row{RandomTags: randtags}
+	if err = copied.EncryptPlaintext(plain, newKey); err != nil {
+		return nil, err
+	}
+
+	if len(row.EncryptedSummary) > 0 {
+		if err = row.DecryptSummary(oldKey); err != nil {
+			return nil, err
+		}
+		if copied.SummaryNonce, err = cryptag.RandomNonce(); err != nil {
+			return nil, err
+		}
+		copied.EncryptedSummary, err = cryptag.Encrypt(row.Summary(),
+			copied.SummaryNonce, newKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return copied, nil
+}
+
+// randomTagsOf returns the random tags of the TagPairs in pairs for
+// plain
+func randomTagsOf(pairs types.TagPairs, plain string) []string {
+	var randtags []string
+	for _, pair := range pairs {
+		if pair.Plain() == plain {
+			randtags = append(randtags, pair.Random)
+		}
+	}
+	return randtags
+}
+
+func hasAnyRandomTag(row *types.Row, randtags []string) bool {
+	for _, randtag := range randtags {
+		if row.HasRandomTag(randtag) {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedBoolKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,134 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cryptag/cryptag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncRowsTombstones(t *testing.T) {
+	laptop, phone := newMemBackend(t), newMemBackend(t)
+
+	mustCreateRow(t, laptop, "doomed", "note", "doomed")
+	mustCreateRow(t, laptop, "kept", "note")
+
+	if err := SyncRows(laptop, phone); err != nil {
+		t.Fatalf("Error from SyncRows: %v", err)
+	}
+	assert.Equal(t, []string{"doomed", "kept"}, rowData(t, phone, "note"))
+
+	// Delete on the phone, which leaves a tombstone
+	if err := DeleteRows(WithTombstones(phone), nil, []string{"doomed"}); err != nil {
+		t.Fatalf("Error from DeleteRows: %v", err)
+	}
+	assert.Equal(t, []string{"kept"}, rowData(t, phone, "note"))
+
+	stones, err := Tombstones(phone)
+	if err != nil {
+		t.Fatalf("Error from Tombstones: %v", err)
+	}
+	assert.Equal(t, 1, len(stones))
+	assert.Equal(t, 1, len(stones[0].Rows))
+
+	// Tombstones are hidden from ListAllRows
+	rows, _ := ListAllRows(phone, nil)
+	assert.Equal(t, 1, len(rows))
+
+	// The deletion reaches the laptop rather than the Row coming back,
+	// and sticks
+	for i := 0; i < 2; i++ {
+		if err = SyncRows(laptop, phone); err != nil {
+			t.Fatalf("Error from SyncRows: %v", err)
+		}
+		assert.Equal(t, []string{"kept"}, rowData(t, laptop, "note"))
+		assert.Equal(t, []string{"kept"}, rowData(t, phone, "note"))
+	}
+
+	stones, _ = Tombstones(laptop)
+	assert.Equal(t, 1, len(stones), "Tombstones should sync too")
+
+	// Garbage collection
+	n, err := CollectTombstones(laptop, time.Now().Add(-time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n, "Recent tombstones should be kept")
+
+	for _, bk := range []Backend{laptop, phone} {
+		n, err = CollectTombstones(bk, time.Now())
+		assert.Nil(t, err)
+		assert.Equal(t, 1, n)
+
+		stones, _ = Tombstones(bk)
+		assert.Equal(t, 0, len(stones))
+	}
+	assert.Equal(t, []string{"kept"}, rowData(t, phone, "note"))
+}
+
+func TestSyncRowsPaddedAcrossKeys(t *testing.T) {
+	defer func(orig int) { PadTagsTo = orig }(PadTagsTo)
+	PadTagsTo = 8
+
+	// Each memBackend has its own key
+	laptop, phone := newMemBackend(t), newMemBackend(t)
+
+	mustCreateRow(t, laptop, "doomed", "note", "doomed")
+	mustCreateRow(t, laptop, "kept", "note")
+
+	for i := 0; i < 2; i++ {
+		if err := SyncRows(laptop, phone); err != nil {
+			t.Fatalf("Error from SyncRows: %v", err)
+		}
+		assert.Equal(t, []string{"doomed", "kept"}, rowData(t, phone, "note"))
+		assert.Len(t, phone.rows, 2, "Rows shouldn't be copied again")
+	}
+
+	// The copies' decoys have TagPairs in phone, too
+	pairs, err := phone.AllTagPairs(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	known := knownRandomTags(pairs)
+	for _, row := range phone.rows {
+		assert.Len(t, row.RandomTags, 8)
+		for _, randtag := range row.RandomTags {
+			assert.True(t, known[randtag], "No TagPair for %s", randtag)
+		}
+	}
+
+	if err := DeleteRows(WithTombstones(phone), nil, []string{"doomed"}); err != nil {
+		t.Fatalf("Error from DeleteRows: %v", err)
+	}
+	if err := SyncRows(laptop, phone); err != nil {
+		t.Fatalf("Error from SyncRows: %v", err)
+	}
+	assert.Equal(t, []string{"kept"}, rowData(t, laptop, "note"))
+	assert.Equal(t, []string{"kept"}, rowData(t, phone, "note"))
+}
+
+func TestTombstoneClockOffset(t *testing.T) {
+	cryptag.SetClockOffset(time.Hour)
+	defer cryptag.SetClockOffset(0)
+
+	bk := newMemBackend(t)
+	mustCreateRow(t, bk, "doomed", "doomed")
+
+	err := WithTombstones(bk).DeleteRows([]string{pairsRandom(t, bk, "doomed")})
+	assert.Nil(t, err)
+
+	stones, err := Tombstones(bk)
+	assert.Nil(t, err)
+	if assert.Len(t, stones, 1) {
+		assert.True(t, stones[0].DeletedAt.After(time.Now().Add(30*time.Minute)),
+			"DeletedAt should include ClockOffset")
+	}
+}
+
+func TestTombstoneBackendFlush(t *testing.T) {
+	fb := &flushingBackend{memBackend: newMemBackend(t)}
+	assert.Nil(t, Flush(WithTombstones(fb)))
+	assert.Equal(t, 1, fb.flushed)
+}
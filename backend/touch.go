@@ -0,0 +1,90 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/rowutil"
+	"github.com/cryptag/cryptag/types"
+)
+
+// TouchRow sets the modified time (see DateModified) of the one Row
+// tagged with all of randtags to now, e.g. to bump it to the top of a
+// list sorted by recency, without changing its data or its other
+// tags.  Like any timestamp tag, the modified time is encrypted.
+func TouchRow(bk Backend, randtags cryptag.RandomTags) error {
+	rows, err := rowsFromRandomTags(bk, randtags)
+	if err != nil {
+		return err
+	}
+	if len(rows) != 1 {
+		return fmt.Errorf("Random tags `%s` matched %d Rows, not 1",
+			strings.Join(randtags, " "), len(rows))
+	}
+	row := rows[0]
+
+	pairs, err := bk.AllTagPairs(nil)
+	if err != nil {
+		return err
+	}
+	if err = row.Populate(bk.RowKey(), pairs); err != nil {
+		return err
+	}
+
+	var plaintags []string
+	for _, plain := range row.PlainTags() {
+		if !strings.HasPrefix(plain, string(DateModified)) {
+			plaintags = append(plaintags, plain)
+		}
+	}
+	plaintags = append(plaintags, string(DateModified)+cryptag.NowStr())
+
+	if err = ReplaceRowTags(bk, randtags, plaintags); err != nil {
+		return err
+	}
+
+	return deleteUnusedModified(bk, pairs, row)
+}
+
+// deleteUnusedModified deletes the TagPairs for the modified:... tags
+// row was tagged with before being touched that no Row is tagged with
+// anymore, so that touching
+// a Row over and over doesn't leave a TagPair behind each time.  Does
+// nothing if bk can't delete TagPairs.
+func deleteUnusedModified(bk Backend, pairs types.TagPairs, row *types.Row) error {
+	var unused types.TagPairs
+	for _, pair := range pairs {
+		if !strings.HasPrefix(pair.Plain(), string(DateModified)) ||
+			!row.HasRandomTag(pair.Random) {
+			continue
+		}
+		rows, err := listRows(bk, []string{pair.Random})
+		if err != nil && err != types.ErrRowsNotFound {
+			return err
+		}
+		if len(rows) == 0 {
+			unused = append(unused, pair)
+		}
+	}
+
+	err := DeleteTagPairs(bk, unused)
+	if err == ErrCannotDeleteTagPairs {
+		return nil
+	}
+	return err
+}
+
+// RowModifiedAt returns when row, whose plaintags must be populated,
+// was last touched (see TouchRow), or, if never, when it was created.
+func RowModifiedAt(row *types.Row) (time.Time, error) {
+	ts := rowutil.TagWithPrefixStripped(row, string(DateModified))
+	if ts == "" {
+		ts = rowutil.TagWithPrefixStripped(row, string(DateCreated))
+	}
+	return cryptag.ParseTimeStr(ts)
+}
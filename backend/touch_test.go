@@ -0,0 +1,89 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cryptag/cryptag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTouchRow(t *testing.T) {
+	mem := newMemBackend(t)
+
+	row := mustCreateRow(t, mem, "old news", "note", "topic:go")
+	mustCreateRow(t, mem, "other", "note")
+
+	var id string
+	for _, plain := range row.PlainTags() {
+		if strings.HasPrefix(plain, "id:") {
+			id = plain
+		}
+	}
+	idRand := pairsRandom(t, mem, id)
+
+	created, err := RowModifiedAt(row)
+	if err != nil {
+		t.Fatalf("Error from RowModifiedAt: %v", err)
+	}
+
+	defer cryptag.SetClockOffset(cryptag.ClockOffset())
+
+	prev := created
+	for i := 1; i <= 2; i++ {
+		cryptag.SetClockOffset(cryptag.ClockOffset() + time.Hour)
+
+		if err = TouchRow(mem, []string{idRand}); err != nil {
+			t.Fatalf("Error from TouchRow: %v", err)
+		}
+
+		rows, err := RowsFromPlainTags(mem, nil, []string{id})
+		if err != nil {
+			t.Fatalf("Error from RowsFromPlainTags: %v", err)
+		}
+		if !assert.Len(t, rows, 1) {
+			return
+		}
+		touched := rows[0]
+
+		modified, err := RowModifiedAt(touched)
+		if err != nil {
+			t.Fatalf("Error from RowModifiedAt: %v", err)
+		}
+		assert.True(t, modified.After(prev), "Modified time didn't advance")
+		prev = modified
+
+		assert.Equal(t, "old news", string(touched.Decrypted()))
+
+		// Same tags, plus one modified:... tag
+		var others []string
+		for _, plain := range touched.PlainTags() {
+			if !strings.HasPrefix(plain, string(DateModified)) {
+				others = append(others, plain)
+			}
+		}
+		orig := append([]string{}, row.PlainTags()...)
+		sort.Strings(orig)
+		sort.Strings(others)
+		assert.Equal(t, orig, others)
+		assert.Len(t, touched.PlainTags(), len(row.PlainTags())+1)
+	}
+
+	// Only the latest modified:... TagPair is kept
+	pairs, err := mem.AllTagPairs(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modifiedPairs := 0
+	for _, pair := range pairs {
+		if strings.HasPrefix(pair.Plain(), string(DateModified)) {
+			modifiedPairs++
+		}
+	}
+	assert.Equal(t, 1, modifiedPairs)
+}
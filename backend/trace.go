@@ -0,0 +1,157 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"log"
+	"time"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+	"golang.org/x/net/context"
+)
+
+type contextKey int
+
+const correlationIDKey contextKey = iota
+
+// WithCorrelationID returns a copy of ctx carrying id, which
+// identifies one logical operation (e.g., one HTTP request) in the
+// log lines and OpEvents of every Backend call made with the returned
+// context (see TracedBackend).
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey, id)
+}
+
+// CorrelationID returns the correlation ID ctx carries (see
+// WithCorrelationID), or "" if it has none.
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey).(string)
+	return id
+}
+
+// OpEvent describes one operation performed through a TracedBackend.
+type OpEvent struct {
+	CorrelationID string
+	Backend       string // Name of the wrapped Backend
+	Op            string // E.g., "SaveRow"
+	Duration      time.Duration
+	Err           error
+}
+
+// TracedBackend wraps a Backend so that each operation that talks to
+// storage is logged (when types.Debug is set) and reported to Hook,
+// if set, tagged with the correlation ID of the TracedBackend's
+// context.  Use WithContext to get a TracedBackend for a given
+// context, e.g. one per request.
+type TracedBackend struct {
+	Backend
+
+	Hook func(*OpEvent)
+
+	ctx context.Context
+}
+
+// Traced wraps bk so that its operations are traced; see
+// TracedBackend.
+func Traced(bk Backend, hook func(*OpEvent)) *TracedBackend {
+	return &TracedBackend{Backend: bk, Hook: hook, ctx: context.Background()}
+}
+
+// WithContext returns a copy of tb whose operations are tagged with
+// the correlation ID ctx carries (see WithCorrelationID).  If the
+// wrapped Backend implements ContextBackend, it's given ctx, too.
+// Implements ContextBackend.
+func (tb *TracedBackend) WithContext(ctx context.Context) Backend {
+	bk := tb.Backend
+	if cbk, ok := bk.(ContextBackend); ok {
+		bk = cbk.WithContext(ctx)
+	}
+	return &TracedBackend{Backend: bk, Hook: tb.Hook, ctx: ctx}
+}
+
+func (tb *TracedBackend) trace(op string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+
+	ev := &OpEvent{
+		CorrelationID: CorrelationID(tb.ctx),
+		Backend:       tb.Backend.Name(),
+		Op:            op,
+		Duration:      time.Since(start),
+		Err:           err,
+	}
+
+	if types.Debug {
+		log.Printf("[%s] %s.%s took %v; err: %v\n", ev.CorrelationID,
+			ev.Backend, ev.Op, ev.Duration, ev.Err)
+	}
+	if tb.Hook != nil {
+		tb.Hook(ev)
+	}
+
+	return err
+}
+
+func (tb *TracedBackend) AllTagPairs(oldPairs types.TagPairs) (pairs types.TagPairs, err error) {
+	err = tb.trace("AllTagPairs", func() error {
+		pairs, err = tb.Backend.AllTagPairs(oldPairs)
+		return err
+	})
+	return pairs, err
+}
+
+func (tb *TracedBackend) TagPairsFromRandomTags(randtags cryptag.RandomTags) (pairs types.TagPairs, err error) {
+	err = tb.trace("TagPairsFromRandomTags", func() error {
+		pairs, err = tb.Backend.TagPairsFromRandomTags(randtags)
+		return err
+	})
+	return pairs, err
+}
+
+func (tb *TracedBackend) SaveTagPair(pair *types.TagPair) error {
+	return tb.trace("SaveTagPair", func() error {
+		return tb.Backend.SaveTagPair(pair)
+	})
+}
+
+func (tb *TracedBackend) ListRows(randtags cryptag.RandomTags) (rows types.Rows, err error) {
+	err = tb.trace("ListRows", func() error {
+		rows, err = tb.Backend.ListRows(randtags)
+		return err
+	})
+	return rows, err
+}
+
+func (tb *TracedBackend) RowsFromRandomTags(randtags cryptag.RandomTags) (rows types.Rows, err error) {
+	err = tb.trace("RowsFromRandomTags", func() error {
+		rows, err = tb.Backend.RowsFromRandomTags(randtags)
+		return err
+	})
+	return rows, err
+}
+
+func (tb *TracedBackend) SaveRow(row *types.Row) error {
+	return tb.trace("SaveRow", func() error {
+		return tb.Backend.SaveRow(row)
+	})
+}
+
+func (tb *TracedBackend) DeleteRows(randtags cryptag.RandomTags) error {
+	return tb.trace("DeleteRows", func() error {
+		return tb.Backend.DeleteRows(randtags)
+	})
+}
+
+func (tb *TracedBackend) Flush() error {
+	return tb.trace("Flush", func() error {
+		return Flush(tb.Backend)
+	})
+}
+
+func (tb *TracedBackend) Warm(queries []cryptag.RandomTags) error {
+	return tb.trace("Warm", func() error {
+		return Warm(tb.Backend, queries)
+	})
+}
@@ -0,0 +1,72 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/cryptag/cryptag/types"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestTracedBackend(t *testing.T) {
+	var mu sync.Mutex
+	var events []*OpEvent
+
+	hook := func(ev *OpEvent) {
+		mu.Lock()
+		events = append(events, ev)
+		mu.Unlock()
+	}
+
+	mem := newMemBackend(t)
+	traced := Traced(mem, hook)
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	types.Debug = true
+	defer func() {
+		types.Debug = false
+		log.SetOutput(os.Stderr)
+	}()
+
+	ctx := WithCorrelationID(context.Background(), "req-123")
+	bk := traced.WithContext(ctx)
+
+	if _, err := CreateRow(bk, nil, []byte("traced"), []string{"note"}); err != nil {
+		t.Fatalf("Error from CreateRow: %v", err)
+	}
+
+	// Other operations aren't tagged with req-123
+	if _, err := traced.AllTagPairs(nil); err != nil {
+		t.Fatalf("Error from AllTagPairs: %v", err)
+	}
+
+	types.Debug = false
+	log.SetOutput(os.Stderr)
+
+	ops := map[string]bool{}
+	for _, ev := range events[:len(events)-1] {
+		assert.Equal(t, "req-123", ev.CorrelationID)
+		assert.Equal(t, mem.Name(), ev.Backend)
+		assert.Nil(t, ev.Err)
+		ops[ev.Op] = true
+	}
+	assert.True(t, ops["AllTagPairs"])
+	assert.True(t, ops["SaveTagPair"])
+	assert.True(t, ops["SaveRow"])
+
+	last := events[len(events)-1]
+	assert.Equal(t, "", last.CorrelationID)
+	assert.Equal(t, "AllTagPairs", last.Op)
+
+	assert.Contains(t, logs.String(), "[req-123] "+mem.Name()+".SaveRow took")
+
+	assert.Equal(t, "", CorrelationID(context.Background()))
+}
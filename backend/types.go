@@ -13,6 +13,7 @@ const (
 	TypeFileSystem    = "filesystem"
 	TypeWebserver     = "webserver"
 	TypeSandstorm     = "sandstorm" // Uses webserver + WebserverBackend code
+	TypeArchive       = "archive"
 )
 
 var (
@@ -34,6 +35,10 @@ func LoadBackend(backendPath, backendName string) (Backend, error) {
 		return nil, err
 	}
 
+	if err = ValidateConfig(conf); err != nil {
+		return nil, err
+	}
+
 	typ := conf.GetType()
 
 	maker, err := GetMaker(typ)
@@ -0,0 +1,99 @@
+// Steve Phillips / elimisteve
+// 2017.04.09
+
+package backend
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// TagRules configures how ValidateTags normalizes and validates
+// plaintags.
+type TagRules struct {
+	// TrimSpace trims leading and trailing whitespace
+	TrimSpace bool
+
+	// CollapseSpace replaces each run of whitespace within a plaintag
+	// with a single space (and trims, too)
+	CollapseSpace bool
+
+	// MaxLength is the maximum length (in bytes, after normalization)
+	// of a plaintag; 0 means no limit
+	MaxLength int
+}
+
+// ValidTagRules are the TagRules that ValidateTags, and therefore
+// PopulateRowBeforeSave (and CreateRow), enforce.  Their whitespace
+// rules are applied to looked-up plaintags, too (see NormalizeTag), so
+// that a query for " foo" finds the Rows saved with "foo".  Plaintags
+// are otherwise binary-safe (see types.TagPair), so only outer
+// whitespace is trimmed by default.
+var ValidTagRules = TagRules{
+	TrimSpace: true,
+	MaxLength: 1024,
+}
+
+// InvalidTag is a plaintag that failed validation, and why.
+type InvalidTag struct {
+	Tag    string
+	Reason string
+}
+
+// InvalidTagsError lists every plaintag that failed validation.
+type InvalidTagsError struct {
+	Tags []InvalidTag
+}
+
+func (e *InvalidTagsError) Error() string {
+	var invalid []string
+	for _, tag := range e.Tags {
+		invalid = append(invalid, fmt.Sprintf("%q (%s)", tag.Tag, tag.Reason))
+	}
+	return "Invalid tag(s): " + strings.Join(invalid, ", ")
+}
+
+// ValidateTags normalizes plaintags according to ValidTagRules,
+// returning the normalized plaintags or an *InvalidTagsError listing
+// every plaintag that is empty (once normalized) or too long.
+func ValidateTags(plaintags []string) ([]string, error) {
+	return ValidTagRules.Validate(plaintags)
+}
+
+// Validate is like ValidateTags, but uses rules instead of
+// ValidTagRules.
+func (rules TagRules) Validate(plaintags []string) ([]string, error) {
+	valid := make([]string, 0, len(plaintags))
+	var invalid []InvalidTag
+
+	for _, plain := range plaintags {
+		tag := rules.normalize(plain)
+
+		switch {
+		case tag == "" && plain == "":
+			invalid = append(invalid, InvalidTag{plain, "empty"})
+		case tag == "":
+			invalid = append(invalid, InvalidTag{plain, "only whitespace"})
+		case rules.MaxLength > 0 && len(tag) > rules.MaxLength:
+			invalid = append(invalid, InvalidTag{plain,
+				fmt.Sprintf("longer than %d bytes", rules.MaxLength)})
+		default:
+			valid = append(valid, tag)
+		}
+	}
+
+	if len(invalid) > 0 {
+		return nil, &InvalidTagsError{Tags: invalid}
+	}
+	return valid, nil
+}
+
+func (rules TagRules) normalize(plain string) string {
+	if rules.CollapseSpace {
+		plain = strings.Join(strings.FieldsFunc(plain, unicode.IsSpace), " ")
+	} else if rules.TrimSpace {
+		plain = strings.TrimSpace(plain)
+	}
+	return plain
+}
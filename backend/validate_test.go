@@ -0,0 +1,93 @@
+// Steve Phillips / elimisteve
+// 2017.04.09
+
+package backend
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateTags(t *testing.T) {
+	valid, err := ValidateTags([]string{"  padded\t", "in  side", "multi\nline"})
+	if err != nil {
+		t.Fatalf("Error from ValidateTags: %v", err)
+	}
+	assert.Equal(t, []string{"padded", "in  side", "multi\nline"}, valid)
+
+	tooLong := strings.Repeat("x", ValidTagRules.MaxLength+1)
+
+	_, err = ValidateTags([]string{"ok", "", " \t\n", tooLong})
+	if err == nil {
+		t.Fatal("Expected error from ValidateTags, got nil")
+	}
+
+	invalid, ok := err.(*InvalidTagsError)
+	if !ok {
+		t.Fatalf("Expected *InvalidTagsError, got %T", err)
+	}
+	assert.Equal(t, []InvalidTag{
+		{"", "empty"},
+		{" \t\n", "only whitespace"},
+		{tooLong, "longer than 1024 bytes"},
+	}, invalid.Tags)
+}
+
+func TestTagRulesValidate(t *testing.T) {
+	rules := TagRules{CollapseSpace: true, MaxLength: 5}
+
+	valid, err := rules.Validate([]string{" a \t b ", "12345"})
+	if err != nil {
+		t.Fatalf("Error from Validate: %v", err)
+	}
+	assert.Equal(t, []string{"a b", "12345"}, valid)
+
+	_, err = rules.Validate([]string{"123456"})
+	assert.NotNil(t, err)
+
+	// No rules, no normalization
+	valid, err = TagRules{}.Validate([]string{" ", " x "})
+	if err != nil {
+		t.Fatalf("Error from Validate: %v", err)
+	}
+	assert.Equal(t, []string{" ", " x "}, valid)
+}
+
+func TestCreateRowInvalidTags(t *testing.T) {
+	bk := newMemBackend(t)
+
+	_, err := CreateRow(bk, nil, []byte("data"), []string{"fine", "  "})
+	if _, ok := err.(*InvalidTagsError); !ok {
+		t.Fatalf("Expected *InvalidTagsError, got %v", err)
+	}
+
+	pairs, _ := bk.AllTagPairs(nil)
+	assert.Equal(t, 0, len(pairs), "No tags should be created for an invalid row")
+
+	row := mustCreateRow(t, bk, "data", " trimmed ")
+	assert.True(t, row.HasPlainTag("trimmed"))
+	assert.Equal(t, []string{"data"}, rowData(t, bk, "trimmed"))
+}
+
+func TestTrimmedTagLookups(t *testing.T) {
+	bk := newMemBackend(t)
+	mustCreateRow(t, bk, "padded", "  padded\t")
+
+	// Queries are trimmed just like saves
+	assert.Equal(t, []string{"padded"}, rowData(t, bk, "padded"))
+	assert.Equal(t, []string{"padded"}, rowData(t, bk, " padded "))
+
+	randtags, unresolved, err := ResolveRandomTags(bk, []string{"padded "})
+	if err != nil {
+		t.Fatalf("Error from ResolveRandomTags: %v", err)
+	}
+	assert.Len(t, randtags, 1)
+	assert.Empty(t, unresolved)
+
+	if err = DeleteRows(bk, nil, []string{"\tpadded"}); err != nil {
+		t.Fatalf("Error from DeleteRows: %v", err)
+	}
+	assert.Nil(t, rowData(t, bk, "padded"))
+}
@@ -0,0 +1,87 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"errors"
+
+	"github.com/cryptag/cryptag/types"
+)
+
+var (
+	ErrWrongKey = errors.New("backend: Key can't decrypt this Backend's" +
+		" existing data; wrong key or passphrase?")
+	ErrNothingToVerify = errors.New("backend: Backend has no data to" +
+		" verify the key against")
+)
+
+// VerifyKey checks that bk's keys can decrypt bk's existing data,
+// e.g. to catch a mistyped passphrase before anything is saved with
+// the key derived from it.  One TagPair is decrypted with bk.TagKey()
+// and, if any Row has that tag, one Row with bk.RowKey().
+//
+// Returns ErrWrongKey if decryption fails, or ErrNothingToVerify if bk
+// has no TagPairs, in which case any key is as good as any other.
+func VerifyKey(bk Backend) error {
+	pairs, _, err := TagPairsPaged(bk, 0, 1)
+	pairs, err = partialTagPairs(pairs, err)
+	if err != nil {
+		if isWrongKey(err) {
+			return ErrWrongKey
+		}
+		return err
+	}
+	if len(pairs) == 0 {
+		return ErrNothingToVerify
+	}
+	pair := pairs[0]
+
+	// Decrypt again, since some Backends just log decryption errors
+	fresh := &types.TagPair{
+		PlainEncrypted: pair.PlainEncrypted,
+		Random:         pair.Random,
+		Nonce:          pair.Nonce,
+	}
+	if err = fresh.Decrypt(bk.TagKey()); err != nil {
+		if types.IsWrongKey(err) {
+			return ErrWrongKey
+		}
+		return err
+	}
+
+	rows, err := RowsFromRandomTagsLimit(bk, []string{pair.Random}, 0, 1)
+	if err == types.ErrRowsNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = rows[0].Decrypt(bk.RowKey()); err != nil {
+		if types.IsWrongKey(err) {
+			return ErrWrongKey
+		}
+		return err
+	}
+
+	return nil
+}
+
+// isWrongKey is like types.IsWrongKey, but also recognizes an
+// *InvalidTagPairsError all of whose TagPairs failed to decrypt
+func isWrongKey(err error) bool {
+	var ierr *InvalidTagPairsError
+	if !errors.As(err, &ierr) {
+		return types.IsWrongKey(err)
+	}
+	if len(ierr.Invalid) == 0 {
+		return false
+	}
+	for _, err := range ierr.Invalid {
+		if !types.IsWrongKey(err) {
+			return false
+		}
+	}
+	return true
+}
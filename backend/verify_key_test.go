@@ -0,0 +1,151 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyKey(t *testing.T) {
+	bk := newMemBackend(t)
+	assert.Equal(t, ErrNothingToVerify, VerifyKey(bk))
+
+	mustCreateRow(t, bk, "data", "tag")
+	assert.Nil(t, VerifyKey(bk))
+
+	key := *bk.key
+	key[0]++
+	bk.key = &key
+	assert.Equal(t, ErrWrongKey, VerifyKey(bk))
+}
+
+func TestVerifyKeyFileSystem(t *testing.T) {
+	fs, cleanup := newTestFileSystem(t)
+	defer cleanup()
+
+	assert.Equal(t, ErrNothingToVerify, VerifyKey(fs))
+
+	mustCreateRow(t, fs, "data", "tag")
+	assert.Nil(t, VerifyKey(fs))
+
+	// Right tag key, wrong row key
+	key := *fs.key
+	fs.tagKey = fs.key
+	key[0]++
+	fs.key = &key
+	assert.Equal(t, ErrWrongKey, VerifyKey(fs))
+
+	// Wrong tag key too
+	fs.tagKey = nil
+	assert.Equal(t, ErrWrongKey, VerifyKey(fs))
+}
+
+// remoteTagPairs returns TagPairs for plaintags encrypted with key, as
+// a remote Backend would store them
+func remoteTagPairs(t *testing.T, key *[32]byte, plaintags ...string) types.TagPairs {
+	var pairs types.TagPairs
+	for _, plain := range plaintags {
+		pair, err := NewTagPair(key, plain)
+		if err != nil {
+			t.Fatalf("Error from NewTagPair: %v", err)
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs
+}
+
+// fakeWebserver serves pairs and no Rows, like a cryptag webserver
+func fakeWebserver(pairs types.TagPairs) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/tags" {
+			json.NewEncoder(w).Encode(pairs)
+			return
+		}
+		w.Write([]byte("[]"))
+	}))
+}
+
+// fakeDropbox serves pairs, one file per TagPair, and no Rows, like
+// Dropbox's API does a DropboxRemote's folder
+func fakeDropbox(pairs types.TagPairs) *httptest.Server {
+	byRandom := map[string]*types.TagPair{}
+	for _, pair := range pairs {
+		byRandom[pair.Random] = pair
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch p := req.URL.Path; {
+		case strings.HasPrefix(p, "/metadata/") && strings.HasSuffix(p, "/tags"):
+			entry := map[string]interface{}{"hash": "h", "is_dir": true}
+			var contents []map[string]string
+			for _, pair := range pairs {
+				contents = append(contents,
+					map[string]string{"path": "/cryptag/tags/" + pair.Random})
+			}
+			entry["contents"] = contents
+			json.NewEncoder(w).Encode(entry)
+		case strings.HasPrefix(p, "/files/"):
+			pair, ok := byRandom[path.Base(p)]
+			if !ok {
+				http.NotFound(w, req)
+				return
+			}
+			json.NewEncoder(w).Encode(pair)
+		default:
+			w.Write([]byte("[]"))
+		}
+	}))
+}
+
+// fakeRemote is a remote Backend type along with a fake of the server
+// it talks to
+type fakeRemote struct {
+	serve func(pairs types.TagPairs) *httptest.Server
+	open  func(t *testing.T, srvURL string, key *[32]byte) Backend
+}
+
+var fakeRemotes = map[string]fakeRemote{
+	"webserver": {fakeWebserver, func(t *testing.T, srvURL string, key *[32]byte) Backend {
+		ws, err := NewWebserverBackend(key[:], "fake", srvURL, "token")
+		if err != nil {
+			t.Fatalf("Error from NewWebserverBackend: %v", err)
+		}
+		return ws
+	}},
+	"dropbox": {fakeDropbox, func(t *testing.T, srvURL string, key *[32]byte) Backend {
+		db, err := NewDropboxRemote(key[:], "fake", DropboxConfig{
+			AppKey: "k", AppSecret: "s", AccessToken: "t",
+			BasePath: "/cryptag",
+		})
+		if err != nil {
+			t.Fatalf("Error from NewDropboxRemote: %v", err)
+		}
+		db.dbox.APIURL, db.dbox.APIContentURL = srvURL, srvURL
+		return db
+	}},
+}
+
+func TestVerifyKeyRemote(t *testing.T) {
+	key, _ := cryptag.RandomKey()
+	wrongKey, _ := cryptag.RandomKey()
+	pairs := remoteTagPairs(t, key, "one", "two")
+
+	for name, remote := range fakeRemotes {
+		srv := remote.serve(pairs)
+
+		assert.Nil(t, VerifyKey(remote.open(t, srv.URL, key)), name)
+		assert.Equal(t, ErrWrongKey, VerifyKey(remote.open(t, srv.URL, wrongKey)), name)
+
+		srv.Close()
+	}
+}
@@ -0,0 +1,61 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import "github.com/cryptag/cryptag"
+
+// Warmer is implemented by Backends that cache (such as
+// QueryCacheBackend and TagCacheBackend), and by wrappers around them.
+// Warm loads TagPairs and the results of queries into cache.
+type Warmer interface {
+	Warm(queries []cryptag.RandomTags) error
+}
+
+// Warm pre-loads bk's caches, if it has any (see Warmer), with its
+// TagPairs and the results of queries, so that the first real request
+// is fast, e.g. before a latency-sensitive session.  For every other
+// Backend, Warm does nothing.
+func Warm(bk Backend, queries []cryptag.RandomTags) error {
+	if w, ok := bk.(Warmer); ok {
+		return w.Warm(queries)
+	}
+	return nil
+}
+
+func (ro *ReadOnlyBackend) Warm(queries []cryptag.RandomTags) error {
+	return Warm(ro.Backend, queries)
+}
+
+// Warm warms sb's Backend with queries limited to sb's scope, as
+// sb's own queries are (see withScope)
+func (sb *scopedBackend) Warm(queries []cryptag.RandomTags) error {
+	scope, err := sb.scopeTag(false)
+	if err != nil {
+		return err
+	}
+	if scope == "" {
+		// Nothing is in scope yet
+		return Warm(sb.Backend, nil)
+	}
+
+	scoped := make([]cryptag.RandomTags, len(queries))
+	for i, randtags := range queries {
+		scoped[i] = withScope(randtags, scope)
+	}
+	return Warm(sb.Backend, scoped)
+}
+
+func (mb *ManifestBackend) Warm(queries []cryptag.RandomTags) error {
+	return Warm(mb.Backend, queries)
+}
+
+func (tb *TimeoutBackend) Warm(queries []cryptag.RandomTags) error {
+	return tb.run(func(bk Backend) error {
+		return Warm(bk, queries)
+	})
+}
+
+func (tb *TombstoneBackend) Warm(queries []cryptag.RandomTags) error {
+	return Warm(tb.Backend, queries)
+}
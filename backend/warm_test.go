@@ -0,0 +1,128 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package backend
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/cryptag/cryptag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWarm(t *testing.T) {
+	counter := &queryCountingBackend{memBackend: newMemBackend(t)}
+	qc := WithQueryCache(counter)
+
+	mustCreateRow(t, qc, "first", "todo")
+	mustCreateRow(t, qc, "second", "todo", "home")
+	todo, home := pairsRandom(t, qc, "todo"), pairsRandom(t, qc, "home")
+
+	queries := []cryptag.RandomTags{{todo}, {home, todo}}
+	if err := Warm(qc, queries); err != nil {
+		t.Fatalf("Error from Warm: %v", err)
+	}
+	counter.queries = 0
+
+	rows, err := qc.RowsFromRandomTags([]string{todo})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, rows, 2)
+
+	rows, err = qc.ListRows([]string{todo, home})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, rows, 1)
+	assert.Nil(t, rows[0].Encrypted)
+
+	assert.Equal(t, 0, counter.queries)
+
+	// No-op for Backends that don't cache
+	assert.Nil(t, Warm(newMemBackend(t), queries))
+}
+
+func TestWarmTagPairCache(t *testing.T) {
+	fs, cleanup := newTestFileSystem(t)
+	defer cleanup()
+
+	counter := &fetchCountingFS{FileSystem: fs}
+	createTags(t, counter, "a", "b")
+
+	tb := WithTagPairCache(counter)
+	if err := Warm(tb, nil); err != nil {
+		t.Fatalf("Error from Warm: %v", err)
+	}
+	assert.Equal(t, 1, counter.all)
+
+	// Only what's new since warming is fetched
+	pairs, err := tb.AllTagPairs(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, pairs, 2)
+	assert.Equal(t, 1, counter.all)
+}
+
+// warmingBackend records the queries passed to Warm
+type warmingBackend struct {
+	*memBackend
+	warmed [][]cryptag.RandomTags
+}
+
+func (wb *warmingBackend) Warm(queries []cryptag.RandomTags) error {
+	wb.warmed = append(wb.warmed, queries)
+	return nil
+}
+
+func TestWarmWrappers(t *testing.T) {
+	wb := &warmingBackend{memBackend: newMemBackend(t)}
+
+	dir, err := ioutil.TempDir("", "cryptag-outbox-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	outbox, err := NewOutbox(wb, dir)
+	if err != nil {
+		t.Fatalf("Error from NewOutbox: %v", err)
+	}
+	quota, err := WithQuota(wb, 1<<20)
+	if err != nil {
+		t.Fatalf("Error from WithQuota: %v", err)
+	}
+
+	wrappers := map[string]Backend{
+		"pool":       WithPool(wb, 1),
+		"traced":     Traced(wb, nil),
+		"split":      Split(newMemBackend(t), wb),
+		"replica":    ReplicaRead(newMemBackend(t), wb),
+		"quota":      quota,
+		"outbox":     outbox,
+		"appendonly": AppendOnly(wb),
+	}
+
+	queries := []cryptag.RandomTags{{"a", "b"}}
+	for name, bk := range wrappers {
+		wb.warmed = nil
+		if err := Warm(bk, queries); err != nil {
+			t.Fatalf("Error from Warm(%s): %v", name, err)
+		}
+		assert.Equal(t, [][]cryptag.RandomTags{queries}, wb.warmed, name)
+	}
+
+	// Scoped Backends warm only their scope
+	scoped := Scoped(wb, "work")
+	mustCreateRow(t, scoped, "in scope", "todo")
+	work := pairsRandom(t, wb, "work")
+
+	wb.warmed = nil
+	if err := Warm(scoped, queries); err != nil {
+		t.Fatalf("Error from Warm: %v", err)
+	}
+	assert.Equal(t, [][]cryptag.RandomTags{{{work, "a", "b"}}}, wb.warmed)
+}
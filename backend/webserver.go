@@ -33,12 +33,18 @@ type WebserverBackend struct {
 
 	bkType string // TypeWebserver or TypeSandstorm
 
-	client *http.Client
-	useTor bool
+	client   *http.Client
+	httpConf *HTTPConfig
+	useTor   bool
 
 	authToken string
 
-	key *[32]byte
+	key    *[32]byte
+	tagKey *[32]byte // Encrypts TagPairs if set; see TagKey
+
+	skewMu    sync.Mutex
+	skew      time.Duration // Server clock minus ours; see ClockSkew
+	skewKnown bool
 }
 
 func NewWebserverBackend(key []byte, serverName, serverBaseUrl, authToken string) (*WebserverBackend, error) {
@@ -69,7 +75,7 @@ func NewWebserverBackend(key []byte, serverName, serverBaseUrl, authToken string
 		tagsUrl:       serverBaseUrl + "/tags",
 		bkType:        TypeWebserver,
 		authToken:     authToken,
-		client:        &http.Client{},
+		client:        HTTPClient(nil),
 	}
 
 	return ws, nil
@@ -115,8 +121,16 @@ func WebserverFromConfig(conf *Config) (*WebserverBackend, error) {
 		return nil, err
 	}
 
-	return NewWebserverBackend((*conf.Key)[:], conf.Name, webConf.BaseURL,
+	ws, err := NewWebserverBackend((*conf.Key)[:], conf.Name, webConf.BaseURL,
 		webConf.AuthToken)
+	if err != nil {
+		return nil, err
+	}
+
+	ws.SetHTTPConfig(conf.HTTP)
+	ws.SetTagKey(conf.TagKey)
+
+	return ws, nil
 }
 
 func (wb *WebserverBackend) ToConfig() (*Config, error) {
@@ -124,9 +138,11 @@ func (wb *WebserverBackend) ToConfig() (*Config, error) {
 		return nil, cryptag.ErrNilKey
 	}
 	c := Config{
-		Name: wb.serverName,
-		Type: wb.bkType,
-		Key:  wb.key,
+		Name:   wb.serverName,
+		Type:   wb.bkType,
+		Key:    wb.key,
+		TagKey: wb.tagKey,
+		HTTP:   wb.httpConf,
 	}
 
 	if wb.bkType == TypeWebserver {
@@ -151,6 +167,14 @@ func (wb *WebserverBackend) SetHTTPClient(client *http.Client) {
 	wb.client = client
 }
 
+// SetHTTPConfig sets wb's HTTP client to the shared client
+// configured by hc (see HTTPClient) and records hc so that it is
+// included in wb.ToConfig().
+func (wb *WebserverBackend) SetHTTPConfig(hc *HTTPConfig) {
+	wb.SetHTTPClient(HTTPClient(hc))
+	wb.httpConf = hc
+}
+
 // UseTor sets wb's HTTP client to one that uses Tor and records that
 // Tor should be used.
 func (wb *WebserverBackend) UseTor() error {
@@ -177,15 +201,84 @@ func (wb *WebserverBackend) Key() *[32]byte {
 	return wb.key
 }
 
-func (wb *WebserverBackend) AllTagPairs(oldPairs types.TagPairs) (types.TagPairs, error) {
-	pairs, err := wb.getTagsFromUrl(wb.tagsUrl)
+// TagKey returns the key that wb's TagPairs are encrypted with, which
+// is wb.Key() unless a separate tag key has been set.
+func (wb *WebserverBackend) TagKey() *[32]byte {
+	if wb.tagKey != nil {
+		return wb.tagKey
+	}
+	return wb.key
+}
+
+// RowKey returns the key that wb's Rows are encrypted with.
+func (wb *WebserverBackend) RowKey() *[32]byte {
+	return wb.key
+}
+
+// SetTagKey sets the key that wb's TagPairs are encrypted with.
+// Implements TagKeySetter.
+func (wb *WebserverBackend) SetTagKey(key *[32]byte) {
+	wb.tagKey = key
+}
+
+// ClockSkew returns how far ahead of the local clock the server's
+// clock is (negative if it's behind), going by the Date header of the
+// most recent response from the server, or of a new request to
+// wb's base URL if there hasn't been one.  Accurate to about a second.
+// Implements ClockSkewer.
+func (wb *WebserverBackend) ClockSkew() (time.Duration, error) {
+	wb.skewMu.Lock()
+	skew, known := wb.skew, wb.skewKnown
+	wb.skewMu.Unlock()
+
+	if known {
+		return skew, nil
+	}
+
+	resp, err := wb.get(wb.serverBaseUrl)
 	if err != nil {
-		return nil, err
+		return 0, err
+	}
+	resp.Body.Close()
+
+	wb.skewMu.Lock()
+	defer wb.skewMu.Unlock()
+
+	if !wb.skewKnown {
+		return 0, ErrNoServerTime
+	}
+	return wb.skew, nil
+}
+
+// recordServerTime records the skew between the server's clock, per
+// resp's Date header, and the local clock, which read sent when the
+// request resp answers was sent.
+func (wb *WebserverBackend) recordServerTime(sent time.Time, resp *http.Response) {
+	serverTime, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return
 	}
-	return pairs, nil
+
+	// Date is truncated to the second and the server set it sometime
+	// between sending and now, so compare against the middle of both
+	local := sent.Add(time.Since(sent) / 2)
+	skew := serverTime.Add(500 * time.Millisecond).Sub(local)
+
+	wb.skewMu.Lock()
+	wb.skew, wb.skewKnown = skew, true
+	wb.skewMu.Unlock()
+}
+
+func (wb *WebserverBackend) AllTagPairs(oldPairs types.TagPairs) (_ types.TagPairs, err error) {
+	defer annotateErr(&err, wb, "AllTagPairs")
+
+	// Valid TagPairs are returned along with an *InvalidTagPairsError
+	return wb.getTagsFromUrl(wb.tagsUrl)
 }
 
-func (wb *WebserverBackend) SaveRow(row *types.Row) error {
+func (wb *WebserverBackend) SaveRow(row *types.Row) (err error) {
+	defer annotateErr(&err, wb, "SaveRow")
+
 	if len(row.Encrypted) == 0 || len(row.RandomTags) == 0 || row.Nonce == nil || *row.Nonce == [24]byte{} {
 		return errors.New("Invalid row; requires Encrypted, RandomTags, Nonce fields")
 	}
@@ -217,7 +310,9 @@ func (wb *WebserverBackend) SaveRow(row *types.Row) error {
 	return nil
 }
 
-func (wb *WebserverBackend) SaveTagPair(pair *types.TagPair) error {
+func (wb *WebserverBackend) SaveTagPair(pair *types.TagPair) (err error) {
+	defer annotateErr(&err, wb, "SaveTagPair")
+
 	pairBytes, err := json.Marshal(pair)
 	if err != nil {
 		return err
@@ -251,26 +346,40 @@ func (wb *WebserverBackend) SaveTagPair(pair *types.TagPair) error {
 	return nil
 }
 
-func (wb *WebserverBackend) TagPairsFromRandomTags(randtags cryptag.RandomTags) (types.TagPairs, error) {
+func (wb *WebserverBackend) TagPairsFromRandomTags(randtags cryptag.RandomTags) (_ types.TagPairs, err error) {
+	defer annotateErr(&err, wb, "TagPairsFromRandomTags")
+
 	if len(randtags) == 0 {
 		return nil, fmt.Errorf("Can't get 0 tags")
 	}
 
 	url := wb.tagsUrl + "?tags=" + strings.Join(randtags, ",")
-	return wb.getTagsFromUrl(url)
+
+	var pairs types.TagPairs
+	if err := wb.getInto(url, &pairs); err != nil {
+		return nil, fmt.Errorf("Error fetching pairs: %v", err)
+	}
+
+	return verifyTagPairs(wb.TagKey(), pairs)
 }
 
-func (wb *WebserverBackend) ListRows(randtags cryptag.RandomTags) (types.Rows, error) {
+func (wb *WebserverBackend) ListRows(randtags cryptag.RandomTags) (_ types.Rows, err error) {
+	defer annotateErr(&err, wb, "ListRows")
+
 	fullURL := wb.rowsUrl + "/list?tags=" + strings.Join(randtags, ",")
 	return wb.getRowsFromUrl(fullURL)
 }
 
-func (wb *WebserverBackend) RowsFromRandomTags(randtags cryptag.RandomTags) (types.Rows, error) {
+func (wb *WebserverBackend) RowsFromRandomTags(randtags cryptag.RandomTags) (_ types.Rows, err error) {
+	defer annotateErr(&err, wb, "RowsFromRandomTags")
+
 	fullURL := wb.rowsUrl + "?tags=" + strings.Join(randtags, ",")
 	return wb.getRowsFromUrl(fullURL)
 }
 
-func (wb *WebserverBackend) DeleteRows(randtags cryptag.RandomTags) error {
+func (wb *WebserverBackend) DeleteRows(randtags cryptag.RandomTags) (err error) {
+	defer annotateErr(&err, wb, "DeleteRows")
+
 	fullURL := wb.rowsUrl + "/delete?tags=" + strings.Join(randtags, ",")
 	resp, err := wb.get(fullURL)
 	if err != nil {
@@ -313,7 +422,8 @@ func (wb *WebserverBackend) getRowsFromUrl(url string) (types.Rows, error) {
 }
 
 // getTagsFromUrl fetches the encrypted tag pairs at url, decrypts
-// them, and unmarshals them into a TagPairs value
+// them, and unmarshals them into a TagPairs value.  Invalid TagPairs
+// are reported as by validTagPairs.
 func (wb *WebserverBackend) getTagsFromUrl(url string) (types.TagPairs, error) {
 	var pairs types.TagPairs
 	var err error
@@ -326,26 +436,35 @@ func (wb *WebserverBackend) getTagsFromUrl(url string) (types.TagPairs, error) {
 		return nil, fmt.Errorf("Error fetching pairs: %v", err)
 	}
 
+	errs := make([]error, len(pairs))
+
 	wg := &sync.WaitGroup{}
 	wg.Add(len(pairs))
 
-	for _, pair := range pairs {
-		go func(pair *types.TagPair) {
-			// TODO: Return first error
-			if err = pair.Decrypt(wb.key); err != nil {
-				log.Printf("Error from pair.Decrypt: %v", err)
-			}
+	for i, pair := range pairs {
+		go func(i int, pair *types.TagPair) {
+			errs[i] = verifyTagPair(wb.TagKey(), pair)
 			wg.Done()
-		}(pair)
+		}(i, pair)
 	}
 
 	wg.Wait()
 
+	valid := make(types.TagPairs, 0, len(pairs))
+	ierr := &InvalidTagPairsError{Invalid: map[string]error{}}
+	for i, pair := range pairs {
+		if errs[i] != nil {
+			ierr.Invalid[pair.Random] = errs[i]
+			continue
+		}
+		valid = append(valid, pair)
+	}
+
 	if types.Debug {
-		log.Printf("getTagsFromUrl: returning %d TagPairs\n", len(pairs))
+		log.Printf("getTagsFromUrl: returning %d TagPairs\n", len(valid))
 	}
 
-	return pairs, nil
+	return validTagPairs(valid, ierr)
 }
 
 func (wb *WebserverBackend) get(url string) (*http.Response, error) {
@@ -360,7 +479,7 @@ func (wb *WebserverBackend) get(url string) (*http.Response, error) {
 	}
 	req.Header.Add("Authorization", "Bearer "+wb.authToken)
 
-	return wb.client.Do(req)
+	return wb.do(req)
 }
 
 func (wb *WebserverBackend) getInto(url string, strct interface{}) error {
@@ -391,7 +510,18 @@ func (wb *WebserverBackend) post(url string, data []byte) (*http.Response, error
 	}
 	req.Header.Add("Authorization", "Bearer "+wb.authToken)
 
-	return wb.client.Do(req)
+	return wb.do(req)
+}
+
+// do sends req, recording the server's clock from the response
+func (wb *WebserverBackend) do(req *http.Request) (*http.Response, error) {
+	sent := time.Now()
+	resp, err := wb.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	wb.recordServerTime(sent, resp)
+	return resp, nil
 }
 
 //
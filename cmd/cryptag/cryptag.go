@@ -331,7 +331,13 @@ func main() {
 			log.Fatal(err)
 		}
 
+		// -a lists system tags, too
+		showSystem := len(osArgs) > 2 && osArgs[2] == "-a"
+
 		for _, pair := range pairs {
+			if !showSystem && backend.IsSystemTag(pair.Plain()) {
+				continue
+			}
 			color.Printf("%s  %s\n", pair.Random, color.BlackOnWhite(pair.Plain()))
 		}
 
@@ -496,6 +502,8 @@ var (
 	allInviteUsage            = strings.Join([]string{createInviteUsage,
 		createInviteOnServerUsage, getInviteOnServerUsage}, "\n")
 
+	tagsUsage = prefix + "tags [-a]"
+
 	getkeyUsage = prefix + "getkey"
 	setkeyUsage = prefix + "setkey <key>"
 
@@ -506,6 +514,7 @@ var (
 		listTextUsage, listFilesUsage, listAnyUsage, "",
 		getTextUsage, getFilesUsage, getAnyUsage, "",
 		deleteTextUsage, deleteFilesUsage, deleteAnyUsage, "",
+		tagsUsage, "",
 		listBackendsUsage, "",
 		setDefaultBackendUsage, "",
 		createInviteUsage, createInviteOnServerUsage, getInviteOnServerUsage, "",
@@ -0,0 +1,90 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package cryptag
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// CryptoEvent describes one call to Encrypt or Decrypt, for
+// CryptoHook.  Calls rejected before any encryption or decryption is
+// attempted (e.g., for a nil key or a truncated ciphertext) aren't
+// reported.
+type CryptoEvent struct {
+	Op       string // "Encrypt" or "Decrypt"
+	Bytes    int    // Length of the plaintext; 0 if decryption failed
+	Duration time.Duration
+	Err      error
+}
+
+// CryptoHook, if set, is called with every CryptoEvent, e.g. to feed
+// them to a metrics system alongside the OpEvents of
+// backend.TracedBackend, which time storage operations (some of which
+// include decryption).  Set it before encrypting or decrypting
+// anything; it may be called from many goroutines at once.
+var CryptoHook func(*CryptoEvent)
+
+// CryptoStats are running totals of the encryption and decryption
+// done by Encrypt and Decrypt, as reported to CryptoHook.
+type CryptoStats struct {
+	EncryptOps   int64
+	EncryptBytes int64
+	EncryptTime  time.Duration
+
+	DecryptOps   int64
+	DecryptBytes int64
+	DecryptTime  time.Duration
+}
+
+var cryptoStats CryptoStats
+
+// ReadCryptoStats returns the CryptoStats accumulated since the
+// program started or ResetCryptoStats was last called.
+func ReadCryptoStats() CryptoStats {
+	return CryptoStats{
+		EncryptOps:   atomic.LoadInt64(&cryptoStats.EncryptOps),
+		EncryptBytes: atomic.LoadInt64(&cryptoStats.EncryptBytes),
+		EncryptTime:  time.Duration(atomic.LoadInt64((*int64)(&cryptoStats.EncryptTime))),
+
+		DecryptOps:   atomic.LoadInt64(&cryptoStats.DecryptOps),
+		DecryptBytes: atomic.LoadInt64(&cryptoStats.DecryptBytes),
+		DecryptTime:  time.Duration(atomic.LoadInt64((*int64)(&cryptoStats.DecryptTime))),
+	}
+}
+
+// ResetCryptoStats zeroes the totals ReadCryptoStats returns.
+func ResetCryptoStats() {
+	for _, n := range []*int64{
+		&cryptoStats.EncryptOps, &cryptoStats.EncryptBytes,
+		(*int64)(&cryptoStats.EncryptTime),
+		&cryptoStats.DecryptOps, &cryptoStats.DecryptBytes,
+		(*int64)(&cryptoStats.DecryptTime),
+	} {
+		atomic.StoreInt64(n, 0)
+	}
+}
+
+func recordCrypto(op string, nbytes int, start time.Time, err error) {
+	ev := &CryptoEvent{
+		Op:       op,
+		Bytes:    nbytes,
+		Duration: time.Since(start),
+		Err:      err,
+	}
+
+	ops, bytes, dur := &cryptoStats.EncryptOps, &cryptoStats.EncryptBytes,
+		(*int64)(&cryptoStats.EncryptTime)
+	if op == "Decrypt" {
+		ops, bytes, dur = &cryptoStats.DecryptOps, &cryptoStats.DecryptBytes,
+			(*int64)(&cryptoStats.DecryptTime)
+	}
+	atomic.AddInt64(ops, 1)
+	atomic.AddInt64(bytes, int64(nbytes))
+	atomic.AddInt64(dur, int64(ev.Duration))
+
+	if CryptoHook != nil {
+		CryptoHook(ev)
+	}
+}
@@ -0,0 +1,66 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package cryptag
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCryptoStats(t *testing.T) {
+	key, err := RandomKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce, err := RandomNonce()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var events []*CryptoEvent
+	CryptoHook = func(ev *CryptoEvent) { events = append(events, ev) }
+	defer func() { CryptoHook = nil }()
+
+	ResetCryptoStats()
+
+	plain := bytes.Repeat([]byte("x"), 1000)
+	cipher, err := Encrypt(plain, nonce, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Encrypt(plain[:24], nonce, key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Decrypt(cipher, nonce, key); err != nil {
+		t.Fatal(err)
+	}
+
+	// Failed decryptions count as operations but not bytes
+	wrong, _ := RandomKey()
+	_, err = Decrypt(cipher, nonce, wrong)
+	assert.Equal(t, ErrDecrypt, err)
+
+	// Rejected before decrypting; not counted at all
+	_, err = Decrypt(cipher[:5], nonce, key)
+	assert.Equal(t, ErrDecryptMalformed, err)
+
+	stats := ReadCryptoStats()
+	assert.Equal(t, int64(2), stats.EncryptOps)
+	assert.Equal(t, int64(1024), stats.EncryptBytes)
+	assert.Equal(t, int64(2), stats.DecryptOps)
+	assert.Equal(t, int64(1000), stats.DecryptBytes)
+
+	if assert.Len(t, events, 4) {
+		assert.Equal(t, "Encrypt", events[0].Op)
+		assert.Equal(t, 1000, events[0].Bytes)
+		assert.Equal(t, "Decrypt", events[2].Op)
+		assert.Equal(t, 1000, events[2].Bytes)
+		assert.Equal(t, ErrDecrypt, events[3].Err)
+	}
+
+	ResetCryptoStats()
+	assert.Equal(t, CryptoStats{}, ReadCryptoStats())
+}
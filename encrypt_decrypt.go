@@ -4,8 +4,12 @@
 package cryptag
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha512"
 	"fmt"
+	"io"
+	"time"
 
 	"golang.org/x/crypto/nacl/secretbox"
 )
@@ -16,7 +20,17 @@ const (
 )
 
 var (
-	ErrDecrypt      = fmt.Errorf("Error decrypting ciphertext")
+	// ErrDecrypt means the ciphertext failed authentication, most
+	// likely because it was encrypted with a different key, though
+	// possibly because it was tampered with
+	ErrDecrypt = fmt.Errorf("Error decrypting ciphertext: authentication" +
+		" failed (wrong key, or ciphertext was tampered with)")
+
+	// ErrDecryptMalformed means the ciphertext is too short to be
+	// valid, e.g. because it was truncated
+	ErrDecryptMalformed = fmt.Errorf("Error decrypting ciphertext: too short" +
+		" to be valid (truncated or corrupt)")
+
 	ErrDecryptEmpty = fmt.Errorf("Error decrypting empty ciphertext")
 	ErrInvalidKey   = fmt.Errorf("Invalid key")
 	ErrNilKey       = fmt.Errorf("Nil key")
@@ -32,10 +46,19 @@ func Encrypt(plain []byte, nonce *[24]byte, key *[32]byte) ([]byte, error) {
 		return nil, ErrNilKey
 	}
 
+	start := time.Now()
 	cipher := secretbox.Seal(nil, plain, nonce, key)
+	recordCrypto("Encrypt", len(plain), start, nil)
+
 	return cipher, nil
 }
 
+// Decrypt decrypts cipher, returning ErrDecryptEmpty if cipher is
+// empty, ErrDecryptMalformed if it's too short to be valid, and
+// ErrDecrypt if it fails authentication (e.g., key is wrong).
+// Ciphertext that is long enough but otherwise garbage can't be told
+// apart from ciphertext encrypted with another key, so yields
+// ErrDecrypt.
 func Decrypt(cipher []byte, nonce *[24]byte, key *[32]byte) ([]byte, error) {
 	if nonce == nil {
 		return nil, ErrNilNonce
@@ -46,14 +69,62 @@ func Decrypt(cipher []byte, nonce *[24]byte, key *[32]byte) ([]byte, error) {
 	if len(cipher) == 0 {
 		return nil, ErrDecryptEmpty
 	}
+	if len(cipher) < secretbox.Overhead {
+		return nil, ErrDecryptMalformed
+	}
 
+	start := time.Now()
 	plain, ok := secretbox.Open(nil, cipher, nonce, key)
 	if !ok {
+		recordCrypto("Decrypt", 0, start, ErrDecrypt)
 		return nil, ErrDecrypt
 	}
+	recordCrypto("Decrypt", len(plain), start, nil)
+
 	return plain, nil
 }
 
+// EncryptDeterministic encrypts plain such that the same plain and
+// key always produce the same ciphertext, which lets an untrusted
+// server test ciphertexts for equality without learning plaintexts.
+// The nonce used, which is derived from plain and key (see
+// DeterministicNonce), is returned so it can be stored alongside the
+// ciphertext like any other nonce.
+//
+// PRIVACY NOTE: this reveals which ciphertexts have equal plaintexts!
+// Only use this where that leak is acceptable (e.g., for tags), never
+// for Row data.
+func EncryptDeterministic(plain []byte, key *[32]byte) (cipher []byte, nonce *[24]byte, err error) {
+	nonce, err = DeterministicNonce(plain, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	cipher, err = Encrypt(plain, nonce, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cipher, nonce, nil
+}
+
+// DeterministicNonce derives a nonce from plain and key using
+// HMAC-SHA512.  Nonces are only reused when plaintexts are, so
+// encrypting with these nonces is only as revealing as described in
+// EncryptDeterministic's privacy note.
+func DeterministicNonce(plain []byte, key *[32]byte) (*[24]byte, error) {
+	if key == nil {
+		return nil, ErrNilKey
+	}
+
+	mac := hmac.New(sha512.New, key[:])
+	mac.Write([]byte("cryptag deterministic nonce\x00"))
+	mac.Write(plain)
+
+	var nonce [validNonceLength]byte
+	copy(nonce[:], mac.Sum(nil))
+
+	return &nonce, nil
+}
+
 func ConvertKey(key []byte) (goodKey *[32]byte, err error) {
 	if len(key) != validKeyLength {
 		return nil, fmt.Errorf("Invalid key; must be of length %d, has length %d",
@@ -85,7 +156,7 @@ func ConvertNonce(nonce []byte) (goodNonce *[24]byte, err error) {
 
 func RandomNonce() (*[24]byte, error) {
 	var b [24]byte
-	_, err := rand.Reader.Read(b[:])
+	_, err := io.ReadFull(rand.Reader, b[:])
 	if err != nil {
 		return nil, err
 	}
@@ -94,7 +165,7 @@ func RandomNonce() (*[24]byte, error) {
 
 func RandomKey() (*[32]byte, error) {
 	var b [32]byte
-	_, err := rand.Reader.Read(b[:])
+	_, err := io.ReadFull(rand.Reader, b[:])
 	if err != nil {
 		return nil, err
 	}
@@ -28,3 +28,48 @@ func TestEncryptDecrypt(t *testing.T) {
 
 	assert.Equal(t, dec, plain, "Decrypted data doesn't match original plaintext")
 }
+
+func TestEncryptDeterministic(t *testing.T) {
+	key, _ := RandomKey()
+	key2, _ := RandomKey()
+
+	enc1, nonce1, err := EncryptDeterministic([]byte("type:file"), key)
+	if err != nil {
+		t.Fatalf("Error encrypting: %v", err)
+	}
+	enc2, nonce2, _ := EncryptDeterministic([]byte("type:file"), key)
+	enc3, _, _ := EncryptDeterministic([]byte("type:text"), key)
+	enc4, _, _ := EncryptDeterministic([]byte("type:file"), key2)
+
+	assert.Equal(t, enc1, enc2, "Equal plaintexts should yield equal ciphertexts")
+	assert.Equal(t, nonce1, nonce2)
+	assert.NotEqual(t, enc1, enc3, "Unequal plaintexts yielded equal ciphertexts")
+	assert.NotEqual(t, enc1, enc4, "Different keys yielded equal ciphertexts")
+
+	dec, err := Decrypt(enc1, nonce1, key)
+	if err != nil {
+		t.Fatalf("Error decrypting: %v", err)
+	}
+	assert.Equal(t, []byte("type:file"), dec)
+}
+
+func TestDecryptErrors(t *testing.T) {
+	plain := []byte("Encrypted with one key, decrypted with another")
+	nonce, _ := RandomNonce()
+	key, _ := RandomKey()
+	wrongKey, _ := RandomKey()
+
+	enc, err := Encrypt(plain, nonce, key)
+	if err != nil {
+		t.Fatalf("Error encrypting: %v", err)
+	}
+
+	_, err = Decrypt(enc, nonce, wrongKey)
+	assert.Equal(t, ErrDecrypt, err)
+
+	_, err = Decrypt(enc[:10], nonce, key)
+	assert.Equal(t, ErrDecryptMalformed, err)
+
+	_, err = Decrypt(nil, nonce, key)
+	assert.Equal(t, ErrDecryptEmpty, err)
+}
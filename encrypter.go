@@ -0,0 +1,159 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package cryptag
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+)
+
+// Encrypter is an authenticated encryption algorithm, identified by a
+// version byte that Seal stores along with the nonce and ciphertext,
+// so that data sealed with different Encrypters can coexist and each
+// be opened with the right one.  Each Encrypter declares its own nonce
+// size.
+type Encrypter interface {
+	// Version identifies the algorithm in sealed data; see
+	// RegisterEncrypter
+	Version() byte
+
+	NonceSize() int
+
+	// Encrypt and Decrypt are given nonces of NonceSize() bytes.
+	// Decrypt returns ErrDecrypt if cipher fails authentication.
+	Encrypt(plain, nonce []byte, key *[32]byte) ([]byte, error)
+	Decrypt(cipher, nonce []byte, key *[32]byte) ([]byte, error)
+}
+
+// SecretboxEncrypter is the Encrypter for NaCl's secretbox
+// (XSalsa20-Poly1305), which Encrypt and Decrypt use; its version is
+// 1 and its nonces are 24 bytes long.
+type SecretboxEncrypter struct{}
+
+func (SecretboxEncrypter) Version() byte {
+	return 1
+}
+
+func (SecretboxEncrypter) NonceSize() int {
+	return validNonceLength
+}
+
+func (SecretboxEncrypter) Encrypt(plain, nonce []byte, key *[32]byte) ([]byte, error) {
+	n, err := ConvertNonce(nonce)
+	if err != nil {
+		return nil, err
+	}
+	return Encrypt(plain, n, key)
+}
+
+func (SecretboxEncrypter) Decrypt(cipher, nonce []byte, key *[32]byte) ([]byte, error) {
+	n, err := ConvertNonce(nonce)
+	if err != nil {
+		return nil, err
+	}
+	return Decrypt(cipher, n, key)
+}
+
+// DefaultEncrypter is what Seal uses, and what Rows' data is
+// encrypted with (see types.Row.EncryptPlaintext).
+var DefaultEncrypter Encrypter = SecretboxEncrypter{}
+
+var (
+	encryptersMu sync.RWMutex
+	encrypters   = map[byte]Encrypter{
+		SecretboxEncrypter{}.Version(): SecretboxEncrypter{},
+	}
+)
+
+// RegisterEncrypter makes data sealed with enc openable by Open.
+// Returns an error if an Encrypter of a different type already has
+// enc's version; registering the same type again is a no-op.
+func RegisterEncrypter(enc Encrypter) error {
+	encryptersMu.Lock()
+	defer encryptersMu.Unlock()
+
+	// Compare types rather than values, which may not be comparable
+	existing, ok := encrypters[enc.Version()]
+	if ok && reflect.TypeOf(existing) != reflect.TypeOf(enc) {
+		return fmt.Errorf("Encrypter version %d is already registered",
+			enc.Version())
+	}
+	if !ok {
+		encrypters[enc.Version()] = enc
+	}
+	return nil
+}
+
+// EncrypterByVersion returns the registered Encrypter with the given
+// version.
+func EncrypterByVersion(version byte) (Encrypter, error) {
+	encryptersMu.RLock()
+	defer encryptersMu.RUnlock()
+
+	enc, ok := encrypters[version]
+	if !ok {
+		return nil, fmt.Errorf("Unknown encrypter version %d", version)
+	}
+	return enc, nil
+}
+
+// RandomNonceFor returns a random nonce of the size enc uses.
+func RandomNonceFor(enc Encrypter) ([]byte, error) {
+	nonce := make([]byte, enc.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return nonce, nil
+}
+
+// Seal encrypts plain with DefaultEncrypter and a random nonce; see
+// SealWith.
+func Seal(plain []byte, key *[32]byte) ([]byte, error) {
+	return SealWith(DefaultEncrypter, plain, key)
+}
+
+// SealWith encrypts plain with enc and a random nonce of enc's size,
+// returning enc's version byte, then the nonce, then the ciphertext,
+// all of which Open needs to decrypt it.
+func SealWith(enc Encrypter, plain []byte, key *[32]byte) ([]byte, error) {
+	nonce, err := RandomNonceFor(enc)
+	if err != nil {
+		return nil, err
+	}
+
+	cipher, err := enc.Encrypt(plain, nonce, key)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := make([]byte, 0, 1+len(nonce)+len(cipher))
+	sealed = append(sealed, enc.Version())
+	sealed = append(sealed, nonce...)
+	sealed = append(sealed, cipher...)
+
+	return sealed, nil
+}
+
+// Open decrypts data returned by Seal or SealWith, using the
+// registered Encrypter its version byte names.
+func Open(sealed []byte, key *[32]byte) ([]byte, error) {
+	if len(sealed) == 0 {
+		return nil, ErrDecryptEmpty
+	}
+
+	enc, err := EncrypterByVersion(sealed[0])
+	if err != nil {
+		return nil, err
+	}
+
+	rest := sealed[1:]
+	if len(rest) < enc.NonceSize() {
+		return nil, ErrDecryptMalformed
+	}
+
+	return enc.Decrypt(rest[enc.NonceSize():], rest[:enc.NonceSize()], key)
+}
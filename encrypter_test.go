@@ -0,0 +1,123 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package cryptag
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// gcmEncrypter is AES-256-GCM, whose nonces are 12 bytes long rather
+// than secretbox's 24
+type gcmEncrypter struct{}
+
+func (gcmEncrypter) Version() byte  { return 200 }
+func (gcmEncrypter) NonceSize() int { return 12 }
+
+func (gcmEncrypter) aead(key *[32]byte) (cipher.AEAD, error) {
+	if key == nil {
+		return nil, ErrNilKey
+	}
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (g gcmEncrypter) Encrypt(plain, nonce []byte, key *[32]byte) ([]byte, error) {
+	aead, err := g.aead(key)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nil, nonce, plain, nil), nil
+}
+
+func (g gcmEncrypter) Decrypt(cipher, nonce []byte, key *[32]byte) ([]byte, error) {
+	aead, err := g.aead(key)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, nonce, cipher, nil)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plain, nil
+}
+
+func TestSealOpenEncrypters(t *testing.T) {
+	if err := RegisterEncrypter(gcmEncrypter{}); err != nil {
+		t.Fatalf("Error from RegisterEncrypter: %v", err)
+	}
+
+	key, _ := RandomKey()
+	plain := []byte("sealed twice")
+
+	old, err := Seal(plain, key)
+	if err != nil {
+		t.Fatalf("Error from Seal: %v", err)
+	}
+	sealed, err := SealWith(gcmEncrypter{}, plain, key)
+	if err != nil {
+		t.Fatalf("Error from SealWith: %v", err)
+	}
+
+	// Each stores its own version and size of nonce
+	assert.Equal(t, SecretboxEncrypter{}.Version(), old[0])
+	assert.Equal(t, gcmEncrypter{}.Version(), sealed[0])
+	assert.Equal(t, 1+24+len(plain)+16, len(old))
+	assert.Equal(t, 1+12+len(plain)+16, len(sealed))
+
+	// ...so both can be opened side by side
+	for _, s := range [][]byte{old, sealed} {
+		dec, err := Open(s, key)
+		if err != nil {
+			t.Fatalf("Error from Open: %v", err)
+		}
+		assert.Equal(t, plain, dec)
+	}
+
+	other, _ := RandomKey()
+	_, err = Open(sealed, other)
+	assert.Equal(t, ErrDecrypt, err)
+
+	_, err = Open(sealed[:5], key)
+	assert.Equal(t, ErrDecryptMalformed, err)
+
+	_, err = Open(append([]byte{99}, sealed[1:]...), key)
+	assert.NotNil(t, err)
+
+	// Versions can't be taken over
+	assert.NotNil(t, RegisterEncrypter(otherEncrypter{gcmEncrypter{}}))
+}
+
+type otherEncrypter struct {
+	gcmEncrypter
+}
+
+// unhashableEncrypter can't be compared with ==
+type unhashableEncrypter struct {
+	gcmEncrypter
+	pad []byte
+}
+
+func (unhashableEncrypter) Version() byte { return 201 }
+
+func TestRegisterEncrypterUncomparable(t *testing.T) {
+	assert.Nil(t, RegisterEncrypter(unhashableEncrypter{pad: []byte{1}}))
+	assert.Nil(t, RegisterEncrypter(unhashableEncrypter{pad: []byte{2}}))
+}
+
+func TestRandomNonceFor(t *testing.T) {
+	nonce, err := RandomNonceFor(gcmEncrypter{})
+	assert.Nil(t, err)
+	assert.Len(t, nonce, 12)
+
+	nonce, err = RandomNonceFor(DefaultEncrypter)
+	assert.Nil(t, err)
+	assert.Len(t, nonce, 24)
+}
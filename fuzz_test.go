@@ -0,0 +1,68 @@
+// Steve Phillips / elimisteve
+// 2017.04.15
+
+package cryptag
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func FuzzEncryptDecrypt(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte("hello"))
+	f.Add([]byte("nul\x00byte"))
+	f.Add([]byte("invalid-utf8:\xff\xfe"))
+	f.Add([]byte(strings.Repeat("huge", 1<<18)))
+
+	key, _ := RandomKey()
+
+	f.Fuzz(func(t *testing.T, plain []byte) {
+		nonce, err := RandomNonce()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cipher, err := Encrypt(plain, nonce, key)
+		if err != nil {
+			t.Fatalf("Error from Encrypt: %v", err)
+		}
+
+		dec, err := Decrypt(cipher, nonce, key)
+		if err != nil {
+			t.Fatalf("Error from Decrypt: %v", err)
+		}
+		if !bytes.Equal(plain, dec) {
+			t.Fatalf("Round trip failed: %q != %q", plain, dec)
+		}
+
+		cipher, nonce, err = EncryptDeterministic(plain, key)
+		if err != nil {
+			t.Fatalf("Error from EncryptDeterministic: %v", err)
+		}
+		dec, err = Decrypt(cipher, nonce, key)
+		if err != nil || !bytes.Equal(plain, dec) {
+			t.Fatalf("Deterministic round trip failed: %q != %q (%v)", plain,
+				dec, err)
+		}
+	})
+}
+
+// Decrypting garbage must fail cleanly, never panic
+func FuzzDecrypt(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{0})
+	f.Add(bytes.Repeat([]byte{0xff}, 15))
+	f.Add(bytes.Repeat([]byte{0xff}, 16))
+	f.Add(bytes.Repeat([]byte{0xff}, 1024))
+
+	key, _ := RandomKey()
+	nonce, _ := RandomNonce()
+
+	f.Fuzz(func(t *testing.T, cipher []byte) {
+		if _, err := Decrypt(cipher, nonce, key); err == nil {
+			t.Fatalf("Decrypted garbage `%x`", cipher)
+		}
+	})
+}
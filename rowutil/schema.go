@@ -0,0 +1,143 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package rowutil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/types"
+)
+
+var (
+	ErrNotStruct = errors.New("rowutil: Value must be a struct or pointer to one")
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// MarshalRow returns a new Row (see types.NewRow) whose data is v, a
+// struct, JSON-encoded, and which is tagged with plaintags plus the
+// tags derived from v's fields (see FieldTags).  E.g., if Task has a
+// field Project with the struct tag `cryptag:"project"`, then
+// MarshalRow(&Task{Project: "cryptag"}, "type:task") returns a Row
+// tagged with "type:task" and "project:cryptag".
+func MarshalRow(v interface{}, plaintags ...string) (*types.Row, error) {
+	fieldTags, err := FieldTags(v)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return types.NewRow(data, append(append([]string{}, plaintags...),
+		fieldTags...))
+}
+
+// UnmarshalRow JSON-decodes row's (decrypted) data into v, undoing
+// MarshalRow.
+func UnmarshalRow(row *types.Row, v interface{}) error {
+	if err := json.Unmarshal(row.Decrypted(), v); err != nil {
+		return fmt.Errorf("Error parsing row data: %v", err)
+	}
+	return nil
+}
+
+// FieldTags returns a "key:value" plaintag for each field of v, a
+// struct, with a `cryptag:"key"` struct tag.  Fields may be strings,
+// bools, numbers, time.Times (formatted with cryptag.TimeStr, in UTC),
+// or slices of those, which yield one tag per element.  Empty strings
+// and zero times yield no tag; neither do other zero values (false, 0)
+// if the struct tag includes ",omitempty".  Tagging an unexported
+// field, which MarshalRow wouldn't encode, is an error.
+func FieldTags(v interface{}) ([]string, error) {
+	val := reflect.ValueOf(v)
+	for val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return nil, ErrNotStruct
+		}
+		val = val.Elem()
+	}
+	if val.Kind() != reflect.Struct {
+		return nil, ErrNotStruct
+	}
+
+	var plaintags []string
+
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+
+		key, opts := parseFieldTag(field.Tag.Get("cryptag"))
+		if key == "" || key == "-" {
+			continue
+		}
+		if field.PkgPath != "" {
+			return nil, fmt.Errorf("Error tagging field %s: unexported"+
+				" fields can't be tagged", field.Name)
+		}
+		omitEmpty := strings.Contains(opts, "omitempty")
+
+		elems := []reflect.Value{val.Field(i)}
+		if f := val.Field(i); f.Kind() == reflect.Slice {
+			elems = make([]reflect.Value, f.Len())
+			for j := range elems {
+				elems[j] = f.Index(j)
+			}
+		}
+
+		for _, elem := range elems {
+			value, zero, err := fieldValue(elem)
+			if err != nil {
+				return nil, fmt.Errorf("Error tagging field %s: %v",
+					field.Name, err)
+			}
+			if value == "" || (zero && omitEmpty) {
+				continue
+			}
+			plaintags = append(plaintags, key+":"+value)
+		}
+	}
+
+	return plaintags, nil
+}
+
+func parseFieldTag(tag string) (key, opts string) {
+	if i := strings.Index(tag, ","); i != -1 {
+		return tag[:i], tag[i+1:]
+	}
+	return tag, ""
+}
+
+// fieldValue returns field's value formatted for use in a tag ("" for
+// zero times), and whether it's the zero value of its type
+func fieldValue(field reflect.Value) (value string, zero bool, err error) {
+	if field.Type() == timeType {
+		t := field.Interface().(time.Time)
+		if t.IsZero() {
+			return "", true, nil
+		}
+		return cryptag.TimeStr(t.UTC()), false, nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		return field.String(), field.String() == "", nil
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16,
+		reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		zero = field.Interface() == reflect.Zero(field.Type()).Interface()
+		return fmt.Sprint(field.Interface()), zero, nil
+	}
+
+	return "", false, fmt.Errorf("can't make tag from value of type %s",
+		field.Type())
+}
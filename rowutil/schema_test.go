@@ -0,0 +1,92 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package rowutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type task struct {
+	Title    string    `json:"title"`
+	Body     string    `json:"body"`
+	Project  string    `json:"project" cryptag:"project"`
+	Due      time.Time `json:"due" cryptag:"due,omitempty"`
+	Priority int       `json:"priority" cryptag:"priority"`
+	Labels   []string  `json:"labels" cryptag:"label"`
+	Done     bool      `json:"done" cryptag:"done,omitempty"`
+	Ignored  string    `json:"ignored" cryptag:"-"`
+}
+
+func TestMarshalRow(t *testing.T) {
+	due := time.Date(2017, 5, 1, 9, 30, 0, 0, time.UTC)
+
+	orig := &task{
+		Title:    "Ship it",
+		Body:     "Ship the typed layer",
+		Project:  "cryptag",
+		Due:      due,
+		Priority: 2,
+		Labels:   []string{"work", "urgent"},
+		Ignored:  "not a tag",
+	}
+
+	row, err := MarshalRow(orig, "type:task")
+	if err != nil {
+		t.Fatalf("Error from MarshalRow: %v", err)
+	}
+
+	assert.True(t, row.HasPlainTag("type:task"))
+	assert.True(t, row.HasPlainTag("project:cryptag"))
+	assert.True(t, row.HasPlainTag("due:20170501093000000000000"))
+	assert.True(t, row.HasPlainTag("priority:2"))
+	assert.True(t, row.HasPlainTag("label:work"))
+	assert.True(t, row.HasPlainTag("label:urgent"))
+
+	// Omitted when empty
+	assert.Equal(t, []string(nil), TagsWithPrefix(row, "done:"))
+	assert.Equal(t, []string(nil), TagsWithPrefix(row, "Ignored:"))
+
+	var decoded task
+	if err = UnmarshalRow(row, &decoded); err != nil {
+		t.Fatalf("Error from UnmarshalRow: %v", err)
+	}
+	assert.Equal(t, *orig, decoded)
+
+	// Zero values are tagged unless omitempty, but empty strings and
+	// times never are
+	row, _ = MarshalRow(task{Done: true})
+	assert.True(t, row.HasPlainTag("done:true"))
+	assert.True(t, row.HasPlainTag("priority:0"))
+	assert.Equal(t, []string(nil), TagsWithPrefix(row, "project:"))
+	assert.Equal(t, []string(nil), TagsWithPrefix(row, "due:"))
+}
+
+func TestFieldTagsErrors(t *testing.T) {
+	_, err := FieldTags("not a struct")
+	assert.Equal(t, ErrNotStruct, err)
+
+	_, err = FieldTags((*task)(nil))
+	assert.Equal(t, ErrNotStruct, err)
+
+	type nested struct {
+		Task task `cryptag:"task"`
+	}
+	_, err = FieldTags(nested{})
+	assert.NotNil(t, err)
+}
+
+func TestFieldTagsUnexported(t *testing.T) {
+	type secret struct {
+		Name  string `cryptag:"name"`
+		token string `cryptag:"token"`
+	}
+	_, err := FieldTags(secret{Name: "n", token: "t"})
+	assert.NotNil(t, err)
+
+	_, err = MarshalRow(&secret{Name: "n", token: "t"})
+	assert.NotNil(t, err)
+}
@@ -472,6 +472,49 @@ func main() {
 		api.WriteJSONB(w, rowsB)
 	}
 
+	// StreamRows is like GetRows, but streams Rows as JSON Lines (see
+	// backend.ServeRows) rather than buffering them all
+	StreamRows := func(w http.ResponseWriter, req *http.Request) {
+		db, handledReq := getBackend(bkStore, w, req)
+		if handledReq {
+			return
+		}
+
+		plaintags, handledReq := parsePlaintags(w, req)
+		if handledReq {
+			return
+		}
+
+		newPairs, err := db.AllTagPairs(pairs.Get(db))
+		if err != nil {
+			api.WriteError(w, err.Error())
+			return
+		}
+		pairs.Set(db, newPairs)
+
+		matches, err := newPairs.WithAllPlainTags(plaintags)
+		if err != nil {
+			api.WriteErrorStatus(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		sw := &streamWriter{ResponseWriter: w}
+		sw.Header().Set("Content-Type", "application/x-ndjson")
+
+		err = backend.ServeRows(db, matches.AllRandom(), sw)
+		if err != nil && !sw.wrote {
+			if err == types.ErrRowsNotFound {
+				api.WriteErrorStatus(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			api.WriteError(w, err.Error())
+			return
+		}
+		if err != nil {
+			log.Printf("Error streaming rows: %v\n", err)
+		}
+	}
+
 	GetTags := func(w http.ResponseWriter, req *http.Request) {
 		db, handledReq := getBackend(bkStore, w, req)
 		if handledReq {
@@ -583,6 +626,7 @@ func main() {
 	r.HandleFunc("/trusted/rows/get", GetRows).Methods("POST")
 	r.HandleFunc("/trusted/rows/get/versioned", GetRows).Methods("POST")
 	r.HandleFunc("/trusted/rows/get/versioned/latest", GetRows).Methods("POST")
+	r.HandleFunc("/trusted/rows/get/stream", StreamRows).Methods("POST")
 	r.HandleFunc("/trusted/rows", CreateRow).Methods("POST")
 	r.HandleFunc("/trusted/rows/string", CreateRow).Methods("POST")
 	r.HandleFunc("/trusted/rows/file", CreateFileRow).Methods("POST")
@@ -676,6 +720,24 @@ func parsePlaintags(w http.ResponseWriter, req *http.Request) (plaintags []strin
 	return creq.PlainTags, false
 }
 
+// streamWriter records whether anything has been written to the
+// response, after which an error status can no longer be sent
+type streamWriter struct {
+	http.ResponseWriter
+	wrote bool
+}
+
+func (sw *streamWriter) Write(b []byte) (int, error) {
+	sw.wrote = true
+	return sw.ResponseWriter.Write(b)
+}
+
+func (sw *streamWriter) Flush() {
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 type Request struct {
 	PlainTags []string `json:"plaintags"`
 }
@@ -878,7 +940,10 @@ func fetchRowsFromPlainTags(fetcher func(backend.Backend, types.TagPairs, crypta
 		return rows, nil
 	}
 
-	if match, _ := regexp.MatchString("(?:Random|Plain)Tag `[a-z0-9]+?` not found", err.Error()); match {
+	// PlainTags can contain any characters (colons, slashes, unicode,
+	// even newlines), so don't assume anything about what's between
+	// the backticks
+	if match, _ := regexp.MatchString("(?s)(?:Random|Plain)Tag `.*` not found", err.Error()); match {
 		if err = pairStore.Update(bk); err != nil {
 			return nil, fmt.Errorf("Error re-fetching TagPairs: %v", err)
 		}
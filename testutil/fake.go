@@ -0,0 +1,205 @@
+// Steve Phillips / elimisteve
+// 2017.04.14
+
+// Package testutil contains helpers for testing code that uses
+// cryptag, most notably FakeBackend.
+package testutil
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cryptag/cryptag"
+	"github.com/cryptag/cryptag/backend"
+	"github.com/cryptag/cryptag/types"
+	"github.com/elimisteve/fun"
+)
+
+var (
+	ErrInjected = errors.New("testutil: injected error")
+)
+
+// FakeBackend is a backend.MemoryBackend with knobs for latency,
+// error injection, and TagPair ordering.  Like a real Backend, it
+// stores only ciphertexts, nonces, and random tags, so everything read
+// from it must be decrypted.
+//
+// Set the exported fields before using a FakeBackend concurrently.
+//
+// *FakeBackend implements quick.Generator, so testing/quick can
+// generate FakeBackends with random knobs.
+type FakeBackend struct {
+	*backend.MemoryBackend
+
+	// Latency is how long each method sleeps before doing anything
+	Latency time.Duration
+
+	// Fail, if set, is called at the start of each method with the
+	// method's name (e.g., "SaveTagPair"); if it returns an error, the
+	// method returns that error instead of doing anything.
+	Fail func(method string) error
+
+	// OrderPairs, if set, reorders the TagPairs AllTagPairs returns
+	OrderPairs func(pairs types.TagPairs)
+}
+
+var fakeCount int32
+
+// NewFakeBackend returns an empty FakeBackend that encrypts with key,
+// or a new random key if key is nil.
+func NewFakeBackend(key *[32]byte) (*FakeBackend, error) {
+	// Unique names so that caches keyed by name don't collide
+	n := atomic.AddInt32(&fakeCount, 1)
+
+	mem, err := backend.NewMemoryBackend(fmt.Sprintf("fake%d", n), key)
+	if err != nil {
+		return nil, err
+	}
+	return &FakeBackend{MemoryBackend: mem}, nil
+}
+
+// FailMethods returns a FakeBackend.Fail func that makes each of
+// methods always return err.
+func FailMethods(err error, methods ...string) func(method string) error {
+	return func(method string) error {
+		if fun.SliceContains(methods, method) {
+			return err
+		}
+		return nil
+	}
+}
+
+// FailRandomly returns a FakeBackend.Fail func that makes each call to
+// each of methods (or to any method, if none are given) return
+// ErrInjected with probability rate, using r as its source of
+// randomness.
+func FailRandomly(r *rand.Rand, rate float64, methods ...string) func(method string) error {
+	var mu sync.Mutex
+	return func(method string) error {
+		if len(methods) > 0 && !fun.SliceContains(methods, method) {
+			return nil
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Float64() < rate {
+			return ErrInjected
+		}
+		return nil
+	}
+}
+
+// ShufflePairs returns a FakeBackend.OrderPairs func that shuffles
+// TagPairs using r as its source of randomness.
+func ShufflePairs(r *rand.Rand) func(pairs types.TagPairs) {
+	var mu sync.Mutex
+	return func(pairs types.TagPairs) {
+		mu.Lock()
+		defer mu.Unlock()
+		for i := len(pairs) - 1; i > 0; i-- {
+			j := r.Intn(i + 1)
+			pairs[i], pairs[j] = pairs[j], pairs[i]
+		}
+	}
+}
+
+// ReversePairs is a FakeBackend.OrderPairs func that returns TagPairs
+// newest first.
+func ReversePairs(pairs types.TagPairs) {
+	for i, j := 0, len(pairs)-1; i < j; i, j = i+1, j-1 {
+		pairs[i], pairs[j] = pairs[j], pairs[i]
+	}
+}
+
+// Generate implements quick.Generator, returning a *FakeBackend that
+// fails randomly (at a random rate below 50%) and shuffles TagPairs.
+func (fb *FakeBackend) Generate(r *rand.Rand, size int) reflect.Value {
+	gen, err := NewFakeBackend(nil)
+	if err != nil {
+		panic(err)
+	}
+
+	seeded := rand.New(rand.NewSource(r.Int63()))
+	gen.Fail = FailRandomly(seeded, r.Float64()/2)
+	gen.OrderPairs = ShufflePairs(rand.New(rand.NewSource(r.Int63())))
+
+	return reflect.ValueOf(gen)
+}
+
+func (fb *FakeBackend) before(method string) error {
+	if fb.Latency > 0 {
+		time.Sleep(fb.Latency)
+	}
+	if fb.Fail != nil {
+		return fb.Fail(method)
+	}
+	return nil
+}
+
+func (fb *FakeBackend) AllTagPairs(oldPairs types.TagPairs) (types.TagPairs, error) {
+	if err := fb.before("AllTagPairs"); err != nil {
+		return nil, err
+	}
+
+	pairs, err := fb.MemoryBackend.AllTagPairs(oldPairs)
+	if err != nil {
+		return nil, err
+	}
+	if fb.OrderPairs != nil {
+		fb.OrderPairs(pairs)
+	}
+	return pairs, nil
+}
+
+func (fb *FakeBackend) TagPairsFromRandomTags(randtags cryptag.RandomTags) (types.TagPairs, error) {
+	if err := fb.before("TagPairsFromRandomTags"); err != nil {
+		return nil, err
+	}
+	return fb.MemoryBackend.TagPairsFromRandomTags(randtags)
+}
+
+func (fb *FakeBackend) SaveTagPair(pair *types.TagPair) error {
+	if err := fb.before("SaveTagPair"); err != nil {
+		return err
+	}
+	return fb.MemoryBackend.SaveTagPair(pair)
+}
+
+func (fb *FakeBackend) DeleteTagPair(random string) error {
+	if err := fb.before("DeleteTagPair"); err != nil {
+		return err
+	}
+	return fb.MemoryBackend.DeleteTagPair(random)
+}
+
+func (fb *FakeBackend) ListRows(randtags cryptag.RandomTags) (types.Rows, error) {
+	if err := fb.before("ListRows"); err != nil {
+		return nil, err
+	}
+	return fb.MemoryBackend.ListRows(randtags)
+}
+
+func (fb *FakeBackend) RowsFromRandomTags(randtags cryptag.RandomTags) (types.Rows, error) {
+	if err := fb.before("RowsFromRandomTags"); err != nil {
+		return nil, err
+	}
+	return fb.MemoryBackend.RowsFromRandomTags(randtags)
+}
+
+func (fb *FakeBackend) SaveRow(row *types.Row) error {
+	if err := fb.before("SaveRow"); err != nil {
+		return err
+	}
+	return fb.MemoryBackend.SaveRow(row)
+}
+
+func (fb *FakeBackend) DeleteRows(randtags cryptag.RandomTags) error {
+	if err := fb.before("DeleteRows"); err != nil {
+		return err
+	}
+	return fb.MemoryBackend.DeleteRows(randtags)
+}
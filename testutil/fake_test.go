@@ -0,0 +1,93 @@
+// Steve Phillips / elimisteve
+// 2017.04.14
+
+package testutil
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"testing/quick"
+
+	"github.com/cryptag/cryptag/backend"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ backend.Backend = &FakeBackend{}
+
+func TestCreateTagsFromPlainAllSavesFail(t *testing.T) {
+	fb, _ := NewFakeBackend(nil)
+	fb.Fail = FailMethods(ErrInjected, "SaveTagPair")
+
+	newPairs, err := backend.CreateTagsFromPlain(fb, []string{"a", "b", "c"}, nil)
+	if err != nil {
+		t.Fatalf("Error from CreateTagsFromPlain: %v", err)
+	}
+	assert.Equal(t, 0, len(newPairs))
+	assert.Equal(t, 0, fb.Pairs())
+}
+
+// CreateTagsFromPlain should only return TagPairs that were actually
+// saved, in the order their plaintags were given, no matter which
+// saves fail or how the Backend orders its TagPairs
+func TestCreateTagsFromPlainInjectedFailures(t *testing.T) {
+	property := func(fb *FakeBackend, tags []uint8) bool {
+		var plaintags []string
+		for _, tag := range tags {
+			plaintags = append(plaintags, fmt.Sprintf("tag%d", tag%16))
+		}
+
+		newPairs, err := backend.CreateTagsFromPlain(fb, plaintags, nil)
+		if err != nil {
+			return false
+		}
+
+		// Failures are only injected into saves from here on
+		fb.Fail = FailMethods(ErrInjected, "SaveTagPair")
+
+		stored, err := fb.AllTagPairs(nil)
+		if err != nil || len(stored) != len(newPairs) {
+			return false
+		}
+
+		last := -1
+		for _, pair := range newPairs {
+			if _, err := stored.WithAllRandomTags([]string{pair.Random}); err != nil {
+				return false
+			}
+			// Preserves order and doesn't duplicate
+			i := indexOf(plaintags, pair.Plain())
+			if i <= last {
+				return false
+			}
+			last = i
+		}
+		return true
+	}
+
+	cfg := &quick.Config{Rand: rand.New(rand.NewSource(1))}
+	if err := quick.Check(property, cfg); err != nil {
+		t.Error(err)
+	}
+}
+
+func indexOf(strs []string, s string) int {
+	for i := range strs {
+		if strs[i] == s {
+			return i
+		}
+	}
+	return -1
+}
+
+func ExampleFailMethods() {
+	fb, _ := NewFakeBackend(nil)
+	fb.Fail = FailMethods(ErrInjected, "SaveRow")
+
+	_, err := backend.CreateRow(fb, nil, []byte("data"), []string{"example"})
+	fmt.Println(err)
+	fmt.Println(fb.Rows(), "rows saved")
+	// Output:
+	// testutil: injected error
+	// 0 rows saved
+}
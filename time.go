@@ -5,11 +5,30 @@ package cryptag
 
 import (
 	"fmt"
+	"sync/atomic"
 	"time"
 )
 
+// clockOffset is the time.Duration added to the local clock by Now;
+// only accessed atomically
+var clockOffset int64
+
+// ClockOffset returns what Now adds to the local clock; see
+// SetClockOffset.
+func ClockOffset() time.Duration {
+	return time.Duration(atomic.LoadInt64(&clockOffset))
+}
+
+// SetClockOffset sets what Now adds to the local clock, e.g. to
+// correct for a local clock that disagrees with a server's; see
+// backend.SyncClock.  The offset is process-wide, not per Backend.
+func SetClockOffset(offset time.Duration) {
+	atomic.StoreInt64(&clockOffset, int64(offset))
+}
+
+// Now returns the current time in UTC, adjusted by ClockOffset.
 func Now() time.Time {
-	return time.Now().UTC()
+	return time.Now().Add(ClockOffset()).UTC()
 }
 
 func NowStr() string {
@@ -22,3 +41,12 @@ func TimeStr(t time.Time) string {
 	nano := t.Nanosecond()
 	return fmt.Sprintf("%d%02d%02d%02d%02d%02d%09d", y, m, d, hr, min, sec, nano)
 }
+
+// ParseTimeStr parses a timestamp returned by TimeStr (with or without
+// its trailing 9 digits of nanoseconds).
+func ParseTimeStr(s string) (time.Time, error) {
+	if len(s) > 14 {
+		return time.Parse("20060102150405.000000000", s[:14]+"."+s[14:])
+	}
+	return time.Parse("20060102150405", s)
+}
@@ -0,0 +1,30 @@
+// Steve Phillips / elimisteve
+// 2017.04.12
+
+package cryptag
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTimeStr(t *testing.T) {
+	now := Now()
+
+	parsed, err := ParseTimeStr(TimeStr(now))
+	if err != nil {
+		t.Fatalf("Error from ParseTimeStr: %v", err)
+	}
+	assert.True(t, now.Equal(parsed), "%v != %v", now, parsed)
+
+	parsed, err = ParseTimeStr("20170412093000")
+	if err != nil {
+		t.Fatalf("Error from ParseTimeStr: %v", err)
+	}
+	assert.Equal(t, time.Date(2017, 4, 12, 9, 30, 0, 0, time.UTC), parsed)
+
+	_, err = ParseTimeStr("yesterday")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,45 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package types
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"strings"
+)
+
+// DecoyTagPrefix begins the plaintag of each decoy's TagPair.  Decoys
+// added by backend.PadTagsTo get TagPairs like any other random tag,
+// so that a Backend can't pick them out as the random tags with no
+// TagPair; populating a Row leaves their plaintags out.
+const DecoyTagPrefix = "system:decoy:"
+
+// IsDecoyPlainTag reports whether plain is the plaintag of a decoy's
+// TagPair (see DecoyTagPrefix)
+func IsDecoyPlainTag(plain string) bool {
+	return strings.HasPrefix(plain, DecoyTagPrefix)
+}
+
+// decoyTagBits is how many leading bits of a decoy tag's MAC (see
+// IsDecoyTag) are zero.  Each bit doubles the work of finding a decoy
+// tag and halves the odds of a random tag passing for one.
+const decoyTagBits = 12
+
+// IsDecoyTag reports whether randtag is a decoy with no TagPair, as
+// backend.PadTagsTo added to Rows before decoys got TagPairs of their
+// own (see DecoyTagPrefix).  These decoys look like any other random
+// tag to those without key, but the leading decoyTagBits bits of
+// their HMAC-SHA256 under key are zero.
+func IsDecoyTag(key *[32]byte, randtag string) bool {
+	mac := hmac.New(sha256.New, key[:])
+	mac.Write([]byte("decoy:" + randtag))
+	sum := mac.Sum(nil)
+
+	for bit := 0; bit < decoyTagBits; bit++ {
+		if sum[bit/8]&(0x80>>uint(bit%8)) != 0 {
+			return false
+		}
+	}
+	return true
+}
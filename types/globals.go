@@ -7,6 +7,17 @@ import "os"
 
 var (
 	Debug = false
+
+	// PopulateWorkers is the maximum number of Rows that
+	// Rows.Populate decrypts concurrently; 0 means
+	// runtime.GOMAXPROCS(0).
+	PopulateWorkers = 0
+
+	// RequireBoundTags makes Row.Decrypt reject Rows whose data isn't
+	// bound to their random tags (see Row.Plaintext), i.e., those
+	// saved before binding was introduced, which a malicious Backend
+	// could otherwise swap for one another undetected.
+	RequireBoundTags = false
 )
 
 func init() {
@@ -0,0 +1,42 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package types
+
+import "sync"
+
+// A ProgressFunc is called as a long-running operation makes progress,
+// with how many items are done out of how many in total (-1 if the
+// total isn't known, e.g. while streaming).  Calls are never made
+// concurrently, and done never decreases from one call to the next.
+type ProgressFunc func(done, total int)
+
+// Progress counts the items a long-running operation has done,
+// reporting each increase to a ProgressFunc.  Safe for concurrent use.
+type Progress struct {
+	mu    sync.Mutex
+	fn    ProgressFunc
+	done  int
+	total int
+}
+
+// NewProgress returns a Progress that reports to fn (which may be
+// nil), out of total items (-1 if unknown).
+func NewProgress(fn ProgressFunc, total int) *Progress {
+	return &Progress{fn: fn, total: total}
+}
+
+// Add records that n more items are done.
+func (p *Progress) Add(n int) {
+	if p == nil || p.fn == nil {
+		return
+	}
+
+	// Hold the lock while calling p.fn so that calls are serialized
+	// and each sees a larger done than the last
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.done += n
+	p.fn(p.done, p.total)
+}
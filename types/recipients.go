@@ -0,0 +1,318 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package types
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/cryptag/cryptag"
+	"golang.org/x/crypto/nacl/box"
+)
+
+var (
+	ErrNotRecipient = errors.New("Not a recipient of this row")
+	ErrNoDataKey    = errors.New("Row's data key unknown; seal the row or" +
+		" open it as a recipient first")
+	ErrNoRecipients = errors.New("Row must have at least one recipient")
+
+	ErrRecipientsTampered = errors.New("Row's recipient list has been" +
+		" tampered with")
+)
+
+// recipientEnvelope is what row.Encrypted contains once row is sealed
+// for recipients (see SealForRecipients): row's plaintext encrypted
+// with a random data key, plus that data key encrypted to each
+// recipient's public key, keyed by recipient key ID (see
+// RecipientKeyID).  MAC authenticates the recipient list with the
+// data key, so that whoever can write row can't choose who
+// RemoveRecipient re-encrypts it for.
+type recipientEnvelope struct {
+	Recipients map[string]*wrappedKey `json:"recipients"`
+	Body       []byte                 `json:"body"`
+	MAC        []byte                 `json:"mac"`
+}
+
+// wrappedKey is a Row's data key encrypted to one recipient's public
+// key, using a one-time (ephemeral) sender key pair
+type wrappedKey struct {
+	PublicKey    *[32]byte `json:"public_key"`
+	EphemeralKey *[32]byte `json:"ephemeral_key"`
+	Nonce        *[24]byte `json:"nonce"`
+	Key          []byte    `json:"key"`
+}
+
+// RecipientKeyID returns the ID that recipients of sealed Rows are
+// listed by: the hex-encoded first 8 bytes of the SHA-256 of pubkey.
+func RecipientKeyID(pubkey *[32]byte) string {
+	sum := sha256.Sum256(pubkey[:])
+	return hex.EncodeToString(sum[:8])
+}
+
+// SealForRecipients encrypts row's plaintext (see Plaintext) with a
+// new, random data key, which is then encrypted to each of pubkeys
+// (NaCl box public keys), and stores the result in row.Encrypted, so
+// that each recipient can decrypt row with OpenAsRecipient.  Sealed
+// Rows are saved like any other; only their contents differ, so call
+// this after backend.PopulateRowBeforeSave, which sets row.Encrypted
+// too.
+func (row *Row) SealForRecipients(pubkeys ...*[32]byte) error {
+	if len(pubkeys) == 0 {
+		return ErrNoRecipients
+	}
+
+	recipients := make(map[string]*[32]byte, len(pubkeys))
+	for _, pub := range pubkeys {
+		recipients[RecipientKeyID(pub)] = pub
+	}
+
+	return row.seal(recipients)
+}
+
+// seal (re-)encrypts row's plaintext with a new data key for each of
+// recipients
+func (row *Row) seal(recipients map[string]*[32]byte) error {
+	if row.Nonce == nil {
+		return cryptag.ErrNilNonce
+	}
+
+	dataKey, err := cryptag.RandomKey()
+	if err != nil {
+		return err
+	}
+
+	plain, err := row.Plaintext()
+	if err != nil {
+		return err
+	}
+
+	body, err := cryptag.Encrypt(plain, row.Nonce, dataKey)
+	if err != nil {
+		return err
+	}
+
+	env := &recipientEnvelope{
+		Recipients: make(map[string]*wrappedKey, len(recipients)),
+		Body:       body,
+	}
+	for id, pub := range recipients {
+		if env.Recipients[id], err = wrapKey(dataKey, pub); err != nil {
+			return err
+		}
+	}
+	env.MAC = env.recipientsMAC(dataKey)
+
+	if err = row.setEnvelope(env); err != nil {
+		return err
+	}
+	row.dataKey = dataKey
+
+	return nil
+}
+
+// AddRecipient lets the owner of pubkey decrypt row, too, without
+// re-encrypting row for its other recipients.  row must have been
+// sealed (see SealForRecipients) or opened (see OpenAsRecipient)
+// first, so that its data key is known.
+func (row *Row) AddRecipient(pubkey *[32]byte) error {
+	if row.dataKey == nil {
+		return ErrNoDataKey
+	}
+
+	env, err := row.verifiedEnvelope(row.dataKey)
+	if err != nil {
+		return err
+	}
+
+	wrapped, err := wrapKey(row.dataKey, pubkey)
+	if err != nil {
+		return err
+	}
+	env.Recipients[RecipientKeyID(pubkey)] = wrapped
+	env.MAC = env.recipientsMAC(row.dataKey)
+
+	return row.setEnvelope(env)
+}
+
+// RemoveRecipient revokes the access of the owner of pubkey to row.
+// Since they may have kept row's data key, row is re-encrypted with a
+// new data key, which only row's remaining recipients are given.  row
+// must have been sealed or opened first, so that its plaintext is
+// known.  Returns ErrRecipientsTampered if row's recipient list
+// wasn't written by one of its recipients.
+func (row *Row) RemoveRecipient(pubkey *[32]byte) error {
+	if row.dataKey == nil {
+		return ErrNoDataKey
+	}
+
+	env, err := row.verifiedEnvelope(row.dataKey)
+	if err != nil {
+		return err
+	}
+
+	id := RecipientKeyID(pubkey)
+	if _, ok := env.Recipients[id]; !ok {
+		return ErrNotRecipient
+	}
+	if len(env.Recipients) == 1 {
+		return ErrNoRecipients
+	}
+
+	remaining := make(map[string]*[32]byte, len(env.Recipients)-1)
+	for rid, wrapped := range env.Recipients {
+		if rid != id {
+			remaining[rid] = wrapped.PublicKey
+		}
+	}
+
+	return row.seal(remaining)
+}
+
+// Recipients returns the key IDs (see RecipientKeyID) of everyone row
+// is sealed for, sorted.
+func (row *Row) Recipients() ([]string, error) {
+	env, err := row.envelope()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(env.Recipients))
+	for id := range env.Recipients {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids, nil
+}
+
+// OpenAsRecipient decrypts row, which was sealed for recipients (see
+// SealForRecipients), using the recipient key pair pubkey, privkey.
+// Returns ErrNotRecipient if row isn't sealed for pubkey, and
+// ErrRecipientsTampered if its recipient list has been altered by
+// someone other than a recipient.
+func (row *Row) OpenAsRecipient(pubkey, privkey *[32]byte) error {
+	env, err := row.envelope()
+	if err != nil {
+		return err
+	}
+
+	wrapped, ok := env.Recipients[RecipientKeyID(pubkey)]
+	if !ok {
+		return ErrNotRecipient
+	}
+
+	key, ok := box.Open(nil, wrapped.Key, wrapped.Nonce, wrapped.EphemeralKey,
+		privkey)
+	if !ok {
+		return &DecryptError{What: "row data key", Err: cryptag.ErrDecrypt}
+	}
+	dataKey, err := cryptag.ConvertKey(key)
+	if err != nil {
+		return err
+	}
+
+	if !env.verify(dataKey) {
+		return ErrRecipientsTampered
+	}
+
+	plain, err := cryptag.Decrypt(env.Body, row.Nonce, dataKey)
+	if err != nil {
+		return &DecryptError{What: "row", Err: err}
+	}
+
+	if err = row.setPlaintext(plain); err != nil {
+		return err
+	}
+	row.dataKey = dataKey
+
+	return nil
+}
+
+func (row *Row) envelope() (*recipientEnvelope, error) {
+	var env recipientEnvelope
+	if err := json.Unmarshal(row.Encrypted, &env); err != nil || env.Recipients == nil {
+		return nil, fmt.Errorf("Row isn't sealed for recipients")
+	}
+	return &env, nil
+}
+
+// verifiedEnvelope returns row's envelope once its recipient list has
+// been authenticated with dataKey
+func (row *Row) verifiedEnvelope(dataKey *[32]byte) (*recipientEnvelope, error) {
+	env, err := row.envelope()
+	if err != nil {
+		return nil, err
+	}
+	if !env.verify(dataKey) {
+		return nil, ErrRecipientsTampered
+	}
+	return env, nil
+}
+
+// recipientsMAC returns the HMAC-SHA256, keyed by dataKey, of env's
+// recipients' key IDs and public keys, sorted by key ID
+func (env *recipientEnvelope) recipientsMAC(dataKey *[32]byte) []byte {
+	ids := make([]string, 0, len(env.Recipients))
+	for id := range env.Recipients {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	mac := hmac.New(sha256.New, dataKey[:])
+	mac.Write([]byte("cryptag recipients\x00"))
+	for _, id := range ids {
+		mac.Write([]byte(id))
+		if pub := env.Recipients[id].PublicKey; pub != nil {
+			mac.Write(pub[:])
+		}
+	}
+	return mac.Sum(nil)
+}
+
+// verify reports whether env's recipient list is authentic, i.e., was
+// MACed with dataKey and lists each recipient under its own key ID
+func (env *recipientEnvelope) verify(dataKey *[32]byte) bool {
+	for id, wrapped := range env.Recipients {
+		if wrapped == nil || wrapped.PublicKey == nil ||
+			RecipientKeyID(wrapped.PublicKey) != id {
+			return false
+		}
+	}
+	return hmac.Equal(env.MAC, env.recipientsMAC(dataKey))
+}
+
+func (row *Row) setEnvelope(env *recipientEnvelope) error {
+	b, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	row.Encrypted = b
+	return nil
+}
+
+// wrapKey encrypts dataKey to pubkey with a new ephemeral key pair
+func wrapKey(dataKey, pubkey *[32]byte) (*wrappedKey, error) {
+	ephPub, ephPriv, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := cryptag.RandomNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	return &wrappedKey{
+		PublicKey:    pubkey,
+		EphemeralKey: ephPub,
+		Nonce:        nonce,
+		Key:          box.Seal(nil, dataKey[:], nonce, pubkey, ephPriv),
+	}, nil
+}
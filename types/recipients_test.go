@@ -0,0 +1,148 @@
+// Steve Phillips / elimisteve
+// 2017.04.18
+
+package types
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/cryptag/cryptag"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/nacl/box"
+)
+
+type keypair struct {
+	pub, priv *[32]byte
+}
+
+func newKeypair(t *testing.T) keypair {
+	pub, priv, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key pair: %v", err)
+	}
+	return keypair{pub, priv}
+}
+
+// fetched returns a copy of row as a Backend would return it
+func fetched(row *Row) *Row {
+	return &Row{Encrypted: row.Encrypted, RandomTags: row.RandomTags,
+		Nonce: row.Nonce}
+}
+
+func TestRowRecipients(t *testing.T) {
+	alice, bob, carol := newKeypair(t), newKeypair(t), newKeypair(t)
+
+	row, _ := NewRow([]byte("for your eyes only"), []string{"secret"})
+	if err := row.SealForRecipients(alice.pub, bob.pub, carol.pub); err != nil {
+		t.Fatalf("Error from SealForRecipients: %v", err)
+	}
+
+	ids, _ := row.Recipients()
+	assert.Equal(t, 3, len(ids))
+	assert.Contains(t, ids, RecipientKeyID(bob.pub))
+
+	for _, kp := range []keypair{alice, bob, carol} {
+		r := fetched(row)
+		if err := r.OpenAsRecipient(kp.pub, kp.priv); err != nil {
+			t.Fatalf("Error from OpenAsRecipient: %v", err)
+		}
+		assert.Equal(t, "for your eyes only", string(r.Decrypted()))
+	}
+
+	// Bob remembers the data key
+	bobs := fetched(row)
+	bobs.OpenAsRecipient(bob.pub, bob.priv)
+	oldKey := bobs.dataKey
+
+	// Alice revokes Bob's access
+	alices := fetched(row)
+	alices.OpenAsRecipient(alice.pub, alice.priv)
+	if err := alices.RemoveRecipient(bob.pub); err != nil {
+		t.Fatalf("Error from RemoveRecipient: %v", err)
+	}
+
+	r := fetched(alices)
+	assert.Equal(t, ErrNotRecipient, r.OpenAsRecipient(bob.pub, bob.priv))
+
+	env, _ := alices.envelope()
+	_, err := cryptag.Decrypt(env.Body, alices.Nonce, oldKey)
+	assert.Equal(t, cryptag.ErrDecrypt, err, "Old data key still works")
+
+	for _, kp := range []keypair{alice, carol} {
+		r := fetched(alices)
+		if err := r.OpenAsRecipient(kp.pub, kp.priv); err != nil {
+			t.Fatalf("Error opening after revocation: %v", err)
+		}
+		assert.Equal(t, "for your eyes only", string(r.Decrypted()))
+	}
+
+	// Carol re-adds Bob
+	carols := fetched(alices)
+	carols.OpenAsRecipient(carol.pub, carol.priv)
+	if err := carols.AddRecipient(bob.pub); err != nil {
+		t.Fatalf("Error from AddRecipient: %v", err)
+	}
+	r = fetched(carols)
+	assert.Nil(t, r.OpenAsRecipient(bob.pub, bob.priv))
+	assert.Equal(t, "for your eyes only", string(r.Decrypted()))
+
+	// Can't add recipients without the data key
+	assert.Equal(t, ErrNoDataKey, fetched(carols).AddRecipient(alice.pub))
+}
+
+func TestRemoveRecipientTamperedEnvelope(t *testing.T) {
+	alice, bob, mallory := newKeypair(t), newKeypair(t), newKeypair(t)
+
+	row, _ := NewRow([]byte("for your eyes only"), []string{"secret"})
+	if err := row.SealForRecipients(alice.pub, bob.pub); err != nil {
+		t.Fatalf("Error from SealForRecipients: %v", err)
+	}
+
+	// Whoever can write the row swaps Mallory in for Bob, hoping
+	// Alice re-encrypts for Mallory once she removes someone
+	tampered := fetched(row)
+	env, _ := tampered.envelope()
+	bobID := RecipientKeyID(bob.pub)
+	env.Recipients[bobID].PublicKey = mallory.pub
+	env.Recipients[RecipientKeyID(mallory.pub)] = env.Recipients[bobID]
+	delete(env.Recipients, bobID)
+	tampered.setEnvelope(env)
+
+	r := fetched(tampered)
+	assert.Equal(t, ErrRecipientsTampered, r.OpenAsRecipient(alice.pub, alice.priv))
+
+	// Nor can an already-opened row be re-sealed from a tampered list
+	alices := fetched(row)
+	if err := alices.OpenAsRecipient(alice.pub, alice.priv); err != nil {
+		t.Fatalf("Error from OpenAsRecipient: %v", err)
+	}
+	alices.Encrypted = tampered.Encrypted
+	assert.Equal(t, ErrRecipientsTampered, alices.RemoveRecipient(alice.pub))
+	assert.Equal(t, ErrRecipientsTampered, alices.AddRecipient(mallory.pub))
+}
+
+func TestPopulateSealedRow(t *testing.T) {
+	key, _ := cryptag.RandomKey()
+	alice := newKeypair(t)
+
+	_, pairs := encryptedRows(t, key, 0, 0)
+
+	row, _ := NewRow([]byte("for your eyes only"), []string{"all"})
+	row.RandomTags = []string{pairs[0].Random}
+	if err := row.SealForRecipients(alice.pub); err != nil {
+		t.Fatalf("Error from SealForRecipients: %v", err)
+	}
+
+	assert.Equal(t, ErrNoDataKey, fetched(row).Populate(key, pairs))
+
+	r := fetched(row)
+	if err := r.OpenAsRecipient(alice.pub, alice.priv); err != nil {
+		t.Fatalf("Error from OpenAsRecipient: %v", err)
+	}
+	if err := r.Populate(key, pairs); err != nil {
+		t.Fatalf("Error populating opened row: %v", err)
+	}
+	assert.Equal(t, "for your eyes only", string(r.Decrypted()))
+	assert.Equal(t, []string{"all"}, r.PlainTags())
+}
@@ -4,10 +4,15 @@
 package types
 
 import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"sort"
+	"strings"
 
 	"github.com/cryptag/cryptag"
 	"github.com/elimisteve/fun"
@@ -40,12 +45,91 @@ type Row struct {
 	decrypted []byte
 	plainTags []string
 	Nonce     *[24]byte `json:"nonce"`
+
+	// EncryptedSummary is the encrypted summary (e.g., title) of this
+	// Row, if it has one.  Backends that implement
+	// backend.SummaryLister store it separately from the Row's data,
+	// so that list views can fetch and decrypt it alone.  It has its
+	// own nonce, SummaryNonce.
+	EncryptedSummary []byte    `json:"summary,omitempty"`
+	SummaryNonce     *[24]byte `json:"summary_nonce,omitempty"`
+	summary          []byte
+
+	// Random tags of the id:... tags of the Rows this Row references;
+	// see SetReferences
+	references []string
+
+	// Key row's data is encrypted with, if row is sealed for
+	// recipients; see SealForRecipients
+	dataKey *[32]byte
+
+	// SkipAllTag keeps this Row from being tagged with the "all" tag
+	// (see backend.AllTag) when it is saved, so that it can only be
+	// found by its other tags
+	SkipAllTag bool `json:"-"`
 }
 
 var (
 	ErrRowsNotFound = errors.New("No rows found")
+
+	ErrTagsMismatch = errors.New("Row's data was encrypted for a Row with" +
+		" different random tags; the Backend may have substituted it")
+	ErrTagsNotBound = errors.New("Row's data isn't bound to its random" +
+		" tags, but RequireBoundTags is set")
 )
 
+// DecryptError is returned when a Row or TagPair can't be decrypted.
+// Err is the error from cryptag.Decrypt, so callers can tell a wrong
+// key (cryptag.ErrDecrypt) from corrupt data
+// (cryptag.ErrDecryptMalformed).
+type DecryptError struct {
+	What string // What couldn't be decrypted
+	Err  error
+}
+
+func (e *DecryptError) Error() string {
+	return fmt.Sprintf("Error decrypting %s: %v", e.What, e.Err)
+}
+
+// IsWrongKey answers the question, "did decryption fail because the
+// wrong key was used (or the ciphertext was tampered with)?"  err may
+// be a *DecryptError or a *RowsError whose every error is one, or an
+// error wrapping either.
+func IsWrongKey(err error) bool {
+	return decryptCause(err) == cryptag.ErrDecrypt
+}
+
+// IsCorrupt answers the question, "did decryption fail because the
+// ciphertext is truncated or otherwise malformed?"
+func IsCorrupt(err error) bool {
+	return decryptCause(err) == cryptag.ErrDecryptMalformed
+}
+
+func decryptCause(err error) error {
+	switch e := err.(type) {
+	case *DecryptError:
+		return e.Err
+	case *RowsError:
+		var cause error
+		for _, err := range e.Errs {
+			if err == nil {
+				continue
+			}
+			c := decryptCause(err)
+			if cause != nil && c != cause {
+				return nil
+			}
+			cause = c
+		}
+		return cause
+	}
+	if inner := errors.Unwrap(err); inner != nil {
+		// E.g., a Backend's error wrapping a *DecryptError
+		return decryptCause(inner)
+	}
+	return nil
+}
+
 // NewRow returns a *Row containing/tagged with the passed-in
 // plainTags, in addition to a unique ID tag ("id:..."), a timestamp
 // tag ("created:created:20170105092731"), and the "all" tag.  The
@@ -79,7 +163,8 @@ func NewRow(decrypted []byte, plainTags []string) (*Row, error) {
 
 	// TODO(elimisteve): Randomize plainTags[1:len(plainTags)-1] here
 
-	row := &Row{decrypted: decrypted, plainTags: plainTags, Nonce: nonce}
+	row := &Row{decrypted: emptyIfNil(decrypted), plainTags: plainTags,
+		Nonce: nonce}
 
 	return row, nil
 }
@@ -92,7 +177,8 @@ func NewRowSimple(decrypted []byte, plainTags []string) (*Row, error) {
 		return nil, err
 	}
 
-	row := &Row{decrypted: decrypted, plainTags: plainTags, Nonce: nonce}
+	row := &Row{decrypted: emptyIfNil(decrypted), plainTags: plainTags,
+		Nonce: nonce}
 
 	return row, nil
 }
@@ -111,16 +197,109 @@ func NewRowFromBytes(b []byte) (*Row, error) {
 }
 
 // Decrypted returns row.decrypted, row's (unexported) decrypted data (if any).
+// Rows with an empty body (e.g., tag-only markers) have empty,
+// non-nil data once created or decrypted; nil means row's data hasn't
+// been fetched or decrypted.
 func (row *Row) Decrypted() []byte {
 	return row.decrypted
 }
 
+// emptyIfNil returns b, or an empty slice if b is nil
+func emptyIfNil(b []byte) []byte {
+	if b == nil {
+		return []byte{}
+	}
+	return b
+}
+
+// Summary returns row's (unexported) decrypted summary, if any.
+func (row *Row) Summary() []byte {
+	return row.summary
+}
+
+// SetSummary sets row's summary, which is encrypted (by
+// backend.PopulateRowBeforeSave) separately from row's data.
+func (row *Row) SetSummary(summary []byte) {
+	row.summary = summary
+}
+
+// DecryptSummary sets row's summary based upon row.EncryptedSummary,
+// if row has one.
+func (row *Row) DecryptSummary(key *[32]byte) error {
+	if len(row.EncryptedSummary) == 0 {
+		return nil
+	}
+
+	dec, err := cryptag.Decrypt(row.EncryptedSummary, row.SummaryNonce, key)
+	if err != nil {
+		return &DecryptError{What: "row summary", Err: err}
+	}
+
+	row.summary = dec
+
+	return nil
+}
+
+// AppendDecrypted appends data to row's decrypted data (e.g., a
+// segment appended to row with backend.AppendToRow).  row.Encrypted
+// is left untouched.
+func (row *Row) AppendDecrypted(data []byte) {
+	row.decrypted = append(row.decrypted, data...)
+}
+
 // PlainTags returns row.plaintags, row's (unexported) plain
 // (human-entered, human-readable) tags.
 func (row *Row) PlainTags() []string {
 	return row.plainTags
 }
 
+// Equal answers the question, "do row and other have the same
+// decrypted data and the same plaintags (in any order)?"  Everything
+// that differs between copies of a Row -- random tags, nonces,
+// ciphertexts -- is ignored, as are references and summaries, so
+// copies in different Backends are Equal once populated.
+//
+// If either Row isn't populated (has no decrypted data or no
+// plaintags), there's nothing to compare but what's stored, so Rows
+// are Equal only if they have the same (non-empty) ciphertext and
+// random tags (in any order), i.e., are the same stored Row.
+func (row *Row) Equal(other *Row) bool {
+	if row == nil || other == nil {
+		return row == other
+	}
+	if !row.populated() || !other.populated() {
+		return len(row.Encrypted) > 0 &&
+			bytes.Equal(row.Encrypted, other.Encrypted) &&
+			sameStrings(row.RandomTags, other.RandomTags)
+	}
+	return bytes.Equal(row.decrypted, other.decrypted) &&
+		sameStrings(row.plainTags, other.plainTags)
+}
+
+func (row *Row) populated() bool {
+	return row.decrypted != nil && len(row.plainTags) > 0
+}
+
+// sameStrings reports whether a and b contain the same strings, in
+// any order, without reordering either
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	mine := append([]string{}, a...)
+	theirs := append([]string{}, b...)
+	sort.Strings(mine)
+	sort.Strings(theirs)
+
+	for i := range mine {
+		if mine[i] != theirs[i] {
+			return false
+		}
+	}
+	return true
+}
+
 // HasRandomTag answers the question, "does row have the random tag randtag?"
 func (row *Row) HasRandomTag(randtag string) bool {
 	return fun.SliceContains(row.RandomTags, randtag)
@@ -149,16 +328,185 @@ func (row *Row) Decrypt(key *[32]byte) error {
 		return cryptag.ErrNilKey
 	}
 
-	dec, err := cryptag.Decrypt(row.Encrypted, row.Nonce, key)
+	var dec []byte
+	var err error
+	if bytes.HasPrefix(row.Encrypted, sealedMagic) {
+		dec, err = cryptag.Open(row.Encrypted[len(sealedMagic):], key)
+	} else {
+		dec, err = cryptag.Decrypt(row.Encrypted, row.Nonce, key)
+	}
+	if err != nil {
+		return &DecryptError{What: "row", Err: err}
+	}
+
+	return row.setPlaintext(dec)
+}
+
+// sealedMagic starts row.Encrypted when it was encrypted with an
+// Encrypter other than secretbox (see cryptag.DefaultEncrypter), and
+// is followed by what cryptag.SealWith returned, whose version byte
+// says which Encrypter opens it.  Rows encrypted with secretbox keep
+// the original format -- just the ciphertext, its nonce in Nonce -- so
+// that older versions can still read them.
+var sealedMagic = []byte("\x00cryptag:sealed\x00")
+
+// EncryptPlaintext sets row.Encrypted to plain (see Plaintext)
+// encrypted with key by cryptag.DefaultEncrypter, and row.Nonce to a
+// fresh nonce, which only secretbox uses; other Encrypters store
+// their own in row.Encrypted.
+func (row *Row) EncryptPlaintext(plain []byte, key *[32]byte) error {
+	nonce, err := cryptag.RandomNonce()
+	if err != nil {
+		return err
+	}
+
+	enc := cryptag.DefaultEncrypter
+	if enc == nil || enc.Version() == (cryptag.SecretboxEncrypter{}).Version() {
+		encData, err := cryptag.Encrypt(plain, nonce, key)
+		if err != nil {
+			return err
+		}
+		row.Encrypted, row.Nonce = encData, nonce
+		return nil
+	}
+
+	sealed, err := cryptag.SealWith(enc, plain, key)
+	if err != nil {
+		return err
+	}
+	row.Encrypted = append(append([]byte{}, sealedMagic...), sealed...)
+	row.Nonce = nonce
+
+	return nil
+}
+
+// refsMagic starts the plaintext of Rows that reference other Rows,
+// and is followed by a JSON array of the references, a newline, then
+// the Row's data
+var refsMagic = []byte("\x00cryptag:refs\x00")
+
+// tagsMagic starts the plaintext of Rows whose data is bound to their
+// random tags, and is followed by the SHA-256 of those tags (sorted
+// and joined by "-"); see Plaintext
+var tagsMagic = []byte("\x00cryptag:tags\x00")
+
+// Plaintext returns what row.Encrypted is the encryption of: row's
+// decrypted data, preceded by its references, if it has any (see
+// SetReferences), all preceded by a digest of row.RandomTags, if set.
+//
+// Since the digest is encrypted along with the data, a Backend that
+// returns some other Row's ciphertext in place of row's is caught by
+// Decrypt.  Changing a Row's random tags therefore means re-encrypting
+// it.
+func (row *Row) Plaintext() ([]byte, error) {
+	body, err := row.plaintextBody()
+	if err != nil {
+		return nil, err
+	}
+	if len(row.RandomTags) == 0 {
+		return body, nil
+	}
+
+	digest := randomTagsDigest(row.RandomTags)
+
+	plain := make([]byte, 0, len(tagsMagic)+len(digest)+len(body))
+	plain = append(plain, tagsMagic...)
+	plain = append(plain, digest...)
+	plain = append(plain, body...)
+
+	return plain, nil
+}
+
+// plaintextBody returns row's decrypted data, preceded by its
+// references, if it has any.  Data that itself starts with refsMagic
+// or tagsMagic is framed with (empty) references all the same, so that
+// it isn't mistaken for framing when decrypted.
+func (row *Row) plaintextBody() ([]byte, error) {
+	if len(row.references) == 0 && !bytes.HasPrefix(row.decrypted, refsMagic) &&
+		!bytes.HasPrefix(row.decrypted, tagsMagic) {
+		return row.decrypted, nil
+	}
+
+	refs, err := json.Marshal(row.references)
 	if err != nil {
-		return fmt.Errorf("Error decrypting: %v", err)
+		return nil, err
 	}
 
-	row.decrypted = dec
+	plain := make([]byte, 0, len(refsMagic)+len(refs)+1+len(row.decrypted))
+	plain = append(plain, refsMagic...)
+	plain = append(plain, refs...)
+	plain = append(plain, '\n')
+	plain = append(plain, row.decrypted...)
+
+	return plain, nil
+}
+
+// randomTagsDigest returns the SHA-256 of randtags, sorted and joined
+// by "-"
+func randomTagsDigest(randtags []string) []byte {
+	sorted := append([]string{}, randtags...)
+	sort.Strings(sorted)
+
+	sum := sha256.Sum256([]byte(strings.Join(sorted, "-")))
+	return sum[:]
+}
+
+// setPlaintext sets row's decrypted data and references from plain
+// (see Plaintext), first checking that plain was bound to
+// row.RandomTags, if it was bound to any
+func (row *Row) setPlaintext(plain []byte) error {
+	if bytes.HasPrefix(plain, tagsMagic) {
+		rest := plain[len(tagsMagic):]
+		if len(rest) < sha256.Size {
+			return errors.New("Row's random tag digest is truncated")
+		}
+		if !hmac.Equal(rest[:sha256.Size], randomTagsDigest(row.RandomTags)) {
+			return ErrTagsMismatch
+		}
+		plain = rest[sha256.Size:]
+	} else if RequireBoundTags && len(plain) > 0 {
+		return ErrTagsNotBound
+	}
+
+	if !bytes.HasPrefix(plain, refsMagic) {
+		// Decrypting zero bytes yields nil
+		row.decrypted = emptyIfNil(plain)
+		return nil
+	}
+
+	rest := plain[len(refsMagic):]
+	end := bytes.IndexByte(rest, '\n')
+	if end == -1 {
+		return errors.New("Row references not terminated")
+	}
+
+	var refs []string
+	if err := json.Unmarshal(rest[:end], &refs); err != nil {
+		return fmt.Errorf("Error parsing row references: %v", err)
+	}
+
+	if len(refs) > 0 {
+		row.references = refs
+	}
+	row.decrypted = rest[end+1:]
 
 	return nil
 }
 
+// References returns the random tags of the id:... tags of the Rows
+// that row references.
+func (row *Row) References() []string {
+	return row.references
+}
+
+// SetReferences sets the Rows that row references, each identified by
+// the random tag of its id:... tag.  References are encrypted along
+// with row's data (see Plaintext), so only those who can decrypt row
+// can see them.
+func (row *Row) SetReferences(randtags []string) {
+	row.references = randtags
+}
+
 // SetPlainTags uses row.RandomTags and pairs to set row.plainTags
 func (row *Row) SetPlainTags(pairs TagPairs) error {
 	matches, err := pairs.WithAllRandomTags(row.RandomTags)
@@ -166,7 +514,7 @@ func (row *Row) SetPlainTags(pairs TagPairs) error {
 		return err
 	}
 
-	row.plainTags = matches.AllPlain()
+	row.plainTags = withoutDecoys(matches.AllPlain())
 
 	if Debug {
 		log.Printf("row.plainTags set to `%#v`\n", row.plainTags)
@@ -175,14 +523,75 @@ func (row *Row) SetPlainTags(pairs TagPairs) error {
 	return nil
 }
 
-// Populate sets row.decrypted based on row.Encrypted and
-// row.plainTags based on row.RandomTags, thereby populating row with
-// plaintext data.
+// setPlainTags is like SetPlainTags, but also skips row's decoy tags
+// that have no TagPair (see IsDecoyTag)
+func (row *Row) setPlainTags(key *[32]byte, pairs TagPairs) error {
+	matches, err := pairs.WithAllRandomTags(row.RandomTags)
+	if err == nil {
+		row.plainTags = withoutDecoys(matches.AllPlain())
+		return nil
+	}
+
+	known := make(map[string]bool, len(pairs))
+	for _, pair := range pairs {
+		known[pair.Random] = true
+	}
+
+	var real []string
+	for _, randtag := range row.RandomTags {
+		if known[randtag] || !IsDecoyTag(key, randtag) {
+			real = append(real, randtag)
+		}
+	}
+
+	matches, err = pairs.WithAllRandomTags(real)
+	if err != nil {
+		return err
+	}
+	row.plainTags = withoutDecoys(matches.AllPlain())
+
+	return nil
+}
+
+// withoutDecoys returns plaintags minus the plaintags of decoys'
+// TagPairs (see DecoyTagPrefix)
+func withoutDecoys(plaintags []string) []string {
+	real := plaintags[:0]
+	for _, plain := range plaintags {
+		if !IsDecoyPlainTag(plain) {
+			real = append(real, plain)
+		}
+	}
+	return real
+}
+
+// ReplacePlainTags replaces row.plainTags with plaintags (e.g., once
+// they have been normalized).  row.RandomTags is left untouched.
+func (row *Row) ReplacePlainTags(plaintags []string) {
+	row.plainTags = plaintags
+}
+
+// Populate sets row.decrypted based on row.Encrypted, row's summary
+// based on row.EncryptedSummary, and row.plainTags based on
+// row.RandomTags, thereby populating row with plaintext data.
+//
+// Rows sealed for recipients (see SealForRecipients) aren't encrypted
+// with key, so they must be opened with OpenAsRecipient first, after
+// which Populate leaves their data alone; otherwise ErrNoDataKey is
+// returned.
 func (row *Row) Populate(key *[32]byte, pairs TagPairs) error {
-	if err := row.Decrypt(key); err != nil {
-		return fmt.Errorf("Error decrypting row: %v", err)
+	if row.dataKey == nil {
+		if err := row.Decrypt(key); err != nil {
+			if _, serr := row.envelope(); serr == nil {
+				return ErrNoDataKey
+			}
+			return err
+		}
+	}
+	if err := row.DecryptSummary(key); err != nil {
+		return err
 	}
-	if err := row.SetPlainTags(pairs); err != nil {
+	if err := row.setPlainTags(key, pairs); err != nil {
 		return fmt.Errorf("Error setting row's plain tags: %v", err)
 	}
 	return nil
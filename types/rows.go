@@ -6,7 +6,9 @@ package types
 import (
 	"fmt"
 	"log"
+	"runtime"
 	"sort"
+	"sync"
 )
 
 type Rows []*Row
@@ -40,17 +42,88 @@ func (rows Rows) WithAllRandomTags(random []string) Rows {
 	return matches
 }
 
+// Populate decrypts and sets the plaintags of each of rows (see
+// Row.Populate), spreading the work across up to PopulateWorkers
+// goroutines.  rows keeps its order.
+//
+// A Row that fails to populate doesn't stop the others from being
+// populated; if any fail, a *RowsError reporting each failure is
+// returned.
 func (rows Rows) Populate(key *[32]byte, pairs TagPairs) error {
-	// TODO: Benchmark whether parallelizing would increase
-	// performance
+	return rows.PopulateProgress(key, pairs, nil)
+}
+
+// PopulateProgress is like Populate, but reports each Row populated
+// (successfully or not) to progress, if it's non-nil.
+func (rows Rows) PopulateProgress(key *[32]byte, pairs TagPairs, progress ProgressFunc) error {
+	prog := NewProgress(progress, len(rows))
+
+	workers := PopulateWorkers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(rows) {
+		workers = len(rows)
+	}
+
+	errs := make([]error, len(rows))
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				errs[i] = rows[i].Populate(key, pairs)
+				prog.Add(1)
+			}
+		}()
+	}
+
 	for i := range rows {
-		if err := rows[i].Populate(key, pairs); err != nil {
-			return err
-		}
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	if rerr := NewRowsError(errs); rerr.failed > 0 {
+		return rerr
 	}
 	return nil
 }
 
+// NewRowsError returns a *RowsError reporting errs, where errs[i] is
+// the error from the ith Row, or nil if it succeeded.
+func NewRowsError(errs []error) *RowsError {
+	var failed int
+	for _, err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+	return &RowsError{Errs: errs, failed: failed}
+}
+
+// RowsError reports which Rows failed to populate.  Errs[i] is the
+// error from populating the ith Row, or nil if it succeeded.
+type RowsError struct {
+	Errs []error
+
+	failed int
+}
+
+func (e *RowsError) Error() string {
+	for i, err := range e.Errs {
+		if err != nil {
+			return fmt.Sprintf("%d of %d rows failed; row %d: %v", e.failed,
+				len(e.Errs), i, err)
+		}
+	}
+	return "No rows failed"
+}
+
 func (rows Rows) Sort(less func(r1, r2 *Row) bool) {
 	rs := rowSorter{rows, less}
 	sort.Sort(rs)
@@ -0,0 +1,323 @@
+// Steve Phillips / elimisteve
+// 2017.04.10
+
+package types
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/cryptag/cryptag"
+	"github.com/stretchr/testify/assert"
+)
+
+// encryptedRows returns n Rows, as fetched from a Backend, each
+// containing size bytes and tagged with the one TagPair returned
+func encryptedRows(tb testing.TB, key *[32]byte, n, size int) (Rows, TagPairs) {
+	nonce, _ := cryptag.RandomNonce()
+	enc, err := cryptag.Encrypt([]byte("all"), nonce, key)
+	if err != nil {
+		tb.Fatalf("Error encrypting plaintag: %v", err)
+	}
+	pair := &TagPair{PlainEncrypted: enc, Random: "allrandom", Nonce: nonce}
+	if err = pair.Decrypt(key); err != nil {
+		tb.Fatalf("Error decrypting plaintag: %v", err)
+	}
+
+	rows := make(Rows, n)
+	for i := range rows {
+		data := []byte(fmt.Sprintf("%06d", i))
+		data = append(data, bytes.Repeat([]byte{'x'}, size)...)
+
+		nonce, _ := cryptag.RandomNonce()
+		enc, err := cryptag.Encrypt(data, nonce, key)
+		if err != nil {
+			tb.Fatalf("Error encrypting row: %v", err)
+		}
+		rows[i] = &Row{Encrypted: enc, RandomTags: []string{pair.Random},
+			Nonce: nonce}
+	}
+
+	return rows, TagPairs{pair}
+}
+
+func TestRowsPopulateOrderAndErrors(t *testing.T) {
+	key, _ := cryptag.RandomKey()
+
+	rows, pairs := encryptedRows(t, key, 200, 16)
+
+	// Corrupt one row
+	const bad = 57
+	rows[bad].Encrypted[0] ^= 0xff
+
+	err := rows.Populate(key, pairs)
+	rowsErr, ok := err.(*RowsError)
+	if !ok {
+		t.Fatalf("Expected *RowsError, got %v", err)
+	}
+
+	for i, row := range rows {
+		if i == bad {
+			assert.NotNil(t, rowsErr.Errs[i])
+			assert.Nil(t, row.Decrypted())
+			continue
+		}
+		assert.Nil(t, rowsErr.Errs[i])
+		assert.Equal(t, fmt.Sprintf("%06d", i), string(row.Decrypted()[:6]))
+		assert.Equal(t, []string{"all"}, row.PlainTags())
+	}
+
+	// No rows, no problem
+	assert.Nil(t, Rows{}.Populate(key, pairs))
+}
+
+func BenchmarkRowsPopulate(b *testing.B) {
+	key, _ := cryptag.RandomKey()
+
+	for _, workers := range []int{1, 0} {
+		name := fmt.Sprintf("workers=%d", workers)
+		if workers == 0 {
+			name = "workers=GOMAXPROCS"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			orig := PopulateWorkers
+			PopulateWorkers = workers
+			defer func() { PopulateWorkers = orig }()
+
+			rows, pairs := encryptedRows(b, key, 500, 16*1024)
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				if err := rows.Populate(key, pairs); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestPopulateDecryptErrors(t *testing.T) {
+	key, _ := cryptag.RandomKey()
+	wrongKey, _ := cryptag.RandomKey()
+
+	rows, pairs := encryptedRows(t, key, 2, 10)
+
+	err := rows[0].Populate(wrongKey, pairs)
+	if _, ok := err.(*DecryptError); !ok {
+		t.Fatalf("Expected *DecryptError, got %T: %v", err, err)
+	}
+	assert.True(t, IsWrongKey(err))
+	assert.False(t, IsCorrupt(err))
+
+	rows[1].Encrypted = rows[1].Encrypted[:5]
+
+	err = rows[1].Populate(key, pairs)
+	assert.True(t, IsCorrupt(err))
+	assert.False(t, IsWrongKey(err))
+
+	// Every failure is a wrong key
+	rows, pairs = encryptedRows(t, key, 3, 10)
+	err = rows.Populate(wrongKey, pairs)
+	assert.True(t, IsWrongKey(err), "Error: %v", err)
+}
+
+func TestPopulateProgress(t *testing.T) {
+	origWorkers := PopulateWorkers
+	PopulateWorkers = 4
+	defer func() { PopulateWorkers = origWorkers }()
+
+	key, _ := cryptag.RandomKey()
+	rows, pairs := encryptedRows(t, key, 50, 10)
+
+	var dones []int
+	progress := func(done, total int) {
+		assert.Equal(t, 50, total)
+		dones = append(dones, done)
+	}
+
+	if err := rows.PopulateProgress(key, pairs, progress); err != nil {
+		t.Fatalf("Error from PopulateProgress: %v", err)
+	}
+
+	assert.Equal(t, 50, len(dones))
+	for i := range dones {
+		assert.Equal(t, i+1, dones[i], "done counts not increasing by 1")
+	}
+}
+
+func TestDecryptEmptyBody(t *testing.T) {
+	key, _ := cryptag.RandomKey()
+	nonce, _ := cryptag.RandomNonce()
+
+	enc, err := cryptag.Encrypt(nil, nonce, key)
+	if err != nil {
+		t.Fatalf("Error encrypting empty body: %v", err)
+	}
+
+	row := &Row{Encrypted: enc, Nonce: nonce}
+	if err = row.Decrypt(key); err != nil {
+		t.Fatalf("Error decrypting empty body: %v", err)
+	}
+	assert.Equal(t, []byte{}, row.Decrypted())
+
+	// Empty body with references
+	row, _ = NewRow(nil, []string{"marker"})
+	assert.Equal(t, []byte{}, row.Decrypted())
+	row.SetReferences([]string{"ref"})
+
+	plain, err := row.Plaintext()
+	if err != nil {
+		t.Fatalf("Error from Plaintext: %v", err)
+	}
+	enc, _ = cryptag.Encrypt(plain, nonce, key)
+
+	row = &Row{Encrypted: enc, Nonce: nonce}
+	if err = row.Decrypt(key); err != nil {
+		t.Fatalf("Error decrypting empty body with references: %v", err)
+	}
+	assert.Equal(t, []byte{}, row.Decrypted())
+	assert.Equal(t, []string{"ref"}, row.References())
+}
+
+func TestDecryptBodyStartingWithMagic(t *testing.T) {
+	key, _ := cryptag.RandomKey()
+	nonce, _ := cryptag.RandomNonce()
+
+	for _, data := range [][]byte{
+		append(append([]byte{}, refsMagic...), []byte("[\"x\"]\nrest")...),
+		append(append([]byte{}, tagsMagic...), []byte("not a digest")...),
+	} {
+		for _, randtags := range [][]string{nil, {"rand1"}} {
+			row, _ := NewRowSimple(data, nil)
+			row.RandomTags = randtags
+			plain, err := row.Plaintext()
+			if err != nil {
+				t.Fatalf("Error from Plaintext: %v", err)
+			}
+			enc, _ := cryptag.Encrypt(plain, nonce, key)
+
+			row = &Row{Encrypted: enc, Nonce: nonce, RandomTags: randtags}
+			if err = row.Decrypt(key); err != nil {
+				t.Fatalf("Error from Decrypt: %v", err)
+			}
+			assert.Equal(t, data, row.Decrypted())
+			assert.Nil(t, row.References())
+		}
+	}
+}
+
+func TestDecryptBoundTags(t *testing.T) {
+	key, _ := cryptag.RandomKey()
+	nonce, _ := cryptag.RandomNonce()
+
+	row, _ := NewRowSimple([]byte("data"), nil)
+	row.RandomTags = []string{"rand2", "rand1"}
+	plain, err := row.Plaintext()
+	if err != nil {
+		t.Fatalf("Error from Plaintext: %v", err)
+	}
+	enc, _ := cryptag.Encrypt(plain, nonce, key)
+
+	// Same tags, in any order
+	row = &Row{Encrypted: enc, Nonce: nonce, RandomTags: []string{"rand1", "rand2"}}
+	if err = row.Decrypt(key); err != nil {
+		t.Fatalf("Error from Decrypt: %v", err)
+	}
+	assert.Equal(t, "data", string(row.Decrypted()))
+
+	// Other tags
+	row = &Row{Encrypted: enc, Nonce: nonce, RandomTags: []string{"rand1"}}
+	assert.Equal(t, ErrTagsMismatch, row.Decrypt(key))
+
+	// Unbound (legacy) Rows are accepted unless RequireBoundTags is set
+	enc, _ = cryptag.Encrypt([]byte("legacy"), nonce, key)
+	row = &Row{Encrypted: enc, Nonce: nonce, RandomTags: []string{"rand1"}}
+	assert.Nil(t, row.Decrypt(key))
+
+	RequireBoundTags = true
+	defer func() { RequireBoundTags = false }()
+	assert.Equal(t, ErrTagsNotBound, row.Decrypt(key))
+}
+
+func TestRowEqual(t *testing.T) {
+	row := func(data string, plaintags ...string) *Row {
+		r, err := NewRowSimple([]byte(data), plaintags)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	r := row("data", "type:note", "id:1")
+
+	// Plaintag order, random tags, and nonces don't matter
+	same := row("data", "id:1", "type:note")
+	same.RandomTags = []string{"elsewhere"}
+	assert.True(t, r.Equal(same))
+	assert.True(t, same.Equal(r))
+
+	assert.False(t, r.Equal(row("other data", "type:note", "id:1")))
+	assert.False(t, r.Equal(row("data", "type:note", "id:2")))
+	assert.False(t, r.Equal(row("data", "type:note")))
+	assert.False(t, r.Equal(row("data", "type:note", "id:1", "extra")))
+	assert.False(t, r.Equal(nil))
+	assert.True(t, (*Row)(nil).Equal(nil))
+
+	// The plaintags passed in aren't reordered
+	tags := []string{"z", "a"}
+	row("data", tags...).Equal(row("data", "a", "z"))
+	assert.Equal(t, []string{"z", "a"}, tags)
+
+	// Unpopulated Rows are only Equal to the same stored Row
+	stored := &Row{Encrypted: []byte("ciphertext"), RandomTags: []string{"r1", "r2"}}
+	assert.False(t, stored.Equal(&Row{}))
+	assert.False(t, (&Row{}).Equal(r))
+	assert.False(t, stored.Equal(&Row{Encrypted: []byte("other"), RandomTags: []string{"r1", "r2"}}))
+	assert.True(t, stored.Equal(&Row{Encrypted: []byte("ciphertext"), RandomTags: []string{"r2", "r1"}}))
+}
+
+// altEncrypter is secretbox under another version, standing in for a
+// newer algorithm
+type altEncrypter struct {
+	cryptag.SecretboxEncrypter
+}
+
+func (altEncrypter) Version() byte { return 202 }
+
+func TestRowEncrypter(t *testing.T) {
+	if err := cryptag.RegisterEncrypter(altEncrypter{}); err != nil {
+		t.Fatalf("Error from RegisterEncrypter: %v", err)
+	}
+	key, _ := cryptag.RandomKey()
+
+	old, _ := NewRow([]byte("secretbox"), nil)
+	if err := old.EncryptPlaintext([]byte("secretbox"), key); err != nil {
+		t.Fatalf("Error from EncryptPlaintext: %v", err)
+	}
+	assert.False(t, bytes.HasPrefix(old.Encrypted, sealedMagic))
+
+	cryptag.DefaultEncrypter = altEncrypter{}
+	defer func() { cryptag.DefaultEncrypter = cryptag.SecretboxEncrypter{} }()
+
+	row, _ := NewRow([]byte("alt"), nil)
+	if err := row.EncryptPlaintext([]byte("alt"), key); err != nil {
+		t.Fatalf("Error from EncryptPlaintext: %v", err)
+	}
+	assert.True(t, bytes.HasPrefix(row.Encrypted, sealedMagic))
+	assert.Equal(t, byte(202), row.Encrypted[len(sealedMagic)])
+
+	// Each is decrypted with the Encrypter it was encrypted with
+	for data, r := range map[string]*Row{"secretbox": old, "alt": row} {
+		fetched := &Row{Encrypted: r.Encrypted, Nonce: r.Nonce}
+		if err := fetched.Decrypt(key); err != nil {
+			t.Fatalf("Error decrypting %s row: %v", data, err)
+		}
+		assert.Equal(t, data, string(fetched.Decrypted()))
+	}
+
+	wrong, _ := cryptag.RandomKey()
+	err := (&Row{Encrypted: row.Encrypted, Nonce: row.Nonce}).Decrypt(wrong)
+	assert.True(t, IsWrongKey(err))
+}
@@ -14,6 +14,17 @@ var (
 	ErrTagPairNotFound = errors.New("TagPair(s) not found")
 )
 
+// TagPair maps a human-readable plaintag to the RandomTag that rows
+// are actually tagged with (see Row).
+//
+// Plaintags are arbitrary strings; they are encrypted as raw bytes
+// and compared byte-for-byte, so colons, slashes, unicode, and even
+// NUL bytes round-trip and match exactly.  By convention, the first
+// colon separates a plaintag's key from its value (e.g.,
+// "filename:notes:2017.txt" has the key "filename" and the value
+// "notes:2017.txt"), so values may contain more colons and need no
+// escaping.  Unicode is not normalized, so "é" (U+00E9) and "é" ("e"
+// + U+0301) are different tags.
 type TagPair struct {
 	PlainEncrypted []byte    `json:"plain_encrypted"`
 	Random         string    `json:"random"`
@@ -35,12 +46,26 @@ func (pair *TagPair) Plain() string {
 	return pair.plain
 }
 
+// Equal answers the question, "do pair and other have the same
+// plaintag and random tag?"  How the plaintag is encrypted (nonce,
+// ciphertext) is ignored, so pair and other must be decrypted.
+func (pair *TagPair) Equal(other *TagPair) bool {
+	if pair == nil || other == nil {
+		return pair == other
+	}
+	return pair.plain == other.plain && pair.Random == other.Random
+}
+
 // Decrypt sets pair.plain based off of pair.PlainEncrypted
 func (pair *TagPair) Decrypt(key *[32]byte) error {
 	plain, err := cryptag.Decrypt(pair.PlainEncrypted, pair.Nonce, key)
 	if err != nil {
-		return fmt.Errorf("Error decrypting plain tag `%s` (%v): %v",
-			pair.PlainEncrypted, pair.PlainEncrypted, err)
+		// Don't dump PlainEncrypted, which can be arbitrarily large
+		return &DecryptError{
+			What: fmt.Sprintf("plain tag for random tag `%s` (%d bytes)",
+				pair.Random, len(pair.PlainEncrypted)),
+			Err: err,
+		}
 	}
 
 	pair.plain = string(plain)
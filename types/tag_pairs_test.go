@@ -0,0 +1,90 @@
+// Steve Phillips / elimisteve
+// 2017.04.07
+
+package types
+
+import (
+	"testing"
+
+	"github.com/cryptag/cryptag"
+	"github.com/stretchr/testify/assert"
+)
+
+// Plaintags containing delimiters, unicode, and non-UTF-8 bytes
+var oddPlainTags = []string{
+	"filename:notes:2017.txt",
+	"url:https://example.com/a/b?c=d#e",
+	"path:C:\\Users\\me",
+	"title:日本語のタイトル",
+	"emoji:🔒🔑",
+	"café",       // Precomposed é
+	"cafe\u0301", // e + combining acute accent
+	"nul:\x00byte",
+	"invalid-utf8:\xff\xfe",
+	"has,comma-and dash",
+	"multi\nline",
+}
+
+func TestTagPairOddPlainTags(t *testing.T) {
+	key, _ := cryptag.RandomKey()
+
+	var pairs TagPairs
+
+	for i, plain := range oddPlainTags {
+		nonce, _ := cryptag.RandomNonce()
+		enc, err := cryptag.Encrypt([]byte(plain), nonce, key)
+		if err != nil {
+			t.Fatalf("Error encrypting `%q`: %v", plain, err)
+		}
+
+		// Only what a Backend stores; plain must be recovered
+		pair := &TagPair{PlainEncrypted: enc, Random: string('a' + rune(i)), Nonce: nonce}
+		if err = pair.Decrypt(key); err != nil {
+			t.Fatalf("Error decrypting `%q`: %v", plain, err)
+		}
+		assert.Equal(t, plain, pair.Plain())
+
+		pairs = append(pairs, pair)
+	}
+
+	for i, plain := range oddPlainTags {
+		matches, err := pairs.WithAllPlainTags([]string{plain})
+		if err != nil {
+			t.Fatalf("Error finding plaintag `%q`: %v", plain, err)
+		}
+		assert.Equal(t, 1, len(matches))
+		assert.Equal(t, string('a'+rune(i)), matches[0].Random)
+	}
+
+	// Differently-normalized unicode is _not_ treated as equal
+	matches, _ := pairs.WithAllPlainTags([]string{"café"})
+	assert.Equal(t, "café", matches[0].Plain())
+	assert.NotEqual(t, "cafe\u0301", matches[0].Plain())
+
+	// A prefix of a plaintag isn't a match
+	_, err := pairs.WithAllPlainTags([]string{"filename:notes"})
+	assert.NotNil(t, err)
+}
+
+func TestTagPairEqual(t *testing.T) {
+	key, _ := cryptag.RandomKey()
+
+	pair := func(plain, random string) *TagPair {
+		nonce, _ := cryptag.RandomNonce()
+		enc, err := cryptag.Encrypt([]byte(plain), nonce, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return NewTagPair(enc, random, nonce, plain)
+	}
+
+	p := pair("type:note", "abc")
+
+	// Encrypted differently, but the same
+	assert.True(t, p.Equal(pair("type:note", "abc")))
+
+	assert.False(t, p.Equal(pair("type:note", "xyz")))
+	assert.False(t, p.Equal(pair("type:todo", "abc")))
+	assert.False(t, p.Equal(nil))
+	assert.True(t, (*TagPair)(nil).Equal(nil))
+}